@@ -16,12 +16,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/OutOfStack/db/internal/network"
 	"github.com/OutOfStack/db/internal/pool"
 	"github.com/OutOfStack/db/internal/protocol"
+	"github.com/OutOfStack/db/internal/shard"
 )
 
 const (
@@ -31,7 +34,8 @@ const (
 	maxTableNameLen = 128
 )
 
-// transport is the minimal connection interface the client needs. Satisfied by *network.TCPClient and *pool.Client
+// transport is the minimal connection interface the client needs. Satisfied by *network.TCPClient, *pool.Client and
+// *shard.Client
 type transport interface {
 	Send(ctx context.Context, cmd string, args []string) (protocol.Reply, error)
 	Close() error
@@ -49,9 +53,9 @@ type Client struct {
 	transport transport
 }
 
-// New creates a new Client configured by the given options. With WithServers, connections are pooled across the given
-// servers, with reads retried on another server on failure; otherwise commands go to the address set by WithAddress
-// (default 127.0.0.1:3223).
+// New creates a new Client configured by the given options. With WithShards, commands are spread over shard groups, each
+// pooled like WithServers; with WithServers, connections are pooled across the given servers, with reads retried on
+// another server on failure; otherwise commands go to the address set by WithAddress (default 127.0.0.1:3223).
 //
 // No connection is made here — the first command connects, under its own context — so New reports configuration errors
 // only, never an unreachable server.
@@ -64,18 +68,25 @@ func New(opts ...Option) (*Client, error) {
 	netOpts := []network.TCPClientOption{
 		network.WithClientIdleTimeout(o.idleTimeout),
 		network.WithClientMaxMessageSize(o.maxMessageSizeKB * 1024),
+		network.WithClientName(o.name),
 	}
 
-	if len(o.servers) > 0 {
-		poolCfg := &pool.PoolConfig{
-			Enabled:           true,
-			Servers:           toPoolServers(o.servers),
-			SelectionStrategy: pool.SelectionStrategy(o.strategy),
-			MaxRetries:        o.maxRetries,
-			RetryDelay:        o.retryDelay,
-			FailureTimeout:    o.failureTimeout,
+	if len(o.shards) > 0 {
+		shardCfg := &shard.Config{
+			Enabled:      true,
+			By:           shard.Key(o.shardBy),
+			VirtualNodes: o.virtualNodes,
+			Groups:       toShardGroups(o.shards),
+		}
+		shardClient, err := shard.NewClient(shardCfg, o.poolConfig(nil), netOpts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create sharded client: %w", err)
 		}
-		poolClient, err := pool.NewClient(poolCfg, netOpts...)
+		return &Client{transport: shardClient}, nil
+	}
+
+	if len(o.servers) > 0 {
+		poolClient, err := pool.NewClient(o.poolConfig(toPoolServers(o.servers)), netOpts...)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create pool client: %w", err)
 		}
@@ -232,6 +243,18 @@ func errReply(resp protocol.Reply) error {
 	return &ServerError{Msg: replyText(resp)}
 }
 
+// Ping checks that the server is reachable and serving commands.
+func (c *Client) Ping(ctx context.Context) error {
+	resp, err := c.send(ctx, "PING", nil)
+	if err != nil {
+		return err
+	}
+	if resp.Kind == protocol.ReplySimpleString && resp.Value == "PONG" {
+		return nil
+	}
+	return errReply(resp)
+}
+
 // Tables returns all table names in sorted order.
 func (c *Client) Tables(ctx context.Context) ([]string, error) {
 	resp, err := c.send(ctx, "TABLES", nil)
@@ -278,6 +301,69 @@ func (c *Client) Keys(ctx context.Context, table string) ([]string, error) {
 	return stringArray(resp)
 }
 
+// Entry is one key of a table and its value, as Dump returns it and Restore takes it. Value is a literal that reads back
+// as the same value, so a string is quoted ("42" stays a string); Set takes the same form.
+type Entry struct {
+	Key   string
+	Value string
+}
+
+// Dump returns up to count keys of table with their values, in key order, starting after the key after (from the first
+// key when it is empty). A page shorter than count is the end of the table. Each page reads the table as it stands, so
+// paging through one that is being written does not copy it as of a single moment. count is capped by the server at
+// 10000; a page is also subject to the configured message-size limit.
+func (c *Client) Dump(ctx context.Context, table, after string, count int) ([]Entry, error) {
+	if err := validateArgs(table); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(ctx, "DUMP", []string{table, "AFTER", after, "COUNT", strconv.Itoa(count)})
+	if err != nil {
+		return nil, err
+	}
+	values, err := stringArray(resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, &ServerError{Msg: "invalid DUMP response"}
+	}
+	entries := make([]Entry, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		entries = append(entries, Entry{Key: values[i], Value: values[i+1]})
+	}
+	return entries, nil
+}
+
+// Restore stores entries in table, like a Set of each, and returns how many were stored. A malformed value fails the
+// whole batch before any of it is stored; a failure after that leaves the entries before it stored, and repeating the
+// Restore stores the same values again.
+func (c *Client) Restore(ctx context.Context, table string, entries []Entry) (int64, error) {
+	if err := validateArgs(table); err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+
+	args := make([]string, 0, 1+2*len(entries))
+	args = append(args, table)
+	for _, entry := range entries {
+		if err := validateArgs(table, entry.Key); err != nil {
+			return 0, err
+		}
+		args = append(args, entry.Key, entry.Value)
+	}
+	resp, err := c.send(ctx, "RESTORE", args)
+	if err != nil {
+		return 0, err
+	}
+	if resp.Kind != protocol.ReplyInteger {
+		return 0, errReply(resp)
+	}
+	return resp.Integer, nil
+}
+
 func stringArray(resp protocol.Reply) ([]string, error) {
 	if resp.Kind != protocol.ReplyArray {
 		return nil, errReply(resp)
@@ -302,6 +388,10 @@ func (c *Client) Raw(ctx context.Context, command string) (string, error) {
 	if len(parts) == 0 {
 		return "", errors.New("empty command")
 	}
+	// the replies MONITOR streams would be read as the replies to the commands sent after it
+	if strings.EqualFold(parts[0], "MONITOR") {
+		return "", errors.New("MONITOR streams on a connection of its own; use Monitor")
+	}
 	resp, err := c.send(ctx, parts[0], parts[1:])
 	if err != nil {
 		return "", err
@@ -309,6 +399,46 @@ func (c *Client) Raw(ctx context.Context, command string) (string, error) {
 	return replyText(resp), nil
 }
 
+// PoolStats is a snapshot of a pooled client's counters
+type PoolStats struct {
+	Reads     uint64 // read-only commands sent
+	Hedged    uint64 // reads that were also sent to a second server (see WithHedging)
+	HedgeWins uint64 // hedged reads answered by the second server first
+}
+
+// PoolStats returns the pool counters, summed over every shard group in sharded mode, or zero values when the client
+// talks to a single server
+func (c *Client) PoolStats() PoolStats {
+	var pools []*pool.Client
+	switch t := c.transport.(type) {
+	case *pool.Client:
+		pools = []*pool.Client{t}
+	case *shard.Client:
+		pools = slices.Collect(maps.Values(t.Groups()))
+	}
+
+	var stats PoolStats
+	for _, p := range pools {
+		s := p.Stats()
+		stats.Reads += s.Reads
+		stats.Hedged += s.Hedged
+		stats.HedgeWins += s.HedgeWins
+	}
+	return stats
+}
+
+// Rebalance moves keys to the shard group that owns them, after a group has been added to a sharded client, and
+// returns how many moved. Each key is copied before it is deleted, so an interrupted run loses nothing and can simply be
+// repeated; writes should be paused meanwhile, since a key written while it moves can lose that write.
+func (c *Client) Rebalance(ctx context.Context) (int, error) {
+	sharded, ok := c.transport.(*shard.Client)
+	if !ok {
+		return 0, errors.New("rebalance requires a sharded client (WithShards)")
+	}
+	result, err := sharded.Rebalance(ctx)
+	return result.Moved, err
+}
+
 // Close closes the client's connections and retires it: later calls fail rather than reconnecting. It is safe to call
 // more than once, and safe to call while other goroutines have commands in flight, which it interrupts.
 func (c *Client) Close() error {
@@ -447,6 +577,33 @@ func unescape(r rune) rune {
 	}
 }
 
+// poolConfig builds the pool configuration of the given servers from the pool options
+func (o *options) poolConfig(servers []pool.ServerConfig) *pool.PoolConfig {
+	return &pool.PoolConfig{
+		Enabled:             true,
+		Servers:             servers,
+		SelectionStrategy:   pool.SelectionStrategy(o.strategy),
+		Zone:                o.zone,
+		MaxRetries:          o.maxRetries,
+		RetryDelay:          o.retryDelay,
+		FailureTimeout:      o.failureTimeout,
+		FailureThreshold:    o.failureThreshold,
+		HealthCheckInterval: o.healthInterval,
+		HealthCheckTimeout:  o.healthTimeout,
+		HedgeDelay:          o.hedgeDelay,
+		HedgePercentile:     o.hedgePercentile,
+	}
+}
+
+// toShardGroups converts public ShardGroup values to shard config entries
+func toShardGroups(groups []ShardGroup) []shard.GroupConfig {
+	out := make([]shard.GroupConfig, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, shard.GroupConfig{Name: g.Name, Servers: toPoolServers(g.Servers)})
+	}
+	return out
+}
+
 // toPoolServers converts public Server values to pool config entries
 func toPoolServers(servers []Server) []pool.ServerConfig {
 	out := make([]pool.ServerConfig, 0, len(servers))
@@ -454,6 +611,8 @@ func toPoolServers(servers []Server) []pool.ServerConfig {
 		out = append(out, pool.ServerConfig{
 			Address: s.Address,
 			Role:    pool.ServerRole(s.Role),
+			Weight:  s.Weight,
+			Zone:    s.Zone,
 		})
 	}
 	return out
@@ -196,6 +196,23 @@ func TestClient_Introspection(t *testing.T) {
 			t.Fatalf("TableExists() error = %v, want ServerError", err)
 		}
 	})
+	t.Run("ping", func(t *testing.T) {
+		t.Parallel()
+		ft := &fakeTransport{resp: protocol.SimpleString("PONG")}
+		if err := client.NewWithTransport(ft).Ping(t.Context()); err != nil {
+			t.Fatalf("Ping() error = %v", err)
+		}
+		if len(ft.sent) != 1 || ft.sent[0].cmd != "PING" {
+			t.Fatalf("sent %v, want one PING", ft.sent)
+		}
+	})
+	t.Run("ping error", func(t *testing.T) {
+		t.Parallel()
+		err := client.NewWithTransport(&fakeTransport{resp: protocol.Error("boom")}).Ping(t.Context())
+		if _, ok := errors.AsType[*client.ServerError](err); !ok {
+			t.Fatalf("Ping() error = %v, want ServerError", err)
+		}
+	})
 }
 
 func TestClient_Raw(t *testing.T) {
@@ -235,6 +252,9 @@ func TestClient_Raw(t *testing.T) {
 	if _, err = c.Raw(t.Context(), `SET t k trailing\`); err == nil {
 		t.Error("Raw() with unfinished escape should fail")
 	}
+	if _, err = c.Raw(t.Context(), "monitor"); err == nil {
+		t.Error("Raw() with MONITOR should fail")
+	}
 	if len(ft.sent) != 2 {
 		t.Errorf("rejected commands must not reach the transport, sent: %#v", ft.sent)
 	}
@@ -387,6 +407,20 @@ func TestNew_Validation(t *testing.T) {
 			client.WithServers(client.Server{Address: "a:1", Role: client.RoleMaster}),
 			client.WithRetries(-1, 0),
 		}},
+		{"duplicate shard group names", []client.Option{
+			client.WithShards(
+				client.ShardGroup{Name: "a", Servers: []client.Server{{Address: "a:1", Role: client.RoleMaster}}},
+				client.ShardGroup{Name: "a", Servers: []client.Server{{Address: "a:2", Role: client.RoleMaster}}},
+			),
+		}},
+		{"invalid shard key", []client.Option{
+			client.WithShards(client.ShardGroup{Name: "a", Servers: []client.Server{{Address: "a:1", Role: client.RoleMaster}}}),
+			client.WithShardBy("column"),
+		}},
+		{"hedge percentile out of range", []client.Option{
+			client.WithServers(client.Server{Address: "a:1", Role: client.RoleMaster}),
+			client.WithHedging(0, 100),
+		}},
 	}
 
 	for _, tt := range tests {
@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"net"
 	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -15,6 +16,7 @@ import (
 	"github.com/OutOfStack/db/client"
 	"github.com/OutOfStack/db/internal/compute"
 	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/migration"
 	"github.com/OutOfStack/db/internal/network"
 	"github.com/OutOfStack/db/internal/parser"
 	"github.com/OutOfStack/db/internal/protocol"
@@ -41,7 +43,9 @@ func startStoppableServer(t *testing.T, opts ...network.TCPServerOption) (addr s
 		t.Fatalf("failed to start server: %v", err)
 	}
 
-	comp := compute.New(parser.New(), storage.New(engine.New()), logger)
+	store := storage.New(engine.New())
+	migrator := migration.New(store, logger, migration.WithLocalAddress(srv.Addr().String()))
+	comp := compute.New(parser.New(), store, logger, compute.WithClients(srv), compute.WithMigrator(migrator))
 
 	done := make(chan error, 1)
 	go func() {
@@ -70,6 +74,7 @@ func startStoppableServer(t *testing.T, opts ...network.TCPServerOption) (addr s
 			if sErr := <-done; sErr != nil {
 				t.Errorf("Serve: %v", sErr)
 			}
+			_ = migrator.Close()
 		})
 	}
 	t.Cleanup(stop)
@@ -221,6 +226,75 @@ func TestClient_Raw_RoundTrip(t *testing.T) {
 	}
 }
 
+// TestClient_WithName_RoundTrip verifies the name set with WithName is what CLIENT LIST shows for the connection.
+func TestClient_WithName_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	addr := startServer(t)
+
+	c, err := client.New(client.WithAddress(addr), client.WithName("loader"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+
+	list, err := c.Raw(t.Context(), "CLIENT LIST")
+	if err != nil {
+		t.Fatalf("Raw(CLIENT LIST) error = %v", err)
+	}
+	if !strings.Contains(list, " name=loader ") || !strings.Contains(list, " cmd=client ") {
+		t.Errorf("CLIENT LIST = %q, want this connection named loader", list)
+	}
+}
+
+// TestMonitor_RoundTrip verifies Monitor sees the commands other clients send and returns once its context is done.
+func TestMonitor_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	addr := startServer(t)
+	c, err := client.New(client.WithAddress(addr))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	lines := make(chan string, 100)
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Monitor(ctx, addr, func(line string) error {
+			lines <- line
+			return nil
+		})
+	}()
+
+	// the monitor sees nothing sent before it started, so ping until it sees a command
+	for watching := false; !watching; {
+		if err = c.Ping(ctx); err != nil {
+			t.Fatalf("Ping() error = %v", err)
+		}
+		select {
+		case <-lines:
+			watching = true
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if err = c.Set(ctx, "users", "name", "vlad"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	for line := range lines {
+		if strings.HasSuffix(line, `"SET" "users" "name" "vlad"`) {
+			break
+		}
+	}
+
+	cancel()
+	if err = <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Monitor() error = %v, want context.Canceled", err)
+	}
+}
+
 func TestClient_PipelinedCommands(t *testing.T) {
 	t.Parallel()
 
@@ -423,6 +497,63 @@ func TestClient_Pool_Failover(t *testing.T) {
 	}
 }
 
+func TestClient_Sharded_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	group := func(name string) client.ShardGroup {
+		return client.ShardGroup{Name: name, Servers: []client.Server{{Address: startServer(t), Role: client.RoleMaster}}}
+	}
+	a, b := group("a"), group("b")
+	ctx := t.Context()
+
+	before, err := client.New(client.WithShards(a), client.WithShardBy(client.ShardByKey))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer before.Close()
+	for i := range 50 {
+		if err = before.Set(ctx, "users", strconv.Itoa(i), "v"+strconv.Itoa(i)); err != nil {
+			t.Fatalf("Set() error = %v", err)
+		}
+	}
+
+	after, err := client.New(client.WithShards(a, b), client.WithShardBy(client.ShardByKey))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer after.Close()
+
+	moved, err := after.Rebalance(ctx)
+	if err != nil || moved == 0 || moved == 50 {
+		t.Fatalf("Rebalance() = %d, %v; want some but not all of 50 keys moved", moved, err)
+	}
+	for i := range 50 {
+		got, gErr := after.Get(ctx, "users", strconv.Itoa(i))
+		if gErr != nil || got != "v"+strconv.Itoa(i) {
+			t.Fatalf("Get(%d) = %q, %v after rebalance", i, got, gErr)
+		}
+	}
+	keys, err := after.Keys(ctx, "users")
+	if err != nil || len(keys) != 50 {
+		t.Fatalf("Keys() = %d keys, %v; want 50 merged across groups", len(keys), err)
+	}
+	if stats := after.PoolStats(); stats.Reads == 0 {
+		t.Errorf("PoolStats() = %+v, want reads counted across groups", stats)
+	}
+
+	if _, err = before.Rebalance(ctx); err != nil {
+		t.Errorf("Rebalance() on a single group error = %v", err)
+	}
+	single, err := client.New(client.WithAddress(a.Servers[0].Address))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer single.Close()
+	if _, err = single.Rebalance(ctx); err == nil {
+		t.Error("Rebalance() without shards: want error")
+	}
+}
+
 // eventually retries cond for a short while, returning nil once it holds.
 func eventually(cond func() bool) error {
 	for range 50 {
@@ -506,3 +637,52 @@ func TestClient_TypedValuesRoundTrip(t *testing.T) {
 		t.Errorf("Incr() on an array = %q, want %q", srvErr.Msg, want)
 	}
 }
+
+func TestClient_DumpRestore(t *testing.T) {
+	t.Parallel()
+
+	addr := startServer(t)
+
+	c, err := client.New(client.WithAddress(addr))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer c.Close()
+
+	ctx := t.Context()
+
+	want := []client.Entry{{Key: "a", Value: `"42"`}, {Key: "b", Value: "42"}, {Key: "c", Value: `{"x":[1.5,true]}`}}
+	if n, rErr := c.Restore(ctx, "src", want); rErr != nil || n != 3 {
+		t.Fatalf("Restore() = %d, %v; want 3", n, rErr)
+	}
+
+	var got []client.Entry
+	after := ""
+	for {
+		page, dErr := c.Dump(ctx, "src", after, 2)
+		if dErr != nil {
+			t.Fatalf("Dump() error = %v", dErr)
+		}
+		got = append(got, page...)
+		if len(page) < 2 {
+			break
+		}
+		after = page[len(page)-1].Key
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Dump() = %v, want %v", got, want)
+	}
+
+	if kind, tErr := c.Type(ctx, "src", "a"); tErr != nil || kind != "string" {
+		t.Errorf("Type(a) = %q, %v; want string", kind, tErr)
+	}
+
+	_, err = c.Restore(ctx, "src", []client.Entry{{Key: "d", Value: "1"}, {Key: "e", Value: "[1,"}})
+	var srvErr *client.ServerError
+	if !errors.As(err, &srvErr) {
+		t.Fatalf("Restore() of a malformed value error = %v, want ServerError", err)
+	}
+	if _, gErr := c.Get(ctx, "src", "d"); !errors.Is(gErr, client.ErrNotFound) {
+		t.Errorf("Get(d) after a rejected Restore error = %v, want ErrNotFound", gErr)
+	}
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/OutOfStack/db/internal/protocol"
+)
+
+// monitorMaxLine bounds one MONITOR line. The server cuts arguments short, so lines stay far below it.
+const monitorMaxLine = 1 << 20
+
+// Monitor streams every command the server at address receives to fn, one line per command: the Unix time, the
+// sending client's address in brackets, then the command and its arguments quoted, with long arguments cut short.
+//
+// It runs on a connection of its own until ctx is done, fn returns an error, or the server closes the connection, and
+// returns ctx's error, fn's error, or io.EOF respectively. The server closes a monitor that falls too far behind rather
+// than slow its other clients down, so fn should return quickly.
+func Monitor(ctx context.Context, address string, fn func(line string) error) error {
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	if err = protocol.WriteCommand(conn, "MONITOR", nil); err != nil {
+		return errors.Join(ctx.Err(), err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := protocol.ReadReply(reader, monitorMaxLine)
+	if err != nil {
+		return errors.Join(ctx.Err(), err)
+	}
+	if err = okReply(resp); err != nil {
+		return err
+	}
+	for {
+		resp, err = protocol.ReadReply(reader, monitorMaxLine)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			return err
+		}
+		if resp.Kind == protocol.ReplyError {
+			return &ServerError{Msg: resp.Value}
+		}
+		if err = fn(resp.Value); err != nil {
+			return err
+		}
+	}
+}
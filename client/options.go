@@ -23,24 +23,60 @@ const (
 	RoundRobin Strategy = "round_robin"
 	// Random picks a random server for each read
 	Random Strategy = "random"
+	// LeastLatency reads from the server with the lowest average reply time
+	LeastLatency Strategy = "least_latency"
+	// LeastOutstanding reads from the server with the fewest commands in flight
+	LeastOutstanding Strategy = "least_outstanding"
+	// ZonePreference reads from servers in the client's zone (see WithZone), crossing zones only when none is available
+	ZonePreference Strategy = "zone_preference"
 )
 
 // Server describes a single server in the pool
 type Server struct {
 	Address string
 	Role    Role
+	// Weight scales the server's share of reads relative to the others; zero counts as 1
+	Weight int
+	// Zone is the availability zone the server runs in, used by ZonePreference
+	Zone string
+}
+
+// ShardKey selects what commands are sharded by in sharded mode
+type ShardKey string
+
+const (
+	// ShardByTable keeps every key of a table on one shard group
+	ShardByTable ShardKey = "table"
+	// ShardByKey places each table+key pair on its own, spreading large tables across shard groups
+	ShardByKey ShardKey = "key"
+)
+
+// ShardGroup describes one shard: a master/standby group with the same rules as WithServers
+type ShardGroup struct {
+	Name    string
+	Servers []Server
 }
 
 // options holds the client configuration built from Option funcs
 type options struct {
 	address          string
 	servers          []Server
+	shards           []ShardGroup
+	shardBy          ShardKey
+	virtualNodes     int
 	strategy         Strategy
+	zone             string
 	maxRetries       int
 	retryDelay       time.Duration
 	failureTimeout   time.Duration
+	failureThreshold int
+	healthInterval   time.Duration
+	healthTimeout    time.Duration
+	hedgeDelay       time.Duration
+	hedgePercentile  float64
 	idleTimeout      time.Duration
 	maxMessageSizeKB int
+	name             string
 }
 
 // defaultOptions returns options with sensible defaults
@@ -48,9 +84,11 @@ func defaultOptions() *options {
 	return &options{
 		address:          "127.0.0.1:3223",
 		strategy:         MasterFirst,
+		shardBy:          ShardByTable,
 		maxRetries:       3,
 		retryDelay:       time.Second,
 		failureTimeout:   30 * time.Second,
+		failureThreshold: 1,
 		idleTimeout:      time.Minute,
 		maxMessageSizeKB: 4,
 	}
@@ -73,6 +111,32 @@ func WithServers(servers ...Server) Option {
 	}
 }
 
+// WithShards enables sharded mode: tables (or table+key pairs, see WithShardBy) are spread over the given groups by
+// consistent hashing, each group served by a pool of its own. The pool options apply to every group. Group names decide
+// placement, so every client of a dataset must use the same names. Takes precedence over WithServers.
+func WithShards(groups ...ShardGroup) Option {
+	return func(o *options) {
+		o.shards = groups
+	}
+}
+
+// WithShardBy sets what commands are sharded by in sharded mode (default ShardByTable)
+func WithShardBy(key ShardKey) Option {
+	return func(o *options) {
+		o.shardBy = key
+	}
+}
+
+// WithVirtualNodes sets how many points each shard group gets on the hash ring in sharded mode (default 128). Every
+// client of a dataset must use the same value.
+func WithVirtualNodes(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.virtualNodes = n
+		}
+	}
+}
+
 // WithStrategy sets the server selection strategy for pool mode
 func WithStrategy(s Strategy) Option {
 	return func(o *options) {
@@ -80,6 +144,13 @@ func WithStrategy(s Strategy) Option {
 	}
 }
 
+// WithZone sets the availability zone the client runs in, for the ZonePreference strategy
+func WithZone(zone string) Option {
+	return func(o *options) {
+		o.zone = zone
+	}
+}
+
 // WithRetries sets the number of retries and the delay between them for pool mode
 func WithRetries(n int, delay time.Duration) Option {
 	return func(o *options) {
@@ -97,6 +168,39 @@ func WithFailureTimeout(d time.Duration) Option {
 	}
 }
 
+// WithFailureThreshold sets how many failures in a row take a server out of rotation in pool mode. The server then gets
+// a single trial request once the failure timeout has passed, and rejoins the pool when it succeeds.
+func WithFailureThreshold(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.failureThreshold = n
+		}
+	}
+}
+
+// WithHealthCheck enables background health checks in pool mode: every interval, each server is sent a PING that must
+// answer within timeout. A server that fails its checks is taken out of rotation before a request has to discover it,
+// and one that passes is readmitted without waiting out the failure timeout. A zero timeout means the interval.
+func WithHealthCheck(interval, timeout time.Duration) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.healthInterval = interval
+			o.healthTimeout = timeout
+		}
+	}
+}
+
+// WithHedging enables hedged reads in pool mode: a read that has not been answered within the hedge delay is also sent
+// to a second server, the first reply is used and the other request is cancelled. A non-zero percentile (e.g. 95) sets
+// the delay to that percentile of recently observed read latencies, with delay standing in until enough have been seen.
+// Commands that modify data are never hedged.
+func WithHedging(delay time.Duration, percentile float64) Option {
+	return func(o *options) {
+		o.hedgeDelay = delay
+		o.hedgePercentile = percentile
+	}
+}
+
 // WithIdleTimeout sets the connection idle timeout
 func WithIdleTimeout(d time.Duration) Option {
 	return func(o *options) {
@@ -106,6 +210,14 @@ func WithIdleTimeout(d time.Duration) Option {
 	}
 }
 
+// WithName names every connection the client opens, so the server's CLIENT LIST shows which program it belongs to. A
+// name is printable ASCII without spaces; the server refuses anything else, and the connection with it.
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
 // WithMaxMessageSize sets the maximum message size in kilobytes
 func WithMaxMessageSize(kb int) Option {
 	return func(o *options) {
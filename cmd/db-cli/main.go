@@ -3,23 +3,31 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/OutOfStack/db/client"
+	"github.com/OutOfStack/db/internal/clientopts"
 	"github.com/OutOfStack/db/internal/config"
 )
 
 func main() {
 	var configPath, address string
 	var timeout time.Duration
+	var rebalance, monitor bool
 	flag.StringVar(&configPath, "config", "", "Path to configuration file")
 	flag.StringVar(&address, "address", "", "Database server address (overrides config)")
 	flag.DurationVar(&timeout, "timeout", 0, "Connection idle timeout (overrides config)")
+	flag.BoolVar(&rebalance, "rebalance", false, "Move keys to the shard group that owns them, then exit (sharding only)")
+	flag.BoolVar(&monitor, "monitor", false, "Print every command the server at -address receives until interrupted")
 	flag.Parse()
 
 	cfg, err := config.LoadClientConfig(configPath)
@@ -34,22 +42,31 @@ func main() {
 	if timeout > 0 {
 		cfg.Network.IdleTimeout = timeout
 	}
+	if monitor {
+		os.Exit(runMonitor(cfg.Network.Address))
+	}
 
 	// the client connects on first use, so an unreachable server surfaces on the first command rather than here
-	dbClient, err := client.New(clientOptions(cfg)...)
+	dbClient, err := client.New(clientopts.FromConfig(cfg)...)
 	if err != nil {
 		fmt.Printf("Invalid client configuration: %v\n", err)
 		os.Exit(1)
 	}
+	if rebalance {
+		os.Exit(runRebalance(dbClient))
+	}
 	defer func() {
 		if err = dbClient.Close(); err != nil {
 			fmt.Printf("Failed to close connection: %v\n", err)
 		}
 	}()
 
-	if cfg.Pool.Enabled {
+	switch {
+	case cfg.Sharding.Enabled:
+		fmt.Printf("Using sharded database (%d groups)\n", len(cfg.Sharding.Groups))
+	case cfg.Pool.Enabled:
 		fmt.Printf("Using database pool (%d servers)\n", len(cfg.Pool.Servers))
-	} else {
+	default:
 		fmt.Printf("Using database server at %s\n", cfg.Network.Address)
 	}
 	fmt.Println("Available commands:")
@@ -58,6 +75,7 @@ func main() {
 	fmt.Println("  GET table key")
 	fmt.Println("  DEL table key")
 	fmt.Println("  TABLES")
+	fmt.Println("  PING [message]")
 	fmt.Println("  EXISTS table")
 	fmt.Println("  KEYS table")
 	fmt.Println("  TYPE table key")
@@ -65,6 +83,17 @@ func main() {
 	fmt.Println("  APPEND table key value")
 	fmt.Println("  HSET table key field value")
 	fmt.Println("  HGET table key field")
+	fmt.Println("  MIGRATE host:port table [key]")
+	fmt.Println("  MIGRATION STATUS")
+	fmt.Println("  DUMP table [AFTER key] [COUNT n]")
+	fmt.Println("  RESTORE table key value [key value ...]")
+	fmt.Println("  VERIFY [tiered|wal|snapshot] [QUARANTINE]")
+	fmt.Println("  COMPACT [FORCE]")
+	fmt.Println("  CHECKPOINT dir")
+	fmt.Println("  INFO [section]")
+	fmt.Println("  SLOWLOG GET [count] | LEN | RESET")
+	fmt.Println("  CLIENT LIST | SETNAME name | KILL id|addr | PAUSE ms [WRITE|ALL] | UNPAUSE")
+	fmt.Println("  CONFIG GET pattern | SET param value | REWRITE")
 	fmt.Println("Values are typed: 42 int, 42.5 float, true bool, [1,2] array, {\"a\":1} map, anything else string")
 	fmt.Println("Wrap a literal in single quotes when it contains quotes, spaces or backslashes: SET t conf '{\"a\":1}'")
 	fmt.Println("Type 'exit' to quit")
@@ -86,6 +115,10 @@ func main() {
 		if input == "" || strings.HasPrefix(input, "#") {
 			continue
 		}
+		if strings.EqualFold(input, "MONITOR") {
+			fmt.Println("Run db-cli --monitor to watch the commands a server receives")
+			continue
+		}
 
 		response, sErr := dbClient.Raw(ctx, input)
 		if sErr != nil {
@@ -100,28 +133,38 @@ func main() {
 	}
 }
 
-// clientOptions maps the loaded CLI configuration to client options
-func clientOptions(cfg *config.ClientConfig) []client.Option {
-	opts := []client.Option{
-		client.WithIdleTimeout(cfg.Network.IdleTimeout),
-		client.WithMaxMessageSize(cfg.Network.MaxMessageSizeKB),
-	}
+// runRebalance moves keys to the shard group that owns them and closes the client, returning the exit code
+func runRebalance(dbClient *client.Client) int {
+	defer func() { _ = dbClient.Close() }()
 
-	if !cfg.Pool.Enabled {
-		return append(opts, client.WithAddress(cfg.Network.Address))
+	moved, err := dbClient.Rebalance(context.Background())
+	if err != nil {
+		fmt.Printf("Rebalance failed after moving %d keys: %v\n", moved, err)
+		return 1
 	}
+	fmt.Printf("Rebalance moved %d keys\n", moved)
+	return 0
+}
+
+// runMonitor prints the commands the server at address receives until interrupted, returning the exit code. It always
+// watches a single server: a pool or shard group has several, each seeing only its share of the commands.
+func runMonitor(address string) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	servers := make([]client.Server, 0, len(cfg.Pool.Servers))
-	for _, s := range cfg.Pool.Servers {
-		servers = append(servers, client.Server{
-			Address: s.Address,
-			Role:    client.Role(s.Role),
-		})
+	fmt.Printf("Monitoring %s, press Ctrl-C to stop\n", address)
+	err := client.Monitor(ctx, address, func(line string) error {
+		fmt.Println(line)
+		return nil
+	})
+	switch {
+	case errors.Is(err, context.Canceled):
+		return 0
+	case errors.Is(err, io.EOF):
+		fmt.Println("The server closed the connection")
+		return 1
+	default:
+		fmt.Printf("Monitor failed: %v\n", err)
+		return 1
 	}
-	return append(opts,
-		client.WithServers(servers...),
-		client.WithStrategy(client.Strategy(cfg.Pool.SelectionStrategy)),
-		client.WithRetries(cfg.Pool.MaxRetries, cfg.Pool.RetryDelay),
-		client.WithFailureTimeout(cfg.Pool.FailureTimeout),
-	)
 }
@@ -0,0 +1,80 @@
+// Command db-import reads a file of JSON lines written by db-export and stores every key in it with RESTORE, batching
+// consecutive keys of a table. Storing a key overwrites it, so an import run twice leaves the same data.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/OutOfStack/db/client"
+	"github.com/OutOfStack/db/internal/clientopts"
+	"github.com/OutOfStack/db/internal/config"
+	"github.com/OutOfStack/db/internal/transfer"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	var configPath, address, in, tables string
+	var batch, skip int
+	var rate int64
+	flag.StringVar(&configPath, "config", "", "Path to client configuration file")
+	flag.StringVar(&address, "address", "", "Database server address (overrides config)")
+	flag.StringVar(&in, "in", "", "File to read (default standard input)")
+	flag.StringVar(&tables, "tables", "", "Comma-separated table patterns to import, such as users,log_* (default all)")
+	flag.IntVar(&batch, "batch", transfer.DefaultBatch, "Keys per RESTORE request")
+	flag.Int64Var(&rate, "rate", 0, "Maximum MiB read per second (0 is unlimited)")
+	flag.IntVar(&skip, "skip", 0, "Lines to skip, to continue an import that stopped")
+	flag.Parse()
+
+	cfg, err := config.LoadClientConfig(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		return 1
+	}
+	if address != "" {
+		cfg.Network.Address = address
+	}
+	patterns, err := transfer.ParsePatterns(tables)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	transferCfg := transfer.Config{Tables: patterns, Batch: batch, Rate: rate << 20}
+
+	var r io.Reader = os.Stdin
+	if in != "" {
+		file, oErr := os.Open(in) // #nosec G304 -- the operator names the file to import
+		if oErr != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open %s: %v\n", in, oErr)
+			return 1
+		}
+		defer func() { _ = file.Close() }()
+		r = file
+	}
+
+	dbClient, err := client.New(clientopts.FromConfig(cfg)...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid client configuration: %v\n", err)
+		return 1
+	}
+	defer func() { _ = dbClient.Close() }()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	restored, done, err := transfer.Import(ctx, dbClient, r, transferCfg, skip)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed after %d keys: %v\n", restored, err)
+		fmt.Fprintf(os.Stderr, "Run it again with -skip %d to continue\n", done)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Imported %d keys\n", restored)
+	return 0
+}
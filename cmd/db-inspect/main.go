@@ -0,0 +1,446 @@
+// Command db-inspect looks inside a data directory offline: it lists WAL segments, snapshots and tiered segments with
+// the LSNs they cover, dumps their records, and checks them for damage. It only ever reads, and takes no lock, so run it
+// against a copy of the directory rather than one a server has open.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/OutOfStack/db/internal/engine/tiered"
+	"github.com/OutOfStack/db/internal/protocol"
+	"github.com/OutOfStack/db/internal/wal"
+)
+
+const usage = `Usage: db-inspect <command> [flags]
+
+Commands:
+  list -dir DIR                             list WAL segments, snapshots and tiered segments with their LSN ranges
+  verify -dir DIR                           check every file for damage and torn tails; exits 1 on damage
+  dump -dir DIR [-from N] [-to M] [-json]   print the WAL records from LSN N to M
+  snapshot [-json] [-table T] FILE          print the entries of a snapshot, or of one table
+  segment [-json] FILE                      print the records of a tiered segment
+
+Archived WAL segments and snapshots, gzipped or not, are read as well.
+`
+
+// exit codes: 1 for damage or a failure, 2 for a usage error
+const (
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		_, _ = fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	flags := flag.NewFlagSet("db-inspect "+args[0], flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dir := flags.String("dir", "", "Data directory (wal.data_dir, wal.archive_dir or engine.data_dir)")
+	from := flags.Uint64("from", 0, "First LSN to dump")
+	to := flags.Uint64("to", 0, "Last LSN to dump (0 for the end of the log)")
+	asJSON := flags.Bool("json", false, "Print one JSON object per line")
+	tableName := flags.String("table", "", "Table of the snapshot to print")
+	if err := flags.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+
+	var err error
+	switch command := args[0]; {
+	case command == "list" && *dir != "":
+		err = list(stdout, *dir)
+	case command == "verify" && *dir != "":
+		var damaged bool
+		if damaged, err = verify(stdout, *dir); err == nil && damaged {
+			return exitFailure
+		}
+	case command == "dump" && *dir != "":
+		err = dump(stdout, *dir, *from, *to, *asJSON)
+	case command == "snapshot" && flags.NArg() == 1:
+		err = dumpSnapshot(stdout, flags.Arg(0), *tableName, *asJSON)
+	case command == "segment" && flags.NArg() == 1:
+		err = dumpSegment(stdout, flags.Arg(0), *asJSON)
+	default:
+		_, _ = fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "db-inspect: %v\n", err)
+		return exitFailure
+	}
+	return 0
+}
+
+// dataFiles are the files of a data directory db-inspect reads, each kind in order.
+type dataFiles struct {
+	walSegments []string
+	snapshots   []string
+	segments    []string
+}
+
+func findFiles(dir string) (dataFiles, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return dataFiles{}, err
+	}
+	var files dataFiles
+	var err error
+	if files.walSegments, err = glob(dir, wal.WALPrefix, wal.WALSuffix); err != nil {
+		return files, err
+	}
+	if files.snapshots, err = glob(dir, wal.SnapshotPrefix, wal.SnapshotSuffix); err != nil {
+		return files, err
+	}
+	files.segments, err = glob(dir, tiered.SegPrefix, tiered.SegSuffix)
+	return files, err
+}
+
+// glob lists the files of one kind, archived copies included. Their numbers are zero-padded to a fixed width, so the
+// names sort in number order; an archive holds a plain or a gzipped copy of a file, never both in use.
+func glob(dir, prefix, suffix string) ([]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, prefix+"*"+suffix))
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := filepath.Glob(filepath.Join(dir, prefix+"*"+suffix+".gz"))
+	if err != nil {
+		return nil, err
+	}
+	paths = append(paths, compressed...)
+	slices.SortFunc(paths, func(a, b string) int {
+		return strings.Compare(strings.TrimSuffix(a, ".gz"), strings.TrimSuffix(b, ".gz"))
+	})
+	return paths, nil
+}
+
+func list(out io.Writer, dir string) error {
+	files, err := findFiles(dir)
+	if err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(table, "WAL segments: %d\n", len(files.walSegments))
+	for index, path := range files.walSegments {
+		report, inspectErr := wal.InspectSegment(path, nil)
+		if inspectErr != nil {
+			return inspectErr
+		}
+		_, _ = fmt.Fprintf(table, "  %s\tv%d\t%s\t%d records\t%s\t%s\n", filepath.Base(path), report.Format,
+			lsnRange(report.FirstLSN, report.LastLSN), report.Records, timeRange(report.FirstTime, report.LastTime),
+			walStatus(report, index == len(files.walSegments)-1))
+	}
+	_, _ = fmt.Fprintf(table, "Snapshots: %d\n", len(files.snapshots))
+	for _, path := range files.snapshots {
+		report, inspectErr := wal.InspectSnapshot(path, nil)
+		if inspectErr != nil {
+			return inspectErr
+		}
+		_, _ = fmt.Fprintf(table, "  %s\tv%d\tLSN %d\t%d entries, %d tables%s\t%s\n", filepath.Base(path),
+			report.Format, report.LSN, report.Entries, report.Tables, compressedStatus(report.Compressed),
+			damageStatus(report.Damage, report.DamageOffset))
+	}
+	_, _ = fmt.Fprintf(table, "Tiered segments: %d\n", len(files.segments))
+	for index, path := range files.segments {
+		report, inspectErr := tiered.InspectSegment(path, nil)
+		if inspectErr != nil {
+			return inspectErr
+		}
+		_, _ = fmt.Fprintf(table, "  %s\tv%d\t%s\t%d records, %d tombstones\t%s\n", filepath.Base(path), report.Format,
+			lsnRange(report.MinLSN, report.MaxLSN), report.Records, report.Tombstones,
+			segmentStatus(report, index == len(files.segments)-1))
+	}
+	return table.Flush()
+}
+
+// verify checks every file in dir and prints what is wrong with each, returning whether anything is damaged. A torn
+// tail at the end of the newest WAL segment or tiered segment is reported but not counted: the server truncates it on
+// its next start.
+func verify(out io.Writer, dir string) (bool, error) {
+	files, err := findFiles(dir)
+	if err != nil {
+		return false, err
+	}
+	damaged := false
+	report := func(path, problem string, damage bool) {
+		damaged = damaged || damage
+		_, _ = fmt.Fprintf(out, "%s: %s\n", filepath.Base(path), problem)
+	}
+
+	var previous wal.SegmentReport
+	for index, path := range files.walSegments {
+		segment, inspectErr := wal.InspectSegment(path, nil)
+		if inspectErr != nil {
+			report(path, inspectErr.Error(), true)
+			continue
+		}
+		newest := index == len(files.walSegments)-1
+		if segment.Damage != nil {
+			report(path, walStatus(segment, newest), !(newest && segment.TornTail()))
+		}
+		if previous.Damage == nil && previous.Records > 0 && segment.NameLSN != previous.LastLSN+1 {
+			report(path, fmt.Sprintf("starts at LSN %d, but the segment before it ends at LSN %d", segment.NameLSN,
+				previous.LastLSN), true)
+		}
+		previous = segment
+	}
+	for _, path := range files.snapshots {
+		snapshot, inspectErr := wal.InspectSnapshot(path, nil)
+		if inspectErr != nil {
+			report(path, inspectErr.Error(), true)
+		} else if snapshot.Damage != nil {
+			report(path, damageStatus(snapshot.Damage, snapshot.DamageOffset), true)
+		}
+	}
+	for index, path := range files.segments {
+		segment, inspectErr := tiered.InspectSegment(path, nil)
+		newest := index == len(files.segments)-1
+		if inspectErr != nil {
+			report(path, inspectErr.Error(), true)
+		} else if segment.Damage != nil {
+			report(path, segmentStatus(segment, newest), !(newest && segment.TornTail()))
+		}
+	}
+
+	checked := len(files.walSegments) + len(files.snapshots) + len(files.segments)
+	if damaged {
+		_, _ = fmt.Fprintf(out, "checked %d files: damaged\n", checked)
+	} else {
+		_, _ = fmt.Fprintf(out, "checked %d files: ok\n", checked)
+	}
+	return damaged, nil
+}
+
+// errDone stops a dump once it is past the last LSN asked for.
+var errDone = errors.New("done")
+
+// dump prints the WAL records of dir from LSN from to LSN to, up to the first damaged record.
+func dump(out io.Writer, dir string, from, to uint64, asJSON bool) error {
+	files, err := findFiles(dir)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(out)
+	for index, path := range files.walSegments {
+		// a segment whose successor starts at or before from holds nothing to print
+		if index+1 < len(files.walSegments) {
+			if next, ok := walNameLSN(files.walSegments[index+1]); ok && next <= from {
+				continue
+			}
+		}
+		report, inspectErr := wal.InspectSegment(path, func(record wal.Record) error {
+			switch {
+			case record.LSN < from:
+				return nil
+			case to > 0 && record.LSN > to:
+				return errDone
+			case asJSON:
+				return encoder.Encode(walRecordJSON(record))
+			default:
+				_, printErr := fmt.Fprintln(out, walRecordText(record))
+				return printErr
+			}
+		})
+		if errors.Is(inspectErr, errDone) {
+			return nil
+		}
+		if inspectErr != nil {
+			return inspectErr
+		}
+		if report.Damage != nil {
+			return fmt.Errorf("%s: %s", filepath.Base(path), walStatus(report, index == len(files.walSegments)-1))
+		}
+	}
+	return nil
+}
+
+// dumpSnapshot prints the entries of the snapshot at path. With a table, only its blocks are read when the snapshot
+// has an index; a snapshot without one is read in full and filtered.
+func dumpSnapshot(out io.Writer, path, only string, asJSON bool) error {
+	encoder := json.NewEncoder(out)
+	printEntry := func(table, key, stored string) error {
+		if only != "" && table != only {
+			return nil
+		}
+		value := protocol.Decode(stored)
+		if asJSON {
+			return encoder.Encode(entryJSON{Table: table, Key: key, Kind: value.Kind.String(),
+				Value: protocol.Render(value)})
+		}
+		_, printErr := fmt.Fprintf(out, "%s %s %s\n", field(table), field(key), protocol.Render(value))
+		return printErr
+	}
+	if only != "" {
+		err := wal.ReadSnapshotTable(path, only, func(key, value string) error { return printEntry(only, key, value) })
+		if !errors.Is(err, wal.ErrNoSnapshotIndex) {
+			return err
+		}
+	}
+	report, err := wal.InspectSnapshot(path, printEntry)
+	if err != nil {
+		return err
+	}
+	if report.Damage != nil {
+		return errors.New(damageStatus(report.Damage, report.DamageOffset))
+	}
+	return nil
+}
+
+func compressedStatus(compressed bool) string {
+	if compressed {
+		return ", compressed"
+	}
+	return ""
+}
+
+func dumpSegment(out io.Writer, path string, asJSON bool) error {
+	encoder := json.NewEncoder(out)
+	report, err := tiered.InspectSegment(path, func(record tiered.SegmentRecord) error {
+		entry := entryJSON{Offset: record.Offset, LSN: record.LSN, Table: record.Table, Key: record.Key,
+			Tombstone: record.Tombstone, Compressed: record.Compressed}
+		if !record.Tombstone {
+			value := protocol.Decode(record.Value)
+			entry.Kind, entry.Value = value.Kind.String(), protocol.Render(value)
+		}
+		if asJSON {
+			return encoder.Encode(entry)
+		}
+		value := entry.Value
+		if record.Tombstone {
+			value = "(deleted)"
+		}
+		_, printErr := fmt.Fprintf(out, "@%d LSN %d %s %s %s\n", record.Offset, record.LSN, field(record.Table),
+			field(record.Key), value)
+		return printErr
+	})
+	if err != nil {
+		return err
+	}
+	if report.Damage != nil {
+		return errors.New(damageStatus(report.Damage, report.DamageOffset))
+	}
+	return nil
+}
+
+// recordJSON is a WAL record as dump -json prints it. The last argument of a command that writes a value is the
+// value, rendered the way GET shows it, and Kind is its type.
+type recordJSON struct {
+	LSN     uint64    `json:"lsn"`
+	Time    time.Time `json:"time,omitzero"`
+	Origin  string    `json:"origin,omitempty"`
+	Command string    `json:"command"`
+	Args    []string  `json:"args"`
+	Kind    string    `json:"kind,omitempty"`
+}
+
+// entryJSON is a snapshot entry or a tiered segment record as snapshot -json and segment -json print it.
+type entryJSON struct {
+	Offset     int64  `json:"offset,omitempty"`
+	LSN        uint64 `json:"lsn,omitempty"`
+	Table      string `json:"table"`
+	Key        string `json:"key"`
+	Tombstone  bool   `json:"tombstone,omitempty"`
+	Compressed bool   `json:"compressed,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+	Value      string `json:"value,omitempty"`
+}
+
+func walRecordJSON(record wal.Record) recordJSON {
+	args, kind := renderArgs(record)
+	return recordJSON{LSN: record.LSN, Time: record.Time, Origin: record.Origin, Command: record.Command, Args: args,
+		Kind: kind}
+}
+
+func walRecordText(record wal.Record) string {
+	args, _ := renderArgs(record)
+	parts := []string{strconv.FormatUint(record.LSN, 10), "-", "-", record.Command}
+	if !record.Time.IsZero() {
+		parts[1] = record.Time.Format(time.RFC3339Nano)
+	}
+	if record.Origin != "" {
+		parts[2] = field(record.Origin)
+	}
+	for index, arg := range args {
+		if index < len(args)-1 || record.Command == wal.CommandDel {
+			arg = field(arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// renderArgs returns the arguments of a record with the value, the last argument of every command but DEL, decoded
+// and rendered, along with the value's kind.
+func renderArgs(record wal.Record) ([]string, string) {
+	args := slices.Clone(record.Args)
+	if record.Command == wal.CommandDel || len(args) == 0 {
+		return args, ""
+	}
+	value := protocol.Decode(args[len(args)-1])
+	args[len(args)-1] = protocol.Render(value)
+	return args, value.Kind.String()
+}
+
+// field quotes a table, key or origin that would not read back as one word.
+func field(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"") || !strconv.IsPrint(rune(s[0])) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func walNameLSN(path string) (uint64, bool) {
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".gz"), wal.WALSuffix)
+	lsn, err := strconv.ParseUint(strings.TrimPrefix(name, wal.WALPrefix), 10, 64)
+	return lsn, err == nil
+}
+
+func lsnRange(first, last uint64) string {
+	if last == 0 {
+		return "no LSNs"
+	}
+	return fmt.Sprintf("LSN %d-%d", first, last)
+}
+
+func timeRange(first, last time.Time) string {
+	if last.IsZero() {
+		return "-"
+	}
+	return first.Format(time.RFC3339) + " to " + last.Format(time.RFC3339)
+}
+
+// walStatus describes a WAL segment's damage; newest says whether it is the segment recovery would append to.
+func walStatus(report wal.SegmentReport, newest bool) string {
+	if report.TornTail() && newest {
+		return fmt.Sprintf("torn tail at offset %d (truncated on the next start)", report.DamageOffset)
+	}
+	return damageStatus(report.Damage, report.DamageOffset)
+}
+
+// segmentStatus describes a tiered segment's damage; newest says whether it is the active segment.
+func segmentStatus(report tiered.SegmentReport, newest bool) string {
+	if report.TornTail() && newest {
+		return fmt.Sprintf("torn tail at offset %d (truncated on the next start)", report.DamageOffset)
+	}
+	return damageStatus(report.Damage, report.DamageOffset)
+}
+
+func damageStatus(damage error, offset int64) string {
+	if damage == nil {
+		return "ok"
+	}
+	return fmt.Sprintf("damaged at offset %d: %v", offset, damage)
+}
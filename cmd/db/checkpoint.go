@@ -0,0 +1,23 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/OutOfStack/db/internal/engine/tiered"
+	"github.com/OutOfStack/db/internal/protocol"
+)
+
+// checkpointer serves CHECKPOINT for the tiered engine. The directory is a path on the server, written by the server.
+type checkpointer struct {
+	engine *tiered.Engine
+}
+
+func (c checkpointer) Checkpoint(_ context.Context, dir string) (protocol.Reply, error) {
+	manifest, err := c.engine.Checkpoint(dir)
+	if err != nil {
+		return protocol.Reply{}, err
+	}
+	return protocol.SimpleString(fmt.Sprintf("checkpoint of %d segments at LSN %d", len(manifest.Segments),
+		manifest.LSN)), nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/OutOfStack/db/internal/engine/tiered"
+	"github.com/OutOfStack/db/internal/protocol"
+)
+
+// compactor serves COMPACT for the tiered engine. The run goes on in the background; its progress and history are in
+// the engine's stats.
+type compactor struct {
+	engine *tiered.Engine
+}
+
+func (c compactor) Compact(_ context.Context, force bool) (protocol.Reply, error) {
+	queued, err := c.engine.CompactNow(force)
+	if err != nil {
+		return protocol.Reply{}, err
+	}
+	if queued == 0 {
+		return protocol.SimpleString("nothing to compact"), nil
+	}
+	return protocol.SimpleString(fmt.Sprintf("compacting %d segments", queued)), nil
+}
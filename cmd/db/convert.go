@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/OutOfStack/db/internal/config"
+	"github.com/OutOfStack/db/internal/datadir"
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/engine/tiered"
+	"github.com/OutOfStack/db/internal/storage"
+	"github.com/OutOfStack/db/internal/wal"
+)
+
+// digest summarizes a dataset whatever order it is read in: the number of keys, and the sum of a checksum of each
+// table, key and value. Two datasets with equal digests hold the same keys and values, short of a checksum collision.
+type digest struct {
+	keys int
+	sum  uint64
+}
+
+func (d *digest) add(table, key, value string) {
+	hash := fnv.New64a()
+	for _, field := range []string{table, key, value} {
+		// the length keeps ("ab", "c") and ("a", "bc") apart
+		_, _ = fmt.Fprintf(hash, "%d:%s", len(field), field)
+	}
+	d.keys++
+	d.sum += hash.Sum64()
+}
+
+// digestOf reads source in full. A tiered engine skips a value it fails to read, logging it, so a key count that falls
+// short of the engine's own is a failed read rather than a smaller dataset.
+func digestOf(source wal.SnapshotSource, want int) (digest, error) {
+	var d digest
+	source.Range(func(table, key, value string) bool {
+		d.add(table, key, value)
+		return true
+	})
+	if d.keys != want {
+		return d, fmt.Errorf("read %d keys of %d", d.keys, want)
+	}
+	return d, nil
+}
+
+// digestingSource passes a source through to WriteSnapshot, adding every entry written to a digest
+type digestingSource struct {
+	source wal.SnapshotSource
+	digest *digest
+}
+
+func (s digestingSource) Range(fn func(table, key, value string) bool) {
+	s.source.Range(func(table, key, value string) bool {
+		s.digest.add(table, key, value)
+		return fn(table, key, value)
+	})
+}
+
+// convert moves the database in the data directory src, written by the other engine, into the empty data directory of
+// the configured one, and returns without starting the server: a WAL directory (its latest snapshot and the records
+// after it) becomes tiered segments, and tiered segments become a WAL snapshot. Both directories are locked, so neither
+// may be in use by a server. The copy is read back at the end and must hold the same keys and values as the source.
+//
+// The source is recovered the way a server start recovers it, so a record cut short at its end is truncated; it is
+// otherwise left as it was, since a tiered source is opened read-only: no hint files are written and no compaction
+// runs. A failed conversion can leave a partial store in the destination, which has to be removed
+// before converting again.
+func convert(cfg *config.ServerConfig, logger *slog.Logger, src string) (err error) {
+	dst, srcKind := cfg.WAL.DataDir, datadir.KindTiered
+	switch {
+	case cfg.Engine.Type == engine.TypeTiered:
+		dst, srcKind = cfg.Engine.DataDir, datadir.KindWAL
+	case !cfg.WAL.Enabled:
+		return errors.New("convert needs the tiered engine, or the in_memory engine with wal enabled")
+	}
+	if filepath.Clean(src) == filepath.Clean(dst) {
+		return fmt.Errorf("convert source %q is the configured data directory", src)
+	}
+
+	srcLock, err := lockDataDir(src, srcKind)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, srcLock.Close()) }()
+	dstLock, err := lockDataDir(dst, datadir.KindNone)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, dstLock.Close()) }()
+
+	ctx := context.Background()
+	var source, copied digest
+	var lsn uint64
+	if srcKind == datadir.KindWAL {
+		source, copied, lsn, err = walToTiered(ctx, src, tieredConfig(cfg.Engine), logger)
+	} else {
+		srcConfig := tieredConfig(cfg.Engine)
+		srcConfig.Dir = src
+		srcConfig.ReadOnly = true
+		source, copied, lsn, err = tieredToWAL(ctx, srcConfig, dst, logger, snapshotOptions(cfg)...)
+	}
+	if err != nil {
+		return err
+	}
+	if copied != source {
+		return fmt.Errorf("converted data does not match its source: %d keys, checksum %016x; want %d keys, "+
+			"checksum %016x", copied.keys, copied.sum, source.keys, source.sum)
+	}
+	logger.Info("Data directory converted", "from", src, "from_kind", srcKind, "to", dst, "lsn", lsn,
+		"keys", source.keys, "checksum", fmt.Sprintf("%016x", source.sum))
+	return nil
+}
+
+// lockDataDir takes the lock of dir and checks it holds database files of the wanted kind
+func lockDataDir(dir string, want datadir.Kind) (*datadir.Lock, error) {
+	lock, err := datadir.Acquire(dir)
+	if err != nil {
+		return nil, err
+	}
+	kind, err := datadir.Detect(dir)
+	if err == nil && kind != want {
+		if want == datadir.KindNone {
+			err = fmt.Errorf("refusing to convert over existing %s database files in %q", kind, dir)
+		} else {
+			err = fmt.Errorf("convert source %q holds %s database files, want %s", dir, kind, want)
+		}
+	}
+	if err != nil {
+		return nil, errors.Join(err, lock.Close())
+	}
+	return lock, nil
+}
+
+// walToTiered recovers the state of the WAL directory src in memory, as a server start would, and writes every key to a
+// new tiered engine stamped with the last LSN, so a replication log started on it continues the WAL's numbering. It
+// returns the digests of the recovered state and of the engine reopened from disk.
+func walToTiered(ctx context.Context, src string, cfg tiered.Config, logger *slog.Logger) (source, copied digest,
+	lsn uint64, err error) {
+	state := engine.New()
+	var entries []engine.Entry
+	snapshotLSN, err := wal.LoadLatestSnapshot(src, func(table, key, value string) error {
+		entries = append(entries, engine.Entry{Table: table, Key: key, Value: value})
+		return nil
+	})
+	if err != nil {
+		return source, copied, 0, fmt.Errorf("load snapshot: %w", err)
+	}
+	state.Load(ctx, entries)
+	lsn, err = wal.NewReader(src, logger).Replay(snapshotLSN, func(record wal.Record) error {
+		return storage.ApplyReplay(ctx, state, record.Command, record.Args)
+	})
+	if err != nil {
+		return source, copied, 0, fmt.Errorf("replay WAL: %w", err)
+	}
+	if source, err = digestOf(state, totalKeys(state.KeyCounts(ctx))); err != nil {
+		return source, copied, lsn, err
+	}
+
+	eng, err := tiered.Open(cfg, logger)
+	if err != nil {
+		return source, copied, lsn, fmt.Errorf("open tiered engine: %w", err)
+	}
+	lsnCtx := engine.WithLSN(ctx, lsn)
+	state.Range(func(table, key, value string) bool {
+		err = eng.Set(lsnCtx, table, key, value)
+		return err == nil
+	})
+	if err = errors.Join(err, eng.Close()); err != nil {
+		return source, copied, lsn, fmt.Errorf("write tiered engine: %w", err)
+	}
+
+	if eng, err = tiered.Open(cfg, logger); err != nil {
+		return source, copied, lsn, fmt.Errorf("reopen tiered engine: %w", err)
+	}
+	copied, err = digestOf(eng, totalKeys(eng.KeyCounts(ctx)))
+	return source, copied, lsn, errors.Join(err, eng.Close())
+}
+
+// tieredToWAL writes the live keys of the tiered engine at cfg into a snapshot in dst, numbered with the engine's
+// applied LSN, so the WAL opened on it continues from there. It returns the digests of what was written and of the
+// snapshot read back.
+func tieredToWAL(ctx context.Context, cfg tiered.Config, dst string, logger *slog.Logger, opts ...wal.SnapshotOption) (
+	source, copied digest, lsn uint64, err error) {
+	eng, err := tiered.Open(cfg, logger)
+	if err != nil {
+		return source, copied, 0, fmt.Errorf("open tiered engine: %w", err)
+	}
+	lsn = eng.AppliedLSN()
+	want := totalKeys(eng.KeyCounts(ctx))
+	err = wal.WriteSnapshot(ctx, dst, lsn, digestingSource{source: eng, digest: &source}, opts...)
+	if err = errors.Join(err, eng.Close()); err != nil {
+		return source, copied, lsn, fmt.Errorf("write snapshot: %w", err)
+	}
+	if source.keys != want {
+		return source, copied, lsn, fmt.Errorf("read %d keys of %d", source.keys, want)
+	}
+
+	if _, err = wal.LoadLatestSnapshot(dst, func(table, key, value string) error {
+		copied.add(table, key, value)
+		return nil
+	}); err != nil {
+		return source, copied, lsn, fmt.Errorf("read back snapshot: %w", err)
+	}
+	return source, copied, lsn, nil
+}
+
+func totalKeys(counts map[string]int) int {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/OutOfStack/db/internal/config"
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/engine/tiered"
+	"github.com/OutOfStack/db/internal/protocol"
+	"github.com/OutOfStack/db/internal/storage"
+	"github.com/OutOfStack/db/internal/wal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestConvert moves a WAL directory, snapshot and records after it, into a tiered engine and back into another WAL
+// directory, and checks every value survives both ways with its type and that the LSN carries over.
+func TestConvert(t *testing.T) {
+	t.Parallel()
+	logger := slog.New(slog.DiscardHandler)
+	walCfg := config.DefaultServerConfig()
+	walCfg.WAL.Enabled = true
+	walCfg.WAL.DataDir = t.TempDir()
+	walCfg.WAL.Sync = wal.SyncAlways
+
+	dbEngine, writer, _, err := recoverPersistence(walCfg, logger)
+	require.NoError(t, err)
+	store := storage.New(dbEngine, storage.WithWAL(writer))
+	for _, command := range [][]string{
+		{"SET", "users", "a", "42"},
+		{"SET", "users", "b", `"42"`},
+		{"snapshot"},
+		{"SET", "users", "c", "[1,2.0]"},
+		{"DEL", "users", "a"},
+		{"HSET", "orders", "o1", "total", "9.5"},
+	} {
+		if command[0] == "snapshot" {
+			_, err = createSnapshot(t.Context(), walCfg.WAL.DataDir, archiveConfig(walCfg), store)
+		} else {
+			_, err = store.Execute(t.Context(), command[0], command[1:])
+		}
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+	want := map[[2]string]string{
+		{"users", "b"}:   `"42"`,
+		{"users", "c"}:   "[1,2.0]",
+		{"orders", "o1"}: `{"total":9.5}`,
+	}
+
+	tieredCfg := config.DefaultServerConfig()
+	tieredCfg.Engine.Type = engine.TypeTiered
+	tieredCfg.Engine.DataDir = t.TempDir()
+	require.ErrorContains(t, convert(tieredCfg, logger, tieredCfg.Engine.DataDir), "is the configured data directory")
+	require.NoError(t, convert(tieredCfg, logger, walCfg.WAL.DataDir))
+	require.ErrorContains(t, convert(tieredCfg, logger, walCfg.WAL.DataDir), "refusing to convert over existing tiered")
+
+	eng, err := tiered.Open(tieredConfig(tieredCfg.Engine), logger)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), eng.AppliedLSN())
+	assert.Equal(t, want, literals(t, eng))
+	require.NoError(t, eng.Close())
+
+	backCfg := config.DefaultServerConfig()
+	backCfg.WAL.Enabled = true
+	backCfg.WAL.DataDir = t.TempDir()
+	require.ErrorContains(t, convert(backCfg, logger, walCfg.WAL.DataDir), "holds wal database files, want tiered")
+	before := dirListing(t, tieredCfg.Engine.DataDir)
+	require.NoError(t, convert(backCfg, logger, tieredCfg.Engine.DataDir))
+	assert.Equal(t, before, dirListing(t, tieredCfg.Engine.DataDir), "the tiered source must be left as it was")
+	recovered, recoveredWriter, snapshotLSN, err := recoverPersistence(backCfg, logger)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), snapshotLSN)
+	assert.Equal(t, want, literals(t, recovered))
+	require.NoError(t, recoveredWriter.Close())
+
+	ephemeral := config.DefaultServerConfig()
+	require.ErrorContains(t, convert(ephemeral, logger, walCfg.WAL.DataDir), "needs the tiered engine")
+}
+
+// dirListing returns the size of every file in dir, by name
+func dirListing(t *testing.T, dir string) map[string]int64 {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	sizes := make(map[string]int64, len(entries))
+	for _, entry := range entries {
+		info, infoErr := entry.Info()
+		require.NoError(t, infoErr)
+		sizes[entry.Name()] = info.Size()
+	}
+	return sizes
+}
+
+// literals returns every value of source as its literal, by table and key
+func literals(t *testing.T, source wal.SnapshotSource) map[[2]string]string {
+	t.Helper()
+	values := make(map[[2]string]string)
+	source.Range(func(table, key, value string) bool {
+		values[[2]string{table, key}] = protocol.Literal(protocol.Decode(value))
+		return true
+	})
+	return values
+}
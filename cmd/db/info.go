@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/OutOfStack/db/internal/config"
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/engine/tiered"
+	"github.com/OutOfStack/db/internal/info"
+	"github.com/OutOfStack/db/internal/network"
+	"github.com/OutOfStack/db/internal/storage"
+	"github.com/OutOfStack/db/internal/wal"
+)
+
+// version is the server's release, set at build time with -ldflags "-X main.version=<version>".
+var version = "dev" //nolint:gochecknoglobals // written by the linker
+
+// infoProviders lists the INFO sections of this server in the order INFO reports them. Each subsystem reports its own;
+// the server, memory and the parts of persistence and replication that no subsystem owns are reported here.
+func infoProviders(
+	settings *runtimeSettings,
+	srv *network.TCPServer,
+	store *storage.Storage,
+	dbEngine storage.Engine,
+	walWriter *wal.Writer,
+	repl *replicationRuntime,
+) []info.Provider {
+	started := time.Now()
+	providers := []info.Provider{
+		info.ProviderFunc(func(context.Context) info.Section {
+			cfg := settings.current()
+			return serverInfo(&cfg, started)
+		}),
+		srv,
+		info.ProviderFunc(memoryInfo),
+		store,
+		info.ProviderFunc(func(context.Context) info.Section {
+			cfg := settings.current()
+			return persistenceInfo(&cfg, walWriter)
+		}),
+	}
+	if walWriter != nil {
+		providers = append(providers, walWriter)
+	}
+	if tieredEngine, ok := dbEngine.(*tiered.Engine); ok {
+		providers = append(providers, tieredEngine)
+	}
+	if repl != nil {
+		providers = append(providers, repl.admin)
+	} else {
+		providers = append(providers, info.ProviderFunc(func(context.Context) info.Section {
+			section := info.Section{Name: "replication"}
+			section.Add("role", roleName(config.RoleStandalone))
+			return section
+		}))
+	}
+	return providers
+}
+
+func serverInfo(cfg *config.ServerConfig, started time.Time) info.Section {
+	section := info.Section{Name: "server"}
+	section.Add("version", version)
+	section.Add("go_version", runtime.Version())
+	section.Add("os", runtime.GOOS+"/"+runtime.GOARCH)
+	section.Add("process_id", os.Getpid())
+	section.Add("tcp_address", cfg.Network.Address)
+	section.Add("started", started)
+	section.Add("uptime_in_seconds", time.Since(started))
+	section.Add("engine", cfg.Engine.Type)
+	section.Add("role", roleName(cfg.Replication.Role))
+	section.Add("max_message_size", cfg.Network.MaxMessageSizeKB*1024)
+	section.Add("idle_timeout", cfg.Network.IdleTimeout)
+	section.Add("log_level", cfg.Logging.Level)
+	return section
+}
+
+// memoryInfo reports the Go runtime's view of the process: the heap in use, what the runtime holds from the operating
+// system, and the collector's work so far.
+func memoryInfo(context.Context) info.Section {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	section := info.Section{Name: "memory"}
+	section.Add("used_memory", stats.HeapAlloc)
+	section.Add("heap_in_use", stats.HeapInuse)
+	section.Add("heap_objects", stats.HeapObjects)
+	section.Add("sys_memory", stats.Sys)
+	section.Add("gc_runs", stats.NumGC)
+	section.Add("gc_pause_total_ms", stats.PauseTotalNs/uint64(time.Millisecond))
+	section.Add("goroutines", runtime.NumGoroutine())
+	return section
+}
+
+// persistenceInfo reports how the engine keeps its data; the WAL, when there is one, adds its own fields after these.
+func persistenceInfo(cfg *config.ServerConfig, walWriter *wal.Writer) info.Section {
+	section := info.Section{Name: "persistence"}
+	if cfg.Engine.Type == engine.TypeTiered {
+		section.Add("engine_data_dir", cfg.Engine.DataDir)
+		section.Add("engine_fsync", string(cfg.Engine.Sync))
+	}
+	if walWriter == nil {
+		section.Add("wal_enabled", false)
+	}
+	return section
+}
@@ -10,6 +10,7 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 	"time"
 
@@ -18,9 +19,12 @@ import (
 	"github.com/OutOfStack/db/internal/datadir"
 	"github.com/OutOfStack/db/internal/engine"
 	"github.com/OutOfStack/db/internal/engine/tiered"
+	"github.com/OutOfStack/db/internal/metrics"
+	"github.com/OutOfStack/db/internal/migration"
 	"github.com/OutOfStack/db/internal/network"
 	"github.com/OutOfStack/db/internal/parser"
 	"github.com/OutOfStack/db/internal/protocol"
+	"github.com/OutOfStack/db/internal/scrub"
 	"github.com/OutOfStack/db/internal/storage"
 	"github.com/OutOfStack/db/internal/wal"
 )
@@ -34,24 +38,59 @@ func main() {
 func execute() int {
 	var configPath string
 	var allowEphemeralOverData bool
+	var target restoreTarget
+	var convertFrom string
 	flag.StringVar(&configPath, "config", "", "Path to configuration file")
 	flag.BoolVar(&allowEphemeralOverData, "allow-ephemeral-over-data", false,
 		"Allow ephemeral startup when durable database files already exist")
+	flag.Uint64Var(&target.lsn, "restore-to-lsn", 0,
+		"Rebuild the empty data directory from the WAL archive up to this LSN, then exit")
+	flag.StringVar(&target.time, "restore-to-time", "",
+		"Rebuild the empty data directory from the WAL archive up to this RFC 3339 time, then exit")
+	flag.StringVar(&target.from, "restore-from", "",
+		"WAL archive to restore from, when wal.archive_dir names a new one for the restored server")
+	flag.StringVar(&convertFrom, "convert-from", "",
+		"Convert the other engine's data directory at this path into the empty configured one, then exit")
 	flag.Parse()
+	if target.lsn > 0 && target.time != "" {
+		log.Println("Use only one of -restore-to-lsn and -restore-to-time")
+		return 2
+	}
+	if target.set() && convertFrom != "" {
+		log.Println("Use only one of -convert-from and a restore")
+		return 2
+	}
+	if target.from != "" && !target.set() {
+		log.Println("-restore-from needs -restore-to-lsn or -restore-to-time")
+		return 2
+	}
 
 	cfg, err := config.LoadServerConfig(configPath)
 	if err != nil {
 		log.Printf("Failed to load configuration: %v\n", err)
 		return 1
 	}
-	logger, closeLog, err := newLogger(cfg.Logging)
+	// CONFIG SET and a reload on SIGHUP change the log level through level
+	level := new(slog.LevelVar)
+	logger, closeLog, err := newLogger(cfg.Logging, level)
 	if err != nil {
 		log.Printf("Failed to configure logging: %v\n", err)
 		return 1
 	}
-	runErr := run(cfg, logger, allowEphemeralOverData)
-	if runErr != nil {
-		logger.Error("Server stopped", "error", runErr)
+	var runErr error
+	switch {
+	case target.set():
+		if runErr = restore(cfg, logger, target); runErr != nil {
+			logger.Error("Restore failed", "error", runErr)
+		}
+	case convertFrom != "":
+		if runErr = convert(cfg, logger, convertFrom); runErr != nil {
+			logger.Error("Conversion failed", "error", runErr)
+		}
+	default:
+		if runErr = run(cfg, configPath, logger, level, allowEphemeralOverData); runErr != nil {
+			logger.Error("Server stopped", "error", runErr)
+		}
 	}
 	closeErr := closeLog()
 	if closeErr != nil {
@@ -67,16 +106,8 @@ func processExitCode(errs ...error) int {
 	return 0
 }
 
-func newLogger(cfg config.ServerLoggingConfig) (*slog.Logger, func() error, error) {
-	level := slog.LevelInfo
-	switch cfg.Level {
-	case "debug":
-		level = slog.LevelDebug
-	case "warn":
-		level = slog.LevelWarn
-	case "error":
-		level = slog.LevelError
-	}
+func newLogger(cfg config.ServerLoggingConfig, level *slog.LevelVar) (*slog.Logger, func() error, error) {
+	level.Set(logLevel(cfg.Level))
 	opts := &slog.HandlerOptions{Level: level}
 	if cfg.Output == "" {
 		return slog.New(slog.NewJSONHandler(os.Stdout, opts)), func() error { return nil }, nil
@@ -88,7 +119,27 @@ func newLogger(cfg config.ServerLoggingConfig) (*slog.Logger, func() error, erro
 	return slog.New(slog.NewJSONHandler(file, opts)), file.Close, nil
 }
 
-func run(cfg *config.ServerConfig, logger *slog.Logger, allowEphemeralOverData bool) (err error) {
+// logLevel maps a logging.level setting to its slog level.
+func logLevel(name string) slog.Level {
+	switch name {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func run(
+	cfg *config.ServerConfig,
+	configPath string,
+	logger *slog.Logger,
+	level *slog.LevelVar,
+	allowEphemeralOverData bool,
+) (err error) {
 	logSupportBoundary(cfg, logger)
 	lock, err := prepareDataDir(cfg, allowEphemeralOverData)
 	if err != nil {
@@ -123,14 +174,63 @@ func run(cfg *config.ServerConfig, logger *slog.Logger, allowEphemeralOverData b
 		return err
 	}
 
-	var computeOptions []compute.Option
+	// MIGRATE connects to its targets like any client; Close stops background table migrations before the engine closes
+	migrator := migration.New(store, logger,
+		migration.WithLocalAddress(cfg.Network.Address),
+		migration.WithClientOptions(
+			network.WithClientIdleTimeout(cfg.Network.IdleTimeout),
+			network.WithClientMaxMessageSize(cfg.Network.MaxMessageSizeKB*1024)))
+	defer func() { err = errors.Join(err, migrator.Close()) }()
+
+	scrubber := newScrubber(cfg, logger, dbEngine, store, walWriter)
+	computeOptions := []compute.Option{
+		compute.WithMigrator(migrator),
+		compute.WithVerifier(scrubber),
+		compute.WithSlowLog(cfg.SlowLog.Threshold, cfg.SlowLog.MaxLen),
+	}
+	if tieredEngine, ok := dbEngine.(*tiered.Engine); ok {
+		computeOptions = append(computeOptions,
+			compute.WithCompactor(compactor{engine: tieredEngine}),
+			compute.WithCheckpointer(checkpointer{engine: tieredEngine}))
+	}
 	if repl != nil {
 		computeOptions = append(computeOptions,
 			compute.WithAdmin(repl.admin),
 			compute.WithPromoteEnabled(cfg.Replication.AllowRemotePromote))
 	}
+	// the metrics listener starts first, so a busy port fails startup before the client port opens; collectors join as
+	// the subsystems they belong to are built
+	registry := metrics.NewRegistry()
+	if cfg.Metrics.Address != "" {
+		stopMetrics, metricsErr := startMetricsServer(cfg.Metrics.Address, logger, registry)
+		if metricsErr != nil {
+			return errors.Join(metricsErr, stopReplication(repl))
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Network.ShutdownTimeout)
+			defer cancel()
+			err = errors.Join(err, stopMetrics(ctx))
+		}()
+	}
+	srv, err := network.NewTCPServer(cfg.Network.Address, logger,
+		network.WithServerIdleTimeout(cfg.Network.IdleTimeout),
+		network.WithServerMaxMessageSize(cfg.Network.MaxMessageSizeKB*1024),
+		network.WithServerMaxConnections(cfg.Network.MaxConnections))
+	if err != nil {
+		return errors.Join(err, stopReplication(repl))
+	}
+	settings := newRuntimeSettings(cfg, configPath, logger, level, srv, dbEngine)
+	computeOptions = append(computeOptions,
+		compute.WithInfo(infoProviders(settings, srv, store, dbEngine, walWriter, repl)...),
+		compute.WithClients(srv),
+		compute.WithConfigurer(settings))
 	comp := compute.New(parser.New(), store, logger, computeOptions...)
-	return serve(cfg, logger, comp, store, walWriter, repl, snapshotLSN)
+	var snapshots *snapshotMetrics
+	if walWriter != nil && cfg.Engine.Type != engine.TypeTiered {
+		snapshots = newSnapshotMetrics()
+	}
+	registerMetrics(registry, comp, srv, dbEngine, walWriter, repl, snapshots)
+	return serve(cfg, settings, logger, srv, comp, store, walWriter, repl, scrubber, snapshotLSN, snapshots)
 }
 
 func prepareDataDir(cfg *config.ServerConfig, allowEphemeralOverData bool) (*datadir.Lock, error) {
@@ -189,9 +289,9 @@ func logSupportBoundary(cfg *config.ServerConfig, logger *slog.Logger) {
 	}
 }
 
-// buildEngine constructs the configured storage engine. The tiered engine keeps its own durable segment store (no WAL);
-// the in-memory engine recovers from the WAL/snapshot when persistence is enabled, and so returns a writer and the LSN
-// to resume from.
+// buildEngine constructs the configured storage engine. The tiered engine keeps its own durable segment store, and a
+// WAL only as its replication log; the in-memory engine recovers from the WAL/snapshot when persistence is enabled, and
+// so returns a writer and the LSN to resume from.
 func buildEngine( //nolint:ireturn // returns the configured engine (in-memory or tiered) behind storage.Engine
 	cfg *config.ServerConfig,
 	logger *slog.Logger,
@@ -201,11 +301,91 @@ func buildEngine( //nolint:ireturn // returns the configured engine (in-memory o
 		if err != nil {
 			return nil, nil, 0, fmt.Errorf("open tiered engine: %w", err)
 		}
-		return tieredEngine, nil, 0, nil
+		writer, err := openReplicationLog(cfg, logger, tieredEngine)
+		if err != nil {
+			return nil, nil, 0, errors.Join(err, tieredEngine.Close())
+		}
+		return tieredEngine, writer, 0, nil
 	}
 	return recoverPersistence(cfg, logger)
 }
 
+// replicationLogDir is where a replicated tiered engine keeps its replication log: beside its segments, so the two
+// move together, but in a directory of its own so neither mistakes the other's files for its own.
+func replicationLogDir(cfg *config.ServerConfig) string {
+	return filepath.Join(cfg.Engine.DataDir, "replication")
+}
+
+// logDir returns the directory of the WAL the server keeps, the one replication streams.
+func logDir(cfg *config.ServerConfig) string {
+	if cfg.Engine.Type == engine.TypeTiered {
+		return replicationLogDir(cfg)
+	}
+	return cfg.WAL.DataDir
+}
+
+// openReplicationLog opens the WAL a replicated tiered engine logs its mutations to, replaying into the engine the
+// records it does not hold yet. A standalone server writes no log, so it removes one left by an earlier replicated run:
+// that log no longer covers the writes made since.
+//
+// A master whose log is empty starts it one LSN past the engine. Nothing in the log says what the segments hold then —
+// they may carry writes made while the server ran standalone — so every standby, even one that appears caught up,
+// falls behind the log's start and is resynced from the segment files.
+func openReplicationLog(cfg *config.ServerConfig, logger *slog.Logger, eng *tiered.Engine) (*wal.Writer, error) {
+	dir := replicationLogDir(cfg)
+	if cfg.Replication.Role == config.RoleStandalone {
+		if _, err := os.Stat(dir); err == nil {
+			logger.Info("Removing replication log of a previous replicated run", "dir", dir)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return nil, fmt.Errorf("remove stale replication log: %w", err)
+		}
+		return nil, nil //nolint:nilnil // a standalone tiered server keeps no log
+	}
+
+	applied := eng.AppliedLSN()
+	oldest, err := wal.OldestRecordLSN(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	// The whole log is read, not just the records past applied: the log is pruned up to what the segments hold, so it is
+	// short, and its last LSN is needed below. It may start past applied+1 only by the LSN reserved when it started empty.
+	var logLast uint64
+	if oldest > 0 {
+		logLast, err = wal.NewReader(dir, logger).Replay(oldest-1, func(record wal.Record) error {
+			if record.LSN <= applied {
+				return nil
+			}
+			return storage.ApplyReplay(engine.WithLSN(context.Background(), record.LSN), eng, record.Command, record.Args)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("replay replication log: %w", err)
+		}
+	}
+
+	lastLSN := max(applied, logLast)
+	if oldest == 0 && cfg.Replication.Role == config.RoleMaster {
+		lastLSN++
+	}
+	writer, err := wal.OpenWriter(wal.WriterConfig{
+		Dir:         dir,
+		Sync:        cfg.Engine.Sync,
+		SegmentSize: cfg.WAL.SegmentSizeMB << 20,
+	}, lastLSN)
+	if err != nil {
+		return nil, fmt.Errorf("open replication log: %w", err)
+	}
+	if oldest > 0 && applied > logLast {
+		// the segments survived a crash that cut the log's tail: appending after that tail would leave a gap in the log
+		logger.Warn("Replication log is behind the tiered engine; restarting it", "engine_lsn", applied, "log_lsn", logLast)
+		if err = writer.Reset(context.Background(), applied); err != nil {
+			return nil, errors.Join(fmt.Errorf("reset replication log: %w", err), writer.Close())
+		}
+	}
+	logger.Info("Replication log recovered", "engine_lsn", applied, "last_lsn", lastLSN)
+	return writer, nil
+}
+
 func tieredConfig(cfg config.ServerEngineConfig) tiered.Config {
 	const mib = 1 << 20
 	return tiered.Config{
@@ -216,6 +396,10 @@ func tieredConfig(cfg config.ServerEngineConfig) tiered.Config {
 		Sync:                cfg.Sync,
 		CompactionThreshold: cfg.CompactionThreshold,
 		CompactionInterval:  cfg.CompactionInterval,
+		CompactionRate:      cfg.CompactionRateMB * mib,
+		CompactionWindow:    cfg.CompactionWindow,
+		Compression:         cfg.Compression,
+		CompressionMinSize:  cfg.CompressionMinSize,
 	}
 }
 
@@ -244,10 +428,14 @@ func recoverPersistence(
 	if err != nil {
 		return nil, nil, 0, fmt.Errorf("replay WAL: %w", err)
 	}
+	if err = checkArchiveDir(cfg.WAL.ArchiveDir, lastLSN); err != nil {
+		return nil, nil, 0, fmt.Errorf("%w: it holds another history; point wal.archive_dir at a new directory", err)
+	}
 	writer, err := wal.OpenWriter(wal.WriterConfig{
 		Dir:         cfg.WAL.DataDir,
 		Sync:        cfg.WAL.Sync,
 		SegmentSize: cfg.WAL.SegmentSizeMB << 20,
+		Archive:     archiveConfig(cfg),
 	}, lastLSN)
 	if err != nil {
 		return nil, nil, 0, fmt.Errorf("open WAL: %w", err)
@@ -258,21 +446,17 @@ func recoverPersistence(
 
 func serve(
 	cfg *config.ServerConfig,
+	settings *runtimeSettings,
 	logger *slog.Logger,
+	srv *network.TCPServer,
 	comp *compute.Compute,
 	store *storage.Storage,
 	walWriter *wal.Writer,
 	repl *replicationRuntime,
+	scrubber *scrub.Scrubber,
 	recoveredSnapshotLSN uint64,
+	snapshots *snapshotMetrics,
 ) error {
-	srv, err := network.NewTCPServer(cfg.Network.Address, logger,
-		network.WithServerIdleTimeout(cfg.Network.IdleTimeout),
-		network.WithServerMaxMessageSize(cfg.Network.MaxMessageSizeKB*1024),
-		network.WithServerMaxConnections(cfg.Network.MaxConnections))
-	if err != nil {
-		return errors.Join(err, stopReplication(repl))
-	}
-
 	runtimeCtx, cancelRuntime := context.WithCancel(context.Background())
 	defer cancelRuntime()
 	serverDone := make(chan error, 1)
@@ -281,14 +465,21 @@ func serve(
 	}()
 	// Snapshots run for every role: a standby applies replicated records through the storage layer under the same lock a
 	// snapshot takes, so its snapshots are consistent, and this keeps a promoted node's WAL bounded.
-	snapshotDone := startSnapshotLoop(runtimeCtx, cfg, logger, store, walWriter, recoveredSnapshotLSN)
+	snapshotDone := startSnapshotLoop(runtimeCtx, cfg, logger, store, walWriter, recoveredSnapshotLSN, snapshots,
+		settings.snapshotInterval)
 	replDone := startReplication(runtimeCtx, logger, repl)
+	scrubDone := startScrubLoop(runtimeCtx, cfg.Scrub, scrubber)
 
 	logger.Info("Server started", "address", cfg.Network.Address, "role", roleName(cfg.Replication.Role))
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	defer signal.Stop(sigChan)
-	<-sigChan
+	for sig := <-sigChan; sig == syscall.SIGHUP; sig = <-sigChan {
+		logger.Info("Reloading config file")
+		if err := settings.reload(); err != nil {
+			logger.Error("Failed to reload config file", "error", err)
+		}
+	}
 	logger.Info("Shutting down server...")
 	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.Network.ShutdownTimeout)
 	serveErr := srv.Shutdown(shutdownCtx)
@@ -299,12 +490,13 @@ func serve(
 	replErr := stopReplication(repl)
 	<-replDone
 	<-snapshotDone
+	<-scrubDone
 	return errors.Join(serveErr, replErr)
 }
 
 func requestHandler(comp *compute.Compute) network.RequestHandler {
 	return func(ctx context.Context, cmd string, args []string) protocol.Reply {
-		result, err := comp.HandleRequest(ctx, cmd, args)
+		result, err := comp.HandleRequest(wal.WithOrigin(ctx, clientOrigin(ctx)), cmd, args)
 		if err == nil {
 			return result
 		}
@@ -318,6 +510,16 @@ func requestHandler(comp *compute.Compute) network.RequestHandler {
 	}
 }
 
+// clientOrigin is the origin of the WAL records a client's writes append: the client's address, after its name when it
+// has set one.
+func clientOrigin(ctx context.Context) string {
+	addr := network.ClientAddr(ctx)
+	if name := network.ClientName(ctx); name != "" {
+		return name + "@" + addr
+	}
+	return addr
+}
+
 func roleName(role string) string {
 	if role == config.RoleStandalone {
 		return "standalone"
@@ -332,12 +534,21 @@ func startSnapshotLoop(
 	store *storage.Storage,
 	writer *wal.Writer,
 	lastSnapshotLSN uint64,
+	snapshots *snapshotMetrics,
+	intervals <-chan time.Duration,
 ) <-chan struct{} {
 	done := make(chan struct{})
 	if writer == nil {
 		close(done)
 		return done
 	}
+	if cfg.Engine.Type == engine.TypeTiered {
+		go func() {
+			defer close(done)
+			pruneLoop(ctx, cfg.WAL.SnapshotInterval, intervals, logger, store, writer)
+		}()
+		return done
+	}
 	go func() {
 		defer close(done)
 		ticker := time.NewTicker(cfg.WAL.SnapshotInterval)
@@ -346,11 +557,15 @@ func startSnapshotLoop(
 			select {
 			case <-ctx.Done():
 				return
+			case interval := <-intervals:
+				ticker.Reset(interval)
 			case <-ticker.C:
 				if writer.LastLSN() == lastSnapshotLSN {
 					continue
 				}
-				writtenLSN, err := createSnapshot(ctx, cfg.WAL.DataDir, store)
+				start := time.Now()
+				writtenLSN, err := createSnapshot(ctx, cfg.WAL.DataDir, archiveConfig(cfg), store, snapshotOptions(cfg)...)
+				snapshots.observe(start, writtenLSN, err)
 				if err != nil {
 					logger.Error("Failed to write snapshot", "error", err)
 					continue
@@ -363,11 +578,66 @@ func startSnapshotLoop(
 	return done
 }
 
-func createSnapshot(ctx context.Context, dir string, store *storage.Storage) (uint64, error) {
+// pruneLoop is the snapshot loop of a replicated tiered engine: its segments already are the snapshot, so each round
+// only drops the log records they durably hold.
+func pruneLoop(
+	ctx context.Context,
+	interval time.Duration,
+	intervals <-chan time.Duration,
+	logger *slog.Logger,
+	store *storage.Storage,
+	writer *wal.Writer,
+) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var lastSeen uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case interval = <-intervals:
+			ticker.Reset(interval)
+		case <-ticker.C:
+			if last := writer.LastLSN(); last == lastSeen {
+				continue
+			}
+			lastSeen = writer.LastLSN()
+			prunedLSN, err := store.PruneLog(ctx)
+			if err != nil {
+				logger.Error("Failed to prune replication log", "error", err)
+				continue
+			}
+			logger.Info("Replication log pruned", "lsn", prunedLSN)
+		}
+	}
+}
+
+// createSnapshot writes a snapshot into dir and copies it into the archive, if there is one, before the WAL segments it
+// covers are pruned.
+func createSnapshot(
+	ctx context.Context,
+	dir string,
+	archive wal.ArchiveConfig,
+	store *storage.Storage,
+	opts ...wal.SnapshotOption,
+) (uint64, error) {
 	var writtenLSN uint64
 	err := store.Snapshot(ctx, func(ctx context.Context, lsn uint64, source storage.SnapshotSource) error {
 		writtenLSN = lsn
-		return wal.WriteSnapshot(ctx, dir, lsn, source)
+		if err := wal.WriteSnapshot(ctx, dir, lsn, source, opts...); err != nil {
+			return err
+		}
+		return wal.ArchiveSnapshot(dir, lsn, archive)
 	})
 	return writtenLSN, err
 }
+
+// snapshotOptions returns the options snapshots are written with under cfg.
+func snapshotOptions(cfg *config.ServerConfig) []wal.SnapshotOption {
+	return []wal.SnapshotOption{wal.WithSnapshotCompression(cfg.WAL.SnapshotCompress)}
+}
+
+// archiveConfig returns the WAL archive settings of cfg.
+func archiveConfig(cfg *config.ServerConfig) wal.ArchiveConfig {
+	return wal.ArchiveConfig{Dir: cfg.WAL.ArchiveDir, Compress: cfg.WAL.ArchiveCompress}
+}
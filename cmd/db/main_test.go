@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,6 +17,8 @@ import (
 
 	"github.com/OutOfStack/db/internal/config"
 	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/engine/tiered"
+	"github.com/OutOfStack/db/internal/metrics"
 	"github.com/OutOfStack/db/internal/protocol"
 	"github.com/OutOfStack/db/internal/replication"
 	"github.com/OutOfStack/db/internal/storage"
@@ -260,7 +265,7 @@ func TestRecoverPersistenceSnapshotAndWALTail(t *testing.T) {
 	if _, err = store.Execute(t.Context(), "SET", []string{"users", "a", "one"}); err != nil {
 		t.Fatal(err)
 	}
-	if _, err = createSnapshot(t.Context(), cfg.WAL.DataDir, store); err != nil {
+	if _, err = createSnapshot(t.Context(), cfg.WAL.DataDir, wal.ArchiveConfig{}, store); err != nil {
 		t.Fatal(err)
 	}
 	if _, err = store.Execute(t.Context(), "SET", []string{"users", "b", "two"}); err != nil {
@@ -290,6 +295,97 @@ func TestRecoverPersistenceSnapshotAndWALTail(t *testing.T) {
 	}
 }
 
+// TestScrubberReplacesDamagedSnapshot verifies the in-memory server scrubs its WAL and snapshots, and that quarantining a
+// damaged snapshot leaves one a restart recovers from.
+func TestScrubberReplacesDamagedSnapshot(t *testing.T) {
+	t.Parallel()
+	cfg := config.DefaultServerConfig()
+	cfg.WAL.Enabled = true
+	cfg.WAL.DataDir = t.TempDir()
+	cfg.WAL.Sync = wal.SyncAlways
+	logger := slog.New(slog.DiscardHandler)
+
+	dbEngine, writer, _, err := recoverPersistence(cfg, logger)
+	require.NoError(t, err)
+	store := storage.New(dbEngine, storage.WithWAL(writer))
+	_, err = store.Execute(t.Context(), "SET", []string{"users", "a", "one"})
+	require.NoError(t, err)
+	lsn, err := createSnapshot(t.Context(), cfg.WAL.DataDir, wal.ArchiveConfig{}, store)
+	require.NoError(t, err)
+	snapshot := filepath.Join(cfg.WAL.DataDir, fmt.Sprintf("snapshot-%020d.db", lsn))
+	data, err := os.ReadFile(snapshot)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(snapshot, data[:len(data)-2], 0o600))
+
+	scrubber := newScrubber(cfg, logger, dbEngine, store, writer)
+	_, err = scrubber.Verify(t.Context(), "tiered", false)
+	require.ErrorContains(t, err, "wal, snapshot")
+	reply, err := scrubber.Verify(t.Context(), "", true)
+	require.NoError(t, err)
+	text := protocol.Render(protocol.Decode(reply.Array[len(reply.Array)-1].Value))
+	assert.Contains(t, text, "quarantined: replaced by a fresh snapshot")
+	assert.FileExists(t, filepath.Join(cfg.WAL.DataDir, "quarantine", filepath.Base(snapshot)))
+	require.NoError(t, writer.Close())
+
+	recovered, recoveredWriter, _, err := recoverPersistence(cfg, logger)
+	require.NoError(t, err)
+	defer func() { _ = recoveredWriter.Close() }()
+	value, err := recovered.Get(t.Context(), "users", "a")
+	require.NoError(t, err)
+	assert.Equal(t, "one", stored(value))
+}
+
+// TestOpenReplicationLogReplaysPastEngine verifies a replicated tiered server replays the log records its segments lack,
+// and that running it standalone drops the log.
+func TestOpenReplicationLogReplaysPastEngine(t *testing.T) {
+	t.Parallel()
+	cfg := config.DefaultServerConfig()
+	cfg.Engine.Type = engine.TypeTiered
+	cfg.Engine.DataDir = t.TempDir()
+	cfg.Engine.Sync = wal.SyncAlways
+	cfg.Replication.Role = config.RoleMaster
+	logger := slog.New(slog.DiscardHandler)
+
+	dbEngine, writer, _, err := buildEngine(cfg, logger)
+	require.NoError(t, err)
+	// an empty log on a master starts one LSN past the engine, so standbys from an earlier run resync
+	require.Equal(t, uint64(1), writer.LastLSN())
+	store := storage.New(dbEngine, storage.WithWAL(writer))
+	_, err = store.Execute(t.Context(), "SET", []string{"users", "a", "one"})
+	require.NoError(t, err)
+	value, err := dbEngine.Get(t.Context(), "users", "a")
+	require.NoError(t, err)
+	// logged but never applied, as when the server crashed between the two
+	_, err = writer.Append(t.Context(), wal.CommandSet, []string{"users", "b", value})
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.NoError(t, asTiered(t, dbEngine).Close())
+
+	dbEngine, writer, _, err = buildEngine(cfg, logger)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), writer.LastLSN())
+	assert.Equal(t, uint64(3), asTiered(t, dbEngine).AppliedLSN())
+	value, err = dbEngine.Get(t.Context(), "users", "b")
+	require.NoError(t, err)
+	assert.Equal(t, "one", stored(value))
+	require.NoError(t, writer.Close())
+	require.NoError(t, asTiered(t, dbEngine).Close())
+
+	cfg.Replication.Role = config.RoleStandalone
+	dbEngine, writer, _, err = buildEngine(cfg, logger)
+	require.NoError(t, err)
+	defer func() { _ = asTiered(t, dbEngine).Close() }()
+	assert.Nil(t, writer)
+	assert.NoDirExists(t, replicationLogDir(cfg))
+}
+
+func asTiered(t *testing.T, dbEngine storage.Engine) *tiered.Engine {
+	t.Helper()
+	tieredEngine, ok := dbEngine.(*tiered.Engine)
+	require.True(t, ok, "engine is %T, want *tiered.Engine", dbEngine)
+	return tieredEngine
+}
+
 func stored(value string) string {
 	return protocol.Render(protocol.Decode(value))
 }
@@ -330,7 +426,7 @@ func TestRecoverPersistenceTypedValues(t *testing.T) {
 			t.Fatalf("%v: %v", command, err)
 		}
 	}
-	if _, err = createSnapshot(t.Context(), cfg.WAL.DataDir, store); err != nil {
+	if _, err = createSnapshot(t.Context(), cfg.WAL.DataDir, wal.ArchiveConfig{}, store); err != nil {
 		t.Fatal(err)
 	}
 	if _, err = store.Execute(t.Context(), "APPEND", []string{"t", "log", "true"}); err != nil {
@@ -364,3 +460,30 @@ func TestRecoverPersistenceTypedValues(t *testing.T) {
 		}
 	}
 }
+
+// TestMetricsServerServesRegistry verifies /metrics serves the collectors registered after the listener started, and
+// that stopping the server closes the listener.
+func TestMetricsServerServesRegistry(t *testing.T) {
+	addr := freeAddr(t)
+	registry := metrics.NewRegistry()
+	stop, err := startMetricsServer(addr, slog.New(slog.DiscardHandler), registry)
+	require.NoError(t, err)
+	snapshots := newSnapshotMetrics()
+	snapshots.observe(time.Now(), 42, nil)
+	registry.Register(snapshots)
+
+	request, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://"+addr+"/metrics", nil)
+	require.NoError(t, err)
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	body, err := io.ReadAll(response.Body)
+	require.NoError(t, response.Body.Close())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, string(body), "db_snapshot_last_lsn 42\n")
+	assert.Contains(t, string(body), "db_snapshot_duration_seconds_count 1\n")
+
+	require.NoError(t, stop(t.Context()))
+	_, err = http.DefaultClient.Do(request)
+	require.Error(t, err)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/OutOfStack/db/internal/compute"
+	"github.com/OutOfStack/db/internal/engine/tiered"
+	"github.com/OutOfStack/db/internal/metrics"
+	"github.com/OutOfStack/db/internal/network"
+	"github.com/OutOfStack/db/internal/storage"
+	"github.com/OutOfStack/db/internal/wal"
+)
+
+// metricsReadHeaderTimeout bounds how long a scraper may take to send its request headers.
+const metricsReadHeaderTimeout = 5 * time.Second
+
+// snapshotMetrics times the snapshots the snapshot loop writes.
+type snapshotMetrics struct {
+	duration *metrics.Histogram
+	failures metrics.Counter
+	lastLSN  atomic.Uint64
+	lastTime atomic.Int64 // Unix seconds, 0 before the first snapshot
+}
+
+func newSnapshotMetrics() *snapshotMetrics {
+	return &snapshotMetrics{duration: metrics.NewHistogram(metrics.LatencyBuckets())}
+}
+
+// observe records one snapshot attempt that started at start.
+func (m *snapshotMetrics) observe(start time.Time, lsn uint64, err error) {
+	if err != nil {
+		m.failures.Inc()
+		return
+	}
+	m.duration.ObserveSince(start)
+	m.lastLSN.Store(lsn)
+	m.lastTime.Store(time.Now().Unix())
+}
+
+// Collect reports how long snapshots take, how many failed, and the latest one.
+func (m *snapshotMetrics) Collect(enc *metrics.Encoder) {
+	enc.Histogram("db_snapshot_duration_seconds", "Time to write a snapshot.", m.duration)
+	enc.Counter("db_snapshot_failures_total", "Snapshots that failed to write.", float64(m.failures.Value()))
+	enc.Gauge("db_snapshot_last_lsn", "LSN of the latest snapshot written since start.", float64(m.lastLSN.Load()))
+	enc.Gauge("db_snapshot_last_timestamp_seconds", "Unix time of the latest snapshot written since start.",
+		float64(m.lastTime.Load()))
+}
+
+// registerMetrics adds the collectors of this server to registry: each subsystem reports its own metrics.
+func registerMetrics(
+	registry *metrics.Registry,
+	comp *compute.Compute,
+	srv *network.TCPServer,
+	dbEngine storage.Engine,
+	walWriter *wal.Writer,
+	repl *replicationRuntime,
+	snapshots *snapshotMetrics,
+) {
+	registry.Register(comp, srv)
+	if walWriter != nil {
+		registry.Register(walWriter)
+	}
+	if snapshots != nil {
+		registry.Register(snapshots)
+	}
+	if tieredEngine, ok := dbEngine.(*tiered.Engine); ok {
+		registry.Register(tieredEngine)
+	}
+	if repl != nil {
+		registry.Register(repl.admin)
+	}
+}
+
+// startMetricsServer serves registry at /metrics on address. The returned function stops it.
+func startMetricsServer(
+	address string,
+	logger *slog.Logger,
+	registry *metrics.Registry,
+) (func(context.Context) error, error) {
+	lc := net.ListenConfig{}
+	listener, err := lc.Listen(context.Background(), "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("start metrics listener: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", registry)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: metricsReadHeaderTimeout}
+	go func() {
+		if serveErr := server.Serve(listener); serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+			logger.Error("Metrics server stopped", "error", serveErr)
+		}
+	}()
+	logger.Info("Metrics server started", "address", listener.Addr().String())
+	return server.Shutdown, nil
+}
@@ -8,6 +8,9 @@ import (
 	"sync"
 
 	"github.com/OutOfStack/db/internal/config"
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/info"
+	"github.com/OutOfStack/db/internal/metrics"
 	"github.com/OutOfStack/db/internal/protocol"
 	"github.com/OutOfStack/db/internal/replication"
 	"github.com/OutOfStack/db/internal/storage"
@@ -24,40 +27,51 @@ type replicationRuntime struct {
 }
 
 // setupReplication builds the replication runtime for the configured role. It returns nil for a standalone server.
-// Replication requires the WAL, which the config validation guarantees is enabled for master/standby roles.
+// Replication requires the WAL, which the config validation guarantees is kept for master/standby roles: the one
+// wal.enabled turns on, or the replication log of the tiered engine.
 func setupReplication(
 	cfg *config.ServerConfig,
 	logger *slog.Logger,
 	store *storage.Storage,
 	writer *wal.Writer,
 ) (*replicationRuntime, error) {
+	dir := logDir(cfg)
+	// the tiered engine keeps no snapshots: a standby the log no longer covers gets its segment files
+	var masterOptions []replication.MasterOption
+	if cfg.Engine.Type == engine.TypeTiered {
+		masterOptions = append(masterOptions, replication.WithSegmentSource(store))
+	}
+
 	switch cfg.Replication.Role {
 	case config.RoleStandalone:
 		return nil, nil //nolint:nilnil // standalone has no replication runtime
 	case config.RoleMaster:
-		master, err := replication.NewMaster(cfg.Replication.ListenAddress, writer, cfg.WAL.DataDir, logger)
+		master, err := replication.NewMaster(cfg.Replication.ListenAddress, writer, dir, logger, masterOptions...)
 		if err != nil {
 			return nil, err
 		}
 		logger.Info("Replication master listening", "address", master.Addr().String())
 		return &replicationRuntime{
 			master: master,
-			admin:  &replicationAdmin{store: store, writer: writer, logger: logger, role: config.RoleMaster},
+			admin: &replicationAdmin{
+				store: store, writer: writer, master: master, logger: logger, role: config.RoleMaster,
+			},
 		}, nil
 	case config.RoleStandby:
 		standby := replication.NewStandby(
-			cfg.Replication.MasterAddress, store, cfg.WAL.DataDir,
+			cfg.Replication.MasterAddress, store, dir,
 			writer.LastLSN(), cfg.Replication.ReconnectBackoff, logger)
 		return &replicationRuntime{
 			standby: standby,
 			admin: &replicationAdmin{
-				store:      store,
-				writer:     writer,
-				standby:    standby,
-				logger:     logger,
-				dir:        cfg.WAL.DataDir,
-				listenAddr: cfg.Replication.ListenAddress,
-				role:       config.RoleStandby,
+				store:         store,
+				writer:        writer,
+				standby:       standby,
+				logger:        logger,
+				dir:           dir,
+				listenAddr:    cfg.Replication.ListenAddress,
+				masterOptions: masterOptions,
+				role:          config.RoleStandby,
 			},
 		}, nil
 	default:
@@ -113,9 +127,12 @@ type replicationAdmin struct {
 	store      *storage.Storage
 	writer     *wal.Writer
 	standby    *replication.Standby // nil when started as master
+	master     *replication.Master  // nil when started as standby
 	logger     *slog.Logger
 	dir        string
 	listenAddr string // when set, promotion serves replication here
+	// masterOptions configure the master started on promotion
+	masterOptions []replication.MasterOption
 
 	mu             sync.Mutex
 	role           string
@@ -151,7 +168,7 @@ func (a *replicationAdmin) Promote(_ context.Context) (protocol.Reply, error) {
 
 // startMasterLocked starts a replication listener for the promoted node. The caller holds a.mu.
 func (a *replicationAdmin) startMasterLocked() error {
-	master, err := replication.NewMaster(a.listenAddr, a.writer, a.dir, a.logger)
+	master, err := replication.NewMaster(a.listenAddr, a.writer, a.dir, a.logger, a.masterOptions...)
 	if err != nil {
 		return err
 	}
@@ -199,3 +216,58 @@ func (a *replicationAdmin) Status(_ context.Context) (protocol.Reply, error) {
 	}
 	return protocol.BulkStringArray(values), nil
 }
+
+// Info reports the replication section of INFO: the role, how far this node is, whether writes are refused, and on a
+// master the standbys streaming from it, or on a standby when the master committed the last record it applied, its lag
+// and whether it reaches the master.
+func (a *replicationAdmin) Info(_ context.Context) info.Section {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	section := info.Section{Name: "replication"}
+	section.Add("role", roleName(a.role))
+	section.Add("read_only", a.store.ReadOnly())
+	if a.role == config.RoleStandby && a.standby != nil {
+		section.Add("applied_lsn", a.standby.AppliedLSN())
+		section.Add("applied_time", a.standby.AppliedTime())
+		section.Add("lag", a.standby.Lag())
+		section.Add("master_link_up", a.standby.Connected())
+		return section
+	}
+	section.Add("applied_lsn", a.writer.LastLSN())
+	section.Add("connected_standbys", a.connectedStandbysLocked())
+	return section
+}
+
+// Collect reports the figures of Info as metrics.
+func (a *replicationAdmin) Collect(enc *metrics.Encoder) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.role == config.RoleStandby && a.standby != nil {
+		enc.Gauge("db_replication_applied_lsn", "Highest LSN this node holds.", float64(a.standby.AppliedLSN()))
+		enc.Gauge("db_replication_lag", "LSNs this standby trails its master by.", float64(a.standby.Lag()))
+		linkUp := 0.0
+		if a.standby.Connected() {
+			linkUp = 1
+		}
+		enc.Gauge("db_replication_master_link_up", "Whether this standby has a live stream from its master.", linkUp)
+		return
+	}
+	enc.Gauge("db_replication_applied_lsn", "Highest LSN this node holds.", float64(a.writer.LastLSN()))
+	enc.Gauge("db_replication_connected_standbys", "Standbys streaming from this master.",
+		float64(a.connectedStandbysLocked()))
+}
+
+// connectedStandbysLocked returns how many standbys stream from this node, as the master it started as or was promoted
+// to. The caller holds a.mu.
+func (a *replicationAdmin) connectedStandbysLocked() int {
+	master := a.master
+	if a.promoted != nil {
+		master = a.promoted
+	}
+	if master == nil {
+		return 0
+	}
+	return master.Standbys()
+}
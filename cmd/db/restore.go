@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/OutOfStack/db/internal/config"
+	"github.com/OutOfStack/db/internal/datadir"
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/storage"
+	"github.com/OutOfStack/db/internal/wal"
+)
+
+// restoreTarget is the point a restore replays the WAL archive to: an LSN, or an RFC 3339 time that stands for the last
+// record committed at or before it. Only one of the two is set. from is the archive to read, wal.archive_dir when it is
+// empty.
+type restoreTarget struct {
+	lsn  uint64
+	time string
+	from string
+}
+
+func (t restoreTarget) set() bool {
+	return t.lsn > 0 || t.time != ""
+}
+
+// restore rebuilds the data directory of cfg from the WAL archive, as it was at target, and returns without starting
+// the server. The directory must hold no database files: the restored state is written as one snapshot, which the next
+// start recovers from like any other.
+//
+// The restored server's WAL continues from the target, so its LSNs after the target repeat ones the archive already
+// holds for the old history. A restore is refused when wal.archive_dir holds anything past the target: the old archive
+// is then read from target.from, and the restored server archives into the fresh directory wal.archive_dir names.
+func restore(cfg *config.ServerConfig, logger *slog.Logger, target restoreTarget) (err error) {
+	if cfg.Engine.Type != engine.TypeInMemory || !cfg.WAL.Enabled {
+		return errors.New("restore needs the in_memory engine with wal enabled")
+	}
+	if cfg.WAL.ArchiveDir == "" {
+		return errors.New("restore needs wal.archive_dir")
+	}
+	from := target.from
+	if from == "" {
+		from = cfg.WAL.ArchiveDir
+	}
+	dir := cfg.WAL.DataDir
+	lock, err := datadir.Acquire(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, lock.Close()) }()
+	kind, err := datadir.Detect(dir)
+	if err != nil {
+		return err
+	}
+	if kind != datadir.KindNone {
+		return fmt.Errorf("refusing to restore over existing %s database files in %q", kind, dir)
+	}
+
+	targetLSN := target.lsn
+	if target.time != "" {
+		at, parseErr := time.Parse(time.RFC3339Nano, target.time)
+		if parseErr != nil {
+			return fmt.Errorf("invalid -restore-to-time %q: want an RFC 3339 time", target.time)
+		}
+		if targetLSN, err = wal.ArchiveLSNAt(from, at); err != nil {
+			return err
+		}
+		logger.Info("Restore time resolved", "time", at, "lsn", targetLSN)
+	}
+	if err = checkArchiveDir(cfg.WAL.ArchiveDir, targetLSN); err != nil {
+		return fmt.Errorf("%w; set wal.archive_dir to a new directory and read this one with -restore-from", err)
+	}
+
+	ctx := context.Background()
+	dbEngine := engine.New()
+	snapshotLSN, lastLSN, err := wal.ReplayArchive(from, targetLSN,
+		func(table, key, value string) error {
+			dbEngine.Load(ctx, []engine.Entry{{Table: table, Key: key, Value: value}})
+			return nil
+		},
+		func(record wal.Record) error {
+			return storage.ApplyReplay(ctx, dbEngine, record.Command, record.Args)
+		})
+	if err != nil {
+		return fmt.Errorf("replay WAL archive: %w", err)
+	}
+	if lastLSN < targetLSN {
+		return fmt.Errorf("WAL archive ends at LSN %d, before the target LSN %d", lastLSN, targetLSN)
+	}
+	if err = wal.WriteSnapshot(ctx, dir, lastLSN, dbEngine, snapshotOptions(cfg)...); err != nil {
+		return fmt.Errorf("write restored snapshot: %w", err)
+	}
+	logger.Info("Data directory restored from WAL archive", "dir", dir, "archive_snapshot_lsn", snapshotLSN,
+		"lsn", lastLSN)
+	return nil
+}
+
+// checkArchiveDir refuses an archive directory that holds records past lastLSN, the end of the log a server is about to
+// archive into it: they belong to another history, which the server's segments would overwrite.
+func checkArchiveDir(dir string, lastLSN uint64) error {
+	if dir == "" {
+		return nil
+	}
+	archived, err := wal.ArchiveLastLSN(dir)
+	if err != nil {
+		return fmt.Errorf("read WAL archive: %w", err)
+	}
+	if archived > lastLSN {
+		return fmt.Errorf("WAL archive %q holds records up to LSN %d, past LSN %d where this log ends", dir, archived,
+			lastLSN)
+	}
+	return nil
+}
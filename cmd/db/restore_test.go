@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/OutOfStack/db/internal/config"
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/storage"
+	"github.com/OutOfStack/db/internal/wal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRestoreToLSN verifies a server archiving its WAL can be rebuilt in a fresh data directory as it was at an LSN, or
+// at a time, between two snapshots, and that a restore refuses targets the archive cannot reach, a directory in use, and
+// an archive directory that would mix the old history with the restored one.
+func TestRestoreToLSN(t *testing.T) {
+	t.Parallel()
+	cfg := config.DefaultServerConfig()
+	cfg.WAL.Enabled = true
+	cfg.WAL.DataDir = t.TempDir()
+	cfg.WAL.Sync = wal.SyncAlways
+	cfg.WAL.ArchiveDir = t.TempDir()
+	cfg.WAL.ArchiveCompress = true
+	logger := slog.New(slog.DiscardHandler)
+
+	dbEngine, writer, _, err := recoverPersistence(cfg, logger)
+	require.NoError(t, err)
+	store := storage.New(dbEngine, storage.WithWAL(writer))
+	start := time.Now()
+	var afterThird time.Time
+	for _, command := range [][]string{
+		{"SET", "users", "a", "one"},
+		{"SET", "users", "b", "two"},
+		{"snapshot"},
+		{"SET", "users", "a", "three"},
+		{"DEL", "users", "b"},
+		{"snapshot"},
+	} {
+		if command[0] == "snapshot" {
+			_, err = createSnapshot(t.Context(), cfg.WAL.DataDir, archiveConfig(cfg), store)
+		} else {
+			_, err = store.Execute(t.Context(), command[0], command[1:])
+		}
+		require.NoError(t, err)
+		if writer.LastLSN() == 3 && afterThird.IsZero() {
+			afterThird = time.Now()
+		}
+	}
+	require.NoError(t, writer.Close())
+
+	// LSN 3, given as an LSN or as a time between its commit and the next record's
+	reused := *cfg
+	reused.WAL.DataDir = t.TempDir()
+	require.ErrorContains(t, restore(&reused, logger, restoreTarget{lsn: 3}), "holds records up to LSN 4, past LSN 3")
+	for _, target := range []restoreTarget{{lsn: 3}, {time: afterThird.Format(time.RFC3339Nano)}} {
+		target.from = cfg.WAL.ArchiveDir
+		restored := *cfg
+		restored.WAL.DataDir = t.TempDir()
+		restored.WAL.ArchiveDir = t.TempDir()
+		require.NoError(t, restore(&restored, logger, target))
+		recovered, recoveredWriter, snapshotLSN, recoverErr := recoverPersistence(&restored, logger)
+		require.NoError(t, recoverErr)
+		assert.Equal(t, uint64(3), snapshotLSN)
+		assert.Equal(t, uint64(3), recoveredWriter.LastLSN())
+		value, getErr := recovered.Get(t.Context(), "users", "a")
+		require.NoError(t, getErr)
+		assert.Equal(t, "three", stored(value))
+		value, getErr = recovered.Get(t.Context(), "users", "b")
+		require.NoError(t, getErr)
+		assert.Equal(t, "two", stored(value))
+		require.NoError(t, recoveredWriter.Close())
+
+		require.ErrorContains(t, restore(&restored, logger, restoreTarget{lsn: 1, from: cfg.WAL.ArchiveDir}),
+			"refusing to restore over")
+
+		// the restored log ends at LSN 3, so starting it on the old archive would overwrite LSN 4 there
+		restored.WAL.ArchiveDir = cfg.WAL.ArchiveDir
+		_, _, _, recoverErr = recoverPersistence(&restored, logger)
+		require.ErrorContains(t, recoverErr, "it holds another history")
+	}
+	beyond := *cfg
+	beyond.WAL.DataDir = t.TempDir()
+	require.ErrorContains(t, restore(&beyond, logger, restoreTarget{lsn: 9}), "archive ends at LSN 4")
+	require.ErrorContains(t, restore(&beyond, logger, restoreTarget{time: "yesterday"}), "RFC 3339")
+	require.ErrorContains(t, restore(&beyond, logger, restoreTarget{time: start.Add(-time.Hour).Format(time.RFC3339)}),
+		"no archived WAL record")
+
+	// restoring to the archive's last LSN gives the state the server stopped with
+	latest := *cfg
+	latest.WAL.DataDir = t.TempDir()
+	require.NoError(t, restore(&latest, logger, restoreTarget{lsn: 4}))
+	recovered, latestWriter, _, err := recoverPersistence(&latest, logger)
+	require.NoError(t, err)
+	defer func() { _ = latestWriter.Close() }()
+	_, err = recovered.Get(t.Context(), "users", "b")
+	require.ErrorIs(t, err, engine.ErrNotFound)
+}
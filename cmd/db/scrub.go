@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/OutOfStack/db/internal/config"
+	"github.com/OutOfStack/db/internal/engine/tiered"
+	"github.com/OutOfStack/db/internal/scrub"
+	"github.com/OutOfStack/db/internal/storage"
+	"github.com/OutOfStack/db/internal/wal"
+)
+
+// scrubTarget adapts the verification of one kind of file to scrub.Target.
+type scrubTarget struct {
+	name       string
+	verify     func(ctx context.Context, throttle *scrub.Throttle) (int, []scrub.Corruption, error)
+	quarantine func(ctx context.Context, corruption scrub.Corruption) (string, error)
+}
+
+func (t scrubTarget) Name() string { return t.name }
+
+func (t scrubTarget) Verify(ctx context.Context, throttle *scrub.Throttle) (int, []scrub.Corruption, error) {
+	return t.verify(ctx, throttle)
+}
+
+func (t scrubTarget) Quarantine(ctx context.Context, corruption scrub.Corruption) (string, error) {
+	return t.quarantine(ctx, corruption)
+}
+
+// newScrubber builds the scrubber over the files this server keeps: the tiered engine's segments, and the WAL with its
+// snapshots when there is one. A replicated tiered engine's log is checked as a WAL; it has no snapshots.
+func newScrubber(
+	cfg *config.ServerConfig,
+	logger *slog.Logger,
+	dbEngine storage.Engine,
+	store *storage.Storage,
+	walWriter *wal.Writer,
+) *scrub.Scrubber {
+	var targets []scrub.Target
+	tieredEngine, isTiered := dbEngine.(*tiered.Engine)
+	if isTiered {
+		targets = append(targets, scrubTarget{
+			name:   "tiered",
+			verify: tieredEngine.Verify,
+			quarantine: func(_ context.Context, corruption scrub.Corruption) (string, error) {
+				return tieredEngine.Quarantine(corruption.File)
+			},
+		})
+	}
+	if walWriter == nil {
+		return scrub.New(logger, targets...)
+	}
+
+	dir := logDir(cfg)
+	// A WAL segment may only be set aside once the durable state holds all its records. The in-memory engine takes a
+	// snapshot to get there; the tiered engine's synced segments already are that state.
+	covered := func(ctx context.Context) (uint64, error) {
+		if isTiered {
+			return tieredEngine.SyncLSN()
+		}
+		return createSnapshot(ctx, dir, archiveConfig(cfg), store, snapshotOptions(cfg)...)
+	}
+	targets = append(targets, scrubTarget{
+		name: "wal",
+		verify: func(ctx context.Context, throttle *scrub.Throttle) (int, []scrub.Corruption, error) {
+			return wal.VerifySegments(ctx, dir, throttle)
+		},
+		quarantine: func(ctx context.Context, corruption scrub.Corruption) (string, error) {
+			lsn, err := covered(ctx)
+			if err != nil {
+				return "", err
+			}
+			return wal.QuarantineSegment(dir, corruption.File, lsn)
+		},
+	})
+	if !isTiered {
+		targets = append(targets, scrubTarget{
+			name: "snapshot",
+			verify: func(ctx context.Context, throttle *scrub.Throttle) (int, []scrub.Corruption, error) {
+				return wal.VerifySnapshots(ctx, dir, throttle)
+			},
+			quarantine: func(ctx context.Context, corruption scrub.Corruption) (string, error) {
+				return wal.QuarantineSnapshot(dir, corruption.File, func() error {
+					_, err := createSnapshot(ctx, dir, archiveConfig(cfg), store, snapshotOptions(cfg)...)
+					return err
+				})
+			},
+		})
+	}
+	return scrub.New(logger, targets...)
+}
+
+// startScrubLoop runs background scrub passes until ctx is done. A zero interval disables them; VERIFY still works.
+func startScrubLoop(ctx context.Context, cfg config.ServerScrubConfig, scrubber *scrub.Scrubber) <-chan struct{} {
+	done := make(chan struct{})
+	if cfg.Interval <= 0 {
+		close(done)
+		return done
+	}
+	go func() {
+		defer close(done)
+		scrubber.Run(ctx, cfg.Interval, cfg.RateMB<<20)
+	}()
+	return done
+}
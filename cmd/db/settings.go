@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/OutOfStack/db/internal/config"
+	"github.com/OutOfStack/db/internal/engine/tiered"
+	"github.com/OutOfStack/db/internal/network"
+	"github.com/OutOfStack/db/internal/storage"
+)
+
+// runtimeSettings serves CONFIG and the reload on SIGHUP. It holds the configuration in force and hands each change
+// of a runtime parameter (see config.RuntimeParams) to the subsystem it belongs to; every other setting keeps the value
+// the server started with.
+type runtimeSettings struct {
+	// path is the configuration file, empty when the server was started without one
+	path   string
+	logger *slog.Logger
+	level  *slog.LevelVar
+	srv    *network.TCPServer
+	tiered *tiered.Engine
+	// snapshotInterval hands a new wal.snapshot_interval to the snapshot loop
+	snapshotInterval chan time.Duration
+
+	mu  sync.Mutex
+	cfg config.ServerConfig
+}
+
+func newRuntimeSettings(
+	cfg *config.ServerConfig,
+	path string,
+	logger *slog.Logger,
+	level *slog.LevelVar,
+	srv *network.TCPServer,
+	dbEngine storage.Engine,
+) *runtimeSettings {
+	settings := &runtimeSettings{
+		path:             path,
+		logger:           logger,
+		level:            level,
+		srv:              srv,
+		snapshotInterval: make(chan time.Duration, 1),
+		cfg:              *cfg,
+	}
+	if tieredEngine, ok := dbEngine.(*tiered.Engine); ok {
+		settings.tiered = tieredEngine
+	}
+	return settings
+}
+
+// current returns the configuration in force.
+func (s *runtimeSettings) current() config.ServerConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+// Config returns the runtime parameters in force.
+func (s *runtimeSettings) Config() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	params := make(map[string]string)
+	for _, name := range config.RuntimeParams() {
+		params[name], _ = s.cfg.Param(name)
+	}
+	return params
+}
+
+// SetConfig applies a new value of a runtime parameter, if the configuration it makes passes ServerConfig.Validate.
+func (s *runtimeSettings) SetConfig(name, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next := s.cfg
+	if err := next.SetParam(name, value); err != nil {
+		return err
+	}
+	if err := next.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	s.apply(next)
+	return nil
+}
+
+// RewriteConfig writes the runtime parameters in force to the configuration file, so a restart keeps them.
+func (s *runtimeSettings) RewriteConfig() error {
+	if s.path == "" {
+		return errors.New("no config file to rewrite: the server was started without -config")
+	}
+	cfg := s.current()
+	if err := config.RewriteServerConfig(s.path, &cfg); err != nil {
+		return err
+	}
+	s.logger.Info("Config file rewritten", "path", s.path)
+	return nil
+}
+
+// reload reads the configuration file again, with the environment overrides, and applies the runtime parameters it
+// sets. A file that fails to load or validate changes nothing. Changes to any other setting need a restart: they are
+// logged and left alone.
+func (s *runtimeSettings) reload() error {
+	if s.path == "" {
+		return errors.New("no config file to reload: the server was started without -config")
+	}
+	loaded, err := config.LoadServerConfig(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	next, restart := s.cfg, *loaded
+	for _, name := range config.RuntimeParams() {
+		value, _ := loaded.Param(name)
+		current, _ := s.cfg.Param(name)
+		if err = errors.Join(next.SetParam(name, value), restart.SetParam(name, current)); err != nil {
+			return err
+		}
+	}
+	if err = next.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if !reflect.DeepEqual(restart, s.cfg) {
+		s.logger.Warn("Config file changes settings that need a restart; they were not applied", "path", s.path)
+	}
+	s.apply(next)
+	return nil
+}
+
+// apply makes next the configuration in force. The caller holds s.mu.
+func (s *runtimeSettings) apply(next config.ServerConfig) {
+	for _, name := range config.RuntimeParams() {
+		old, _ := s.cfg.Param(name)
+		value, _ := next.Param(name)
+		if value != old {
+			s.logger.Info("Config parameter changed", "param", name, "old", old, "new", value)
+		}
+	}
+	s.level.Set(logLevel(next.Logging.Level))
+	s.srv.SetMaxConnections(next.Network.MaxConnections)
+	s.srv.SetIdleTimeout(next.Network.IdleTimeout)
+	if s.tiered != nil {
+		s.tiered.SetCompactionThreshold(next.Engine.CompactionThreshold)
+	}
+	if next.WAL.SnapshotInterval != s.cfg.WAL.SnapshotInterval {
+		// only apply sends, under s.mu, so after taking a value the loop has not read yet there is room for the new one
+		select {
+		case <-s.snapshotInterval:
+		default:
+		}
+		s.snapshotInterval <- next.WAL.SnapshotInterval
+	}
+	s.cfg = next
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/OutOfStack/db/internal/config"
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/network"
+	"github.com/stretchr/testify/require"
+)
+
+const settingsTestConfig = `# kept across CONFIG REWRITE
+network:
+  address: "127.0.0.1:3223" # the client port
+  max_connections: 10
+logging:
+  level: info
+`
+
+// TestRuntimeSettings verifies CONFIG SET validates and applies a runtime parameter, CONFIG REWRITE writes the values in
+// force into the file without losing the rest of it, and a reload applies the runtime parameters the file changes and
+// nothing else.
+func TestRuntimeSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(settingsTestConfig), 0o600))
+	cfg, err := config.LoadServerConfig(path)
+	require.NoError(t, err)
+	logger := slog.New(slog.DiscardHandler)
+	srv, err := network.NewTCPServer("127.0.0.1:0", logger)
+	require.NoError(t, err)
+	serveDone := make(chan error, 1)
+	go func() { serveDone <- srv.Serve(requestHandler(nil)) }()
+	defer func() {
+		require.NoError(t, srv.Shutdown(t.Context()))
+		require.NoError(t, <-serveDone)
+	}()
+	level := new(slog.LevelVar)
+	settings := newRuntimeSettings(cfg, path, logger, level, srv, engine.New())
+	maxClients := func() string {
+		for _, field := range srv.Info(t.Context()).Fields {
+			if field.Name == "max_clients" {
+				return field.Value
+			}
+		}
+		return ""
+	}
+
+	require.ErrorContains(t, settings.SetConfig(config.ParamMaxConnections, "0"), "maxConnections must be positive")
+	require.ErrorContains(t, settings.SetConfig(config.ParamLogLevel, "loud"), "unsupported logging level")
+	require.Error(t, settings.SetConfig("network.address", "127.0.0.1:4000"))
+	require.Equal(t, "10", settings.Config()[config.ParamMaxConnections])
+
+	require.NoError(t, settings.SetConfig(config.ParamLogLevel, "DEBUG"))
+	require.Equal(t, slog.LevelDebug, level.Level())
+	require.NoError(t, settings.SetConfig(config.ParamMaxConnections, "20"))
+	require.Equal(t, "20", maxClients())
+	require.NoError(t, settings.SetConfig(config.ParamSnapshotInterval, "30s"))
+	require.Equal(t, 30*time.Second, <-settings.snapshotInterval)
+
+	require.NoError(t, settings.RewriteConfig())
+	rewritten, err := config.LoadServerConfig(path)
+	require.NoError(t, err)
+	require.Equal(t, "debug", rewritten.Logging.Level)
+	require.Equal(t, 20, rewritten.Network.MaxConnections)
+	require.Equal(t, 30*time.Second, rewritten.WAL.SnapshotInterval)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "# kept across CONFIG REWRITE")
+	require.Contains(t, string(data), `address: "127.0.0.1:3223" # the client port`)
+
+	// the address needs a restart, so only the connection limit and the log level change
+	edited := "network:\n  address: 127.0.0.1:4000\n  max_connections: 5\nlogging:\n  level: warn\n"
+	require.NoError(t, os.WriteFile(path, []byte(edited), 0o600))
+	require.NoError(t, settings.reload())
+	require.Equal(t, "5", maxClients())
+	require.Equal(t, slog.LevelWarn, level.Level())
+	require.Equal(t, "127.0.0.1:3223", settings.current().Network.Address)
+
+	require.NoError(t, os.WriteFile(path, []byte("network:\n  max_connections: -1\n"), 0o600))
+	require.Error(t, settings.reload())
+	require.Equal(t, "5", settings.Config()[config.ParamMaxConnections])
+
+	require.ErrorContains(t, newRuntimeSettings(cfg, "", logger, level, srv, engine.New()).RewriteConfig(),
+		"without -config")
+}
@@ -0,0 +1,59 @@
+// Package clientopts maps the client configuration file the command-line tools share to client library options.
+package clientopts
+
+import (
+	"github.com/OutOfStack/db/client"
+	"github.com/OutOfStack/db/internal/config"
+	"github.com/OutOfStack/db/internal/pool"
+)
+
+// FromConfig maps a loaded client configuration to client options
+func FromConfig(cfg *config.ClientConfig) []client.Option {
+	opts := []client.Option{
+		client.WithIdleTimeout(cfg.Network.IdleTimeout),
+		client.WithMaxMessageSize(cfg.Network.MaxMessageSizeKB),
+		client.WithName(cfg.Network.Name),
+	}
+
+	switch {
+	case cfg.Sharding.Enabled:
+		groups := make([]client.ShardGroup, 0, len(cfg.Sharding.Groups))
+		for _, g := range cfg.Sharding.Groups {
+			groups = append(groups, client.ShardGroup{Name: g.Name, Servers: toServers(g.Servers)})
+		}
+		opts = append(opts,
+			client.WithShards(groups...),
+			client.WithShardBy(client.ShardKey(cfg.Sharding.By)),
+			client.WithVirtualNodes(cfg.Sharding.VirtualNodes),
+		)
+	case cfg.Pool.Enabled:
+		opts = append(opts, client.WithServers(toServers(cfg.Pool.Servers)...))
+	default:
+		return append(opts, client.WithAddress(cfg.Network.Address))
+	}
+
+	// the pool settings apply to the pool, or to every shard group's pool
+	return append(opts,
+		client.WithStrategy(client.Strategy(cfg.Pool.SelectionStrategy)),
+		client.WithZone(cfg.Pool.Zone),
+		client.WithRetries(cfg.Pool.MaxRetries, cfg.Pool.RetryDelay),
+		client.WithFailureTimeout(cfg.Pool.FailureTimeout),
+		client.WithFailureThreshold(cfg.Pool.FailureThreshold),
+		client.WithHealthCheck(cfg.Pool.HealthCheckInterval, cfg.Pool.HealthCheckTimeout),
+		client.WithHedging(cfg.Pool.HedgeDelay, cfg.Pool.HedgePercentile),
+	)
+}
+
+// toServers maps configured pool servers to client servers
+func toServers(configured []pool.ServerConfig) []client.Server {
+	servers := make([]client.Server, 0, len(configured))
+	for _, s := range configured {
+		servers = append(servers, client.Server{
+			Address: s.Address,
+			Role:    client.Role(s.Role),
+			Weight:  s.Weight,
+			Zone:    s.Zone,
+		})
+	}
+	return servers
+}
@@ -0,0 +1,87 @@
+package compute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OutOfStack/db/internal/protocol"
+)
+
+const clientUsage = "usage: CLIENT LIST | CLIENT SETNAME <name> | CLIENT KILL <id|addr> | " +
+	"CLIENT PAUSE <ms> [WRITE|ALL] | CLIENT UNPAUSE"
+
+// client runs CLIENT LIST, SETNAME, KILL, PAUSE and UNPAUSE.
+func (c *Compute) client(ctx context.Context, args []string) (protocol.Reply, error) {
+	sub := strings.ToUpper(args[0])
+	args = args[1:]
+	if c.clients == nil {
+		return protocol.Reply{}, errors.New("client commands not enabled")
+	}
+	switch {
+	case sub == "LIST" && len(args) == 0:
+		return protocol.BulkString(clientList(c.clients)), nil
+	case sub == "SETNAME" && len(args) == 1:
+		if err := c.clients.SetClientName(ctx, args[0]); err != nil {
+			return protocol.Reply{}, err
+		}
+		return protocol.SimpleString("OK"), nil
+	case sub == "KILL" && len(args) == 1:
+		var killed bool
+		if id, err := strconv.ParseUint(args[0], 10, 64); err == nil {
+			killed = c.clients.KillClient(id)
+		} else {
+			killed = c.clients.KillClientAddr(args[0])
+		}
+		if !killed {
+			return protocol.Reply{}, errors.New("no such client")
+		}
+		return protocol.SimpleString("OK"), nil
+	case sub == "PAUSE" && len(args) >= 1:
+		duration, writesOnly, err := pauseArgs(args)
+		if err != nil {
+			return protocol.Reply{}, err
+		}
+		c.clients.PauseClients(duration, writesOnly)
+		return protocol.SimpleString("OK"), nil
+	case sub == "UNPAUSE" && len(args) == 0:
+		c.clients.UnpauseClients()
+		return protocol.SimpleString("OK"), nil
+	default:
+		return protocol.Reply{}, errors.New(clientUsage)
+	}
+}
+
+// clientList renders one line per connection, with fields named as in Redis' CLIENT LIST. Times are whole seconds.
+func clientList(clients Clients) string {
+	var b strings.Builder
+	for _, client := range clients.Clients() {
+		fmt.Fprintf(&b, "id=%d addr=%s name=%s age=%d idle=%d cmd=%s tot-net-in=%d tot-net-out=%d\n",
+			client.ID, client.Addr, client.Name, int64(client.Age.Seconds()), int64(client.Idle.Seconds()),
+			strings.ToLower(client.Command), client.BytesIn, client.BytesOut)
+	}
+	return b.String()
+}
+
+// pauseArgs parses the <ms> [WRITE|ALL] of CLIENT PAUSE.
+func pauseArgs(args []string) (time.Duration, bool, error) {
+	ms, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || ms < 0 || ms > math.MaxInt64/int64(time.Millisecond) {
+		return 0, false, errors.New("CLIENT PAUSE timeout must be a non-negative number of milliseconds")
+	}
+	writesOnly := false
+	if len(args) == 2 {
+		switch strings.ToUpper(args[1]) {
+		case "WRITE":
+			writesOnly = true
+		case "ALL":
+		default:
+			return 0, false, errors.New(clientUsage)
+		}
+	}
+	return time.Duration(ms) * time.Millisecond, writesOnly, nil
+}
@@ -5,7 +5,10 @@ import (
 	"errors"
 	"log/slog"
 	"strings"
+	"time"
 
+	"github.com/OutOfStack/db/internal/info"
+	"github.com/OutOfStack/db/internal/network"
 	"github.com/OutOfStack/db/internal/protocol"
 	"github.com/OutOfStack/db/internal/storage"
 )
@@ -26,13 +29,67 @@ type Admin interface {
 	Status(ctx context.Context) (protocol.Reply, error)
 }
 
+// Migrator moves keys to another server for MIGRATE, a single key in the request or a whole table in the background,
+// and reports the background migrations for MIGRATION STATUS.
+type Migrator interface {
+	MigrateKey(ctx context.Context, target, table, key string) (protocol.Reply, error)
+	MigrateTable(ctx context.Context, target, table string) (protocol.Reply, error)
+	Status(ctx context.Context) (protocol.Reply, error)
+}
+
+// Verifier checks the files the server keeps on disk for VERIFY: one kind of file when target names it (tiered, wal
+// or snapshot), every kind when it is empty, moving damaged files aside when quarantine is set.
+type Verifier interface {
+	Verify(ctx context.Context, target string, quarantine bool) (protocol.Reply, error)
+}
+
+// Compactor starts a manual compaction of the storage engine's segments for COMPACT, of every segment holding any
+// dead bytes when force is set.
+type Compactor interface {
+	Compact(ctx context.Context, force bool) (protocol.Reply, error)
+}
+
+// Checkpointer writes a consistent copy of the storage engine's files into a directory on the server for CHECKPOINT.
+type Checkpointer interface {
+	Checkpoint(ctx context.Context, dir string) (protocol.Reply, error)
+}
+
+// Clients lists and manages the server's client connections for CLIENT. SetClientName names the connection the request
+// in ctx came from.
+type Clients interface {
+	Clients() []network.ClientInfo
+	SetClientName(ctx context.Context, name string) error
+	KillClient(id uint64) bool
+	KillClientAddr(addr string) bool
+	PauseClients(duration time.Duration, writesOnly bool)
+	UnpauseClients()
+}
+
+// Configurer reads and changes, for CONFIG, the server settings that can change while it runs. Config returns each of
+// them by name; SetConfig checks and applies a new value; RewriteConfig writes the values in force to the server's
+// configuration file.
+type Configurer interface {
+	Config() map[string]string
+	SetConfig(name, value string) error
+	RewriteConfig() error
+}
+
 // Compute represents compute layer
 type Compute struct {
 	parser         Parser
 	storage        Storage
 	admin          Admin
+	migrator       Migrator
+	verifier       Verifier
+	compactor      Compactor
+	checkpointer   Checkpointer
+	clients        Clients
+	configurer     Configurer
+	info           []info.Provider
 	promoteEnabled bool
 	logger         *slog.Logger
+	metrics        *commandMetrics
+	slowLog        *slowLog
 }
 
 // Option configures a Compute.
@@ -43,6 +100,47 @@ func WithAdmin(admin Admin) Option {
 	return func(c *Compute) { c.admin = admin }
 }
 
+// WithMigrator wires the handler for MIGRATE and MIGRATION STATUS.
+func WithMigrator(migrator Migrator) Option {
+	return func(c *Compute) { c.migrator = migrator }
+}
+
+// WithVerifier wires the handler for VERIFY.
+func WithVerifier(verifier Verifier) Option {
+	return func(c *Compute) { c.verifier = verifier }
+}
+
+// WithCompactor wires the handler for COMPACT.
+func WithCompactor(compactor Compactor) Option {
+	return func(c *Compute) { c.compactor = compactor }
+}
+
+// WithCheckpointer wires the handler for CHECKPOINT.
+func WithCheckpointer(checkpointer Checkpointer) Option {
+	return func(c *Compute) { c.checkpointer = checkpointer }
+}
+
+// WithClients wires the handler for CLIENT.
+func WithClients(clients Clients) Option {
+	return func(c *Compute) { c.clients = clients }
+}
+
+// WithConfigurer wires the handler for CONFIG.
+func WithConfigurer(configurer Configurer) Option {
+	return func(c *Compute) { c.configurer = configurer }
+}
+
+// WithInfo adds providers of INFO sections, reported in the order given.
+func WithInfo(providers ...info.Provider) Option {
+	return func(c *Compute) { c.info = append(c.info, providers...) }
+}
+
+// WithSlowLog keeps the latest maxLen commands that took threshold or longer for SLOWLOG; a maxLen of 0 keeps none.
+// Without it the log keeps DefaultSlowLogMaxLen commands of DefaultSlowLogThreshold or longer.
+func WithSlowLog(threshold time.Duration, maxLen int) Option {
+	return func(c *Compute) { c.slowLog = newSlowLog(threshold, maxLen) }
+}
+
 // WithPromoteEnabled permits PROMOTE when enabled is true. Off by default: promotion changes which node accepts
 // writes, so it has to be an explicit operator decision (replication.allow_remote_promote in the server config).
 func WithPromoteEnabled(enabled bool) Option {
@@ -51,26 +149,57 @@ func WithPromoteEnabled(enabled bool) Option {
 
 // New creates a new Compute with the given parser, storage, and logger
 func New(parser Parser, storage Storage, logger *slog.Logger, options ...Option) *Compute {
-	c := &Compute{parser: parser, storage: storage, logger: logger}
+	c := &Compute{
+		parser:  parser,
+		storage: storage,
+		logger:  logger,
+		metrics: newCommandMetrics(),
+		slowLog: newSlowLog(DefaultSlowLogThreshold, DefaultSlowLogMaxLen),
+	}
 	for _, option := range options {
 		option(c)
 	}
 	return c
 }
 
-// HandleRequest validates and executes a decoded request.
+// HandleRequest validates and executes a decoded request, counting it and its latency by command, and adds it to the
+// slow log when it took longer than the threshold.
 func (c *Compute) HandleRequest(ctx context.Context, cmd string, args []string) (protocol.Reply, error) {
+	start := time.Now()
 	cmd, args, err := c.parser.Parse(cmd, args)
 	if err != nil {
 		c.logger.Error("Parse error", "error", err)
+		c.observe(invalidCommand, time.Since(start), err)
 		return protocol.Reply{}, err
 	}
+	var timing storage.Timing
+	reply, err := c.execute(storage.WithTiming(ctx, &timing), cmd, args)
+	duration := time.Since(start)
+	c.observe(cmd, duration, err)
+	c.slowLog.record(start, duration, timing, network.ClientAddr(ctx), cmd, args)
+	return reply, err
+}
+
+// observe records a handled request. A key that was not found is an answer, not a failure.
+func (c *Compute) observe(cmd string, duration time.Duration, err error) {
+	stats := c.metrics.command(cmd)
+	stats.calls.Inc()
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		stats.errors.Inc()
+	}
+	stats.latency.Observe(duration.Seconds())
+}
 
+// execute runs a parsed request.
+func (c *Compute) execute(ctx context.Context, cmd string, args []string) (protocol.Reply, error) {
 	c.logger.Info("Parsed command", "cmd", cmd, "args", args)
 
 	if reply, handled, adminErr := c.handleAdmin(ctx, cmd, args); handled {
 		return reply, adminErr
 	}
+	if cmd == "PING" {
+		return pong(args), nil
+	}
 
 	result, err := c.storage.Execute(ctx, cmd, args)
 	if err != nil {
@@ -85,8 +214,17 @@ func (c *Compute) HandleRequest(ctx context.Context, cmd string, args []string)
 	return result, nil
 }
 
-// handleAdmin dispatches replication control commands. handled is true when cmd is such a command, in which case the
-// caller returns reply/err directly.
+// pong answers PING without touching storage, so a health probe measures the server's ability to serve a request and
+// nothing else. Like Redis, a bare PING replies PONG and PING <message> echoes the message.
+func pong(args []string) protocol.Reply {
+	if len(args) == 1 {
+		return protocol.BulkString(args[0])
+	}
+	return protocol.SimpleString("PONG")
+}
+
+// handleAdmin dispatches replication and migration control commands, and hands the rest to handleMaintenance. handled
+// is true when cmd is such a command, in which case the caller returns reply/err directly.
 func (c *Compute) handleAdmin(ctx context.Context, cmd string, args []string) (protocol.Reply, bool, error) {
 	switch cmd {
 	case "PROMOTE":
@@ -107,7 +245,95 @@ func (c *Compute) handleAdmin(ctx context.Context, cmd string, args []string) (p
 		}
 		reply, err := c.admin.Status(ctx)
 		return reply, true, err
+	case "MIGRATE":
+		if c.migrator == nil {
+			return protocol.Reply{}, true, errors.New("migration not enabled")
+		}
+		if len(args) == 3 {
+			reply, err := c.migrator.MigrateKey(ctx, args[0], args[1], args[2])
+			return reply, true, err
+		}
+		reply, err := c.migrator.MigrateTable(ctx, args[0], args[1])
+		return reply, true, err
+	case "MIGRATION":
+		if len(args) != 1 || !strings.EqualFold(args[0], "STATUS") {
+			return protocol.Reply{}, true, errors.New("usage: MIGRATION STATUS")
+		}
+		if c.migrator == nil {
+			return protocol.Reply{}, true, errors.New("migration not enabled")
+		}
+		reply, err := c.migrator.Status(ctx)
+		return reply, true, err
+	default:
+		return c.handleMaintenance(ctx, cmd, args)
+	}
+}
+
+// handleMaintenance dispatches the commands that look after this node's own files and report on it: VERIFY, COMPACT,
+// CHECKPOINT, INFO, SLOWLOG, CLIENT and CONFIG.
+func (c *Compute) handleMaintenance(ctx context.Context, cmd string, args []string) (protocol.Reply, bool, error) {
+	switch cmd {
+	case "VERIFY":
+		target, quarantine, err := verifyArgs(args)
+		if err != nil {
+			return protocol.Reply{}, true, err
+		}
+		if c.verifier == nil {
+			return protocol.Reply{}, true, errors.New("verification not enabled")
+		}
+		reply, err := c.verifier.Verify(ctx, target, quarantine)
+		return reply, true, err
+	case "COMPACT":
+		if len(args) == 1 && !strings.EqualFold(args[0], "FORCE") {
+			return protocol.Reply{}, true, errors.New("usage: COMPACT [FORCE]")
+		}
+		if c.compactor == nil {
+			return protocol.Reply{}, true, errors.New("compaction not enabled")
+		}
+		reply, err := c.compactor.Compact(ctx, len(args) == 1)
+		return reply, true, err
+	case "CHECKPOINT":
+		if c.checkpointer == nil {
+			return protocol.Reply{}, true, errors.New("checkpoint not enabled")
+		}
+		reply, err := c.checkpointer.Checkpoint(ctx, args[0])
+		return reply, true, err
+	case "INFO":
+		// like Redis, a section the server does not have is an empty reply rather than an error
+		var section string
+		if len(args) == 1 {
+			section = args[0]
+		}
+		return protocol.BulkString(info.Format(info.Collect(ctx, c.info, section))), true, nil
+	case "SLOWLOG":
+		reply, err := c.slowLog.command(args)
+		return reply, true, err
+	case "CLIENT":
+		reply, err := c.client(ctx, args)
+		return reply, true, err
+	case "CONFIG":
+		reply, err := c.config(args)
+		return reply, true, err
 	default:
 		return protocol.Reply{}, false, nil
 	}
 }
+
+// verifyArgs parses VERIFY [tiered|wal|snapshot] [QUARANTINE].
+func verifyArgs(args []string) (string, bool, error) {
+	var (
+		target     string
+		quarantine bool
+	)
+	for i, arg := range args {
+		switch arg = strings.ToLower(arg); {
+		case arg == "quarantine" && i == len(args)-1:
+			quarantine = true
+		case (arg == "tiered" || arg == "wal" || arg == "snapshot") && i == 0:
+			target = arg
+		default:
+			return "", false, errors.New("usage: VERIFY [tiered|wal|snapshot] [QUARANTINE]")
+		}
+	}
+	return target, quarantine, nil
+}
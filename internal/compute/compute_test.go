@@ -5,12 +5,18 @@ import (
 	"context"
 	"errors"
 	"log/slog"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/OutOfStack/db/internal/compute"
 	mocks "github.com/OutOfStack/db/internal/compute/mocks"
+	"github.com/OutOfStack/db/internal/info"
+	"github.com/OutOfStack/db/internal/metrics"
+	"github.com/OutOfStack/db/internal/network"
 	"github.com/OutOfStack/db/internal/parser"
 	"github.com/OutOfStack/db/internal/protocol"
+	"github.com/OutOfStack/db/internal/storage"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
@@ -170,3 +176,367 @@ func TestHandleRequest_PromoteRefusedByDefault(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, protocol.ReplyArray, res.Kind)
 }
+
+// TestHandleRequest_Ping verifies PING is answered by the compute layer itself: a health probe must not depend on, or
+// disturb, storage.
+func TestHandleRequest_Ping(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mocks.NewMockStorage(ctrl)
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	c := compute.New(parser.New(), mockStorage, logger)
+
+	res, err := c.HandleRequest(t.Context(), "PING", nil)
+	require.NoError(t, err)
+	require.Equal(t, protocol.SimpleString("PONG"), res)
+
+	res, err = c.HandleRequest(t.Context(), "ping", []string{"hello"})
+	require.NoError(t, err)
+	require.Equal(t, protocol.BulkString("hello"), res)
+}
+
+// TestHandleRequest_MigrateRouting verifies MIGRATE reaches the migrator, a single key when one is given and the whole
+// table otherwise, and never storage.
+func TestHandleRequest_MigrateRouting(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mocks.NewMockStorage(ctrl)
+	migrator := mocks.NewMockMigrator(ctrl)
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	c := compute.New(parser.New(), mockStorage, logger, compute.WithMigrator(migrator))
+	ctx := t.Context()
+
+	migrator.EXPECT().MigrateKey(gomock.Any(), "db2:3223", "users", "u1").Return(protocol.SimpleString("OK"), nil)
+	res, err := c.HandleRequest(ctx, "MIGRATE", []string{"db2:3223", "users", "u1"})
+	require.NoError(t, err)
+	require.Equal(t, "OK", res.Value)
+
+	migrator.EXPECT().MigrateTable(gomock.Any(), "db2:3223", "users").Return(protocol.SimpleString("OK"), nil)
+	_, err = c.HandleRequest(ctx, "migrate", []string{"db2:3223", "users"})
+	require.NoError(t, err)
+
+	migrator.EXPECT().Status(gomock.Any()).Return(protocol.BulkStringArray([]string{"table", "users"}), nil)
+	res, err = c.HandleRequest(ctx, "MIGRATION", []string{"status"})
+	require.NoError(t, err)
+	require.Equal(t, protocol.ReplyArray, res.Kind)
+
+	_, err = c.HandleRequest(ctx, "MIGRATION", []string{"START"})
+	require.Error(t, err)
+}
+
+// TestHandleRequest_VerifyRouting verifies VERIFY reaches the verifier with its target and quarantine flag parsed, and
+// that a malformed request is refused before it.
+func TestHandleRequest_VerifyRouting(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mocks.NewMockStorage(ctrl)
+	verifier := mocks.NewMockVerifier(ctrl)
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	c := compute.New(parser.New(), mockStorage, logger, compute.WithVerifier(verifier))
+	ctx := t.Context()
+
+	verifier.EXPECT().Verify(gomock.Any(), "", false).Return(protocol.BulkStringArray([]string{"ok"}), nil)
+	res, err := c.HandleRequest(ctx, "VERIFY", nil)
+	require.NoError(t, err)
+	require.Equal(t, protocol.ReplyArray, res.Kind)
+
+	verifier.EXPECT().Verify(gomock.Any(), "wal", true).Return(protocol.BulkStringArray([]string{"ok"}), nil)
+	_, err = c.HandleRequest(ctx, "verify", []string{"WAL", "quarantine"})
+	require.NoError(t, err)
+
+	verifier.EXPECT().Verify(gomock.Any(), "", true).Return(protocol.BulkStringArray([]string{"ok"}), nil)
+	_, err = c.HandleRequest(ctx, "VERIFY", []string{"QUARANTINE"})
+	require.NoError(t, err)
+
+	_, err = c.HandleRequest(ctx, "VERIFY", []string{"QUARANTINE", "wal"})
+	require.Error(t, err)
+	_, err = c.HandleRequest(ctx, "VERIFY", []string{"disks"})
+	require.Error(t, err)
+
+	_, err = compute.New(parser.New(), mockStorage, logger).HandleRequest(ctx, "VERIFY", nil)
+	require.ErrorContains(t, err, "verification not enabled")
+}
+
+// TestHandleRequest_CompactRouting verifies COMPACT reaches the compactor with FORCE parsed, and is refused without
+// one.
+func TestHandleRequest_CompactRouting(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mocks.NewMockStorage(ctrl)
+	compactor := mocks.NewMockCompactor(ctrl)
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	c := compute.New(parser.New(), mockStorage, logger, compute.WithCompactor(compactor))
+	ctx := t.Context()
+
+	compactor.EXPECT().Compact(gomock.Any(), false).Return(protocol.SimpleString("OK"), nil)
+	_, err := c.HandleRequest(ctx, "COMPACT", nil)
+	require.NoError(t, err)
+
+	compactor.EXPECT().Compact(gomock.Any(), true).Return(protocol.SimpleString("OK"), nil)
+	_, err = c.HandleRequest(ctx, "compact", []string{"Force"})
+	require.NoError(t, err)
+
+	_, err = c.HandleRequest(ctx, "COMPACT", []string{"now"})
+	require.ErrorContains(t, err, "usage")
+
+	_, err = compute.New(parser.New(), mockStorage, logger).HandleRequest(ctx, "COMPACT", nil)
+	require.ErrorContains(t, err, "compaction not enabled")
+}
+
+// TestHandleRequest_CheckpointRouting verifies CHECKPOINT reaches the checkpointer with its directory, and is refused
+// without one.
+func TestHandleRequest_CheckpointRouting(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mocks.NewMockStorage(ctrl)
+	checkpointer := mocks.NewMockCheckpointer(ctrl)
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	c := compute.New(parser.New(), mockStorage, logger, compute.WithCheckpointer(checkpointer))
+	ctx := t.Context()
+
+	checkpointer.EXPECT().Checkpoint(gomock.Any(), "/backups/db").Return(protocol.SimpleString("OK"), nil)
+	_, err := c.HandleRequest(ctx, "checkpoint", []string{"/backups/db"})
+	require.NoError(t, err)
+
+	_, err = c.HandleRequest(ctx, "CHECKPOINT", nil)
+	require.Error(t, err)
+
+	_, err = compute.New(parser.New(), mockStorage, logger).HandleRequest(ctx, "CHECKPOINT", []string{"/backups/db"})
+	require.ErrorContains(t, err, "checkpoint not enabled")
+}
+
+// TestHandleRequest_Info verifies INFO reports every provider's section, or the one asked for, without reaching
+// storage.
+func TestHandleRequest_Info(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mocks.NewMockStorage(ctrl)
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	provider := func(name, field string) info.Provider {
+		return info.ProviderFunc(func(context.Context) info.Section {
+			section := info.Section{Name: name}
+			section.Add(field, 1)
+			return section
+		})
+	}
+	c := compute.New(parser.New(), mockStorage, logger,
+		compute.WithInfo(provider("server", "uptime_in_seconds"), provider("keyspace", "keys")))
+	ctx := t.Context()
+
+	reply, err := c.HandleRequest(ctx, "INFO", nil)
+	require.NoError(t, err)
+	require.Equal(t, "# Server\r\nuptime_in_seconds:1\r\n\r\n# Keyspace\r\nkeys:1\r\n", reply.Value)
+
+	reply, err = c.HandleRequest(ctx, "info", []string{"KEYSPACE"})
+	require.NoError(t, err)
+	require.Equal(t, "# Keyspace\r\nkeys:1\r\n", reply.Value)
+
+	reply, err = c.HandleRequest(ctx, "INFO", []string{"tiered"})
+	require.NoError(t, err)
+	require.Empty(t, reply.Value)
+}
+
+// TestHandleRequest_Metrics verifies requests are counted by command, with a missing key not counted as an error and
+// requests the parser rejects counted under one label.
+func TestHandleRequest_Metrics(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mocks.NewMockStorage(ctrl)
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	c := compute.New(parser.New(), mockStorage, logger)
+	ctx := t.Context()
+
+	mockStorage.EXPECT().Execute(gomock.Any(), "GET", []string{"t", "k"}).Return(protocol.Reply{}, storage.ErrNotFound)
+	mockStorage.EXPECT().Execute(gomock.Any(), "SET", []string{"t", "k", "v"}).Return(protocol.Reply{}, errors.New("disk full"))
+	_, _ = c.HandleRequest(ctx, "GET", []string{"t", "k"})
+	_, _ = c.HandleRequest(ctx, "set", []string{"t", "k", "v"})
+	_, _ = c.HandleRequest(ctx, "BOGUS", nil)
+	_, _ = c.HandleRequest(ctx, "PING", nil)
+
+	registry := metrics.NewRegistry()
+	registry.Register(c)
+	var out strings.Builder
+	_, err := registry.WriteTo(&out)
+	require.NoError(t, err)
+	for _, line := range []string{
+		`db_commands_total{command="GET"} 1`,
+		`db_commands_total{command="SET"} 1`,
+		`db_commands_total{command="PING"} 1`,
+		`db_commands_total{command="invalid"} 1`,
+		`db_command_errors_total{command="GET"} 0`,
+		`db_command_errors_total{command="SET"} 1`,
+		`db_command_errors_total{command="invalid"} 1`,
+		`db_command_duration_seconds_count{command="GET"} 1`,
+	} {
+		require.Contains(t, out.String(), line+"\n")
+	}
+}
+
+// TestHandleRequest_SlowLog verifies SLOWLOG keeps the latest commands over the threshold, newest first, with the
+// client's address and long arguments cut short.
+func TestHandleRequest_SlowLog(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mocks.NewMockStorage(ctrl)
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	c := compute.New(parser.New(), mockStorage, logger, compute.WithSlowLog(10*time.Millisecond, 2))
+	ctx := network.WithClientAddr(t.Context(), "10.0.0.1:5000")
+
+	slow := func(context.Context, string, []string) (protocol.Reply, error) {
+		time.Sleep(15 * time.Millisecond)
+		return protocol.SimpleString("OK"), nil
+	}
+	long := strings.Repeat("x", 200)
+	mockStorage.EXPECT().Execute(gomock.Any(), "GET", gomock.Any()).Return(protocol.BulkString("v"), nil)
+	mockStorage.EXPECT().Execute(gomock.Any(), "SET", gomock.Any()).DoAndReturn(slow).Times(3)
+	for _, args := range [][]string{{"t", "k1", "v"}, {"t", "k2", "v"}, {"t", "k3", long}} {
+		_, err := c.HandleRequest(ctx, "SET", args)
+		require.NoError(t, err)
+	}
+	_, err := c.HandleRequest(ctx, "GET", []string{"t", "k1"})
+	require.NoError(t, err)
+
+	reply, err := c.HandleRequest(ctx, "SLOWLOG", []string{"LEN"})
+	require.NoError(t, err)
+	require.Equal(t, protocol.Integer(2), reply)
+
+	reply, err = c.HandleRequest(ctx, "slowlog", []string{"get"})
+	require.NoError(t, err)
+	require.Len(t, reply.Array, 2)
+	newest := reply.Array[0].Array
+	require.Len(t, newest, 8)
+	require.Equal(t, protocol.Integer(2), newest[0])
+	require.GreaterOrEqual(t, newest[2].Integer, int64(10000))
+	require.Equal(t, protocol.BulkStringArray([]string{"SET", "t", "k3", long[:128] + "... (72 more bytes)"}), newest[3])
+	require.Equal(t, protocol.BulkString("10.0.0.1:5000"), newest[4])
+	require.Equal(t, protocol.Integer(1), reply.Array[1].Array[0])
+
+	reply, err = c.HandleRequest(ctx, "SLOWLOG", []string{"GET", "1"})
+	require.NoError(t, err)
+	require.Len(t, reply.Array, 1)
+
+	_, err = c.HandleRequest(ctx, "SLOWLOG", []string{"GET", "many"})
+	require.Error(t, err)
+
+	reply, err = c.HandleRequest(ctx, "SLOWLOG", []string{"RESET"})
+	require.NoError(t, err)
+	require.Equal(t, protocol.SimpleString("OK"), reply)
+	reply, err = c.HandleRequest(ctx, "SLOWLOG", []string{"LEN"})
+	require.NoError(t, err)
+	require.Equal(t, protocol.Integer(0), reply)
+}
+
+// TestHandleRequest_ClientRouting verifies the CLIENT subcommands reach the server's connection registry with their
+// arguments parsed, and are refused without one.
+func TestHandleRequest_ClientRouting(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mocks.NewMockStorage(ctrl)
+	clients := mocks.NewMockClients(ctrl)
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	c := compute.New(parser.New(), mockStorage, logger, compute.WithClients(clients))
+	ctx := t.Context()
+
+	clients.EXPECT().Clients().Return([]network.ClientInfo{{
+		ID: 7, Addr: "10.0.0.1:5000", Name: "worker", Age: 90 * time.Second, Idle: 2 * time.Second, Command: "GET",
+		BytesIn: 120, BytesOut: 64,
+	}})
+	reply, err := c.HandleRequest(ctx, "CLIENT", []string{"list"})
+	require.NoError(t, err)
+	require.Equal(t, "id=7 addr=10.0.0.1:5000 name=worker age=90 idle=2 cmd=get tot-net-in=120 tot-net-out=64\n",
+		reply.Value)
+
+	clients.EXPECT().SetClientName(gomock.Any(), "worker").Return(nil)
+	_, err = c.HandleRequest(ctx, "CLIENT", []string{"SETNAME", "worker"})
+	require.NoError(t, err)
+
+	clients.EXPECT().KillClient(uint64(7)).Return(true)
+	_, err = c.HandleRequest(ctx, "CLIENT", []string{"KILL", "7"})
+	require.NoError(t, err)
+	clients.EXPECT().KillClientAddr("10.0.0.1:5000").Return(false)
+	_, err = c.HandleRequest(ctx, "CLIENT", []string{"KILL", "10.0.0.1:5000"})
+	require.ErrorContains(t, err, "no such client")
+
+	clients.EXPECT().PauseClients(1500*time.Millisecond, true)
+	_, err = c.HandleRequest(ctx, "CLIENT", []string{"PAUSE", "1500", "write"})
+	require.NoError(t, err)
+	clients.EXPECT().PauseClients(time.Second, false)
+	_, err = c.HandleRequest(ctx, "CLIENT", []string{"PAUSE", "1000"})
+	require.NoError(t, err)
+	clients.EXPECT().UnpauseClients()
+	_, err = c.HandleRequest(ctx, "CLIENT", []string{"UNPAUSE"})
+	require.NoError(t, err)
+
+	for _, args := range [][]string{{"PAUSE", "-1"}, {"PAUSE", "10", "READ"}, {"LIST", "extra"}, {"BOGUS"}} {
+		_, err = c.HandleRequest(ctx, "CLIENT", args)
+		require.Error(t, err, args)
+	}
+
+	_, err = compute.New(parser.New(), mockStorage, logger).HandleRequest(ctx, "CLIENT", []string{"LIST"})
+	require.ErrorContains(t, err, "client commands not enabled")
+}
+
+// TestHandleRequest_ConfigRouting verifies CONFIG GET filters the settings by a case-insensitive glob, CONFIG SET and
+// REWRITE reach the configurer, and CONFIG is refused without one.
+func TestHandleRequest_ConfigRouting(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := mocks.NewMockStorage(ctrl)
+	configurer := mocks.NewMockConfigurer(ctrl)
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	c := compute.New(parser.New(), mockStorage, logger, compute.WithConfigurer(configurer))
+	ctx := t.Context()
+
+	settings := map[string]string{
+		"logging.level":           "info",
+		"network.max_connections": "100",
+		"network.idle_timeout":    "1m0s",
+	}
+	configurer.EXPECT().Config().Return(settings).Times(3)
+	reply, err := c.HandleRequest(ctx, "CONFIG", []string{"get", "NETWORK.*"})
+	require.NoError(t, err)
+	require.Equal(t, protocol.BulkStringArray([]string{"network.idle_timeout", "1m0s", "network.max_connections", "100"}),
+		reply)
+	reply, err = c.HandleRequest(ctx, "CONFIG", []string{"GET", "nothing"})
+	require.NoError(t, err)
+	require.Equal(t, protocol.BulkStringArray([]string{}), reply)
+
+	configurer.EXPECT().SetConfig("logging.level", "debug").Return(nil)
+	_, err = c.HandleRequest(ctx, "CONFIG", []string{"SET", "Logging.Level", "debug"})
+	require.NoError(t, err)
+	configurer.EXPECT().SetConfig("network.max_connections", "0").Return(errors.New("maxConnections must be positive"))
+	_, err = c.HandleRequest(ctx, "CONFIG", []string{"SET", "network.max_connections", "0"})
+	require.ErrorContains(t, err, "maxConnections must be positive")
+
+	configurer.EXPECT().RewriteConfig().Return(nil)
+	_, err = c.HandleRequest(ctx, "CONFIG", []string{"REWRITE"})
+	require.NoError(t, err)
+
+	for _, args := range [][]string{{"GET"}, {"GET", "["}, {"SET", "logging.level"}, {"REWRITE", "now"}, {"BOGUS"}} {
+		_, err = c.HandleRequest(ctx, "CONFIG", args)
+		require.Error(t, err, args)
+	}
+
+	_, err = compute.New(parser.New(), mockStorage, logger).HandleRequest(ctx, "CONFIG", []string{"GET", "*"})
+	require.ErrorContains(t, err, "runtime configuration not enabled")
+}
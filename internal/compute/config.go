@@ -0,0 +1,54 @@
+package compute
+
+import (
+	"errors"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/OutOfStack/db/internal/protocol"
+)
+
+const configUsage = "usage: CONFIG GET <pattern> | CONFIG SET <param> <value> | CONFIG REWRITE"
+
+// config runs CONFIG GET, SET and REWRITE.
+func (c *Compute) config(args []string) (protocol.Reply, error) {
+	sub := strings.ToUpper(args[0])
+	args = args[1:]
+	if c.configurer == nil {
+		return protocol.Reply{}, errors.New("runtime configuration not enabled")
+	}
+	switch {
+	case sub == "GET" && len(args) == 1:
+		return configGet(c.configurer.Config(), args[0])
+	case sub == "SET" && len(args) == 2:
+		if err := c.configurer.SetConfig(strings.ToLower(args[0]), args[1]); err != nil {
+			return protocol.Reply{}, err
+		}
+		return protocol.SimpleString("OK"), nil
+	case sub == "REWRITE" && len(args) == 0:
+		if err := c.configurer.RewriteConfig(); err != nil {
+			return protocol.Reply{}, err
+		}
+		return protocol.SimpleString("OK"), nil
+	default:
+		return protocol.Reply{}, errors.New(configUsage)
+	}
+}
+
+// configGet replies as Redis' CONFIG GET does: the name and value of each setting whose name matches the glob pattern,
+// in one flat array sorted by name.
+func configGet(settings map[string]string, pattern string) (protocol.Reply, error) {
+	pattern = strings.ToLower(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return protocol.Reply{}, errors.New("invalid CONFIG GET pattern")
+	}
+	pairs := make([]string, 0, 2*len(settings))
+	for _, name := range slices.Sorted(maps.Keys(settings)) {
+		if matched, _ := path.Match(pattern, name); matched {
+			pairs = append(pairs, name, settings[name])
+		}
+	}
+	return protocol.BulkStringArray(pairs), nil
+}
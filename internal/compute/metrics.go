@@ -0,0 +1,66 @@
+package compute
+
+import (
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/OutOfStack/db/internal/metrics"
+)
+
+// invalidCommand labels the requests the parser rejects. Their names come from clients, so they are not used as labels.
+const invalidCommand = "invalid"
+
+// commandMetrics counts requests and their latency per command.
+type commandMetrics struct {
+	mu        sync.RWMutex
+	byCommand map[string]*commandStats
+}
+
+type commandStats struct {
+	calls   metrics.Counter
+	errors  metrics.Counter
+	latency *metrics.Histogram
+}
+
+func newCommandMetrics() *commandMetrics {
+	return &commandMetrics{byCommand: make(map[string]*commandStats)}
+}
+
+// command returns the stats of cmd, adding them on its first request.
+func (m *commandMetrics) command(cmd string) *commandStats {
+	m.mu.RLock()
+	stats, ok := m.byCommand[cmd]
+	m.mu.RUnlock()
+	if ok {
+		return stats
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stats, ok = m.byCommand[cmd]; !ok {
+		stats = &commandStats{latency: metrics.NewHistogram(metrics.LatencyBuckets())}
+		m.byCommand[cmd] = stats
+	}
+	return stats
+}
+
+// Collect reports the requests served per command, those that failed, and how long they took.
+func (c *Compute) Collect(enc *metrics.Encoder) {
+	c.metrics.mu.RLock()
+	byCommand := maps.Clone(c.metrics.byCommand)
+	c.metrics.mu.RUnlock()
+	commands := slices.Sorted(maps.Keys(byCommand))
+
+	for _, cmd := range commands {
+		enc.Counter("db_commands_total", "Requests handled, by command.", float64(byCommand[cmd].calls.Value()),
+			metrics.Label{Name: "command", Value: cmd})
+	}
+	for _, cmd := range commands {
+		enc.Counter("db_command_errors_total", "Requests answered with an error, by command.",
+			float64(byCommand[cmd].errors.Value()), metrics.Label{Name: "command", Value: cmd})
+	}
+	for _, cmd := range commands {
+		enc.Histogram("db_command_duration_seconds", "Time to handle a request, by command.", byCommand[cmd].latency,
+			metrics.Label{Name: "command", Value: cmd})
+	}
+}
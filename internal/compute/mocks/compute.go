@@ -12,7 +12,9 @@ package compute_mocks
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
+	network "github.com/OutOfStack/db/internal/network"
 	protocol "github.com/OutOfStack/db/internal/protocol"
 	gomock "go.uber.org/mock/gomock"
 )
@@ -149,3 +151,359 @@ func (mr *MockAdminMockRecorder) Status(ctx any) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Status", reflect.TypeOf((*MockAdmin)(nil).Status), ctx)
 }
+
+// MockMigrator is a mock of Migrator interface.
+type MockMigrator struct {
+	ctrl     *gomock.Controller
+	recorder *MockMigratorMockRecorder
+	isgomock struct{}
+}
+
+// MockMigratorMockRecorder is the mock recorder for MockMigrator.
+type MockMigratorMockRecorder struct {
+	mock *MockMigrator
+}
+
+// NewMockMigrator creates a new mock instance.
+func NewMockMigrator(ctrl *gomock.Controller) *MockMigrator {
+	mock := &MockMigrator{ctrl: ctrl}
+	mock.recorder = &MockMigratorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMigrator) EXPECT() *MockMigratorMockRecorder {
+	return m.recorder
+}
+
+// MigrateKey mocks base method.
+func (m *MockMigrator) MigrateKey(ctx context.Context, target, table, key string) (protocol.Reply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MigrateKey", ctx, target, table, key)
+	ret0, _ := ret[0].(protocol.Reply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MigrateKey indicates an expected call of MigrateKey.
+func (mr *MockMigratorMockRecorder) MigrateKey(ctx, target, table, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MigrateKey", reflect.TypeOf((*MockMigrator)(nil).MigrateKey), ctx, target, table, key)
+}
+
+// MigrateTable mocks base method.
+func (m *MockMigrator) MigrateTable(ctx context.Context, target, table string) (protocol.Reply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MigrateTable", ctx, target, table)
+	ret0, _ := ret[0].(protocol.Reply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MigrateTable indicates an expected call of MigrateTable.
+func (mr *MockMigratorMockRecorder) MigrateTable(ctx, target, table any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MigrateTable", reflect.TypeOf((*MockMigrator)(nil).MigrateTable), ctx, target, table)
+}
+
+// Status mocks base method.
+func (m *MockMigrator) Status(ctx context.Context) (protocol.Reply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Status", ctx)
+	ret0, _ := ret[0].(protocol.Reply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Status indicates an expected call of Status.
+func (mr *MockMigratorMockRecorder) Status(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Status", reflect.TypeOf((*MockMigrator)(nil).Status), ctx)
+}
+
+// MockVerifier is a mock of Verifier interface.
+type MockVerifier struct {
+	ctrl     *gomock.Controller
+	recorder *MockVerifierMockRecorder
+	isgomock struct{}
+}
+
+// MockVerifierMockRecorder is the mock recorder for MockVerifier.
+type MockVerifierMockRecorder struct {
+	mock *MockVerifier
+}
+
+// NewMockVerifier creates a new mock instance.
+func NewMockVerifier(ctrl *gomock.Controller) *MockVerifier {
+	mock := &MockVerifier{ctrl: ctrl}
+	mock.recorder = &MockVerifierMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockVerifier) EXPECT() *MockVerifierMockRecorder {
+	return m.recorder
+}
+
+// Verify mocks base method.
+func (m *MockVerifier) Verify(ctx context.Context, target string, quarantine bool) (protocol.Reply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", ctx, target, quarantine)
+	ret0, _ := ret[0].(protocol.Reply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockVerifierMockRecorder) Verify(ctx, target, quarantine any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockVerifier)(nil).Verify), ctx, target, quarantine)
+}
+
+// MockCompactor is a mock of Compactor interface.
+type MockCompactor struct {
+	ctrl     *gomock.Controller
+	recorder *MockCompactorMockRecorder
+	isgomock struct{}
+}
+
+// MockCompactorMockRecorder is the mock recorder for MockCompactor.
+type MockCompactorMockRecorder struct {
+	mock *MockCompactor
+}
+
+// NewMockCompactor creates a new mock instance.
+func NewMockCompactor(ctrl *gomock.Controller) *MockCompactor {
+	mock := &MockCompactor{ctrl: ctrl}
+	mock.recorder = &MockCompactorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCompactor) EXPECT() *MockCompactorMockRecorder {
+	return m.recorder
+}
+
+// Compact mocks base method.
+func (m *MockCompactor) Compact(ctx context.Context, force bool) (protocol.Reply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Compact", ctx, force)
+	ret0, _ := ret[0].(protocol.Reply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Compact indicates an expected call of Compact.
+func (mr *MockCompactorMockRecorder) Compact(ctx, force any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Compact", reflect.TypeOf((*MockCompactor)(nil).Compact), ctx, force)
+}
+
+// MockCheckpointer is a mock of Checkpointer interface.
+type MockCheckpointer struct {
+	ctrl     *gomock.Controller
+	recorder *MockCheckpointerMockRecorder
+	isgomock struct{}
+}
+
+// MockCheckpointerMockRecorder is the mock recorder for MockCheckpointer.
+type MockCheckpointerMockRecorder struct {
+	mock *MockCheckpointer
+}
+
+// NewMockCheckpointer creates a new mock instance.
+func NewMockCheckpointer(ctrl *gomock.Controller) *MockCheckpointer {
+	mock := &MockCheckpointer{ctrl: ctrl}
+	mock.recorder = &MockCheckpointerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCheckpointer) EXPECT() *MockCheckpointerMockRecorder {
+	return m.recorder
+}
+
+// Checkpoint mocks base method.
+func (m *MockCheckpointer) Checkpoint(ctx context.Context, dir string) (protocol.Reply, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Checkpoint", ctx, dir)
+	ret0, _ := ret[0].(protocol.Reply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Checkpoint indicates an expected call of Checkpoint.
+func (mr *MockCheckpointerMockRecorder) Checkpoint(ctx, dir any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Checkpoint", reflect.TypeOf((*MockCheckpointer)(nil).Checkpoint), ctx, dir)
+}
+
+// MockClients is a mock of Clients interface.
+type MockClients struct {
+	ctrl     *gomock.Controller
+	recorder *MockClientsMockRecorder
+	isgomock struct{}
+}
+
+// MockClientsMockRecorder is the mock recorder for MockClients.
+type MockClientsMockRecorder struct {
+	mock *MockClients
+}
+
+// NewMockClients creates a new mock instance.
+func NewMockClients(ctrl *gomock.Controller) *MockClients {
+	mock := &MockClients{ctrl: ctrl}
+	mock.recorder = &MockClientsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockClients) EXPECT() *MockClientsMockRecorder {
+	return m.recorder
+}
+
+// Clients mocks base method.
+func (m *MockClients) Clients() []network.ClientInfo {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Clients")
+	ret0, _ := ret[0].([]network.ClientInfo)
+	return ret0
+}
+
+// Clients indicates an expected call of Clients.
+func (mr *MockClientsMockRecorder) Clients() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Clients", reflect.TypeOf((*MockClients)(nil).Clients))
+}
+
+// KillClient mocks base method.
+func (m *MockClients) KillClient(id uint64) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "KillClient", id)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// KillClient indicates an expected call of KillClient.
+func (mr *MockClientsMockRecorder) KillClient(id any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "KillClient", reflect.TypeOf((*MockClients)(nil).KillClient), id)
+}
+
+// KillClientAddr mocks base method.
+func (m *MockClients) KillClientAddr(addr string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "KillClientAddr", addr)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// KillClientAddr indicates an expected call of KillClientAddr.
+func (mr *MockClientsMockRecorder) KillClientAddr(addr any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "KillClientAddr", reflect.TypeOf((*MockClients)(nil).KillClientAddr), addr)
+}
+
+// PauseClients mocks base method.
+func (m *MockClients) PauseClients(duration time.Duration, writesOnly bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "PauseClients", duration, writesOnly)
+}
+
+// PauseClients indicates an expected call of PauseClients.
+func (mr *MockClientsMockRecorder) PauseClients(duration, writesOnly any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PauseClients", reflect.TypeOf((*MockClients)(nil).PauseClients), duration, writesOnly)
+}
+
+// SetClientName mocks base method.
+func (m *MockClients) SetClientName(ctx context.Context, name string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetClientName", ctx, name)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetClientName indicates an expected call of SetClientName.
+func (mr *MockClientsMockRecorder) SetClientName(ctx, name any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetClientName", reflect.TypeOf((*MockClients)(nil).SetClientName), ctx, name)
+}
+
+// UnpauseClients mocks base method.
+func (m *MockClients) UnpauseClients() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "UnpauseClients")
+}
+
+// UnpauseClients indicates an expected call of UnpauseClients.
+func (mr *MockClientsMockRecorder) UnpauseClients() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnpauseClients", reflect.TypeOf((*MockClients)(nil).UnpauseClients))
+}
+
+// MockConfigurer is a mock of Configurer interface.
+type MockConfigurer struct {
+	ctrl     *gomock.Controller
+	recorder *MockConfigurerMockRecorder
+	isgomock struct{}
+}
+
+// MockConfigurerMockRecorder is the mock recorder for MockConfigurer.
+type MockConfigurerMockRecorder struct {
+	mock *MockConfigurer
+}
+
+// NewMockConfigurer creates a new mock instance.
+func NewMockConfigurer(ctrl *gomock.Controller) *MockConfigurer {
+	mock := &MockConfigurer{ctrl: ctrl}
+	mock.recorder = &MockConfigurerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockConfigurer) EXPECT() *MockConfigurerMockRecorder {
+	return m.recorder
+}
+
+// Config mocks base method.
+func (m *MockConfigurer) Config() map[string]string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Config")
+	ret0, _ := ret[0].(map[string]string)
+	return ret0
+}
+
+// Config indicates an expected call of Config.
+func (mr *MockConfigurerMockRecorder) Config() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Config", reflect.TypeOf((*MockConfigurer)(nil).Config))
+}
+
+// RewriteConfig mocks base method.
+func (m *MockConfigurer) RewriteConfig() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RewriteConfig")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RewriteConfig indicates an expected call of RewriteConfig.
+func (mr *MockConfigurerMockRecorder) RewriteConfig() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RewriteConfig", reflect.TypeOf((*MockConfigurer)(nil).RewriteConfig))
+}
+
+// SetConfig mocks base method.
+func (m *MockConfigurer) SetConfig(name, value string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetConfig", name, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetConfig indicates an expected call of SetConfig.
+func (mr *MockConfigurerMockRecorder) SetConfig(name, value any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetConfig", reflect.TypeOf((*MockConfigurer)(nil).SetConfig), name, value)
+}
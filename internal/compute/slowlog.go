@@ -0,0 +1,174 @@
+package compute
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OutOfStack/db/internal/protocol"
+	"github.com/OutOfStack/db/internal/storage"
+)
+
+// Slow log defaults, as in Redis: commands that took 10ms or more, the latest 128 of them.
+const (
+	DefaultSlowLogThreshold = 10 * time.Millisecond
+	DefaultSlowLogMaxLen    = 128
+)
+
+const (
+	// slowLogMaxArgs and slowLogMaxArgLen bound what an entry keeps of a command, so a slow log of large writes does not
+	// hold their values. Longer commands and arguments are cut short with a note of how much was left out.
+	slowLogMaxArgs   = 32
+	slowLogMaxArgLen = 128
+	// slowLogDefaultGet is how many entries SLOWLOG GET returns without a count.
+	slowLogDefaultGet = 10
+)
+
+const slowLogUsage = "usage: SLOWLOG GET [count] | SLOWLOG LEN | SLOWLOG RESET"
+
+// slowLogEntry is one command that took at least the slow log threshold.
+type slowLogEntry struct {
+	id       uint64
+	time     time.Time
+	duration time.Duration
+	timing   storage.Timing
+	// args is the command followed by its arguments, truncated
+	args   []string
+	client string
+}
+
+// slowLog keeps the latest maxLen commands that took at least threshold in a ring. Entry IDs keep increasing across
+// RESET, so a poller can tell entries it has seen from new ones.
+type slowLog struct {
+	threshold time.Duration
+	maxLen    int
+
+	mu      sync.Mutex
+	entries []slowLogEntry
+	// added counts the entries recorded since the last RESET; the newest is at (added-1) % maxLen
+	added  uint64
+	nextID uint64
+}
+
+func newSlowLog(threshold time.Duration, maxLen int) *slowLog {
+	return &slowLog{threshold: threshold, maxLen: max(maxLen, 0)}
+}
+
+// record adds a command to the log if it took at least the threshold.
+func (l *slowLog) record(start time.Time, duration time.Duration, timing storage.Timing, client, cmd string,
+	args []string) {
+	if duration < l.threshold || l.maxLen == 0 {
+		return
+	}
+	entry := slowLogEntry{
+		time:     start,
+		duration: duration,
+		timing:   timing,
+		args:     truncateArgs(cmd, args),
+		client:   client,
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.id = l.nextID
+	l.nextID++
+	if len(l.entries) < l.maxLen {
+		l.entries = append(l.entries, entry)
+	} else {
+		l.entries[l.added%uint64(l.maxLen)] = entry
+	}
+	l.added++
+}
+
+// newest returns up to n entries, newest first; a negative n returns them all.
+func (l *slowLog) newest(n int) []slowLogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n < 0 || n > len(l.entries) {
+		n = len(l.entries)
+	}
+	entries := make([]slowLogEntry, 0, n)
+	for i := range uint64(n) {
+		entries = append(entries, l.entries[(l.added-1-i)%uint64(l.maxLen)])
+	}
+	return entries
+}
+
+func (l *slowLog) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+func (l *slowLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+	l.added = 0
+}
+
+// command runs SLOWLOG GET [count], SLOWLOG LEN or SLOWLOG RESET.
+func (l *slowLog) command(args []string) (protocol.Reply, error) {
+	switch {
+	case strings.EqualFold(args[0], "GET"):
+		count := slowLogDefaultGet
+		if len(args) == 2 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				return protocol.Reply{}, errors.New(slowLogUsage)
+			}
+			count = n
+		}
+		entries := l.newest(count)
+		replies := make([]protocol.Reply, 0, len(entries))
+		for _, entry := range entries {
+			replies = append(replies, entry.reply())
+		}
+		return protocol.Array(replies), nil
+	case len(args) != 1:
+		return protocol.Reply{}, errors.New(slowLogUsage)
+	case strings.EqualFold(args[0], "LEN"):
+		return protocol.Integer(int64(l.len())), nil
+	case strings.EqualFold(args[0], "RESET"):
+		l.reset()
+		return protocol.SimpleString("OK"), nil
+	default:
+		return protocol.Reply{}, errors.New(slowLogUsage)
+	}
+}
+
+// reply renders an entry as Redis does — ID, Unix time, duration in microseconds, the command and its arguments, the
+// client's address — followed by the microseconds spent waiting for the WAL append, waiting at the apply gate and in
+// the engine.
+func (e slowLogEntry) reply() protocol.Reply {
+	return protocol.Array([]protocol.Reply{
+		protocol.Integer(int64(e.id)), //nolint:gosec // IDs count commands, far below 2^63
+		protocol.Integer(e.time.Unix()),
+		protocol.Integer(e.duration.Microseconds()),
+		protocol.BulkStringArray(e.args),
+		protocol.BulkString(e.client),
+		protocol.Integer(e.timing.WAL.Microseconds()),
+		protocol.Integer(e.timing.Gate.Microseconds()),
+		protocol.Integer(e.timing.Engine.Microseconds()),
+	})
+}
+
+// truncateArgs returns cmd followed by args, keeping at most slowLogMaxArgs of them and slowLogMaxArgLen bytes of each.
+func truncateArgs(cmd string, args []string) []string {
+	argv := make([]string, 0, min(len(args)+1, slowLogMaxArgs))
+	argv = append(argv, cmd)
+	for i, arg := range args {
+		if len(argv) == slowLogMaxArgs-1 && len(args)-i > 1 {
+			argv = append(argv, fmt.Sprintf("... (%d more arguments)", len(args)-i))
+			break
+		}
+		if len(arg) > slowLogMaxArgLen {
+			arg = fmt.Sprintf("%s... (%d more bytes)", arg[:slowLogMaxArgLen], len(arg)-slowLogMaxArgLen)
+		}
+		argv = append(argv, arg)
+	}
+	return argv
+}
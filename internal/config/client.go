@@ -5,12 +5,14 @@ import (
 	"time"
 
 	"github.com/OutOfStack/db/internal/pool"
+	"github.com/OutOfStack/db/internal/shard"
 )
 
 // ClientConfig - configuration for the database client
 type ClientConfig struct {
-	Network ClientNetworkConfig `yaml:"network"`
-	Pool    pool.PoolConfig     `yaml:"pool"`
+	Network  ClientNetworkConfig `yaml:"network"`
+	Pool     pool.PoolConfig     `yaml:"pool"`
+	Sharding shard.Config        `yaml:"sharding"`
 }
 
 // ClientNetworkConfig - network-related configuration for the database client
@@ -18,6 +20,8 @@ type ClientNetworkConfig struct {
 	Address          string        `yaml:"address"`
 	MaxMessageSizeKB int           `yaml:"max_message_size"`
 	IdleTimeout      time.Duration `yaml:"idle_timeout"`
+	// Name is sent with CLIENT SETNAME on every connection; empty sends nothing
+	Name string `yaml:"name"`
 }
 
 // DefaultClientConfig returns a ClientConfig instance with sensible default values. This is used as a fallback when no
@@ -29,14 +33,19 @@ func DefaultClientConfig() *ClientConfig {
 			MaxMessageSizeKB: 4,
 			IdleTimeout:      time.Minute,
 		},
-		Pool: *pool.DefaultPoolConfig(),
+		Pool:     *pool.DefaultPoolConfig(),
+		Sharding: *shard.DefaultConfig(),
 	}
 }
 
 // Validate checks if the configuration values are valid
 func (c *ClientConfig) Validate() error {
-	// If pool is enabled, validate pool config instead of single address
-	if c.Pool.Enabled {
+	// Sharding takes precedence over the pool, whose settings it shares; otherwise a pool replaces the single address
+	if c.Sharding.Enabled {
+		if err := c.Sharding.Validate(&c.Pool); err != nil {
+			return err
+		}
+	} else if c.Pool.Enabled {
 		if err := c.Pool.Validate(); err != nil {
 			return err
 		}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/OutOfStack/db/internal/config"
+	"github.com/OutOfStack/db/internal/shard"
 	"github.com/OutOfStack/db/internal/wal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -158,6 +159,30 @@ func TestServerConfigValidation(t *testing.T) {
 			cfg.Engine.Type = "tiered"
 			cfg.Engine.SegmentSizeMB = int64(^uint64(0)>>1)/(1<<20) + 1
 		}, "engine segment_size overflows bytes"},
+		{"tiered unknown compression", func(cfg *config.ServerConfig) {
+			cfg.Engine.Type = "tiered"
+			cfg.Engine.Compression = "zstd"
+		}, "unsupported engine compression"},
+		{"tiered negative compression threshold", func(cfg *config.ServerConfig) {
+			cfg.Engine.Type = "tiered"
+			cfg.Engine.CompressionMinSize = -1
+		}, "engine compression_min_size"},
+		{"tiered negative compaction rate", func(cfg *config.ServerConfig) {
+			cfg.Engine.Type = "tiered"
+			cfg.Engine.CompactionRateMB = -1
+		}, "engine compaction_rate"},
+		{"tiered malformed compaction window", func(cfg *config.ServerConfig) {
+			cfg.Engine.Type = "tiered"
+			cfg.Engine.CompactionWindow = "01:00-25:00"
+		}, "compaction window"},
+		{"negative scrub interval", func(cfg *config.ServerConfig) { cfg.Scrub.Interval = -time.Hour }, "scrub interval"},
+		{"zero scrub rate", func(cfg *config.ServerConfig) { cfg.Scrub.RateMB = 0 }, "scrub rate"},
+		{"negative slowlog threshold", func(cfg *config.ServerConfig) { cfg.SlowLog.Threshold = -time.Millisecond }, "slowlog threshold"},
+		{"negative slowlog max_len", func(cfg *config.ServerConfig) { cfg.SlowLog.MaxLen = -1 }, "slowlog max_len"},
+		{"metrics address without port", func(cfg *config.ServerConfig) { cfg.Metrics.Address = "localhost" }, "metrics address"},
+		{"metrics on the network address", func(cfg *config.ServerConfig) {
+			cfg.Metrics.Address = cfg.Network.Address
+		}, "metrics address"},
 	}
 
 	for _, test := range tests {
@@ -180,6 +205,17 @@ func TestDefaultServerConfigUsesTenSecondShutdown(t *testing.T) {
 	assert.Equal(t, 10*time.Second, cfg.Network.ShutdownTimeout)
 }
 
+// TestScrubDisabledIgnoresRate checks a disabled scrubber's rate is not validated: an operator turning it off should not
+// have to keep a rate that is never used.
+func TestScrubDisabledIgnoresRate(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.DefaultServerConfig()
+	cfg.Scrub.Interval = 0
+	cfg.Scrub.RateMB = 0
+	require.NoError(t, cfg.Validate())
+}
+
 func TestServerWALConfigValidation(t *testing.T) {
 	t.Parallel()
 
@@ -192,6 +228,13 @@ func TestServerWALConfigValidation(t *testing.T) {
 		{"bad sync policy", func(cfg *config.ServerConfig) { cfg.WAL.Sync = "sometimes" }, "wal sync policy"},
 		{"bad segment size", func(cfg *config.ServerConfig) { cfg.WAL.SegmentSizeMB = 0 }, "wal segmentSize"},
 		{"bad snapshot interval", func(cfg *config.ServerConfig) { cfg.WAL.SnapshotInterval = 0 }, "wal snapshotInterval"},
+		{"archive without wal", func(cfg *config.ServerConfig) {
+			cfg.WAL.Enabled = false
+			cfg.WAL.ArchiveDir = "archive"
+		}, "requires wal"},
+		{"archive in data directory", func(cfg *config.ServerConfig) {
+			cfg.WAL.ArchiveDir = cfg.WAL.DataDir + "/"
+		}, "must differ"},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -229,6 +272,13 @@ func TestServerReplicationConfigValidation(t *testing.T) {
 			cfg.Replication.Role = config.RoleMaster
 			cfg.Replication.ListenAddress = "127.0.0.1:3224"
 		}, "requires wal"},
+		{"replicated tiered engine still uses the wal settings", func(cfg *config.ServerConfig) {
+			cfg.WAL.Enabled = false
+			cfg.WAL.SnapshotInterval = 0
+			cfg.Engine.Type = "tiered"
+			cfg.Replication.Role = config.RoleMaster
+			cfg.Replication.ListenAddress = "127.0.0.1:3224"
+		}, "wal snapshotInterval"},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -252,6 +302,13 @@ func TestServerReplicationConfigValid(t *testing.T) {
 	cfg.Replication.MasterAddress = "127.0.0.1:3224"
 	cfg.Replication.ReconnectBackoff = time.Second
 	require.NoError(t, cfg.Validate())
+
+	// the tiered engine replicates without wal.enabled, which it cannot be combined with
+	cfg = config.DefaultServerConfig()
+	cfg.Engine.Type = "tiered"
+	cfg.Replication.Role = config.RoleMaster
+	cfg.Replication.ListenAddress = "127.0.0.1:3224"
+	require.NoError(t, cfg.Validate())
 }
 
 func TestLoadServerConfig_EnvOverrides(t *testing.T) { //nolint:paralleltest // t.Setenv
@@ -358,6 +415,48 @@ network:
 		assert.Equal(t, 5*time.Minute, cfg.Network.IdleTimeout)
 	})
 
+	t.Run("loads sharding config", func(t *testing.T) {
+		t.Parallel()
+
+		configContent := `
+network:
+  max_message_size: 4
+  idle_timeout: 1m
+pool:
+  selection_strategy: round_robin
+sharding:
+  enabled: true
+  by: key
+  groups:
+    - name: a
+      servers:
+        - address: "127.0.0.1:3223"
+          role: master
+    - name: b
+      servers:
+        - address: "127.0.0.1:4223"
+          role: master
+        - address: "127.0.0.1:4224"
+          role: standby
+`
+		tmpFile, err := os.CreateTemp(".", "config_test_*.yaml")
+		require.NoError(t, err)
+		defer os.Remove(tmpFile.Name())
+
+		_, err = tmpFile.WriteString(configContent)
+		require.NoError(t, err)
+		err = tmpFile.Close()
+		require.NoError(t, err)
+
+		cfg, err := config.LoadClientConfig(filepath.Base(tmpFile.Name()))
+		require.NoError(t, err)
+
+		assert.True(t, cfg.Sharding.Enabled)
+		assert.Equal(t, shard.KeyKey, cfg.Sharding.By)
+		require.Len(t, cfg.Sharding.Groups, 2)
+		assert.Len(t, cfg.Sharding.Groups[1].Servers, 2)
+	})
+
 	t.Run("returns error for invalid config values", func(t *testing.T) {
 		t.Parallel()
 
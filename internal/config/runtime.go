@@ -0,0 +1,189 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Runtime parameters: the server settings CONFIG SET and a reload on SIGHUP can change while the server runs. Each is
+// named by its path in the YAML file.
+const (
+	ParamLogLevel            = "logging.level"
+	ParamMaxConnections      = "network.max_connections"
+	ParamIdleTimeout         = "network.idle_timeout"
+	ParamSnapshotInterval    = "wal.snapshot_interval"
+	ParamCompactionThreshold = "engine.compaction_threshold"
+)
+
+// RuntimeParams lists the runtime parameters, sorted by name.
+func RuntimeParams() []string {
+	return []string{
+		ParamCompactionThreshold,
+		ParamLogLevel,
+		ParamIdleTimeout,
+		ParamMaxConnections,
+		ParamSnapshotInterval,
+	}
+}
+
+// Param returns the value of a runtime parameter as CONFIG GET reports it and CONFIG REWRITE writes it, and false for
+// any other name.
+func (c *ServerConfig) Param(name string) (string, bool) {
+	switch name {
+	case ParamLogLevel:
+		return c.Logging.Level, true
+	case ParamMaxConnections:
+		return strconv.Itoa(c.Network.MaxConnections), true
+	case ParamIdleTimeout:
+		return c.Network.IdleTimeout.String(), true
+	case ParamSnapshotInterval:
+		return c.WAL.SnapshotInterval.String(), true
+	case ParamCompactionThreshold:
+		return strconv.FormatFloat(c.Engine.CompactionThreshold, 'g', -1, 64), true
+	default:
+		return "", false
+	}
+}
+
+// SetParam sets a runtime parameter from its text form. It checks only that the value parses; Validate checks that the
+// result is a configuration the server accepts.
+func (c *ServerConfig) SetParam(name, value string) error {
+	var err error
+	switch name {
+	case ParamLogLevel:
+		c.Logging.Level = strings.ToLower(value)
+	case ParamMaxConnections:
+		c.Network.MaxConnections, err = strconv.Atoi(value)
+	case ParamIdleTimeout:
+		c.Network.IdleTimeout, err = time.ParseDuration(value)
+	case ParamSnapshotInterval:
+		c.WAL.SnapshotInterval, err = time.ParseDuration(value)
+	case ParamCompactionThreshold:
+		c.Engine.CompactionThreshold, err = strconv.ParseFloat(value, 64)
+	default:
+		return fmt.Errorf("unsupported runtime parameter: %s", name)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %q", name, value)
+	}
+	return nil
+}
+
+// RewriteServerConfig writes the runtime parameters of cfg into the YAML file at filename, adding those the file does
+// not set. The rest of the file, comments included, is kept as it is. The new file replaces the old one atomically.
+func RewriteServerConfig(filename string, cfg *ServerConfig) error {
+	// #nosec G304 -- the command-line config path is intentionally operator-controlled.
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("read config file %q: %w", filename, err)
+	}
+	var doc yaml.Node
+	if err = yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return errors.New("failed to parse config file: expected a mapping")
+	}
+	for _, name := range RuntimeParams() {
+		value, _ := cfg.Param(name)
+		section, key, _ := strings.Cut(name, ".")
+		mapping, mErr := mappingValue(root, section)
+		if mErr != nil {
+			return mErr
+		}
+		setScalar(mapping, key, value)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(&doc); err != nil {
+		return fmt.Errorf("encode config file: %w", err)
+	}
+	if err = encoder.Close(); err != nil {
+		return fmt.Errorf("encode config file: %w", err)
+	}
+	return replaceFile(filename, buf.Bytes())
+}
+
+// mappingValue returns the mapping under key in mapping, adding an empty one when key is missing.
+func mappingValue(mapping *yaml.Node, key string) (*yaml.Node, error) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != key {
+			continue
+		}
+		value := mapping.Content[i+1]
+		if value.Kind == yaml.ScalarNode && value.Tag == "!!null" {
+			value.Kind, value.Tag, value.Value = yaml.MappingNode, "", ""
+		}
+		if value.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("failed to parse config file: %s is not a mapping", key)
+		}
+		return value, nil
+	}
+	value := &yaml.Node{Kind: yaml.MappingNode}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, value)
+	return value, nil
+}
+
+// setScalar sets key in mapping to value, keeping the quoting and comments of an existing entry.
+func setScalar(mapping *yaml.Node, key, value string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			node := mapping.Content[i+1]
+			// the tag is resolved again from the new value, which may not be of the old one's kind
+			node.Kind, node.Tag, node.Value = yaml.ScalarNode, "", value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: value})
+}
+
+// replaceFile writes data to a temporary file beside filename, with filename's permissions, then renames it over
+// filename, so a crash leaves either the old file or the new one.
+func replaceFile(filename string, data []byte) error {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return fmt.Errorf("stat config file: %w", err)
+	}
+	temporary, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+"-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create config file: %w", err)
+	}
+	temporaryName := temporary.Name()
+	defer func() { _ = os.Remove(temporaryName) }()
+
+	if _, err = temporary.Write(data); err != nil {
+		_ = temporary.Close()
+		return fmt.Errorf("write config file: %w", err)
+	}
+	if err = temporary.Chmod(stat.Mode().Perm()); err != nil {
+		_ = temporary.Close()
+		return fmt.Errorf("write config file: %w", err)
+	}
+	if err = temporary.Sync(); err != nil {
+		_ = temporary.Close()
+		return fmt.Errorf("sync config file: %w", err)
+	}
+	if err = temporary.Close(); err != nil {
+		return fmt.Errorf("close config file: %w", err)
+	}
+	if err = os.Rename(temporaryName, filename); err != nil {
+		return fmt.Errorf("replace config file: %w", err)
+	}
+	return nil
+}
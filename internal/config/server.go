@@ -4,11 +4,14 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 
 	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/engine/tiered"
 	"github.com/OutOfStack/db/internal/wal"
 )
 
@@ -41,11 +44,14 @@ type ServerConfig struct {
 	Replication ServerReplicationConfig `yaml:"replication"`
 	Network     ServerNetworkConfig     `yaml:"network"`
 	Logging     ServerLoggingConfig     `yaml:"logging"`
+	Scrub       ServerScrubConfig       `yaml:"scrub"`
+	Metrics     ServerMetricsConfig     `yaml:"metrics"`
+	SlowLog     ServerSlowLogConfig     `yaml:"slowlog"`
 }
 
 // ServerReplicationConfig controls master/standby log shipping. Role is "master", "standby", or empty (standalone). A
 // master streams its WAL to standbys that connect to ListenAddress; a standby connects to MasterAddress. Replication
-// requires WAL persistence to be enabled.
+// requires WAL persistence to be enabled, except with the tiered engine, which keeps a replication log of its own.
 type ServerReplicationConfig struct {
 	Role             string        `yaml:"role"`
 	ListenAddress    string        `yaml:"listen_address"`
@@ -56,27 +62,38 @@ type ServerReplicationConfig struct {
 	AllowRemotePromote bool `yaml:"allow_remote_promote"`
 }
 
-// ServerWALConfig controls durable write-ahead logging and snapshots. SegmentSizeMB is measured in MiB.
+// ServerWALConfig controls durable write-ahead logging and snapshots. SegmentSizeMB is measured in MiB. A non-empty
+// ArchiveDir keeps a copy of every snapshot and of every segment before it is pruned, for point-in-time recovery;
+// ArchiveCompress gzips the copies. SnapshotCompress compresses the blocks of new snapshots, which also shrinks what a
+// master ships to a standby it resyncs.
 type ServerWALConfig struct {
 	Enabled          bool           `yaml:"enabled"`
 	DataDir          string         `yaml:"data_dir"`
 	Sync             wal.SyncPolicy `yaml:"sync"`
 	SegmentSizeMB    int64          `yaml:"segment_size"`
 	SnapshotInterval time.Duration  `yaml:"snapshot_interval"`
+	ArchiveDir       string         `yaml:"archive_dir"`
+	ArchiveCompress  bool           `yaml:"archive_compress"`
+	SnapshotCompress bool           `yaml:"snapshot_compress"`
 }
 
 // ServerEngineConfig holds configuration for the database engine. Type is "in_memory" (RAM-only) or "tiered"
 // (memory/disk). The Tiered* fields apply only to the tiered engine, which provides its own durability and therefore
-// cannot be combined with the WAL or replication.
+// cannot be combined with the WAL. Under replication it keeps a replication log in the "replication" directory under
+// DataDir, sized and pruned by the wal segment_size and snapshot_interval settings.
 type ServerEngineConfig struct {
-	Type                string         `yaml:"type"`
-	DataDir             string         `yaml:"data_dir"`
-	MaxMemoryMB         int64          `yaml:"max_memory"`           // hot values kept in RAM (MiB)
-	MaxStorageMB        int64          `yaml:"max_storage"`          // live dataset ceiling (MiB)
-	Sync                wal.SyncPolicy `yaml:"sync"`                 // fsync policy for segments
-	SegmentSizeMB       int64          `yaml:"segment_size"`         // segment file size (MiB)
-	CompactionThreshold float64        `yaml:"compaction_threshold"` // reclaim a segment past this dead-bytes ratio
-	CompactionInterval  time.Duration  `yaml:"compaction_interval"`  // compaction/stats check period
+	Type                string             `yaml:"type"`
+	DataDir             string             `yaml:"data_dir"`
+	MaxMemoryMB         int64              `yaml:"max_memory"`           // hot values kept in RAM (MiB)
+	MaxStorageMB        int64              `yaml:"max_storage"`          // live dataset ceiling (MiB)
+	Sync                wal.SyncPolicy     `yaml:"sync"`                 // fsync policy for segments
+	SegmentSizeMB       int64              `yaml:"segment_size"`         // segment file size (MiB)
+	CompactionThreshold float64            `yaml:"compaction_threshold"` // reclaim a segment past this dead-bytes ratio
+	CompactionInterval  time.Duration      `yaml:"compaction_interval"`  // compaction/stats check period
+	CompactionRateMB    int64              `yaml:"compaction_rate"`      // MiB/s compaction reads; 0 is unlimited
+	CompactionWindow    tiered.Window      `yaml:"compaction_window"`    // HH:MM-HH:MM for background passes
+	Compression         tiered.Compression `yaml:"compression"`          // how new values are stored: none or flate
+	CompressionMinSize  int                `yaml:"compression_min_size"` // bytes; shorter values are stored as is
 }
 
 // ServerNetworkConfig - network-related configuration for the database server
@@ -88,6 +105,26 @@ type ServerNetworkConfig struct {
 	ShutdownTimeout  time.Duration `yaml:"shutdown_timeout"`
 }
 
+// ServerScrubConfig controls the background scrubber, which re-reads the files the server keeps on disk (tiered
+// segments, WAL segments and snapshots) to find damage before a read or a restart does. Interval 0 disables it; RateMB
+// caps its reads in MiB per second, so a pass does not compete with serving.
+type ServerScrubConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	RateMB   int64         `yaml:"rate"`
+}
+
+// ServerMetricsConfig controls the HTTP listener serving Prometheus metrics at /metrics. An empty Address disables it.
+type ServerMetricsConfig struct {
+	Address string `yaml:"address"`
+}
+
+// ServerSlowLogConfig controls the slow log read by SLOWLOG: it keeps the latest MaxLen commands that took Threshold
+// or longer. A Threshold of 0 keeps every command; a MaxLen of 0 keeps none.
+type ServerSlowLogConfig struct {
+	Threshold time.Duration `yaml:"threshold"`
+	MaxLen    int           `yaml:"max_len"`
+}
+
 // ServerLoggingConfig - logging configuration including log level and output destination. Level can be "debug", "info",
 // "warn", or "error". Output can be empty for stdout or a file path
 type ServerLoggingConfig struct {
@@ -108,6 +145,8 @@ func DefaultServerConfig() *ServerConfig {
 			SegmentSizeMB:       64,
 			CompactionThreshold: 0.5,
 			CompactionInterval:  30 * time.Second,
+			Compression:         tiered.CompressionNone,
+			CompressionMinSize:  256,
 		},
 		WAL: ServerWALConfig{
 			Enabled:          false,
@@ -131,6 +170,14 @@ func DefaultServerConfig() *ServerConfig {
 			Level:  defaultLogLevel,
 			Output: "",
 		},
+		Scrub: ServerScrubConfig{
+			Interval: 24 * time.Hour,
+			RateMB:   8,
+		},
+		SlowLog: ServerSlowLogConfig{
+			Threshold: 10 * time.Millisecond,
+			MaxLen:    128,
+		},
 	}
 }
 
@@ -172,7 +219,7 @@ func (c *ServerConfig) applyEnvOverrides() error {
 
 // Validate checks if the configuration values are valid
 func (c *ServerConfig) Validate() error {
-	if err := c.Engine.validate(c.WAL.Enabled, c.Replication.Role); err != nil {
+	if err := c.Engine.validate(c.WAL.Enabled); err != nil {
 		return err
 	}
 	if err := c.Network.validate(); err != nil {
@@ -181,13 +228,24 @@ func (c *ServerConfig) Validate() error {
 	if err := c.Logging.validate(); err != nil {
 		return err
 	}
+	if err := c.Scrub.validate(); err != nil {
+		return err
+	}
+	if err := c.Metrics.validate(c.Network.Address); err != nil {
+		return err
+	}
+	if err := c.SlowLog.validate(); err != nil {
+		return err
+	}
 	if c.Engine.Type == engine.TypeInMemory && c.WAL.DataDir == "" {
 		return errors.New("wal dataDir cannot be empty")
 	}
-	if err := c.WAL.validate(); err != nil {
+	// a replicated tiered engine keeps a WAL as its replication log, whether or not wal.enabled is set
+	logged := c.WAL.Enabled || (c.Engine.Type == engine.TypeTiered && c.Replication.Role != RoleStandalone)
+	if err := c.WAL.validate(logged); err != nil {
 		return err
 	}
-	return c.Replication.validate(c.WAL.Enabled)
+	return c.Replication.validate(logged)
 }
 
 func (c *ServerNetworkConfig) validate() error {
@@ -221,8 +279,55 @@ func (c *ServerLoggingConfig) validate() error {
 	}
 }
 
-func (c *ServerWALConfig) validate() error {
-	if !c.Enabled {
+func (c *ServerMetricsConfig) validate(serverAddress string) error {
+	if c.Address == "" {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return fmt.Errorf("invalid metrics address: %w", err)
+	}
+	if c.Address == serverAddress {
+		return errors.New("metrics address cannot be the network address")
+	}
+	return nil
+}
+
+func (c *ServerSlowLogConfig) validate() error {
+	if c.Threshold < 0 {
+		return errors.New("slowlog threshold cannot be negative")
+	}
+	if c.MaxLen < 0 {
+		return errors.New("slowlog max_len cannot be negative")
+	}
+	return nil
+}
+
+func (c *ServerScrubConfig) validate() error {
+	if c.Interval < 0 {
+		return errors.New("scrub interval cannot be negative")
+	}
+	if c.Interval == 0 {
+		return nil
+	}
+	if c.RateMB <= 0 {
+		return errors.New("scrub rate must be positive")
+	}
+	if c.RateMB > maxMB {
+		return errors.New("scrub rate overflows bytes")
+	}
+	return nil
+}
+
+func (c *ServerWALConfig) validate(used bool) error {
+	if c.ArchiveDir != "" {
+		if !c.Enabled {
+			return errors.New("wal archiveDir requires wal to be enabled")
+		}
+		if filepath.Clean(c.ArchiveDir) == filepath.Clean(c.DataDir) {
+			return errors.New("wal archiveDir must differ from wal dataDir")
+		}
+	}
+	if !used {
 		return nil
 	}
 	switch c.Sync {
@@ -243,8 +348,8 @@ func (c *ServerWALConfig) validate() error {
 }
 
 // validate checks engine settings. The tiered engine keeps its own durable segment store, so it is mutually exclusive
-// with the WAL and with replication (which ships the WAL); enabling either alongside it is a configuration error.
-func (c *ServerEngineConfig) validate(walEnabled bool, replicationRole string) error {
+// with the WAL; enabling both is a configuration error.
+func (c *ServerEngineConfig) validate(walEnabled bool) error {
 	switch c.Type {
 	case engine.TypeInMemory:
 		return nil
@@ -256,9 +361,6 @@ func (c *ServerEngineConfig) validate(walEnabled bool, replicationRole string) e
 	if walEnabled {
 		return errors.New("engine tiered cannot be combined with wal.enabled (it has its own durable store)")
 	}
-	if replicationRole != RoleStandalone {
-		return errors.New("engine tiered does not support replication yet")
-	}
 	if c.DataDir == "" {
 		return errors.New("engine data_dir cannot be empty")
 	}
@@ -293,6 +395,23 @@ func (c *ServerEngineConfig) validateTieredStorage() error {
 	if c.CompactionInterval <= 0 {
 		return errors.New("engine compaction_interval must be positive")
 	}
+	if c.CompactionRateMB < 0 {
+		return errors.New("engine compaction_rate cannot be negative")
+	}
+	if c.CompactionRateMB > maxMB {
+		return errors.New("engine compaction_rate overflows bytes")
+	}
+	if err := c.CompactionWindow.Validate(); err != nil {
+		return fmt.Errorf("engine %w", err)
+	}
+	switch c.Compression {
+	case tiered.CompressionNone, tiered.CompressionFlate:
+	default:
+		return fmt.Errorf("unsupported engine compression: %s", c.Compression)
+	}
+	if c.CompressionMinSize < 0 {
+		return errors.New("engine compression_min_size cannot be negative")
+	}
 	switch c.Sync {
 	case wal.SyncAlways, wal.SyncEverySec, wal.SyncNo:
 	default:
@@ -301,8 +420,9 @@ func (c *ServerEngineConfig) validateTieredStorage() error {
 	return nil
 }
 
-// validate checks replication settings. Replication requires WAL persistence, since the WAL is the replication stream.
-func (r *ServerReplicationConfig) validate(walEnabled bool) error {
+// validate checks replication settings. Replication requires a WAL, since the WAL is the replication stream; logged
+// reports whether the server keeps one.
+func (r *ServerReplicationConfig) validate(logged bool) error {
 	switch r.Role {
 	case RoleStandalone:
 		return nil
@@ -320,7 +440,7 @@ func (r *ServerReplicationConfig) validate(walEnabled bool) error {
 	default:
 		return fmt.Errorf("unsupported replication role: %s", r.Role)
 	}
-	if !walEnabled {
+	if !logged {
 		return errors.New("replication requires wal.enabled")
 	}
 	return nil
@@ -68,6 +68,18 @@ func (e *Engine) Keys(_ context.Context, table string) []string {
 	return keys
 }
 
+// KeyCounts returns the number of keys in every table.
+func (e *Engine) KeyCounts(_ context.Context) map[string]int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	counts := make(map[string]int, len(e.store))
+	for table, keys := range e.store {
+		counts[table] = len(keys)
+	}
+	return counts
+}
+
 // New creates a new Engine instance
 func New() *Engine {
 	return &Engine{
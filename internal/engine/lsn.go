@@ -0,0 +1,29 @@
+package engine
+
+import (
+	"context"
+	"io"
+)
+
+type lsnKey struct{}
+
+// WithLSN returns a context carrying the log sequence number of the mutation applied under it. The storage layer sets it
+// when a logged mutation reaches the engine; an engine with its own durable files (tiered) stamps its records with it,
+// so after a restart it knows which log records it already holds. The in-memory engine ignores it.
+func WithLSN(ctx context.Context, lsn uint64) context.Context {
+	return context.WithValue(ctx, lsnKey{}, lsn)
+}
+
+// LSNFrom returns the LSN set by WithLSN, or 0 for a mutation that was not logged.
+func LSNFrom(ctx context.Context) uint64 {
+	lsn, _ := ctx.Value(lsnKey{}).(uint64)
+	return lsn
+}
+
+// SegmentSet is a frozen, point-in-time view of an engine's segment files, used to ship them to a standby. The files are
+// kept from being compacted away until Release.
+type SegmentSet interface {
+	// Each calls fn with every file, oldest first, and the bytes it held when the set was frozen.
+	Each(fn func(name string, size int64, data io.Reader) error) error
+	Release()
+}
@@ -0,0 +1,101 @@
+package tiered_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/engine/tiered"
+)
+
+// TestCheckpointOpensIndependently takes a checkpoint of an engine with sealed segments and a partly written active
+// one, then changes and compacts the original: an engine opened on the checkpoint sees exactly the data at the
+// checkpoint, and its own writes leave the original alone.
+func TestCheckpointOpensIndependently(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	cfg.SegmentSize = 1024
+	e := open(t, cfg)
+	ctx := context.Background()
+	n := fillSegments(t, e, 2)
+	if err := e.Set(engine.WithLSN(ctx, 99), "t", "last", "in the active segment"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(t.TempDir(), "checkpoint")
+	manifest, err := e.Checkpoint(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.LSN != 99 || len(manifest.Segments) < 3 {
+		t.Fatalf("manifest = %+v, want LSN 99 and every segment", manifest)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, tiered.CheckpointManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written tiered.CheckpointManifest
+	if err = json.Unmarshal(data, &written); err != nil || len(written.Segments) != len(manifest.Segments) {
+		t.Fatalf("manifest file = %s, %v", data, err)
+	}
+
+	// the original moves on: a key changes, another goes, and compaction reclaims the checkpointed segments
+	if err = e.Set(ctx, "t", "k0001", "after the checkpoint"); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Del(ctx, "t", "last"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.CompactNow(true); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := open(t, testConfig(dir))
+	if got := restored.AppliedLSN(); got != 99 {
+		t.Fatalf("restored AppliedLSN = %d, want 99", got)
+	}
+	if got := mustGet(t, restored, "t", "last"); got != "in the active segment" {
+		t.Fatalf("last = %q", got)
+	}
+	if got := mustGet(t, restored, "t", "k0001"); got != "value-that-fills-segments" {
+		t.Fatalf("k0001 = %q, want the value at the checkpoint", got)
+	}
+	if keys := restored.Keys(ctx, "t"); len(keys) != n+1 {
+		t.Fatalf("restored %d keys, want %d", len(keys), n+1)
+	}
+
+	for i := range 50 {
+		if err = restored.Set(ctx, "t", fmt.Sprintf("k%04d", i), "written to the checkpoint"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	restored.Compact()
+	if got := mustGet(t, e, "t", "k0002"); got != "value-that-fills-segments" {
+		t.Fatalf("original k0002 = %q after writes to the checkpoint", got)
+	}
+	if _, err = e.Get(ctx, "t", "last"); !errors.Is(err, engine.ErrNotFound) {
+		t.Fatalf("original last = %v, want it still deleted", err)
+	}
+}
+
+func TestCheckpointRefusesUsedDirectory(t *testing.T) {
+	dataDir := t.TempDir()
+	e := open(t, testConfig(dataDir))
+	if err := e.Set(context.Background(), "t", "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Checkpoint(filepath.Join(dataDir, "backup")); err == nil {
+		t.Fatal("Checkpoint() wrote into the data directory")
+	}
+	used := t.TempDir()
+	if err := os.WriteFile(filepath.Join(used, "note"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Checkpoint(used); err == nil {
+		t.Fatal("Checkpoint() wrote into a directory that is not empty")
+	}
+}
@@ -1,37 +1,112 @@
 package tiered
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"slices"
 	"time"
+
+	"github.com/OutOfStack/db/internal/info"
+	"github.com/OutOfStack/db/internal/metrics"
+	"github.com/OutOfStack/db/internal/scrub"
+)
+
+// compactionHistory is how many finished compactions Stats reports.
+const compactionHistory = 16
+
+// ErrCompactionRunning is returned by CompactNow while an earlier manual run is still going.
+var ErrCompactionRunning = errors.New("compaction already running")
+
+var (
+	errCompactionBusy   = errors.New("another compaction pass is running or the segments are frozen")
+	errNothingToCompact = errors.New("no segment to compact")
 )
 
-// Stats is a point-in-time snapshot of engine counters, used for observability and tests.
+// CompactionRecord describes one finished compaction pass over a segment. BytesRead is the size of the segment,
+// BytesRewritten what its live records and still-needed tombstones took in the active segment, and BytesReclaimed the
+// difference, what the disk got back. A failed pass reclaims nothing and carries its error.
+type CompactionRecord struct {
+	Segment        uint32
+	Started        time.Time
+	Duration       time.Duration
+	BytesRead      int64
+	BytesRewritten int64
+	BytesReclaimed int64
+	Manual         bool
+	Error          string
+}
+
+// CompactionProgress describes the compaction pass in flight. Queued counts the segments a manual run still has to go
+// through after this one.
+type CompactionProgress struct {
+	Segment   uint32
+	Started   time.Time
+	BytesRead int64
+	Size      int64
+	Manual    bool
+	Queued    int
+}
+
+// Stats is a point-in-time snapshot of engine counters, used for observability and tests. ValueBytes is the size of the
+// live values and StoredValueBytes what they take in the segments; CompressionRatio is the first over the second, 1
+// with nothing compressed (or nothing stored). Hits and Misses count point reads; Cache breaks the hits down by cache
+// segment, and ScanReads counts the values bulk iterators read from disk without caching. Compaction is the pass in
+// flight, nil when none is; CompactionHistory lists the latest finished ones, oldest first, and BytesReclaimed sums what
+// every pass since the engine opened gave back.
 type Stats struct {
-	Keys        int
-	LiveBytes   int64
-	DiskBytes   int64
-	Segments    int
-	Hits        uint64
-	Misses      uint64
-	Compactions uint64
+	Keys              int
+	LiveBytes         int64
+	DiskBytes         int64
+	Segments          int
+	Hits              uint64
+	Misses            uint64
+	Compactions       uint64
+	ValueBytes        int64
+	StoredValueBytes  int64
+	CompressionRatio  float64
+	Cache             CacheStats
+	ScanReads         uint64
+	Compaction        *CompactionProgress
+	CompactionHistory []CompactionRecord
+	BytesReclaimed    int64
 }
 
 // Stats returns a snapshot of engine metrics.
 func (e *Engine) Stats() Stats {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
+	ratio := 1.0
+	if e.storedBytes > 0 {
+		ratio = float64(e.valueBytes) / float64(e.storedBytes)
+	}
+	var progress *CompactionProgress
+	if e.progress != nil {
+		current := *e.progress
+		progress = &current
+	}
 	return Stats{
-		Keys:        e.keyCount(),
-		LiveBytes:   e.liveBytes,
-		DiskBytes:   e.store.diskBytes(),
-		Segments:    len(e.store.sizes),
-		Hits:        e.hits.Load(),
-		Misses:      e.misses.Load(),
-		Compactions: e.compactions.Load(),
+		Keys:              e.keyCount(),
+		LiveBytes:         e.liveBytes,
+		DiskBytes:         e.store.diskBytes(),
+		Segments:          len(e.store.sizes),
+		Hits:              e.hits.Load(),
+		Misses:            e.misses.Load(),
+		Compactions:       e.compactions.Load(),
+		ValueBytes:        e.valueBytes,
+		StoredValueBytes:  e.storedBytes,
+		CompressionRatio:  ratio,
+		Cache:             e.lru.stats(),
+		ScanReads:         e.scanReads.Load(),
+		Compaction:        progress,
+		CompactionHistory: slices.Clone(e.history),
+		BytesReclaimed:    e.reclaimed,
 	}
 }
 
-// maintenanceLoop periodically compacts a reclaimable segment and logs stats.
+// maintenanceLoop periodically compacts a reclaimable segment, when the compaction window allows it and no manual run
+// is going, and logs stats.
 func (e *Engine) maintenanceLoop(interval time.Duration) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
@@ -40,7 +115,12 @@ func (e *Engine) maintenanceLoop(interval time.Duration) {
 		case <-e.done:
 			return
 		case <-ticker.C:
-			e.Compact()
+			e.mu.RLock()
+			manual := e.manual
+			e.mu.RUnlock()
+			if !manual && e.window.contains(time.Now()) {
+				e.Compact()
+			}
 			e.logStats()
 		}
 	}
@@ -49,69 +129,286 @@ func (e *Engine) maintenanceLoop(interval time.Duration) {
 func (e *Engine) logStats() {
 	s := e.Stats()
 	total := s.Hits + s.Misses
-	var hitRate float64
+	var hitRate, protectedRate float64
 	if total > 0 {
 		hitRate = float64(s.Hits) / float64(total)
+		protectedRate = float64(s.Cache.ProtectedHits) / float64(total)
 	}
 	e.logger.Info("Tiered engine stats",
 		"keys", s.Keys, "live_bytes", s.LiveBytes, "disk_bytes", s.DiskBytes,
-		"segments", s.Segments, "cache_hit_rate", hitRate, "compactions", s.Compactions)
+		"segments", s.Segments, "cache_hit_rate", hitRate, "cache_protected_hit_rate", protectedRate,
+		"cache_bytes", s.Cache.ProbationBytes+s.Cache.ProtectedBytes, "scan_reads", s.ScanReads,
+		"compactions", s.Compactions, "bytes_reclaimed", s.BytesReclaimed, "compression_ratio", s.CompressionRatio)
+}
+
+// Info reports the tiered section of INFO, the figures of Stats: keys and bytes, the cache and its hit rate,
+// compression and compaction, with the pass in flight and the latest finished one.
+func (e *Engine) Info(_ context.Context) info.Section {
+	s := e.Stats()
+	var hitRate float64
+	if total := s.Hits + s.Misses; total > 0 {
+		hitRate = float64(s.Hits) / float64(total)
+	}
+	section := info.Section{Name: "tiered"}
+	section.Add("keys", s.Keys)
+	section.Add("live_bytes", s.LiveBytes)
+	section.Add("disk_bytes", s.DiskBytes)
+	section.Add("segments", s.Segments)
+	section.Add("cache_hits", s.Hits)
+	section.Add("cache_misses", s.Misses)
+	section.Add("cache_hit_rate", hitRate)
+	section.Add("cache_probation_hits", s.Cache.ProbationHits)
+	section.Add("cache_protected_hits", s.Cache.ProtectedHits)
+	section.Add("cache_bytes", s.Cache.ProbationBytes+s.Cache.ProtectedBytes)
+	section.Add("cache_entries", s.Cache.ProbationEntries+s.Cache.ProtectedEntries)
+	section.Add("scan_reads", s.ScanReads)
+	section.Add("value_bytes", s.ValueBytes)
+	section.Add("stored_value_bytes", s.StoredValueBytes)
+	section.Add("compression_ratio", s.CompressionRatio)
+	section.Add("compactions", s.Compactions)
+	section.Add("bytes_reclaimed", s.BytesReclaimed)
+	section.Add("compaction_running", s.Compaction != nil)
+	if s.Compaction != nil {
+		section.Add("compaction_segment", s.Compaction.Segment)
+		section.Add("compaction_bytes_read", s.Compaction.BytesRead)
+		section.Add("compaction_size", s.Compaction.Size)
+		section.Add("compaction_queued", s.Compaction.Queued)
+	}
+	if n := len(s.CompactionHistory); n > 0 {
+		last := s.CompactionHistory[n-1]
+		section.Add("last_compaction_time", last.Started)
+		section.Add("last_compaction_segment", last.Segment)
+		section.Add("last_compaction_reclaimed", last.BytesReclaimed)
+	}
+	return section
+}
+
+// Collect reports the figures of Stats as metrics.
+func (e *Engine) Collect(enc *metrics.Encoder) {
+	s := e.Stats()
+	enc.Gauge("db_tiered_keys", "Live keys in the tiered engine.", float64(s.Keys))
+	enc.Gauge("db_tiered_live_bytes", "Bytes of the live records in the tiered segments.", float64(s.LiveBytes))
+	enc.Gauge("db_tiered_disk_bytes", "Bytes of the tiered segment files.", float64(s.DiskBytes))
+	enc.Gauge("db_tiered_segments", "Tiered segment files.", float64(s.Segments))
+	enc.Counter("db_tiered_cache_hits_total", "Point reads served from the cache, by cache segment.",
+		float64(s.Cache.ProbationHits), metrics.Label{Name: "segment", Value: "probation"})
+	enc.Counter("db_tiered_cache_hits_total", "", float64(s.Cache.ProtectedHits),
+		metrics.Label{Name: "segment", Value: "protected"})
+	enc.Counter("db_tiered_cache_misses_total", "Point reads that went to disk.", float64(s.Misses))
+	enc.Gauge("db_tiered_cache_bytes", "Bytes of values in the cache, by cache segment.", float64(s.Cache.ProbationBytes),
+		metrics.Label{Name: "segment", Value: "probation"})
+	enc.Gauge("db_tiered_cache_bytes", "", float64(s.Cache.ProtectedBytes),
+		metrics.Label{Name: "segment", Value: "protected"})
+	enc.Counter("db_tiered_scan_reads_total", "Values bulk iterators read from disk without caching.",
+		float64(s.ScanReads))
+	enc.Gauge("db_tiered_compression_ratio", "Live value bytes over the bytes they take in the segments.",
+		s.CompressionRatio)
+	enc.Counter("db_tiered_compactions_total", "Compaction passes finished.", float64(s.Compactions))
+	enc.Counter("db_tiered_compaction_reclaimed_bytes_total", "Bytes compaction gave back.", float64(s.BytesReclaimed))
+	running := 0.0
+	if s.Compaction != nil {
+		running = 1
+	}
+	enc.Gauge("db_tiered_compaction_running", "Whether a compaction pass is in flight.", running)
 }
 
-// Compact runs one compaction pass immediately, independent of the background interval: it reclaims the oldest sealed
-// segment whose dead-bytes ratio exceeds the threshold, rewriting its live records into the active segment. Useful for
-// operators and for deterministic tests.
+// Compact runs one compaction pass immediately, independent of the background interval and window: it reclaims the
+// oldest sealed segment whose dead-bytes ratio exceeds the threshold, rewriting its live records into the active
+// segment. Useful for deterministic tests.
 func (e *Engine) Compact() {
-	seg, file, ok := e.beginCompaction()
-	if !ok {
+	seg, file, format, err := e.beginCompaction(e.pickCompactible)
+	if err != nil {
 		return
 	}
+	ctx, cancel := e.stopContext()
+	defer cancel()
+	_ = e.compactSegment(ctx, seg, file, format, false) // logged and kept in the history
+}
+
+// CompactNow starts a manual compaction run in the background and returns how many segments it will go through: every
+// sealed segment past the dead-bytes threshold, or with force every sealed segment holding any dead bytes at all. It
+// ignores the compaction window but not the rate limit. Segments sealed after the call are left to later passes.
+func (e *Engine) CompactNow(force bool) (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closed {
+		return 0, errClosed
+	}
+	if e.manual {
+		return 0, ErrCompactionRunning
+	}
+	// segments below the active one are the sealed ones the run may pick: it must not chase its own output
+	limit := e.store.activeSeg
+	queued := 0
+	for _, seg := range e.store.segments() {
+		if seg < limit && e.compactible(seg, force) {
+			queued++
+		}
+	}
+	if queued == 0 {
+		return 0, nil
+	}
+	e.manual = true
+	e.wg.Go(func() { e.manualCompaction(force, limit, queued) })
+	return queued, nil
+}
+
+// SetCompactionThreshold changes the dead-bytes ratio past which a sealed segment is compacted. It applies from the next
+// background pass or CompactNow; a pass in flight finishes the segment it picked.
+func (e *Engine) SetCompactionThreshold(threshold float64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.threshold = threshold
+}
+
+// manualCompaction runs the passes CompactNow queued, waiting its turn while a background pass runs or the segments are
+// frozen for shipping, until none is left or the engine closes.
+func (e *Engine) manualCompaction(force bool, limit uint32, queued int) {
+	ctx, cancel := e.stopContext()
+	defer cancel()
+	defer func() {
+		e.mu.Lock()
+		e.manual = false
+		e.mu.Unlock()
+	}()
+	e.logger.Info("Manual compaction started", "segments", queued, "force", force)
+	// a segment whose pass failed is not picked again, or the run would retry it forever
+	failed := make(map[uint32]bool)
+	pick := func() (uint32, bool) {
+		for _, seg := range e.store.segments() {
+			if seg < limit && seg != e.store.activeSeg && !failed[seg] && e.compactible(seg, force) {
+				return seg, true
+			}
+		}
+		return 0, false
+	}
+	for {
+		seg, file, format, err := e.beginCompaction(pick)
+		if errors.Is(err, errCompactionBusy) {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(100 * time.Millisecond):
+				continue
+			}
+		}
+		if err != nil {
+			e.logger.Info("Manual compaction finished")
+			return
+		}
+		e.mu.Lock()
+		queued = max(queued-1, 0)
+		e.progress.Manual, e.progress.Queued = true, queued
+		e.mu.Unlock()
+		if err = e.compactSegment(ctx, seg, file, format, true); err != nil {
+			failed[seg] = true
+		}
+	}
+}
+
+// stopContext returns a context canceled once the engine starts closing, so a throttled pass does not hold Close up.
+func (e *Engine) stopContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	return ctx, cancel
+}
+
+// compactSegment rewrites the live records of a segment claimed by beginCompaction into the active segment and unlinks
+// it, pacing its reads by the compaction rate limit, and records the pass in the history.
+func (e *Engine) compactSegment(ctx context.Context, seg uint32, file *os.File, format byte, manual bool) error {
 	defer e.endCompaction()
 
+	// a throttle per pass: one kept across passes would bank the idle time between them and let the next burst
+	throttle := scrub.NewThrottle(e.compactionRate)
+	var rewritten int64
 	var rewriteErr error
-	_, scanErr := scanPinnedSegment(seg, file, false, func(rec decoded, recPos int64) {
+	_, scanErr := scanPinnedSegment(seg, file, format, false, func(rec decoded, recPos int64) {
 		if rewriteErr != nil {
 			return
 		}
+		if rewriteErr = throttle.Wait(ctx, int(rec.recSize)); rewriteErr != nil {
+			return
+		}
 		e.mu.Lock()
+		defer e.mu.Unlock()
 		if !e.closed {
-			rewriteErr = e.rewriteRecord(seg, rec, recPos)
+			var written int64
+			written, rewriteErr = e.rewriteRecord(seg, rec, recPos)
+			rewritten += written
 		}
-		e.mu.Unlock()
+		e.progress.BytesRead = recPos + rec.recSize
 	})
 	e.store.unpin(seg)
-	if scanErr != nil || rewriteErr != nil {
-		if scanErr == nil {
-			scanErr = rewriteErr
-		}
-		e.logger.Error("Compaction failed", "segment", seg, "error", scanErr)
-		return
+	err := scanErr
+	if err == nil {
+		err = rewriteErr
+	}
+	if err == nil {
+		err = e.finishCompaction(seg)
 	}
-	if err := e.finishCompaction(seg); err != nil {
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	record := CompactionRecord{
+		Segment:        seg,
+		Started:        e.progress.Started,
+		Duration:       time.Since(e.progress.Started),
+		BytesRead:      e.progress.Size,
+		BytesRewritten: rewritten,
+		Manual:         manual,
+	}
+	e.progress = nil
+	if e.closed {
+		return err
+	}
+	if err != nil {
+		record.Error = err.Error()
 		e.logger.Error("Compaction failed", "segment", seg, "error", err)
+	} else {
+		record.BytesReclaimed = record.BytesRead - rewritten
+		e.reclaimed += record.BytesReclaimed
+		e.logger.Info("Compacted segment", "segment", seg, "bytes_reclaimed", record.BytesReclaimed,
+			"bytes_rewritten", rewritten, "duration", record.Duration, "manual", manual)
+	}
+	if len(e.history) == compactionHistory {
+		e.history = slices.Delete(e.history, 0, 1)
 	}
+	e.history = append(e.history, record)
+	return err
 }
 
-// beginCompaction claims the compaction slot and picks a segment to reclaim. Only one pass runs at a time: two passes
-// over the same segment would let one delete the file the other is still reading.
-func (e *Engine) beginCompaction() (uint32, *os.File, bool) {
+// beginCompaction claims the compaction slot and picks a segment to reclaim, returning it pinned with its format. Only
+// one pass runs at a time: two passes over the same segment would let one delete the file the other is still reading.
+// None runs while the segments are frozen for shipping either, since the frozen files must outlive the transfer.
+func (e *Engine) beginCompaction(pick func() (uint32, bool)) (uint32, *os.File, byte, error) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	if e.compacting || e.closed {
-		return 0, nil, false
+	if e.closed {
+		return 0, nil, 0, errClosed
+	}
+	if e.compacting || e.frozen > 0 {
+		return 0, nil, 0, errCompactionBusy
 	}
-	seg, ok := e.pickCompactible()
+	seg, ok := pick()
 	if !ok {
-		return 0, nil, false
+		return 0, nil, 0, errNothingToCompact
 	}
 	file, ok := e.store.pin(seg)
 	if !ok {
-		return 0, nil, false
+		return 0, nil, 0, fmt.Errorf("pin segment %d: %w", seg, errNothingToCompact)
 	}
 	e.compacting = true
 	e.compactWG.Add(1)
-	return seg, file, true
+	e.progress = &CompactionProgress{Segment: seg, Started: time.Now(), Size: e.store.sizes[seg]}
+	return seg, file, e.store.formats[seg], nil
 }
 
 func (e *Engine) endCompaction() {
@@ -125,39 +422,52 @@ func (e *Engine) endCompaction() {
 // it is still being appended to.
 func (e *Engine) pickCompactible() (uint32, bool) {
 	for _, seg := range e.store.segments() {
-		if seg == e.store.activeSeg {
-			continue
-		}
-		size := e.store.dataSize(seg)
-		if size == 0 {
-			continue
-		}
-		dead := size - e.segLive[seg]
-		if float64(dead)/float64(size) >= e.threshold {
+		if seg != e.store.activeSeg && e.compactible(seg, false) {
 			return seg, true
 		}
 	}
 	return 0, false
 }
 
+// compactible reports whether a segment's dead bytes reach the threshold, or with force whether it has any.
+func (e *Engine) compactible(seg uint32, force bool) bool {
+	size := e.store.dataSize(seg)
+	if size == 0 {
+		return false
+	}
+	dead := size - e.segLive[seg]
+	if force {
+		return dead > 0
+	}
+	return float64(dead)/float64(size) >= e.threshold
+}
+
 // rewriteRecord copies one still-live record into the active segment. A record is live iff the keydir points at its
-// exact (segment, offset); everything else is a superseded overwrite or a tombstone.
-func (e *Engine) rewriteRecord(seg uint32, rec decoded, recPos int64) error {
+// exact (segment, offset); everything else is a superseded overwrite or a tombstone. It returns the bytes it appended.
+func (e *Engine) rewriteRecord(seg uint32, rec decoded, recPos int64) (int64, error) {
 	if rec.tombstone {
 		return e.keepTombstone(seg, rec)
 	}
 	location, ok := e.lookup(rec.table, rec.key)
-	if !ok || location.seg != seg || location.valPos != valPosFor(recPos, rec.table, rec.key) {
-		return nil // dead: overwritten or deleted since it was written
+	if !ok || location.seg != seg || location.valPos != recPos+rec.valOff {
+		return 0, nil // dead: overwritten or deleted since it was written
 	}
-	newRec := encodeRecord(rec.table, rec.key, rec.value, false)
+	// the value is carried over as stored, without recompressing it
+	newRec := encodeRecord(rec.table, rec.key, rec.value, rec.codec, false, rec.lsn)
 	newSeg, newRecPos, err := e.store.append(newRec)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	e.dropLive(rec.table, rec.key)
-	e.setLoc(newSeg, rec.table, rec.key, len(rec.value), newRecPos, int64(len(newRec)))
-	return nil
+	e.setLoc(rec.table, rec.key, loc{
+		seg:     newSeg,
+		valLen:  u32(len(rec.value)),
+		rawLen:  rec.rawLen,
+		codec:   rec.codec,
+		valPos:  valPosFor(newRecPos, rec.table, rec.key),
+		recSize: int64(len(newRec)),
+	})
+	return int64(len(newRec)), nil
 }
 
 // finishCompaction makes the rewrites durable and unlinks the reclaimed segment.
@@ -185,13 +495,16 @@ func (e *Engine) finishCompaction(seg uint32) error {
 // keepTombstone carries a delete forward when dropping it could resurrect a key. An older segment may still hold the
 // SET this tombstone buried; once the tombstone's segment is unlinked, recovery would scan that SET with nothing after
 // it and bring the key back. Rewriting into the active segment keeps the delete newer than any surviving value.
-func (e *Engine) keepTombstone(seg uint32, rec decoded) error {
+func (e *Engine) keepTombstone(seg uint32, rec decoded) (int64, error) {
 	if _, live := e.lookup(rec.table, rec.key); live {
-		return nil // a later SET already superseded this delete
+		return 0, nil // a later SET already superseded this delete
 	}
 	if !e.buriedBefore(hashKey(rec.table, rec.key), seg) {
-		return nil // nothing older left to resurrect, so the delete goes away with its segment
+		return 0, nil // nothing older left to resurrect, so the delete goes away with its segment
 	}
-	_, _, err := e.store.append(encodeRecord(rec.table, rec.key, "", true))
-	return err
+	tombstone := encodeRecord(rec.table, rec.key, "", codecNone, true, rec.lsn)
+	if _, _, err := e.store.append(tombstone); err != nil {
+		return 0, err
+	}
+	return int64(len(tombstone)), nil
 }
@@ -0,0 +1,163 @@
+package tiered_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/OutOfStack/db/internal/engine/tiered"
+)
+
+// fillSegments writes keys until the engine has sealed segments, then overwrites every fourth key: each sealed segment
+// is left a quarter dead, under the default threshold.
+func fillSegments(t *testing.T, e *tiered.Engine, segments int) int {
+	t.Helper()
+	ctx := context.Background()
+	n := 0
+	for ; e.Stats().Segments <= segments; n++ {
+		if err := e.Set(ctx, "t", fmt.Sprintf("k%04d", n), "value-that-fills-segments"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i += 4 {
+		if err := e.Set(ctx, "t", fmt.Sprintf("k%04d", i), "rewritten"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return n
+}
+
+func TestCompactNowForce(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	cfg.SegmentSize = 1024
+	e := open(t, cfg)
+	n := fillSegments(t, e, 3)
+
+	queued, err := e.CompactNow(false)
+	if err != nil || queued != 0 {
+		t.Fatalf("CompactNow(false) = %d, %v; want nothing past the threshold", queued, err)
+	}
+	if queued, err = e.CompactNow(true); err != nil || queued < 3 {
+		t.Fatalf("CompactNow(true) = %d, %v; want every sealed segment", queued, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s := e.Stats()
+		if s.Compaction == nil && len(s.CompactionHistory) >= queued {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("manual compaction did not finish: %+v", s.Compaction)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	s := e.Stats()
+	var reclaimed int64
+	for _, record := range s.CompactionHistory {
+		if !record.Manual || record.Error != "" || record.BytesReclaimed <= 0 ||
+			record.BytesReclaimed != record.BytesRead-record.BytesRewritten {
+			t.Fatalf("history record %+v, want a successful manual pass that reclaimed something", record)
+		}
+		reclaimed += record.BytesReclaimed
+	}
+	if s.BytesReclaimed != reclaimed {
+		t.Fatalf("BytesReclaimed = %d, want the history's %d", s.BytesReclaimed, reclaimed)
+	}
+	for i := range n {
+		want := "value-that-fills-segments"
+		if i%4 == 0 {
+			want = "rewritten"
+		}
+		if got := mustGet(t, e, "t", fmt.Sprintf("k%04d", i)); got != want {
+			t.Fatalf("k%04d = %q, want %q", i, got, want)
+		}
+	}
+}
+
+// TestSetCompactionThreshold verifies a lowered threshold makes segments compactible that were not under the old one.
+func TestSetCompactionThreshold(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	cfg.SegmentSize = 1024
+	e := open(t, cfg)
+	fillSegments(t, e, 3)
+
+	if queued, err := e.CompactNow(false); err != nil || queued != 0 {
+		t.Fatalf("CompactNow(false) = %d, %v; want nothing past the threshold", queued, err)
+	}
+	e.SetCompactionThreshold(0.1)
+	if queued, err := e.CompactNow(false); err != nil || queued == 0 {
+		t.Fatalf("CompactNow(false) = %d, %v; want the quarter-dead segments past the lowered threshold", queued, err)
+	}
+}
+
+// TestCompactNowThrottled runs a manual compaction slowed by the rate limit: a second run is refused while it goes,
+// its progress shows in the stats, and Close does not wait for it to finish.
+func TestCompactNowThrottled(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	cfg.SegmentSize = 1024
+	cfg.CompactionRate = 256
+	e, err := tiered.Open(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fillSegments(t, e, 3)
+
+	if _, err = e.CompactNow(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.CompactNow(true); !errors.Is(err, tiered.ErrCompactionRunning) {
+		t.Fatalf("second CompactNow = %v, want ErrCompactionRunning", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if progress := e.Stats().Compaction; progress != nil && progress.Manual && progress.BytesRead > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no progress reported for the manual compaction")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Close waited %v for a throttled compaction", elapsed)
+	}
+}
+
+func TestCompactionWindow(t *testing.T) {
+	at := func(clock string) time.Time {
+		parsed, err := time.Parse("15:04", clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	for _, test := range []struct {
+		window tiered.Window
+		clock  string
+		want   bool
+	}{
+		{"", "12:00", true},
+		{"01:00-05:00", "03:30", true},
+		{"01:00-05:00", "05:00", false},
+		{"22:00-06:00", "23:15", true},
+		{"22:00-06:00", "02:00", true},
+		{"22:00-06:00", "12:00", false},
+	} {
+		if got := tiered.WindowContains(test.window, at(test.clock)); got != test.want {
+			t.Errorf("window %q at %s = %v, want %v", test.window, test.clock, got, test.want)
+		}
+	}
+	for _, bad := range []tiered.Window{"01:00", "01:00-01:00", "1am-5am", "01:00-24:30"} {
+		if err := bad.Validate(); err == nil {
+			t.Errorf("Validate(%q) succeeded", bad)
+		}
+	}
+}
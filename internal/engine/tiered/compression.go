@@ -0,0 +1,116 @@
+package tiered
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Compression selects how the engine stores the values it writes. It only affects new records: every record names its
+// own codec, so segments written with any setting (or by an older build, before values were compressed) read the same.
+type Compression string
+
+const (
+	// CompressionNone stores values as they are.
+	CompressionNone Compression = "none"
+	// CompressionFlate stores values as DEFLATE streams (compress/flate), when that makes them smaller.
+	CompressionFlate Compression = "flate"
+)
+
+// Record codecs, the codec byte of a record. A codecFlate value is stored as its decompressed length (uint32) followed
+// by the DEFLATE stream, so recovery learns the raw size without inflating anything.
+const (
+	codecNone  byte = 0
+	codecFlate byte = 1
+
+	rawLenSize = 4
+)
+
+var errCodec = errors.New("tiered value codec")
+
+// Writers and readers are pooled: each carries tens of KiB of state, too much to allocate per value.
+var (
+	flateWriters = sync.Pool{New: func() any {
+		writer, _ := flate.NewWriter(nil, flate.BestSpeed) // only fails for an invalid level
+		return writer
+	}}
+	flateReaders = sync.Pool{New: func() any { return flate.NewReader(nil) }}
+)
+
+// compressor compresses values under the configured policy.
+type compressor struct {
+	codec   byte
+	minSize int // values shorter than this are stored as they are
+}
+
+func newCompressor(compression Compression, minSize int) (compressor, error) {
+	switch compression {
+	case "", CompressionNone:
+		return compressor{codec: codecNone}, nil
+	case CompressionFlate:
+		return compressor{codec: codecFlate, minSize: minSize}, nil
+	default:
+		return compressor{}, fmt.Errorf("unsupported tiered compression: %s", compression)
+	}
+}
+
+// compress returns the bytes to store for value and their codec. A value is kept as it is when it is below the size
+// threshold or does not shrink: incompressible data would otherwise grow by the DEFLATE framing.
+func (c compressor) compress(value string) (string, byte) {
+	if c.codec == codecNone || len(value) < c.minSize || len(value) == 0 {
+		return value, codecNone
+	}
+	var buf bytes.Buffer
+	buf.Grow(rawLenSize + len(value)/2)
+	buf.Write(binary.BigEndian.AppendUint32(nil, u32(len(value))))
+	writer, _ := flateWriters.Get().(*flate.Writer)
+	writer.Reset(&buf)
+	// writes to a bytes.Buffer cannot fail
+	_, _ = io.WriteString(writer, value)
+	_ = writer.Close()
+	flateWriters.Put(writer)
+	if buf.Len() >= len(value) {
+		return value, codecNone
+	}
+	return buf.String(), codecFlate
+}
+
+// decompress returns the value stored as stored with codec.
+func decompress(codec byte, stored []byte) (string, error) {
+	rawLen, err := rawLength(codec, stored)
+	if err != nil {
+		return "", err
+	}
+	if codec == codecNone {
+		return string(stored), nil
+	}
+	reader, _ := flateReaders.Get().(io.ReadCloser)
+	defer flateReaders.Put(reader)
+	if err = reader.(flate.Resetter).Reset(bytes.NewReader(stored[rawLenSize:]), nil); err != nil { //nolint:forcetypeassert // flate readers implement Resetter
+		return "", fmt.Errorf("%w: %w", errCodec, err)
+	}
+	value := make([]byte, rawLen)
+	if _, err = io.ReadFull(reader, value); err != nil {
+		return "", fmt.Errorf("%w: inflate: %w", errCodec, err)
+	}
+	return string(value), nil
+}
+
+// rawLength returns the decompressed length of a value stored with codec.
+func rawLength(codec byte, stored []byte) (uint32, error) {
+	switch codec {
+	case codecNone:
+		return u32(len(stored)), nil
+	case codecFlate:
+		if len(stored) < rawLenSize {
+			return 0, fmt.Errorf("%w: compressed value of %d bytes has no length", errCodec, len(stored))
+		}
+		return binary.BigEndian.Uint32(stored), nil
+	default:
+		return 0, fmt.Errorf("%w: unknown codec %d", errCodec, codec)
+	}
+}
@@ -0,0 +1,109 @@
+package tiered_test
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/OutOfStack/db/internal/engine/tiered"
+)
+
+// TestCompressionRoundTrip writes compressible, incompressible and small values with flate compression on, and checks
+// they read back intact from disk — before and after a restart, from hints and a scan, and after compaction moves them —
+// while the stats show the compressible one shrank.
+func TestCompressionRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(dir)
+	cfg.MaxMemoryBytes = 1 // every read goes to disk
+	cfg.SegmentSize = 1 << 10
+	cfg.Compression = tiered.CompressionFlate
+	cfg.CompressionMinSize = 64
+	ctx := context.Background()
+
+	noise := make([]byte, 512)
+	_, _ = rand.Read(noise)
+	values := map[string]string{
+		"json":  strings.Repeat(`{"name":"widget","tags":["a","b"],"price":12.5},`, 40),
+		"noise": string(noise),
+		"small": "tiny",
+	}
+
+	e, err := tiered.Open(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for round := range 4 {
+		for key, value := range values {
+			if err = e.Set(ctx, "t", fmt.Sprintf("%s-%d", key, round), value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	check := func(e *tiered.Engine) {
+		t.Helper()
+		for round := range 4 {
+			for key, value := range values {
+				if got := mustGet(t, e, "t", fmt.Sprintf("%s-%d", key, round)); got != value {
+					t.Fatalf("%s-%d: got %d bytes, want %d", key, round, len(got), len(value))
+				}
+			}
+		}
+	}
+	check(e)
+	stats := e.Stats()
+	if stats.StoredValueBytes >= stats.ValueBytes || stats.CompressionRatio <= 1 {
+		t.Fatalf("stats = %+v, want compressible values stored smaller", stats)
+	}
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if segments, hints := segmentFiles(t, dir); len(segments) < 2 || len(hints) == 0 {
+		t.Fatalf("got %d segments and %d hints, want sealed segments with hints", len(segments), len(hints))
+	}
+
+	// reading compressed records does not depend on the compression setting
+	cfg.Compression = tiered.CompressionNone
+	e2, err := tiered.Open(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(e2)
+	if got := e2.Stats(); got.ValueBytes != stats.ValueBytes || got.StoredValueBytes != stats.StoredValueBytes {
+		t.Fatalf("stats after restart = %+v, want value bytes %d/%d", got, stats.ValueBytes, stats.StoredValueBytes)
+	}
+	for round := range 3 {
+		for key := range values {
+			if err = e2.Del(ctx, "t", fmt.Sprintf("%s-%d", key, round)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	before := e2.Stats().Compactions
+	for range 8 {
+		e2.Compact()
+	}
+	if e2.Stats().Compactions == before {
+		t.Fatal("expected a compaction to run")
+	}
+	for key, value := range values {
+		if got := mustGet(t, e2, "t", key+"-3"); got != value {
+			t.Fatalf("%s-3 after compaction: got %d bytes, want %d", key, len(got), len(value))
+		}
+	}
+	if got := e2.Stats(); got.CompressionRatio <= 1 {
+		t.Fatalf("stats after compaction = %+v, want the surviving values still compressed", got)
+	}
+	if err = e2.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompressionRejectsUnknownCodec(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	cfg.Compression = "zip"
+	if _, err := tiered.Open(cfg, nil); err == nil {
+		t.Fatal("want an error for an unknown compression")
+	}
+}
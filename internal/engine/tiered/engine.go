@@ -5,7 +5,9 @@
 //
 // The engine is self-contained: it provides its own durability (fsync of its segments) and needs no write-ahead log —
 // it borrows only wal.SyncPolicy, to spell the fsync policy the same way the WAL-backed engine does. It implements the
-// storage.Engine interface, so the server selects it via engine.type=tiered instead of the RAM-only engine.
+// storage.Engine interface, so the server selects it via engine.type=tiered instead of the RAM-only engine. Under
+// replication the server keeps a log beside it; each record carries the LSN of the mutation that wrote it, so the
+// engine can tell which log records it already holds, and a standby is resynced by shipping the segment files.
 package tiered
 
 import (
@@ -13,7 +15,8 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"maps"
+	"os"
+	"path/filepath"
 	"slices"
 	"sync"
 	"sync/atomic"
@@ -36,13 +39,23 @@ type Config struct {
 	Sync                wal.SyncPolicy
 	CompactionThreshold float64       // reclaim a sealed segment past this dead-bytes ratio
 	CompactionInterval  time.Duration // how often to check for compaction and log stats
+	CompactionRate      int64         // bytes per second compaction reads; 0 leaves it unlimited
+	CompactionWindow    Window        // when background compaction may run; empty means any time
+	Compression         Compression   // how new values are stored; empty means CompressionNone
+	CompressionMinSize  int           // values shorter than this are never compressed
+	// ReadOnly opens the segments to be read, not written: recovery writes no hint files, no background sync or
+	// compaction runs, and a resync a crash interrupted is an error rather than wiped. Recovery still truncates a torn
+	// tail of the newest segment, which it could not read past otherwise. The caller must not write to the engine.
+	ReadOnly bool
 }
 
-// loc is a keydir entry: where a live value lives on disk and the record's size.
+// loc is a keydir entry: where a live value lives on disk, how it is stored there, and the record's size.
 type loc struct {
 	seg     uint32
+	valLen  uint32 // stored bytes
+	rawLen  uint32 // bytes once decompressed
+	codec   byte
 	valPos  int64
-	valLen  uint32
 	recSize int64
 }
 
@@ -73,7 +86,7 @@ type Engine struct {
 	// mu guards the keydir, byte accounting, and store metadata.
 	mu     sync.RWMutex
 	store  *store
-	keydir map[string]map[string]loc // table -> key -> location
+	keydir *keydir
 	lru    *lruCache
 	logger *slog.Logger
 
@@ -82,46 +95,97 @@ type Engine struct {
 	// segSets records which keys have a SET record in each segment, which lets a tombstone be dropped as soon as no older
 	// segment can contradict it. A segment's entry is reclaimed when it is compacted away, so the index tracks what is
 	// actually on disk.
-	segSets   map[uint32]map[keyID]struct{}
-	maxStore  int64
-	threshold float64
+	segSets map[uint32]map[keyID]struct{}
+	// valueBytes and storedBytes are the live values' decompressed and stored sizes, for the compression ratio
+	valueBytes, storedBytes int64
+	compressor              compressor
+	maxStore                int64
+	threshold               float64
+	// lsn is the highest LSN stamped on any record, recovered or appended
+	lsn uint64
 
 	hits, misses, compactions atomic.Uint64
+	// scanReads counts values bulk iterators read from disk without caching them
+	scanReads atomic.Uint64
 
 	compacting bool
 	closed     bool
+	readOnly   bool // see Config.ReadOnly
+	frozen     int  // segment sets handed out by Freeze and not yet released
 	compactWG  sync.WaitGroup
+	// manual is set while a CompactNow run is going; progress describes the pass in flight, history the latest
+	// finished ones, and reclaimed sums the bytes every pass gave back
+	manual    bool
+	progress  *CompactionProgress
+	history   []CompactionRecord
+	reclaimed int64
+	// compactionRate paces compaction reads in bytes per second, 0 for no limit
+	compactionRate int64
+	window         window
 
 	done chan struct{}
 	wg   sync.WaitGroup
 }
 
 // Open recovers the keydir from the on-disk segments and starts the background sync (everysec) and compaction loops.
+// Segments a crash left mid-swap by ReplaceSegments are discarded, and the engine opens empty.
 func Open(cfg Config, logger *slog.Logger) (*Engine, error) {
 	if logger == nil {
 		logger = slog.New(slog.DiscardHandler)
 	}
-	st, err := openStore(cfg.Dir, cfg.SegmentSize, cfg.Sync)
+	codec, err := newCompressor(cfg.Compression, cfg.CompressionMinSize)
+	if err != nil {
+		return nil, err
+	}
+	compactionWindow, err := cfg.CompactionWindow.parse()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ReadOnly {
+		if _, err = os.Stat(filepath.Join(cfg.Dir, resyncPendingFile)); err == nil {
+			return nil, fmt.Errorf("%q holds the segments of a resync a crash interrupted", cfg.Dir)
+		}
+	} else {
+		interrupted, clearErr := clearInterruptedResync(cfg.Dir)
+		if clearErr != nil {
+			return nil, clearErr
+		}
+		if interrupted {
+			logger.Warn("Discarded segments of an interrupted resync; the engine starts empty", "dir", cfg.Dir)
+		}
+	}
+	st, err := openStore(cfg.Dir, cfg.SegmentSize, cfg.Sync, logger)
 	if err != nil {
 		return nil, err
 	}
 	e := &Engine{
-		store:     st,
-		keydir:    make(map[string]map[string]loc),
-		lru:       newLRU(cfg.MaxMemoryBytes),
-		logger:    logger,
-		segLive:   make(map[uint32]int64),
-		segSets:   make(map[uint32]map[keyID]struct{}),
-		maxStore:  cfg.MaxStorageBytes,
-		threshold: cfg.CompactionThreshold,
-		done:      make(chan struct{}),
+		store:          st,
+		keydir:         newKeydir(),
+		lru:            newLRU(cfg.MaxMemoryBytes),
+		logger:         logger,
+		segLive:        make(map[uint32]int64),
+		segSets:        make(map[uint32]map[keyID]struct{}),
+		compressor:     codec,
+		maxStore:       cfg.MaxStorageBytes,
+		threshold:      cfg.CompactionThreshold,
+		compactionRate: cfg.CompactionRate,
+		window:         compactionWindow,
+		readOnly:       cfg.ReadOnly,
+		done:           make(chan struct{}),
+	}
+	if e.lsn, err = readResyncLSN(cfg.Dir); err != nil {
+		_ = st.close()
+		return nil, err
 	}
 	if err = e.recover(); err != nil {
 		_ = st.close()
 		return nil, err
 	}
-	logger.Info("Tiered engine recovered", "keys", e.keyCount(), "live_bytes", e.liveBytes)
+	logger.Info("Tiered engine recovered", "keys", e.keyCount(), "live_bytes", e.liveBytes, "lsn", e.lsn)
 
+	if cfg.ReadOnly {
+		return e, nil
+	}
 	if cfg.Sync == wal.SyncEverySec {
 		e.wg.Go(e.syncLoop)
 	}
@@ -131,72 +195,93 @@ func Open(cfg Config, logger *slog.Logger) (*Engine, error) {
 	return e, nil
 }
 
-// Close stops background loops, flushes, and closes the segments.
+// Close stops background loops, flushes, and closes the segments. The engine is marked closed first, so no manual
+// compaction run can start behind the wait for the background work.
 func (e *Engine) Close() error {
-	close(e.done)
-	e.wg.Wait()
 	e.mu.Lock()
 	e.closed = true
 	e.mu.Unlock()
+	close(e.done)
+	e.wg.Wait()
 	e.compactWG.Wait()
 	e.mu.Lock()
 	defer e.mu.Unlock()
 	return e.store.close()
 }
 
+// recover rebuilds the keydir segment by segment, oldest first. A sealed segment is loaded from its hint file when it
+// has a valid one; the newest segment, which may still be appended to, is always scanned, and so is a sealed segment
+// whose hint is missing or does not match it, after which its hint is written again.
 func (e *Engine) recover() error {
 	segs := e.store.segments()
 	for i, seg := range segs {
 		isLast := i == len(segs)-1
-		// Later records win, so an overwrite or tombstone supersedes the earlier value. Only the newest segment may carry a
-		// torn tail from a crash.
-		if err := e.store.scanSegment(seg, isLast, func(rec decoded, recPos int64) {
-			e.dropLive(rec.table, rec.key)
-			if !rec.tombstone {
-				e.setLoc(seg, rec.table, rec.key, len(rec.value), recPos, rec.recSize)
+		if !isLast {
+			hints, maxLSN, err := e.store.readHints(seg)
+			if err == nil {
+				for _, h := range hints {
+					e.replay(seg, h)
+				}
+				e.lsn = max(e.lsn, maxLSN)
+				continue
+			}
+			if !errors.Is(err, os.ErrNotExist) {
+				e.logger.Warn("Scanning tiered segment instead of its hint file", "segment", seg, "error", err)
 			}
+		}
+
+		// Only the newest segment may carry a torn tail from a crash.
+		var hints []hint
+		if err := e.store.scanSegment(seg, isLast, func(rec decoded, recPos int64) {
+			h := hintOf(rec, recPos)
+			e.replay(seg, h)
+			hints = append(hints, h)
 		}); err != nil {
 			return err
 		}
+		switch {
+		case isLast:
+			e.store.pending = hints
+		case e.readOnly:
+		default:
+			if err := e.store.writeHints(seg, hints); err != nil {
+				e.logger.Warn("Failed to write tiered hint file", "segment", seg, "error", err)
+			}
+		}
 	}
 	return nil
 }
 
+// replay applies one recovered record to the keydir. Later records win, so an overwrite or tombstone supersedes the
+// earlier value.
+func (e *Engine) replay(seg uint32, h hint) {
+	e.lsn = max(e.lsn, h.lsn)
+	e.dropLive(h.table, h.key)
+	if !h.tombstone {
+		e.setLoc(h.table, h.key, h.loc(seg))
+	}
+}
+
 // dropLive removes a key's keydir entry and its live-byte accounting, if present.
 func (e *Engine) dropLive(table, key string) {
-	keys, ok := e.keydir[table]
-	if !ok {
-		return
-	}
-	old, ok := keys[key]
+	old, ok := e.keydir.remove(table, key)
 	if !ok {
 		return
 	}
 	e.liveBytes -= old.recSize
 	e.segLive[old.seg] -= old.recSize
-	delete(keys, key)
-	if len(keys) == 0 {
-		delete(e.keydir, table)
-	}
+	e.valueBytes -= int64(old.rawLen)
+	e.storedBytes -= int64(old.valLen)
 }
 
-// setLoc records a live value's location and adds its live-byte accounting. Callers pass valLen rather than the value
-// itself: recovery never needs the bytes, only their length.
-func (e *Engine) setLoc(seg uint32, table, key string, valLen int, recPos, recSize int64) {
-	e.noteSet(seg, table, key)
-	keys, ok := e.keydir[table]
-	if !ok {
-		keys = make(map[string]loc)
-		e.keydir[table] = keys
-	}
-	keys[key] = loc{
-		seg:     seg,
-		valPos:  valPosFor(recPos, table, key),
-		valLen:  u32(valLen),
-		recSize: recSize,
-	}
-	e.liveBytes += recSize
-	e.segLive[seg] += recSize
+// setLoc records a live value's location and adds its live-byte accounting.
+func (e *Engine) setLoc(table, key string, location loc) {
+	e.noteSet(location.seg, table, key)
+	e.keydir.set(table, key, location)
+	e.liveBytes += location.recSize
+	e.segLive[location.seg] += location.recSize
+	e.valueBytes += int64(location.rawLen)
+	e.storedBytes += int64(location.valLen)
 }
 
 func (e *Engine) noteSet(seg uint32, table, key string) {
@@ -226,18 +311,24 @@ func (e *Engine) buriedBefore(id keyID, seg uint32) bool {
 }
 
 // Set appends the value and updates the keydir and cache. It rejects the write with ErrStorageFull if the live dataset
-// would exceed the configured limit.
-func (e *Engine) Set(_ context.Context, tbl, key, value string) error {
+// would exceed the configured limit. The record is stamped with the LSN ctx carries (see engine.WithLSN).
+func (e *Engine) Set(ctx context.Context, tbl, key, value string) error {
+	if len(value) > maxValueLen {
+		return fmt.Errorf("value exceeds %d bytes", maxValueLen)
+	}
+	// compressing is the slow part of a write and needs nothing the lock guards
+	stored, codec := e.compressor.compress(value)
+
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
-	return e.setLocked(tbl, key, value)
+	return e.setLocked(tbl, key, value, stored, codec, engine.LSNFrom(ctx))
 }
 
 // Update atomically replaces the value of key with what fn returns, reading the current value from the cache or its
 // segment first. It holds the engine mutex across the whole read-modify-write, which is what makes INCR, APPEND and
 // HSET atomic here. An error from fn appends nothing.
-func (e *Engine) Update(_ context.Context, tbl, key string, fn func(old string, exists bool) (string, error)) error {
+func (e *Engine) Update(ctx context.Context, tbl, key string, fn func(old string, exists bool) (string, error)) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
@@ -253,18 +344,19 @@ func (e *Engine) Update(_ context.Context, tbl, key string, fn func(old string,
 	if err != nil {
 		return err
 	}
-	return e.setLocked(tbl, key, value)
+	if len(value) > maxValueLen {
+		return fmt.Errorf("value exceeds %d bytes", maxValueLen)
+	}
+	stored, codec := e.compressor.compress(value)
+	return e.setLocked(tbl, key, value, stored, codec, engine.LSNFrom(ctx))
 }
 
-// setLocked appends a value and updates the keydir and cache. The caller holds e.mu.
-func (e *Engine) setLocked(tbl, key, value string) error {
+// setLocked appends a value, stored as compressed with codec, and updates the keydir and cache. The caller holds e.mu.
+func (e *Engine) setLocked(tbl, key, value, stored string, codec byte, lsn uint64) error {
 	if len(tbl) > maxFieldLen || len(key) > maxFieldLen {
 		return fmt.Errorf("table/key exceeds %d bytes", maxFieldLen)
 	}
-	if len(value) > maxValueLen {
-		return fmt.Errorf("value exceeds %d bytes", maxValueLen)
-	}
-	rec := encodeRecord(tbl, key, value, false)
+	rec := encodeRecord(tbl, key, stored, codec, false, lsn)
 	recSize := int64(len(rec))
 
 	old, exists := e.lookup(tbl, key)
@@ -281,7 +373,15 @@ func (e *Engine) setLocked(tbl, key, value string) error {
 		return err
 	}
 	e.dropLive(tbl, key)
-	e.setLoc(seg, tbl, key, len(value), recPos, recSize)
+	e.setLoc(tbl, key, loc{
+		seg:     seg,
+		valLen:  u32(len(stored)),
+		rawLen:  u32(len(value)),
+		codec:   codec,
+		valPos:  valPosFor(recPos, tbl, key),
+		recSize: recSize,
+	})
+	e.lsn = max(e.lsn, lsn)
 	e.lru.put(tbl, key, value)
 	return e.store.syncIfAlways()
 }
@@ -331,7 +431,7 @@ func (e *Engine) tryGet(tbl, key string) (value string, done bool, err error) {
 		return "", false, nil // segment reclaimed since the lookup
 	}
 
-	value, err = readPinnedValue(location.seg, pinned, location.valPos, location.valLen)
+	value, err = readPinnedValue(pinned, location)
 	e.store.unpin(location.seg)
 	if err != nil {
 		return "", true, err
@@ -355,7 +455,7 @@ func (e *Engine) value(tbl, key string, location loc) (string, error) {
 		return value, nil
 	}
 	e.misses.Add(1)
-	value, err := e.store.readValue(location.seg, location.valPos, location.valLen)
+	value, err := e.store.readValue(location)
 	if err != nil {
 		return "", err
 	}
@@ -364,16 +464,18 @@ func (e *Engine) value(tbl, key string, location loc) (string, error) {
 }
 
 // Del appends a tombstone and removes the key from the keydir and cache.
-func (e *Engine) Del(_ context.Context, tbl, key string) error {
+func (e *Engine) Del(ctx context.Context, tbl, key string) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
 	if _, ok := e.lookup(tbl, key); !ok {
 		return engine.ErrNotFound
 	}
-	if _, _, err := e.store.append(encodeRecord(tbl, key, "", true)); err != nil {
+	lsn := engine.LSNFrom(ctx)
+	if _, _, err := e.store.append(encodeRecord(tbl, key, "", codecNone, true, lsn)); err != nil {
 		return err
 	}
+	e.lsn = max(e.lsn, lsn)
 	e.dropLive(tbl, key)
 	e.lru.remove(tbl, key)
 	return e.store.syncIfAlways()
@@ -383,64 +485,87 @@ func (e *Engine) Del(_ context.Context, tbl, key string) error {
 func (e *Engine) Tables(_ context.Context) []string {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
-	return slices.Sorted(maps.Keys(e.keydir))
+	tables := e.keydir.tableNames()
+	slices.Sort(tables)
+	return tables
 }
 
 // TableExists reports whether a table has at least one live key.
 func (e *Engine) TableExists(_ context.Context, tbl string) bool {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
-	_, ok := e.keydir[tbl]
-	return ok
+	return e.keydir.hasTable(tbl)
 }
 
 // Keys returns all keys in a table in sorted order.
 func (e *Engine) Keys(_ context.Context, tbl string) []string {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
-	return slices.Sorted(maps.Keys(e.keydir[tbl]))
+	keys := e.keydir.keys(tbl)
+	slices.Sort(keys)
+	return keys
+}
+
+// KeyCounts returns the number of live keys in every table.
+func (e *Engine) KeyCounts(_ context.Context) map[string]int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.keydir.counts()
 }
 
-// Range calls fn for every live value, reading from disk on a cache miss.
+// Range calls fn for every live value, reading from disk on a cache miss. It only peeks at the cache: a full pass (a
+// snapshot, an export) neither caches what it reads nor counts as use, so it leaves the hot set where it was.
 func (e *Engine) Range(fn func(table, key, value string) bool) {
 	e.mu.RLock()
 	defer e.mu.RUnlock()
-	for tbl, keys := range e.keydir {
-		for key, location := range keys {
-			value, hit := e.lru.get(tbl, key)
-			if !hit {
-				var err error
-				value, err = e.store.readValue(location.seg, location.valPos, location.valLen)
-				if err != nil {
-					e.logger.Error("Range read failed", "table", tbl, "key", key, "error", err)
-					continue
-				}
-			}
-			if !fn(tbl, key, value) {
-				return
+	e.keydir.each(func(tbl, key string, location loc) bool {
+		value, hit := e.lru.peek(tbl, key)
+		if !hit {
+			var err error
+			value, err = e.store.readValue(location)
+			if err != nil {
+				e.logger.Error("Range read failed", "table", tbl, "key", key, "error", err)
+				return true
 			}
+			e.scanReads.Add(1)
 		}
+		return fn(tbl, key, value)
+	})
+}
+
+// Peek reads one value the way Range does: it only peeks at the cache, and a value read from disk is neither cached nor
+// counted as use, so a pass over a table a page at a time (DUMP) leaves the hot set where it was.
+func (e *Engine) Peek(_ context.Context, tbl, key string) (string, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	location, ok := e.lookup(tbl, key)
+	if !ok {
+		return "", engine.ErrNotFound
+	}
+	if value, hit := e.lru.peek(tbl, key); hit {
+		return value, nil
+	}
+	value, err := e.store.readValue(location)
+	if err != nil {
+		return "", err
 	}
+	e.scanReads.Add(1)
+	return value, nil
 }
 
-// Replace swaps all state for a replication resync snapshot — unreachable here: it is called only by a standby, and the
-// config rejects tiered alongside replication. It stays a stub rather than untested machinery; wiring the two together
-// needs a shared LSN-tagged log, not this method (see docs/plans/05).
+// Replace swaps all state for a replication resync snapshot — unreachable here: a tiered standby is resynced with the
+// master's segment files (ReplaceSegments), and the storage layer refuses to hand a snapshot to an engine that has them.
+// A snapshot would also have to fit in memory, which is exactly what this engine does not assume.
 func (e *Engine) Replace([]engine.Entry) {
 	e.logger.Error("Replace is not supported by the tiered engine")
 }
 
 func (e *Engine) lookup(tbl, key string) (loc, bool) {
-	location, ok := e.keydir[tbl][key]
-	return location, ok
+	return e.keydir.get(tbl, key)
 }
 
 func (e *Engine) keyCount() int {
-	count := 0
-	for _, keys := range e.keydir {
-		count += len(keys)
-	}
-	return count
+	return e.keydir.count
 }
 
 func (e *Engine) syncLoop() {
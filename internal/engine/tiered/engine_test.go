@@ -130,7 +130,7 @@ func TestEvictionServesFromDisk(t *testing.T) {
 
 func TestStorageFullThenDeleteResumes(t *testing.T) {
 	cfg := testConfig(t.TempDir())
-	cfg.MaxStorageBytes = 2000
+	cfg.MaxStorageBytes = 2100
 	e := open(t, cfg)
 	ctx := context.Background()
 
@@ -323,6 +323,58 @@ func TestRestartAfterCompaction(t *testing.T) {
 	}
 }
 
+// TestScanKeepsHotSet reads a hot set twice so it is protected, then runs a scan of one-off reads and a full Range over
+// many more keys than the cache holds: the hot keys must still be served from memory.
+func TestScanKeepsHotSet(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	cfg.MaxMemoryBytes = 4096
+	e := open(t, cfg)
+	ctx := context.Background()
+	value := strings.Repeat("v", 20)
+
+	for i := range 10 {
+		key := fmt.Sprintf("hot%d", i)
+		if err := e.Set(ctx, "t", key, value); err != nil {
+			t.Fatal(err)
+		}
+		mustGet(t, e, "t", key)
+	}
+	for i := range 500 {
+		if err := e.Set(ctx, "t", fmt.Sprintf("cold%03d", i), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 500 {
+		mustGet(t, e, "t", fmt.Sprintf("cold%03d", i))
+	}
+	peeked := e.Stats()
+	for i := range 500 {
+		if _, err := e.Peek(ctx, "t", fmt.Sprintf("cold%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if stats := e.Stats(); stats.Cache != peeked.Cache || stats.ScanReads == peeked.ScanReads {
+		t.Fatalf("Peek changed the cache from %+v to %+v, or read nothing from disk", peeked.Cache, stats.Cache)
+	}
+	e.Range(func(string, string, string) bool { return true })
+
+	before := e.Stats()
+	for i := range 10 {
+		mustGet(t, e, "t", fmt.Sprintf("hot%d", i))
+	}
+	after := e.Stats()
+	if after.Misses != before.Misses || after.Cache.ProtectedHits != before.Cache.ProtectedHits+10 {
+		t.Fatalf("hot set after a scan: %d misses, %d protected hits; want all 10 served from the protected segment",
+			after.Misses-before.Misses, after.Cache.ProtectedHits-before.Cache.ProtectedHits)
+	}
+	if before.ScanReads == 0 {
+		t.Fatal("Range read nothing from disk, want the cold keys it could not find cached")
+	}
+	if cached := after.Cache.ProbationBytes + after.Cache.ProtectedBytes; cached > cfg.MaxMemoryBytes {
+		t.Fatalf("cache holds %d bytes over a %d budget", cached, cfg.MaxMemoryBytes)
+	}
+}
+
 // TestOversizedValueStaysDiskOnly checks max_memory is a real ceiling: a value bigger than the whole budget is served
 // from disk, never cached.
 func TestOversizedValueStaysDiskOnly(t *testing.T) {
@@ -448,6 +500,181 @@ func TestRecoveryTruncatesTornTail(t *testing.T) {
 	}
 }
 
+// TestRecoveryUsesHintFiles checks a restart loads sealed segments from their hint files: a damaged record checksum in
+// a sealed segment, which a scan refuses, goes unnoticed while the hint is valid and is caught once the hint is not.
+func TestRecoveryUsesHintFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(dir)
+	cfg.SegmentSize = 256
+	ctx := context.Background()
+
+	e, err := tiered.Open(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value := strings.Repeat("v", 20)
+	for i := range 40 {
+		if err = e.Set(ctx, "t", fmt.Sprintf("k%02d", i), value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, hints := segmentFiles(t, dir)
+	if len(segments) < 3 {
+		t.Fatalf("expected several segments, got %d", len(segments))
+	}
+	if len(hints) != len(segments)-1 {
+		t.Fatalf("got %d hint files for %d segments, want one per sealed segment", len(hints), len(segments))
+	}
+
+	// The first record (table "t", key "k00") is 17+1+3+20+4 = 45 bytes after the 7-byte segment header; its checksum is
+	// the last 4 of those.
+	flipByte(t, segments[0], 7+45-1)
+	e2, err := tiered.Open(cfg, nil)
+	if err != nil {
+		t.Fatalf("open with valid hints: %v", err)
+	}
+	for i := range 40 {
+		if got := mustGet(t, e2, "t", fmt.Sprintf("k%02d", i)); got != value {
+			t.Fatalf("k%02d: %q", i, got)
+		}
+	}
+	if err = e2.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	flipByte(t, hints[0], 10)
+	if _, err = tiered.Open(cfg, nil); err == nil {
+		t.Fatal("open scanned past a corrupt sealed segment once its hint was invalid")
+	}
+}
+
+// TestRecoveryRewritesInvalidHint checks a hint that does not match its segment is ignored, the segment scanned, and
+// the hint written again.
+func TestRecoveryRewritesInvalidHint(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(dir)
+	cfg.SegmentSize = 256
+	ctx := context.Background()
+
+	e, err := tiered.Open(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 40 {
+		if err = e.Set(ctx, "t", fmt.Sprintf("k%02d", i), fmt.Sprintf("value-%02d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, hints := segmentFiles(t, dir)
+	original, err := os.ReadFile(hints[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipByte(t, hints[0], len(original)-1)
+
+	e2 := open(t, cfg)
+	for i := range 40 {
+		if got := mustGet(t, e2, "t", fmt.Sprintf("k%02d", i)); got != fmt.Sprintf("value-%02d", i) {
+			t.Fatalf("k%02d: %q", i, got)
+		}
+	}
+	rewritten, err := os.ReadFile(hints[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rewritten) != string(original) {
+		t.Fatal("invalid hint was not rewritten")
+	}
+}
+
+// TestCompactionRemovesHint checks a reclaimed segment takes its hint file with it, and that the records compaction
+// rewrote recover from the hints written when their new segment is sealed.
+func TestCompactionRemovesHint(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(dir)
+	cfg.SegmentSize = 256
+	ctx := context.Background()
+
+	e, err := tiered.Open(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 20 {
+		if err = e.Set(ctx, "t", fmt.Sprintf("k%02d", i), fmt.Sprintf("value-%02d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 20 {
+		if err = e.Set(ctx, "t", fmt.Sprintf("k%02d", i%5), fmt.Sprintf("final-%02d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range e.Stats().Segments {
+		e.Compact()
+	}
+	if e.Stats().Compactions == 0 {
+		t.Fatal("expected at least one compaction")
+	}
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, hints := segmentFiles(t, dir)
+	for _, hint := range hints {
+		segment := strings.TrimSuffix(hint, ".hint") + ".data"
+		if !slices.Contains(segments, segment) {
+			t.Errorf("hint %s outlived its segment", filepath.Base(hint))
+		}
+	}
+
+	e2 := open(t, cfg)
+	for i := range 20 {
+		want := fmt.Sprintf("value-%02d", i)
+		if i < 5 {
+			want = fmt.Sprintf("final-%02d", 15+i)
+		}
+		if got := mustGet(t, e2, "t", fmt.Sprintf("k%02d", i)); got != want {
+			t.Fatalf("k%02d after restart: %q, want %q", i, got, want)
+		}
+	}
+}
+
+// segmentFiles returns the segment and hint files in dir, each sorted
+func segmentFiles(t *testing.T, dir string) ([]string, []string) {
+	t.Helper()
+	segments, err := filepath.Glob(filepath.Join(dir, "seg-*.data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hints, err := filepath.Glob(filepath.Join(dir, "seg-*.hint"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(segments)
+	slices.Sort(hints)
+	return segments, hints
+}
+
+func flipByte(t *testing.T, path string, offset int) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[offset] ^= 0xFF
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func lastSegment(t *testing.T, dir string) string {
 	t.Helper()
 	matches, err := filepath.Glob(filepath.Join(dir, "seg-*.data"))
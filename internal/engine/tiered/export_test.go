@@ -0,0 +1,34 @@
+package tiered
+
+import "time"
+
+// FillKeydir builds a keydir of n keys of one table, for the memory benchmark.
+func FillKeydir(n int, key func(i int) string) any {
+	d := newKeydir()
+	for i := range n {
+		d.set("t", key(i), benchLoc(i))
+	}
+	return d
+}
+
+// FillKeydirMap builds the same keys into a map of strings to loc, the representation the keydir replaced.
+func FillKeydirMap(n int, key func(i int) string) any {
+	d := map[string]map[string]loc{"t": {}}
+	for i := range n {
+		d["t"][key(i)] = benchLoc(i)
+	}
+	return d
+}
+
+func benchLoc(i int) loc {
+	return loc{seg: 1, valLen: 100, rawLen: 100, valPos: int64(i) * 150, recSize: 150}
+}
+
+// WindowContains reports whether t falls in w, which must be valid.
+func WindowContains(w Window, t time.Time) bool {
+	parsed, err := w.parse()
+	if err != nil {
+		panic(err)
+	}
+	return parsed.contains(t)
+}
@@ -0,0 +1,210 @@
+package tiered
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A hint file sits next to each sealed segment and lists what recovery needs from every record in it — the keydir
+// fields, not the values — so a restart reads a few bytes per key instead of the whole dataset. Layout (big-endian):
+//
+//	hintHeader | segSize uint64 | maxLSN uint64 | entry... | crc32
+//	entry: tableLen uint16 | keyLen uint16 | valLen uint32 | valPos uint64 | recSize uint64 | codec uint8 |
+//	       rawLen uint32 | table | key
+//
+// valLen == tombstoneMarker marks a delete, as in the segment itself; codec and rawLen describe how the value is stored
+// and its decompressed length. segSize is the size of the segment the hint was written for; a hint whose segment has a
+// different size, or whose checksum fails, is ignored and the segment scanned, and so is a hint of an older version.
+// maxLSN is the highest LSN stamped on the segment's records. Hints are not fsynced: a hint lost or torn in a crash
+// fails those checks and costs one scan, never correctness.
+const (
+	hintHeader    = "DBHINT\x00\x03"
+	hintSuffix    = ".hint"
+	hintEntrySize = 29
+)
+
+var errHintInvalid = errors.New("invalid hint file")
+
+// hint is one record of a segment as recovery sees it
+type hint struct {
+	table     string
+	key       string
+	valPos    int64
+	valLen    uint32
+	rawLen    uint32
+	codec     byte
+	recSize   int64
+	tombstone bool
+	lsn       uint64 // kept in memory only: the file records the segment's highest
+}
+
+// loc returns the keydir entry of the value a hint of segment seg describes.
+func (h hint) loc(seg uint32) loc {
+	return loc{seg: seg, valLen: h.valLen, rawLen: h.rawLen, codec: h.codec, valPos: h.valPos, recSize: h.recSize}
+}
+
+func hintOf(rec decoded, recPos int64) hint {
+	return hint{
+		table:     rec.table,
+		key:       rec.key,
+		valPos:    recPos + rec.valOff,
+		valLen:    u32(len(rec.value)),
+		rawLen:    rec.rawLen,
+		codec:     rec.codec,
+		recSize:   rec.recSize,
+		tombstone: rec.tombstone,
+		lsn:       rec.lsn,
+	}
+}
+
+// hintOfEncoded builds the hint of a record from its encoding, as appended, without decoding the value
+func hintOfEncoded(rec []byte, recPos int64) hint {
+	tableLen := int(binary.BigEndian.Uint16(rec[0:2]))
+	keyLen := int(binary.BigEndian.Uint16(rec[2:4]))
+	valLen := binary.BigEndian.Uint32(rec[4:8])
+	h := hint{
+		table:     string(rec[headerSize : headerSize+tableLen]),
+		key:       string(rec[headerSize+tableLen : headerSize+tableLen+keyLen]),
+		recSize:   int64(len(rec)),
+		tombstone: valLen == tombstoneMarker,
+		lsn:       binary.BigEndian.Uint64(rec[8:16]),
+		codec:     rec[16],
+	}
+	h.valPos = valPosFor(recPos, h.table, h.key)
+	if !h.tombstone {
+		h.valLen = valLen
+		valOff := headerSize + tableLen + keyLen
+		// the record was just encoded from a valid codec, so this cannot fail
+		h.rawLen, _ = rawLength(h.codec, rec[valOff:valOff+int(valLen)])
+	}
+	return h
+}
+
+func encodeHints(segSize int64, hints []hint) []byte {
+	size := len(hintHeader) + 16 + crcSize
+	var maxLSN uint64
+	for _, h := range hints {
+		size += hintEntrySize + len(h.table) + len(h.key)
+		maxLSN = max(maxLSN, h.lsn)
+	}
+	buf := make([]byte, 0, size)
+	buf = append(buf, hintHeader...)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(segSize)) // #nosec G115 -- a file size is never negative
+	buf = binary.BigEndian.AppendUint64(buf, maxLSN)
+	for _, h := range hints {
+		valLen := h.valLen
+		if h.tombstone {
+			valLen = tombstoneMarker
+		}
+		buf = binary.BigEndian.AppendUint16(buf, u16(len(h.table)))
+		buf = binary.BigEndian.AppendUint16(buf, u16(len(h.key)))
+		buf = binary.BigEndian.AppendUint32(buf, valLen)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(h.valPos))  // #nosec G115 -- an offset is never negative
+		buf = binary.BigEndian.AppendUint64(buf, uint64(h.recSize)) // #nosec G115 -- a size is never negative
+		buf = append(buf, h.codec)
+		buf = binary.BigEndian.AppendUint32(buf, h.rawLen)
+		buf = append(buf, h.table...)
+		buf = append(buf, h.key...)
+	}
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+// decodeHints parses a hint file written for a segment of segSize bytes and returns its entries and the segment's
+// highest LSN
+func decodeHints(data []byte, segSize int64) ([]hint, uint64, error) {
+	if len(data) < len(hintHeader)+16+crcSize || string(data[:len(hintHeader)]) != hintHeader {
+		return nil, 0, fmt.Errorf("%w: bad header", errHintInvalid)
+	}
+	body, sum := data[:len(data)-crcSize], data[len(data)-crcSize:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return nil, 0, fmt.Errorf("%w: checksum mismatch", errHintInvalid)
+	}
+	if written := binary.BigEndian.Uint64(body[len(hintHeader):]); written != uint64(segSize) { // #nosec G115
+		return nil, 0, fmt.Errorf("%w: written for %d segment bytes, segment has %d", errHintInvalid, written, segSize)
+	}
+	maxLSN := binary.BigEndian.Uint64(body[len(hintHeader)+8:])
+
+	var hints []hint
+	rest := body[len(hintHeader)+16:]
+	for len(rest) > 0 {
+		if len(rest) < hintEntrySize {
+			return nil, 0, fmt.Errorf("%w: truncated entry", errHintInvalid)
+		}
+		tableLen := int(binary.BigEndian.Uint16(rest[0:2]))
+		keyLen := int(binary.BigEndian.Uint16(rest[2:4]))
+		valLen := binary.BigEndian.Uint32(rest[4:8])
+		valPos := binary.BigEndian.Uint64(rest[8:16])
+		recSize := binary.BigEndian.Uint64(rest[16:24])
+		codec := rest[24]
+		rawLen := binary.BigEndian.Uint32(rest[25:29])
+		rest = rest[hintEntrySize:]
+		if len(rest) < tableLen+keyLen {
+			return nil, 0, fmt.Errorf("%w: truncated entry", errHintInvalid)
+		}
+		h := hint{
+			table:     string(rest[:tableLen]),
+			key:       string(rest[tableLen : tableLen+keyLen]),
+			valPos:    int64(valPos),  // #nosec G115 -- bounded by segSize below
+			recSize:   int64(recSize), // #nosec G115 -- bounded by segSize below
+			tombstone: valLen == tombstoneMarker,
+			codec:     codec,
+		}
+		rest = rest[tableLen+keyLen:]
+		if !h.tombstone {
+			h.valLen = valLen
+			h.rawLen = rawLen
+		}
+		if codec != codecNone && codec != codecFlate {
+			return nil, 0, fmt.Errorf("%w: entry %s/%s has unknown codec %d", errHintInvalid, h.table, h.key, codec)
+		}
+		if valPos > uint64(segSize) || uint64(h.valLen) > uint64(segSize)-valPos || recSize > uint64(segSize) { // #nosec G115
+			return nil, 0, fmt.Errorf("%w: entry %s/%s points past the segment", errHintInvalid, h.table, h.key)
+		}
+		hints = append(hints, h)
+	}
+	return hints, maxLSN, nil
+}
+
+// writeHints writes the hint file of a sealed segment. It goes through a temporary file and a rename, so a reader never
+// sees a half-written hint under the real name.
+func (s *store) writeHints(seg uint32, hints []hint) error {
+	path := filepath.Join(s.dir, hintFilename(seg))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, encodeHints(s.sizes[seg], hints), 0o600); err != nil {
+		return fmt.Errorf("write hint for segment %d: %w", seg, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("write hint for segment %d: %w", seg, err)
+	}
+	return nil
+}
+
+// readHints loads the hint file of a segment and the segment's highest LSN. An absent hint is reported as
+// os.ErrNotExist; one that does not describe the segment as it is on disk, as errHintInvalid.
+func (s *store) readHints(seg uint32) ([]hint, uint64, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, hintFilename(seg)))
+	if err != nil {
+		return nil, 0, err
+	}
+	return decodeHints(data, s.sizes[seg])
+}
+
+// seal writes the hint file of the segment that just stopped being the active one, from the hints collected while it
+// was written. A failure only costs a scan of that segment at the next start, so it is logged, not returned.
+func (s *store) seal(seg uint32) {
+	hints := s.pending
+	s.pending = nil
+	if err := s.writeHints(seg, hints); err != nil {
+		s.logger.Warn("Failed to write tiered hint file", "segment", seg, "error", err)
+	}
+}
+
+func hintFilename(num uint32) string {
+	return strings.TrimSuffix(segFilename(num), SegSuffix) + hintSuffix
+}
@@ -0,0 +1,57 @@
+package tiered_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/engine/tiered"
+)
+
+// TestInspectSegment checks a segment reads back without an engine, compressed values decompressed and deletes marked,
+// and that a damaged record stops the read at its offset.
+func TestInspectSegment(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(dir)
+	cfg.Compression = tiered.CompressionFlate
+	ctx := context.Background()
+	e, err := tiered.Open(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("x", 200)
+	if err = e.Set(engine.WithLSN(ctx, 1), "t", "a", "short"); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Set(engine.WithLSN(ctx, 2), "t", "b", long); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Del(engine.WithLSN(ctx, 3), "t", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := lastSegment(t, dir)
+
+	var records []tiered.SegmentRecord
+	report, err := tiered.InspectSegment(path, func(record tiered.SegmentRecord) error {
+		records = append(records, record)
+		return nil
+	})
+	if err != nil || report.Damage != nil || report.Records != 3 || report.Tombstones != 1 || report.MinLSN != 1 ||
+		report.MaxLSN != 3 {
+		t.Fatalf("InspectSegment() = %+v, %v; want 3 records, 1 tombstone, LSN 1 to 3", report, err)
+	}
+	if records[1].Value != long || !records[1].Compressed || !records[2].Tombstone || records[2].Key != "a" {
+		t.Fatalf("InspectSegment() records = %+v", records)
+	}
+
+	flipByte(t, path, int(records[1].Offset)+20)
+	if report, err = tiered.InspectSegment(path, nil); err != nil || report.Records != 1 || report.TornTail() ||
+		report.DamageOffset != records[1].Offset {
+		t.Fatalf("InspectSegment() of a damaged record = %+v, %v; want damage at offset %d", report, err,
+			records[1].Offset)
+	}
+}
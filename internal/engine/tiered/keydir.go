@@ -0,0 +1,329 @@
+package tiered
+
+import "hash/maphash"
+
+const (
+	// arenaChunk is the size of one block of key bytes. A key is never split across blocks, and keys are at most
+	// maxFieldLen bytes, so every key fits in a fresh block.
+	arenaChunk = 1 << 16
+	// minBlock is the first allocation of a block, which then doubles up to arenaChunk, so a small table stays small.
+	minBlock = 64
+	// emptySlot and deletedSlot mark index slots that hold no entry; any other slot holds an entry index plus one.
+	emptySlot   = 0
+	deletedSlot = ^uint32(0)
+	// freedKey marks an entry whose key was removed and whose place awaits reuse.
+	freedKey = ^uint64(0)
+	// minSlots is the index size of a new table.
+	minSlots = 16
+)
+
+// keydir maps every live (table, key) to the location of its value. It is the one structure that grows with the number
+// of keys rather than with the hot set, so it avoids a Go string and map entry per key: each table packs its key bytes
+// into an arena and its entries into one slice, found through an open-addressed index of entry numbers. A key costs its
+// own bytes plus about 45, where a map of strings to loc took about 80 (BenchmarkKeydirBytesPerKey measures both).
+// Overwrites only change an entry's location; a removal leaves its key bytes behind until enough have piled up to make
+// rewriting the arena worthwhile.
+type keydir struct {
+	seed   maphash.Seed
+	tables map[string]*tableKeys
+	count  int
+}
+
+// tableKeys holds the keys of one table.
+type tableKeys struct {
+	arena   [][]byte // key bytes, in blocks of arenaChunk
+	entries []keyEntry
+	free    []uint32 // entries freed by remove, reused first
+	slots   []uint32 // open-addressed index over entries, its size a power of two
+	live    int
+	filled  int   // slots not empty: live entries plus deleted markers
+	dead    int64 // arena bytes of removed keys
+	size    int64 // arena bytes in use, live and dead
+}
+
+// keyEntry is one key: where its bytes sit in the arena (offset << 16 | length) and its packed location.
+type keyEntry struct {
+	key uint64
+	loc packedLoc
+}
+
+// packedLoc is a loc in 24 bytes instead of 40: the value's offset shares a word with the codec, and the record size is
+// kept as its difference from the value size, which is bounded by the header and the table and key lengths.
+type packedLoc struct {
+	posCodec uint64 // valPos << 8 | codec
+	seg      uint32
+	valLen   uint32
+	rawLen   uint32
+	extra    uint32 // recSize - valLen
+}
+
+func packLoc(location loc) packedLoc {
+	return packedLoc{
+		posCodec: uint64(location.valPos)<<8 | uint64(location.codec), // #nosec G115 -- offsets are never negative
+		seg:      location.seg,
+		valLen:   location.valLen,
+		rawLen:   location.rawLen,
+		extra:    uint32(location.recSize - int64(location.valLen)), // #nosec G115 -- header plus two maxFieldLen fields
+	}
+}
+
+func (p packedLoc) unpack() loc {
+	return loc{
+		seg:     p.seg,
+		valLen:  p.valLen,
+		rawLen:  p.rawLen,
+		codec:   byte(p.posCodec),
+		valPos:  int64(p.posCodec >> 8), // #nosec G115 -- packed from a non-negative int64
+		recSize: int64(p.valLen) + int64(p.extra),
+	}
+}
+
+func newKeydir() *keydir {
+	return &keydir{seed: maphash.MakeSeed(), tables: make(map[string]*tableKeys)}
+}
+
+// get returns the location of a live key.
+func (d *keydir) get(table, key string) (loc, bool) {
+	keys, ok := d.tables[table]
+	if !ok {
+		return loc{}, false
+	}
+	slot, found := keys.find(d.hash(key), key)
+	if !found {
+		return loc{}, false
+	}
+	return keys.entries[keys.slots[slot]-1].loc.unpack(), true
+}
+
+// set records a key's location, returning the one it replaces.
+func (d *keydir) set(table, key string, location loc) (loc, bool) {
+	keys, ok := d.tables[table]
+	if !ok {
+		keys = &tableKeys{slots: make([]uint32, minSlots)}
+		d.tables[table] = keys
+	}
+	old, replaced := keys.set(d, key, packLoc(location))
+	if !replaced {
+		d.count++
+	}
+	return old, replaced
+}
+
+// remove drops a key, returning its location. A table left without keys is dropped with it.
+func (d *keydir) remove(table, key string) (loc, bool) {
+	keys, ok := d.tables[table]
+	if !ok {
+		return loc{}, false
+	}
+	old, ok := keys.remove(d, key)
+	if !ok {
+		return loc{}, false
+	}
+	d.count--
+	if keys.live == 0 {
+		delete(d.tables, table)
+	}
+	return old, true
+}
+
+// hasTable reports whether a table has at least one live key.
+func (d *keydir) hasTable(table string) bool {
+	_, ok := d.tables[table]
+	return ok
+}
+
+// tableNames returns the tables with live keys, in no particular order.
+func (d *keydir) tableNames() []string {
+	names := make([]string, 0, len(d.tables))
+	for name := range d.tables {
+		names = append(names, name)
+	}
+	return names
+}
+
+// keys returns a table's keys in no particular order.
+func (d *keydir) keys(table string) []string {
+	keys, ok := d.tables[table]
+	if !ok {
+		return nil
+	}
+	names := make([]string, 0, keys.live)
+	keys.each(func(key string, _ loc) bool {
+		names = append(names, key)
+		return true
+	})
+	return names
+}
+
+// counts returns the number of live keys in every table.
+func (d *keydir) counts() map[string]int {
+	counts := make(map[string]int, len(d.tables))
+	for name, keys := range d.tables {
+		counts[name] = keys.live
+	}
+	return counts
+}
+
+// each calls fn for every live key until fn returns false. fn must not change the keydir.
+func (d *keydir) each(fn func(table, key string, location loc) bool) {
+	for table, keys := range d.tables {
+		if !keys.each(func(key string, location loc) bool { return fn(table, key, location) }) {
+			return
+		}
+	}
+}
+
+func (d *keydir) hash(key string) uint64 {
+	return maphash.String(d.seed, key)
+}
+
+// find returns the slot holding key, or false with the slot probing stopped at.
+func (t *tableKeys) find(hash uint64, key string) (int, bool) {
+	mask := uint64(len(t.slots) - 1)
+	for i := hash & mask; ; i = (i + 1) & mask {
+		switch slot := t.slots[i]; slot {
+		case emptySlot:
+			return int(i), false // #nosec G115 -- masked to the slot count
+		case deletedSlot:
+		default:
+			if string(t.keyBytes(t.entries[slot-1].key)) == key {
+				return int(i), true // #nosec G115 -- masked to the slot count
+			}
+		}
+	}
+}
+
+func (t *tableKeys) set(d *keydir, key string, location packedLoc) (loc, bool) {
+	hash := d.hash(key)
+	if slot, found := t.find(hash, key); found {
+		entry := &t.entries[t.slots[slot]-1]
+		old := entry.loc.unpack()
+		entry.loc = location
+		return old, true
+	}
+	if (t.filled+1)*4 > len(t.slots)*3 {
+		t.rehash(d)
+	}
+	var index uint32
+	if n := len(t.free); n > 0 {
+		index = t.free[n-1]
+		t.free = t.free[:n-1]
+		t.entries[index] = keyEntry{key: t.store(key), loc: location}
+	} else {
+		index = u32(len(t.entries))
+		t.entries = append(t.entries, keyEntry{key: t.store(key), loc: location})
+	}
+	// probe again for the first free slot: a deleted marker before the empty slot find stopped at is reused
+	mask := uint64(len(t.slots) - 1)
+	i := hash & mask
+	for t.slots[i] != emptySlot && t.slots[i] != deletedSlot {
+		i = (i + 1) & mask
+	}
+	if t.slots[i] == emptySlot {
+		t.filled++
+	}
+	t.slots[i] = index + 1
+	t.live++
+	return loc{}, false
+}
+
+func (t *tableKeys) remove(d *keydir, key string) (loc, bool) {
+	slot, found := t.find(d.hash(key), key)
+	if !found {
+		return loc{}, false
+	}
+	index := t.slots[slot] - 1
+	entry := &t.entries[index]
+	old := entry.loc.unpack()
+	t.dead += int64(entry.key & 0xffff)
+	*entry = keyEntry{key: freedKey}
+	t.slots[slot] = deletedSlot
+	t.free = append(t.free, index)
+	t.live--
+	if t.live > 0 && t.dead > arenaChunk && t.dead*2 > t.size {
+		t.compactArena()
+	}
+	return old, true
+}
+
+func (t *tableKeys) each(fn func(key string, location loc) bool) bool {
+	for _, entry := range t.entries {
+		if entry.key == freedKey {
+			continue
+		}
+		if !fn(string(t.keyBytes(entry.key)), entry.loc.unpack()) {
+			return false
+		}
+	}
+	return true
+}
+
+// store appends key to the arena and returns its reference.
+func (t *tableKeys) store(key string) uint64 {
+	ref, block := t.reserve(len(key))
+	t.arena[block] = append(t.arena[block], key...)
+	return ref
+}
+
+// reserve returns the reference of n key bytes about to be appended to the arena, and the block they go in.
+func (t *tableKeys) reserve(n int) (uint64, int) {
+	last := len(t.arena) - 1
+	if last < 0 || len(t.arena[last])+n > arenaChunk {
+		t.arena = append(t.arena, nil)
+		last++
+	}
+	// grow the block by hand rather than by append, which would take it past arenaChunk
+	if block := t.arena[last]; cap(block)-len(block) < n {
+		grown := make([]byte, len(block), min(arenaChunk, max(2*cap(block), len(block)+n, minBlock)))
+		copy(grown, block)
+		t.arena[last] = grown
+	}
+	offset := uint64(last)*arenaChunk + uint64(len(t.arena[last])) // #nosec G115 -- block indexes are never negative
+	t.size += int64(n)
+	return offset<<16 | uint64(n), last // #nosec G115 -- key length bounded by maxFieldLen
+}
+
+func (t *tableKeys) keyBytes(ref uint64) []byte {
+	offset, length := ref>>16, ref&0xffff
+	block := t.arena[offset/arenaChunk]
+	start := offset % arenaChunk
+	return block[start : start+length]
+}
+
+// rehash rebuilds the index without deleted markers, doubling it when the live entries alone would crowd it.
+func (t *tableKeys) rehash(d *keydir) {
+	size := minSlots
+	for size < (t.live+1)*2 {
+		size *= 2
+	}
+	t.slots = make([]uint32, size)
+	t.filled = 0
+	mask := uint64(size - 1)
+	for index, entry := range t.entries {
+		if entry.key == freedKey {
+			continue
+		}
+		i := maphash.Bytes(d.seed, t.keyBytes(entry.key)) & mask
+		for t.slots[i] != emptySlot {
+			i = (i + 1) & mask
+		}
+		t.slots[i] = u32(index) + 1
+		t.filled++
+	}
+}
+
+// compactArena copies the live keys into a fresh arena, dropping the bytes of removed ones. Entries keep their
+// numbers, so the index stays valid.
+func (t *tableKeys) compactArena() {
+	fresh := &tableKeys{}
+	for index, entry := range t.entries {
+		if entry.key == freedKey {
+			continue
+		}
+		key := t.keyBytes(entry.key)
+		ref, block := fresh.reserve(len(key))
+		fresh.arena[block] = append(fresh.arena[block], key...)
+		t.entries[index].key = ref
+	}
+	t.arena, t.size, t.dead = fresh.arena, fresh.size, 0
+}
@@ -0,0 +1,105 @@
+package tiered_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/engine/tiered"
+)
+
+// TestKeydirSurvivesChurn removes most of many keys and overwrites the rest, enough for the keydir to rewrite its key
+// arena and rebuild its index, and checks every key reads back right, before and after a restart.
+func TestKeydirSurvivesChurn(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	e, err := tiered.Open(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	const n = 6000
+	key := func(i int) string { return fmt.Sprintf("key-with-some-length-%05d", i) }
+	for i := range n {
+		if err = e.Set(ctx, "t", key(i), "v1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var want []string
+	for i := range n {
+		switch {
+		case i%3 != 0:
+			err = e.Del(ctx, "t", key(i))
+		default:
+			err = e.Set(ctx, "t", key(i), fmt.Sprintf("v2-%d", i))
+			want = append(want, key(i))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = e.Set(ctx, "other", key(1), "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	check := func(e *tiered.Engine) {
+		t.Helper()
+		if got := e.Keys(ctx, "t"); !slices.Equal(got, want) {
+			t.Fatalf("Keys = %d keys, want %d", len(got), len(want))
+		}
+		if got := e.Tables(ctx); !slices.Equal(got, []string{"other", "t"}) {
+			t.Fatalf("Tables = %v", got)
+		}
+		for i := range n {
+			got, getErr := e.Get(ctx, "t", key(i))
+			if i%3 != 0 {
+				if !errors.Is(getErr, engine.ErrNotFound) {
+					t.Fatalf("%s = %q, %v; want it deleted", key(i), got, getErr)
+				}
+				continue
+			}
+			if getErr != nil || got != fmt.Sprintf("v2-%d", i) {
+				t.Fatalf("%s = %q, %v", key(i), got, getErr)
+			}
+		}
+		if s := e.Stats(); s.Keys != len(want)+1 {
+			t.Fatalf("Stats().Keys = %d, want %d", s.Keys, len(want)+1)
+		}
+	}
+	check(e)
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	check(open(t, cfg))
+}
+
+// BenchmarkKeydirBytesPerKey reports the heap the keydir takes per key, against the map of strings it replaced.
+func BenchmarkKeydirBytesPerKey(b *testing.B) {
+	const n = 200_000
+	key := func(i int) string { return fmt.Sprintf("user:%012d", i) }
+	for _, impl := range []struct {
+		name string
+		fill func(n int, key func(int) string) any
+	}{
+		{"packed", tiered.FillKeydir},
+		{"map", tiered.FillKeydirMap},
+	} {
+		b.Run(impl.name, func(b *testing.B) {
+			var perKey float64
+			for b.Loop() {
+				var before, after runtime.MemStats
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				keydir := impl.fill(n, key)
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				perKey = float64(int64(after.HeapAlloc)-int64(before.HeapAlloc)) / n //nolint:gosec // heap sizes fit int64
+				runtime.KeepAlive(keydir)
+			}
+			b.ReportMetric(perKey, "bytes/key")
+		})
+	}
+}
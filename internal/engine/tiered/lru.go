@@ -5,9 +5,14 @@ import (
 	"sync"
 )
 
-// lruEntryOverhead approximates the fixed per-entry cost (map bucket, list element, string headers) so the cache is
-// sized by real memory, not payload bytes alone.
-const lruEntryOverhead = 48
+const (
+	// lruEntryOverhead approximates the fixed per-entry cost (map bucket, list element, string headers) so the cache is
+	// sized by real memory, not payload bytes alone.
+	lruEntryOverhead = 48
+	// protectedShare is the part of the budget kept for entries read more than once. The rest is the probation segment
+	// new entries enter through, and the most a scan of one-off reads can churn.
+	protectedShare = 0.8
+)
 
 type lruKey struct {
 	table string
@@ -15,30 +20,58 @@ type lruKey struct {
 }
 
 type lruNode struct {
-	k     lruKey
-	value string
-	bytes int64
+	k         lruKey
+	value     string
+	bytes     int64
+	protected bool
+}
+
+// CacheStats breaks down the cache's hits by the segment that served them, so max_memory can be sized: probation hits
+// are values read again soon after entering the cache, protected hits are the working set. Bytes and entries are per
+// segment too.
+type CacheStats struct {
+	ProbationHits    uint64
+	ProtectedHits    uint64
+	ProbationBytes   int64
+	ProtectedBytes   int64
+	ProbationEntries int
+	ProtectedEntries int
 }
 
-// lruCache is a byte-sized LRU: a map for O(1) lookup plus a list ordering entries most- to least-recently-used. It
-// carries its own mutex because a cache hit reorders the list, and the engine serves reads under a shared read lock:
-// concurrent readers mutate this while none of them holds the engine exclusively.
+// lruCache is a byte-sized segmented LRU: a map for O(1) lookup plus two lists ordering entries most- to
+// least-recently-used. A new entry goes into probation and only moves to the protected segment when it is read again,
+// so a burst of one-off reads (a scan, a bulk load) evicts other probation entries and leaves the working set alone.
+// Protected entries pushed out by newly promoted ones drop back to probation for a second chance rather than out of the
+// cache. It carries its own mutex because a cache hit reorders the lists, and the engine serves reads under a shared
+// read lock: concurrent readers mutate this while none of them holds the engine exclusively.
 type lruCache struct {
-	mu       sync.Mutex
-	maxBytes int64
-	curBytes int64
-	items    map[lruKey]*list.Element
-	order    *list.List // front = most recently used
+	mu             sync.Mutex
+	maxBytes       int64
+	protectedMax   int64
+	probationBytes int64
+	protectedBytes int64
+	items          map[lruKey]*list.Element
+	probation      *list.List // front = most recently used
+	protected      *list.List
+	probationHits  uint64
+	protectedHits  uint64
 }
 
 func newLRU(maxBytes int64) *lruCache {
-	return &lruCache{maxBytes: maxBytes, items: make(map[lruKey]*list.Element), order: list.New()}
+	return &lruCache{
+		maxBytes:     maxBytes,
+		protectedMax: int64(float64(maxBytes) * protectedShare),
+		items:        make(map[lruKey]*list.Element),
+		probation:    list.New(),
+		protected:    list.New(),
+	}
 }
 
 func nodeBytes(k lruKey, value string) int64 {
 	return int64(len(k.table) + len(k.key) + len(value) + lruEntryOverhead)
 }
 
+// get returns a cached value, counting the hit and promoting a probation entry to the protected segment.
 func (c *lruCache) get(table, key string) (string, bool) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -47,26 +80,62 @@ func (c *lruCache) get(table, key string) (string, bool) {
 	if !ok {
 		return "", false
 	}
-	c.order.MoveToFront(element)
-	//nolint:forcetypeassert // the list holds nothing but *lruNode; put is the only writer
-	return element.Value.(*lruNode).value, true
+	//nolint:forcetypeassert // the lists hold nothing but *lruNode; put is the only writer
+	node := element.Value.(*lruNode)
+	if node.protected {
+		c.protectedHits++
+		c.protected.MoveToFront(element)
+		return node.value, true
+	}
+	c.probationHits++
+	c.probation.Remove(element)
+	c.probationBytes -= node.bytes
+	node.protected = true
+	c.items[node.k] = c.protected.PushFront(node)
+	c.protectedBytes += node.bytes
+	c.demote()
+	return node.value, true
+}
+
+// peek returns a cached value without counting a hit or changing its place, for bulk readers that must not pass for
+// the working set.
+func (c *lruCache) peek(table, key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[lruKey{table, key}]
+	if !ok {
+		return "", false
+	}
+	return element.Value.(*lruNode).value, true //nolint:forcetypeassert // see get
 }
 
-// put caches value, evicting to stay within budget. An entry that alone exceeds the whole budget is never cached: it
-// stays disk-only, so max_memory is a real ceiling. Any previously cached value for the key is dropped, never left
-// stale.
+// put caches value, evicting to stay within budget. A key already cached keeps its segment, so overwriting a hot key
+// does not demote it; a new key enters probation. An entry that alone exceeds the whole budget is never cached: it stays
+// disk-only, so max_memory is a real ceiling. Any previously cached value for the key is dropped, never left stale.
 func (c *lruCache) put(table, key, value string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	k := lruKey{table, key}
-	c.dropKey(k)
+	protected := false
+	if element, ok := c.items[k]; ok {
+		protected = element.Value.(*lruNode).protected //nolint:forcetypeassert // see get
+		c.drop(element)
+	}
 	bytes := nodeBytes(k, value)
 	if bytes > c.maxBytes {
 		return
 	}
-	c.items[k] = c.order.PushFront(&lruNode{k: k, value: value, bytes: bytes})
-	c.curBytes += bytes
+	node := &lruNode{k: k, value: value, bytes: bytes, protected: protected}
+	if protected {
+		c.items[k] = c.protected.PushFront(node)
+		c.protectedBytes += bytes
+		c.demote()
+	} else {
+		c.items[k] = c.probation.PushFront(node)
+		c.probationBytes += bytes
+	}
 	c.evict()
 }
 
@@ -74,20 +143,55 @@ func (c *lruCache) remove(table, key string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.dropKey(lruKey{table, key})
+	if element, ok := c.items[lruKey{table, key}]; ok {
+		c.drop(element)
+	}
 }
 
-// dropKey removes a key if it is cached. The caller holds c.mu.
-func (c *lruCache) dropKey(k lruKey) {
-	if element, ok := c.items[k]; ok {
-		c.drop(element)
+// clear empties the cache, keeping its hit counters.
+func (c *lruCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[lruKey]*list.Element)
+	c.probation.Init()
+	c.protected.Init()
+	c.probationBytes, c.protectedBytes = 0, 0
+}
+
+func (c *lruCache) stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheStats{
+		ProbationHits:    c.probationHits,
+		ProtectedHits:    c.protectedHits,
+		ProbationBytes:   c.probationBytes,
+		ProtectedBytes:   c.protectedBytes,
+		ProbationEntries: c.probation.Len(),
+		ProtectedEntries: c.protected.Len(),
 	}
 }
 
-// evict drops least-recently-used entries until the cache fits its budget.
+// demote moves least-recently-used protected entries back to the front of probation until the protected segment fits
+// its share. The caller holds c.mu.
+func (c *lruCache) demote() {
+	for c.protectedBytes > c.protectedMax && c.protected.Len() > 1 {
+		node := c.protected.Remove(c.protected.Back()).(*lruNode) //nolint:forcetypeassert // see get
+		c.protectedBytes -= node.bytes
+		node.protected = false
+		c.items[node.k] = c.probation.PushFront(node)
+		c.probationBytes += node.bytes
+	}
+}
+
+// evict drops least-recently-used entries, probation first, until the cache fits its budget. The caller holds c.mu.
 func (c *lruCache) evict() {
-	for c.curBytes > c.maxBytes {
-		back := c.order.Back()
+	for c.probationBytes+c.protectedBytes > c.maxBytes {
+		back := c.probation.Back()
+		if back == nil {
+			back = c.protected.Back()
+		}
 		if back == nil {
 			return
 		}
@@ -95,8 +199,15 @@ func (c *lruCache) evict() {
 	}
 }
 
+// drop removes an entry from whichever segment holds it. The caller holds c.mu.
 func (c *lruCache) drop(element *list.Element) {
-	node := c.order.Remove(element).(*lruNode) //nolint:forcetypeassert // see get
+	node := element.Value.(*lruNode) //nolint:forcetypeassert // see get
+	if node.protected {
+		c.protected.Remove(element)
+		c.protectedBytes -= node.bytes
+	} else {
+		c.probation.Remove(element)
+		c.probationBytes -= node.bytes
+	}
 	delete(c.items, node.k)
-	c.curBytes -= node.bytes
 }
@@ -0,0 +1,229 @@
+package tiered
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/OutOfStack/db/internal/scrub"
+	"github.com/OutOfStack/db/internal/wal"
+)
+
+// Verify re-reads every segment through throttle and checks each record's checksum, returning the number of segments
+// checked and the damaged ones. It reads at most the bytes a segment held when it got to it, so records appended
+// meanwhile are left to the next pass. Compaction waits while a segment is being read, one segment at a time, so a
+// throttled pass never holds it off for long.
+func (e *Engine) Verify(ctx context.Context, throttle *scrub.Throttle) (int, []scrub.Corruption, error) {
+	e.mu.RLock()
+	segs := e.store.segments()
+	e.mu.RUnlock()
+
+	var (
+		checked     int
+		corruptions []scrub.Corruption
+	)
+	for _, seg := range segs {
+		if err := ctx.Err(); err != nil {
+			return checked, corruptions, err
+		}
+		offset, err := e.verifySegment(ctx, seg, throttle)
+		if errors.Is(err, errGone) {
+			continue // compacted away since the listing
+		}
+		if err != nil && ctx.Err() != nil {
+			return checked, corruptions, ctx.Err()
+		}
+		checked++
+		if err != nil {
+			corruptions = append(corruptions, scrub.Corruption{
+				File:   filepath.Join(e.store.dir, segFilename(seg)),
+				Offset: offset,
+				Err:    err,
+			})
+		}
+	}
+	return checked, corruptions, nil
+}
+
+var errGone = errors.New("segment no longer exists")
+
+// verifySegment reads one segment and returns the offset of its first damaged record along with the damage.
+func (e *Engine) verifySegment(ctx context.Context, seg uint32, throttle *scrub.Throttle) (int64, error) {
+	if err := e.holdCompaction(); err != nil {
+		return 0, err
+	}
+	defer func() {
+		e.mu.Lock()
+		e.frozen--
+		e.mu.Unlock()
+	}()
+
+	e.mu.RLock()
+	file, ok := e.store.pin(seg)
+	size, format := e.store.sizes[seg], e.store.formats[seg]
+	e.mu.RUnlock()
+	if !ok {
+		return 0, errGone
+	}
+	defer e.store.unpin(seg)
+
+	return readSegment(ctx, file, format, size, throttle, nil)
+}
+
+// readSegment decodes the records of a segment of size bytes up to the first damaged one, calling fn for each. It reads
+// through ReadAt, so it neither disturbs nor depends on the file offset a compaction scan uses. It returns the offset
+// reading stopped at and the damage found there, if any.
+func readSegment(
+	ctx context.Context,
+	file *os.File,
+	format byte,
+	size int64,
+	throttle *scrub.Throttle,
+	fn func(rec decoded, recPos int64) error,
+) (int64, error) {
+	offset := int64(len(segmentHeader))
+	if size <= offset {
+		return offset, nil
+	}
+	reader := bufio.NewReaderSize(scrub.Reader(ctx, io.NewSectionReader(file, offset, size-offset), throttle), scanBufSize)
+	for {
+		rec, err := decodeRecord(reader, format)
+		if errors.Is(err, io.EOF) {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		if fn != nil {
+			if err = fn(rec, offset); err != nil {
+				return offset, err
+			}
+		}
+		offset += rec.recSize
+	}
+}
+
+// Quarantine moves a damaged segment out of the data directory into its quarantine subdirectory, after saving what it
+// can: every record before the damage is carried forward the way compaction would, and a live key whose record lies
+// past the damage is rewritten from its own record when that still checks out, or else from the cache. Keys found in
+// neither place are lost and are dropped, and counted in the note returned. A delete recorded past the damage cannot be
+// read back, so a key it removed may reappear after a restart if an older segment still holds its value. The engine is
+// held exclusively while it runs.
+func (e *Engine) Quarantine(path string) (string, error) {
+	seg, ok := segmentNumber(filepath.Base(path))
+	if !ok {
+		return "", fmt.Errorf("%s is not a tiered segment", path)
+	}
+	if err := e.holdCompaction(); err != nil {
+		return "", err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer func() { e.frozen-- }()
+
+	file, ok := e.store.readers[seg]
+	if !ok {
+		return "", fmt.Errorf("segment %d: %w", seg, errGone)
+	}
+	if seg == e.store.activeSeg {
+		if err := e.store.rotate(); err != nil {
+			return "", err
+		}
+	}
+	format := e.store.formats[seg]
+
+	// the readable prefix, live values and tombstones alike
+	carry := func(rec decoded, recPos int64) error {
+		_, err := e.rewriteRecord(seg, rec, recPos)
+		return err
+	}
+	_, damage := readSegment(context.Background(), file, format, e.store.sizes[seg], nil, carry)
+	if damage != nil && !errors.Is(damage, errPartial) && !errors.Is(damage, errChecksum) && !errors.Is(damage, errCodec) {
+		return "", damage
+	}
+
+	saved, cached, lost, err := e.salvage(seg, file, format)
+	if err != nil {
+		return "", err
+	}
+	if err = e.store.syncActive(); err != nil {
+		return "", err
+	}
+	dest, err := e.store.quarantineSegment(seg)
+	if err != nil {
+		return "", err
+	}
+	delete(e.segLive, seg)
+	delete(e.segSets, seg)
+	e.logger.Warn("Quarantined damaged tiered segment",
+		"segment", seg, "moved_to", dest, "saved", saved, "from_cache", cached, "lost", lost)
+	return fmt.Sprintf("moved to %s, %d keys past the damage saved (%d from cache), %d lost", dest, saved+cached,
+		cached, lost), nil
+}
+
+// salvage rescues the live keys still pointing into seg once its readable prefix has been carried forward: their
+// records lie past the damage. A record that still decodes to the same key is copied as it is stored; otherwise a
+// cached value is written again. The caller holds e.mu.
+func (e *Engine) salvage(seg uint32, file *os.File, format byte) (saved, cached, lost int, err error) {
+	type stranded struct {
+		table, key string
+		location   loc
+	}
+	var keys []stranded
+	e.keydir.each(func(tbl, key string, location loc) bool {
+		if location.seg == seg {
+			keys = append(keys, stranded{table: tbl, key: key, location: location})
+		}
+		return true
+	})
+	for _, k := range keys {
+		recPos := k.location.valPos - int64(recordHeaderSize(format)+len(k.table)+len(k.key))
+		reader := bufio.NewReader(io.NewSectionReader(file, recPos, k.location.recSize))
+		if rec, decodeErr := decodeRecord(reader, format); decodeErr == nil && rec.table == k.table && rec.key == k.key {
+			if _, err = e.rewriteRecord(seg, rec, recPos); err != nil {
+				return saved, cached, lost, err
+			}
+			saved++
+			continue
+		}
+		if value, hit := e.lru.peek(k.table, k.key); hit {
+			stored, codec := e.compressor.compress(value)
+			if err = e.setLocked(k.table, k.key, value, stored, codec, 0); err != nil {
+				return saved, cached, lost, err
+			}
+			cached++
+			continue
+		}
+		e.dropLive(k.table, k.key)
+		e.logger.Error("Tiered key lost to a damaged segment", "segment", seg, "table", k.table, "key", k.key)
+		lost++
+	}
+	return saved, cached, lost, nil
+}
+
+// quarantineSegment closes a segment and moves it into the quarantine subdirectory, dropping its hint file, and returns
+// where it went.
+func (s *store) quarantineSegment(seg uint32) (string, error) {
+	if err := s.detach(seg); err != nil {
+		return "", err
+	}
+	dir := filepath.Join(s.dir, scrub.QuarantineDir)
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", fmt.Errorf("create quarantine directory: %w", err)
+	}
+	dest := filepath.Join(dir, segFilename(seg))
+	if err := os.Rename(filepath.Join(s.dir, segFilename(seg)), dest); err != nil {
+		return "", fmt.Errorf("quarantine segment %d: %w", seg, err)
+	}
+	if err := os.Remove(filepath.Join(s.dir, hintFilename(seg))); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("remove hint of segment %d: %w", seg, err)
+	}
+	if err := wal.SyncDirectory(s.dir); err != nil {
+		return "", fmt.Errorf("sync data directory: %w", err)
+	}
+	return dest, nil
+}
@@ -0,0 +1,103 @@
+package tiered_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/engine/tiered"
+)
+
+// TestVerifyAndQuarantine damages one record in the middle of a segment, checks Verify reports it at that record's
+// offset, and then quarantines the segment: the keys around the damage survive, before and after a restart, and the
+// damaged key survives only if the cache still held its value.
+func TestVerifyAndQuarantine(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		cache    int64
+		wantLost bool
+	}{
+		{"damaged value cached", 1 << 20, false},
+		{"damaged value only on disk", 1, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := testConfig(dir)
+			cfg.MaxMemoryBytes = test.cache
+			ctx := context.Background()
+			value := strings.Repeat("v", 20)
+
+			e, err := tiered.Open(cfg, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range 10 {
+				if err = e.Set(engine.WithLSN(ctx, uint64(i+1)), "t", fmt.Sprintf("k%02d", i), value); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// each record is 17+1+3+20+4 = 45 bytes after the 7-byte header; damage the value of k03
+			damagedAt := 7 + 3*45
+			flipByte(t, lastSegment(t, dir), damagedAt+17+1+3+5)
+
+			checked, corruptions, err := e.Verify(ctx, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if checked != 1 || len(corruptions) != 1 || corruptions[0].Offset != int64(damagedAt) {
+				t.Fatalf("Verify = %d checked, %+v; want one damaged record at offset %d", checked, corruptions, damagedAt)
+			}
+
+			note, err := e.Quarantine(corruptions[0].File)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(note, "quarantine") {
+				t.Fatalf("note = %q, want where the segment went", note)
+			}
+			if _, err = os.Stat(filepath.Join(dir, "quarantine", filepath.Base(corruptions[0].File))); err != nil {
+				t.Fatalf("quarantined segment: %v", err)
+			}
+			if _, corruptions, err = e.Verify(ctx, nil); err != nil || len(corruptions) != 0 {
+				t.Fatalf("Verify after quarantine = %+v, %v; want clean", corruptions, err)
+			}
+
+			check := func(e *tiered.Engine) {
+				t.Helper()
+				for i := range 10 {
+					key := fmt.Sprintf("k%02d", i)
+					got, getErr := e.Get(ctx, "t", key)
+					if i == 3 && test.wantLost {
+						if !errors.Is(getErr, engine.ErrNotFound) {
+							t.Fatalf("%s: got %q, %v; want it lost", key, got, getErr)
+						}
+						continue
+					}
+					if getErr != nil || got != value {
+						t.Fatalf("%s = %q, %v", key, got, getErr)
+					}
+				}
+			}
+			check(e)
+			if err = e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			check(open(t, cfg))
+		})
+	}
+}
+
+func TestQuarantineRejectsUnknownFile(t *testing.T) {
+	e := open(t, testConfig(t.TempDir()))
+	if _, err := e.Quarantine("wal-00000000000000000001.log"); err == nil {
+		t.Fatal("want an error for a file that is not a segment")
+	}
+	if _, err := e.Quarantine("seg-0000000042.data"); err == nil {
+		t.Fatal("want an error for a segment the engine does not have")
+	}
+}
@@ -0,0 +1,313 @@
+package tiered
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/wal"
+)
+
+var errClosed = errors.New("tiered engine is closed")
+
+// resyncLSNFile records the LSN the segments were shipped at by the last resync. Their records may all carry lower
+// LSNs (the master's last mutations could have changed nothing), and without it a restarted standby would ask its
+// master for records the shipped state already reflects — and, if the master no longer logs them, be resynced again.
+const resyncLSNFile = "resync.lsn"
+
+// resyncPendingFile marks a segment swap in progress. It is written durably before the old segments are removed and
+// removed once the shipped ones and their LSN are in place, so an engine that finds it at Open knows its segments are a
+// mix of the two datasets.
+const resyncPendingFile = "resync.pending"
+
+// AppliedLSN returns the highest LSN stamped on a record: every logged mutation up to it has reached the segments, and a
+// restart replays the log from the next one. Mutations that changed nothing append no record, so the engine may hold a
+// few LSNs past it; replaying those changes nothing again.
+func (e *Engine) AppliedLSN() uint64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.lsn
+}
+
+// SyncLSN fsyncs the active segment and returns the LSN the segments now durably hold, so the log can be pruned up to
+// it. Sealed segments were synced when they were sealed.
+func (e *Engine) SyncLSN() (uint64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return 0, errClosed
+	}
+	if err := e.store.syncActive(); err != nil {
+		return 0, err
+	}
+	return e.lsn, nil
+}
+
+// frozenFile is one segment of a frozen set: its pinned handle and the bytes it held at the freeze
+type frozenFile struct {
+	seg  uint32
+	file *os.File
+	size int64
+}
+
+// frozenSet is the engine.SegmentSet Freeze returns
+type frozenSet struct {
+	engine  *Engine
+	files   []frozenFile
+	release sync.Once
+}
+
+// Freeze captures every segment as it is now, for shipping to a standby. Records below a segment's frozen size never
+// change, so the set stays consistent while writes go on appending past it; compaction is held off until Release, since
+// it would unlink frozen files. A compaction pass already running is waited for, so the caller should not hold anything
+// compaction needs, and a caller holding a lock of its own takes HoldCompaction before it to keep the wait out of it.
+func (e *Engine) Freeze() (engine.SegmentSet, error) { //nolint:ireturn // the set is consumed through the engine-neutral interface
+	if err := e.holdCompaction(); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// the frozen bytes of the active segment are read back by a standby that fsyncs them itself, but they must not be
+	// lost here before the master's own log is pruned past them
+	if err := e.store.syncActive(); err != nil {
+		e.frozen--
+		return nil, err
+	}
+	set := &frozenSet{engine: e}
+	for _, seg := range e.store.segments() {
+		file, ok := e.store.pin(seg)
+		if !ok {
+			continue
+		}
+		set.files = append(set.files, frozenFile{seg: seg, file: file, size: e.store.sizes[seg]})
+	}
+	return set, nil
+}
+
+// Each calls fn with every frozen segment, oldest first.
+func (f *frozenSet) Each(fn func(name string, size int64, data io.Reader) error) error {
+	for _, frozen := range f.files {
+		if err := fn(segFilename(frozen.seg), frozen.size, io.NewSectionReader(frozen.file, 0, frozen.size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Release unpins the frozen segments and lets compaction run again. Calling it more than once is harmless.
+func (f *frozenSet) Release() {
+	f.release.Do(func() {
+		for _, frozen := range f.files {
+			f.engine.store.unpin(frozen.seg)
+		}
+		f.engine.mu.Lock()
+		f.engine.frozen--
+		f.engine.mu.Unlock()
+	})
+}
+
+// HoldCompaction keeps new compaction passes from starting and waits out one already running, until release is called.
+// A Freeze while it is held does not wait, so a caller can take its own lock after it rather than wait for a pass under
+// that lock. Calling release more than once is harmless.
+func (e *Engine) HoldCompaction() (release func(), err error) {
+	if err = e.holdCompaction(); err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			e.mu.Lock()
+			e.frozen--
+			e.mu.Unlock()
+		})
+	}, nil
+}
+
+// holdCompaction keeps new compaction passes from starting and waits out one already running. The caller undoes it by
+// decrementing e.frozen under e.mu.
+func (e *Engine) holdCompaction() error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return errClosed
+	}
+	e.frozen++
+	e.mu.Unlock()
+	// no pass can begin while frozen > 0, so the wait group only counts the one in flight
+	e.compactWG.Wait()
+	return nil
+}
+
+// ReplaceSegments swaps the whole dataset for the segment files in dir, which a standby received from its master during
+// a resync at lsn. The files are moved, not copied, into the data directory, so dir must be on the same file system; any
+// other file in dir is ignored. Readers wait for the swap and then see the new dataset, never a mix of the two.
+//
+// A crash during the swap can leave a mix on disk, which would otherwise recover as a dataset at the shipped LSN. The
+// swap is marked in progress before anything is removed, and Open wipes the segments of an engine it finds marked: the
+// engine comes back empty at LSN 0, so its standby asks for the whole history and is resynced again.
+func (e *Engine) ReplaceSegments(dir string, lsn uint64) error {
+	nums, err := listSegments(dir)
+	if err != nil {
+		return err
+	}
+	if err = e.holdCompaction(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	defer func() { e.frozen-- }()
+
+	old := e.store
+	if err = old.close(); err != nil {
+		return fmt.Errorf("close segments: %w", err)
+	}
+	if err = writeResyncPending(old.dir); err != nil {
+		return err
+	}
+	if err = removeSegmentFiles(old.dir); err != nil {
+		return err
+	}
+	for _, num := range nums {
+		name := segFilename(num)
+		if err = os.Rename(filepath.Join(dir, name), filepath.Join(old.dir, name)); err != nil {
+			return fmt.Errorf("move shipped segment %d: %w", num, err)
+		}
+	}
+	if err = writeResyncLSN(old.dir, lsn); err != nil {
+		return err
+	}
+	if err = removeSynced(old.dir, resyncPendingFile); err != nil {
+		return err
+	}
+
+	st, err := openStore(old.dir, old.segmentSize, old.sync, old.logger)
+	if err != nil {
+		return err
+	}
+	e.store = st
+	e.keydir = newKeydir()
+	e.segLive = make(map[uint32]int64)
+	e.segSets = make(map[uint32]map[keyID]struct{})
+	e.liveBytes = 0
+	e.valueBytes, e.storedBytes = 0, 0
+	e.lsn = lsn
+	e.lru.clear()
+	if err = e.recover(); err != nil {
+		return err
+	}
+	e.logger.Info("Tiered engine replaced from shipped segments",
+		"segments", len(nums), "keys", e.keyCount(), "live_bytes", e.liveBytes, "lsn", e.lsn)
+	return nil
+}
+
+// writeResyncLSN records lsn as the LSN of the shipped segments, durably along with the renames that put them in place.
+func writeResyncLSN(dir string, lsn uint64) error {
+	path := filepath.Join(dir, resyncLSNFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, binary.BigEndian.AppendUint64(nil, lsn), 0o600); err != nil {
+		return fmt.Errorf("write resync LSN: %w", err)
+	}
+	if err := syncFile(tmp); err != nil {
+		return fmt.Errorf("sync resync LSN: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write resync LSN: %w", err)
+	}
+	if err := wal.SyncDirectory(dir); err != nil {
+		return fmt.Errorf("sync data directory: %w", err)
+	}
+	return nil
+}
+
+// writeResyncPending durably marks a segment swap in dir as in progress.
+func writeResyncPending(dir string) error {
+	path := filepath.Join(dir, resyncPendingFile)
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		return fmt.Errorf("mark resync in progress: %w", err)
+	}
+	if err := wal.SyncDirectory(dir); err != nil {
+		return fmt.Errorf("sync data directory: %w", err)
+	}
+	return nil
+}
+
+// clearInterruptedResync wipes the segments and resync LSN of a swap a crash interrupted, reporting whether there was
+// one. The marker goes last, so a crash in here leaves it for the next Open to finish the job.
+func clearInterruptedResync(dir string) (bool, error) {
+	if _, err := os.Stat(filepath.Join(dir, resyncPendingFile)); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("check for an interrupted resync: %w", err)
+	}
+	if err := removeSegmentFiles(dir); err != nil {
+		return false, err
+	}
+	if err := removeSynced(dir, resyncLSNFile); err != nil {
+		return false, err
+	}
+	return true, removeSynced(dir, resyncPendingFile)
+}
+
+// removeSynced removes the file name from dir, if it is there, and syncs dir so the removal is durable.
+func removeSynced(dir, name string) error {
+	if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove %s: %w", name, err)
+	}
+	if err := wal.SyncDirectory(dir); err != nil {
+		return fmt.Errorf("sync data directory: %w", err)
+	}
+	return nil
+}
+
+// readResyncLSN returns the LSN recorded by the last resync, 0 when there was none.
+func readResyncLSN(dir string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(dir, resyncLSNFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read resync LSN: %w", err)
+	}
+	if len(data) != 8 {
+		return 0, fmt.Errorf("read resync LSN: %d bytes, want 8", len(data))
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+func syncFile(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0o600) // #nosec G304 -- path is built inside the data directory
+	if err != nil {
+		return err
+	}
+	syncErr := file.Sync()
+	if closeErr := file.Close(); syncErr == nil {
+		syncErr = closeErr
+	}
+	return syncErr
+}
+
+// removeSegmentFiles deletes every segment and hint file in dir.
+func removeSegmentFiles(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read data directory: %w", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, SegPrefix) ||
+			(!strings.HasSuffix(name, SegSuffix) && !strings.HasSuffix(name, hintSuffix)) {
+			continue
+		}
+		if err = os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,319 @@
+package tiered_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/engine/tiered"
+)
+
+// TestAppliedLSNSurvivesRestart checks the LSN stamped on records is recovered both from scanned segments and from hint
+// files, and that a delete counts like any other mutation.
+func TestAppliedLSNSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testConfig(dir)
+	cfg.SegmentSize = 256
+	ctx := context.Background()
+
+	e, err := tiered.Open(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range 20 {
+		if err = e.Set(engine.WithLSN(ctx, uint64(i+1)), "t", fmt.Sprintf("k%02d", i), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = e.Del(engine.WithLSN(ctx, 21), "t", "k00"); err != nil {
+		t.Fatal(err)
+	}
+	// a mutation that was not logged carries no LSN and must not lower the applied one
+	if err = e.Set(ctx, "t", "unlogged", "v"); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.AppliedLSN(); got != 21 {
+		t.Fatalf("AppliedLSN before restart = %d, want 21", got)
+	}
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, hints := segmentFiles(t, dir); len(hints) == 0 {
+		t.Fatal("expected hint files for the sealed segments")
+	}
+
+	e2 := open(t, cfg)
+	if got := e2.AppliedLSN(); got != 21 {
+		t.Fatalf("AppliedLSN after restart = %d, want 21", got)
+	}
+}
+
+// TestLegacySegmentReadable checks segments written by older builds — before records carried an LSN (v2) and before
+// they named a codec (v3) — still load, and that new writes go to a fresh segment in the current format.
+func TestLegacySegmentReadable(t *testing.T) {
+	for _, version := range []byte{2, 3} {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			dir := t.TempDir()
+			seg := []byte("DBSEG\x00" + string(rune(version)))
+			seg = appendLegacyRecord(seg, version, "t", "a", "1")
+			seg = appendLegacyRecord(seg, version, "t", "b", "2")
+			if err := os.WriteFile(filepath.Join(dir, "seg-0000000001.data"), seg, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			e, err := tiered.Open(testConfig(dir), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := mustGet(t, e, "t", "a"); got != "1" {
+				t.Fatalf("a = %q", got)
+			}
+			wantLSN := uint64(0)
+			if version == 3 {
+				wantLSN = 5 // appendLegacyRecord stamps v3 records with LSN 5
+			}
+			if got := e.AppliedLSN(); got != wantLSN {
+				t.Fatalf("AppliedLSN of a legacy segment = %d, want %d", got, wantLSN)
+			}
+			if err = e.Set(engine.WithLSN(context.Background(), 7), "t", "c", "3"); err != nil {
+				t.Fatal(err)
+			}
+			if segments, _ := segmentFiles(t, dir); len(segments) != 2 {
+				t.Fatalf("got %d segments, want the legacy one sealed and a new one", len(segments))
+			}
+			if err = e.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			e2 := open(t, testConfig(dir))
+			if got := mustGet(t, e2, "t", "b"); got != "2" {
+				t.Fatalf("b = %q", got)
+			}
+			if got := mustGet(t, e2, "t", "c"); got != "3" {
+				t.Fatalf("c = %q", got)
+			}
+			if got := e2.AppliedLSN(); got != 7 {
+				t.Fatalf("AppliedLSN = %d, want 7", got)
+			}
+		})
+	}
+}
+
+// appendLegacyRecord encodes a record in an older segment format: tableLen uint16 | keyLen uint16 | valLen uint32 |
+// lsn uint64 (v3 only) | table | key | value | crc32.
+func appendLegacyRecord(buf []byte, version byte, table, key, value string) []byte {
+	start := len(buf)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(table)))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(key)))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(value)))
+	if version == 3 {
+		buf = binary.BigEndian.AppendUint64(buf, 5)
+	}
+	buf = append(buf, table...)
+	buf = append(buf, key...)
+	buf = append(buf, value...)
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[start:]))
+}
+
+// TestFreezeAndReplaceSegments ships a frozen set from one engine to another: the receiver ends up with exactly the
+// frozen state, writes made after the freeze stay behind, and the shipped LSN survives the receiver's restart.
+func TestFreezeAndReplaceSegments(t *testing.T) {
+	ctx := context.Background()
+	srcCfg := testConfig(t.TempDir())
+	srcCfg.SegmentSize = 256
+	src := open(t, srcCfg)
+	for i := range 20 {
+		if err := src.Set(engine.WithLSN(ctx, uint64(i+1)), "t", fmt.Sprintf("k%02d", i), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	set, err := src.Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// writes after the freeze append past the frozen sizes and must not be shipped
+	if err = src.Set(engine.WithLSN(ctx, 21), "t", "late", "x"); err != nil {
+		t.Fatal(err)
+	}
+	src.Compact() // held off while the set is frozen; it would unlink frozen files
+	staged := t.TempDir()
+	err = set.Each(func(name string, size int64, data io.Reader) error {
+		file, createErr := os.Create(filepath.Join(staged, name))
+		if createErr != nil {
+			return createErr
+		}
+		defer file.Close()
+		n, copyErr := io.Copy(file, data)
+		if copyErr == nil && n != size {
+			copyErr = fmt.Errorf("%s: copied %d bytes, want %d", name, n, size)
+		}
+		return copyErr
+	})
+	set.Release()
+	set.Release()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dstCfg := testConfig(t.TempDir())
+	dst, err := tiered.Open(dstCfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = dst.Set(ctx, "t", "stale", "gone"); err != nil {
+		t.Fatal(err)
+	}
+	if err = dst.ReplaceSegments(staged, 25); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, dst, "t", "k19"); got != strings.Repeat("v", 20) {
+		t.Fatalf("k19 = %q", got)
+	}
+	for _, key := range []string{"late", "stale"} {
+		if _, err = dst.Get(ctx, "t", key); !errors.Is(err, engine.ErrNotFound) {
+			t.Fatalf("%s: want ErrNotFound, got %v", key, err)
+		}
+	}
+	if got := dst.AppliedLSN(); got != 25 {
+		t.Fatalf("AppliedLSN = %d, want the shipped LSN 25", got)
+	}
+	if _, err = os.Stat(filepath.Join(dstCfg.Dir, "resync.pending")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("resync marker after a finished swap: %v", err)
+	}
+	if err = dst.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := open(t, dstCfg)
+	if got := reopened.AppliedLSN(); got != 25 {
+		t.Fatalf("AppliedLSN after restart = %d, want 25", got)
+	}
+	if got := mustGet(t, reopened, "t", "k00"); got != strings.Repeat("v", 20) {
+		t.Fatalf("k00 = %q", got)
+	}
+}
+
+// TestHoldCompaction checks no compaction pass runs while compaction is held, that a Freeze under the hold succeeds, and
+// that passes run again once it is released.
+func TestHoldCompaction(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	cfg.SegmentSize = 256
+	e := open(t, cfg)
+	ctx := context.Background()
+	for i := range 30 {
+		if err := e.Set(ctx, "t", "hot", fmt.Sprintf("%040d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	release, err := e.HoldCompaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := e.Freeze()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Release()
+	e.Compact()
+	if compactions := e.Stats().Compactions; compactions != 0 {
+		t.Fatalf("%d compactions while held, want 0", compactions)
+	}
+	release()
+	release()
+	e.Compact()
+	if compactions := e.Stats().Compactions; compactions == 0 {
+		t.Fatal("no compaction after the hold was released")
+	}
+}
+
+// TestInterruptedResyncIsDiscarded checks an engine whose segment swap a crash cut short, leaving its marker, reopens
+// empty at LSN 0 rather than recovering the mix of segments as the shipped dataset.
+func TestInterruptedResyncIsDiscarded(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	e, err := tiered.Open(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := range 5 {
+		if err = e.Set(engine.WithLSN(ctx, uint64(i+1)), "t", fmt.Sprintf("k%d", i), "v"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// the state a crash between the marker and its removal leaves: segments of either dataset, and maybe the new LSN
+	lsn := binary.BigEndian.AppendUint64(nil, 40)
+	if err = os.WriteFile(filepath.Join(cfg.Dir, "resync.lsn"), lsn, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(cfg.Dir, "resync.pending"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := open(t, cfg)
+	if got := reopened.AppliedLSN(); got != 0 {
+		t.Fatalf("AppliedLSN = %d, want 0 after an interrupted resync", got)
+	}
+	if _, err = reopened.Get(ctx, "t", "k0"); !errors.Is(err, engine.ErrNotFound) {
+		t.Fatalf("k0: want ErrNotFound, got %v", err)
+	}
+	for _, name := range []string{"resync.pending", "resync.lsn"} {
+		if _, err = os.Stat(filepath.Join(cfg.Dir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("%s after reopening: %v", name, err)
+		}
+	}
+}
+
+// TestReadOnlyOpenWritesNothing checks a read-only open recovers every key without writing the hint files a normal
+// open would, and refuses segments a crash left mid-resync instead of wiping them.
+func TestReadOnlyOpenWritesNothing(t *testing.T) {
+	cfg := testConfig(t.TempDir())
+	cfg.SegmentSize = 256
+	e, err := tiered.Open(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := range 20 {
+		if err = e.Set(ctx, "t", fmt.Sprintf("k%02d", i), strings.Repeat("v", 20)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, hints := segmentFiles(t, cfg.Dir)
+	for _, hint := range hints {
+		if err = os.Remove(hint); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg.ReadOnly = true
+	readOnly := open(t, cfg)
+	if got := mustGet(t, readOnly, "t", "k19"); got != strings.Repeat("v", 20) {
+		t.Fatalf("k19 = %q", got)
+	}
+	if _, hints = segmentFiles(t, cfg.Dir); len(hints) != 0 {
+		t.Fatalf("read-only open wrote hint files %v", hints)
+	}
+
+	if err = os.WriteFile(filepath.Join(cfg.Dir, "resync.pending"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tiered.Open(cfg, nil); err == nil || !strings.Contains(err.Error(), "interrupted") {
+		t.Fatalf("read-only open of an interrupted resync: err = %v", err)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"slices"
@@ -19,12 +20,19 @@ import (
 
 // On-disk record layout (big-endian), append-only, one per mutation:
 //
-//	tableLen uint16 | keyLen uint16 | valLen uint32 | table | key | value | crc32
+//	tableLen uint16 | keyLen uint16 | valLen uint32 | lsn uint64 | codec uint8 | table | key | value | crc32
 //
-// valLen == tombstoneMarker marks a delete (no value bytes follow). The crc32 covers the header and body, mirroring the
-// WAL, so a torn tail from a crash is detected and truncated on recovery.
+// valLen == tombstoneMarker marks a delete (no value bytes follow). lsn is the replication log position of the
+// mutation that wrote the record, 0 when the server keeps no log; a compaction rewrite keeps the original. codec says
+// how the value is stored (see compression.go), and valLen counts the stored bytes. The crc32 covers the header and
+// body, mirroring the WAL, so a torn tail from a crash is detected and truncated on recovery.
+//
+// Older segments are still read: version 3 lacks the codec field and stores every value as is, and version 2, written
+// before records carried an LSN, lacks the lsn field as well.
 const (
-	headerSize      = 8
+	headerSize      = 17
+	headerSizeV3    = 16
+	headerSizeV2    = 8
 	crcSize         = 4
 	tombstoneMarker = 0xFFFFFFFF
 	// maxFieldLen bounds table/key length (uint16 on disk).
@@ -39,26 +47,41 @@ const (
 )
 
 // segmentHeader identifies a segment written by this build; the trailing byte is the format version. A non-empty
-// segment without it is rejected at open rather than parsed, since misreading one looks like a torn tail and gets
-// truncated away.
-const segmentHeader = "DBSEG\x00\x02"
+// segment without it (or the header of an older version this build still reads) is rejected at open rather than
+// parsed, since misreading one looks like a torn tail and gets truncated away.
+const (
+	segmentHeader   = "DBSEG\x00\x04"
+	segmentHeaderV3 = "DBSEG\x00\x03"
+	segmentHeaderV2 = "DBSEG\x00\x02"
+)
+
+// segment format versions, the last byte of their header
+const (
+	formatV2 byte = 2
+	formatV3 byte = 3
+	formatV4 byte = 4
+)
 
 var (
 	errPartial  = errors.New("partial tiered record")
 	errChecksum = errors.New("tiered record checksum mismatch")
 )
 
-// decoded is one record read back from a segment.
+// decoded is one record read back from a segment. value holds the stored bytes, still compressed if codec says so.
 type decoded struct {
 	table     string
 	key       string
 	value     string
+	codec     byte
+	rawLen    uint32 // length of the value once decompressed
 	tombstone bool
+	lsn       uint64
 	recSize   int64
+	valOff    int64 // offset of the value from the start of the record
 }
 
-// valPosFor returns the absolute offset of a record's value bytes given the offset of the record start. The keydir
-// stores this so a cache miss reads only the value, not the whole record.
+// valPosFor returns the absolute offset of a record's value bytes given the offset of the record start, for a record in
+// the current format. The keydir stores this so a cache miss reads only the value, not the whole record.
 func valPosFor(recPos int64, table, key string) int64 {
 	return recPos + headerSize + int64(len(table)+len(key))
 }
@@ -69,7 +92,8 @@ func valPosFor(recPos int64, table, key string) int64 {
 func u16(n int) uint16 { return uint16(n) } // #nosec G115 -- length bounded by maxFieldLen
 func u32(n int) uint32 { return uint32(n) } // #nosec G115 -- length bounded by maxValueLen
 
-func encodeRecord(table, key, value string, tombstone bool) []byte {
+// encodeRecord encodes a record whose value is already stored with codec.
+func encodeRecord(table, key, value string, codec byte, tombstone bool, lsn uint64) []byte {
 	valLen := u32(len(value))
 	if tombstone {
 		valLen = tombstoneMarker
@@ -83,6 +107,8 @@ func encodeRecord(table, key, value string, tombstone bool) []byte {
 	binary.BigEndian.PutUint16(hdr[0:2], u16(len(table)))
 	binary.BigEndian.PutUint16(hdr[2:4], u16(len(key)))
 	binary.BigEndian.PutUint32(hdr[4:8], valLen)
+	binary.BigEndian.PutUint64(hdr[8:16], lsn)
+	hdr[16] = codec
 	buf = append(buf, hdr[:]...)
 	buf = append(buf, table...)
 	buf = append(buf, key...)
@@ -93,8 +119,22 @@ func encodeRecord(table, key, value string, tombstone bool) []byte {
 	return binary.BigEndian.AppendUint32(buf, crc)
 }
 
-func decodeRecord(reader *bufio.Reader) (decoded, error) {
-	hdr := make([]byte, headerSize)
+// recordHeaderSize returns the size of a record header in the given format.
+func recordHeaderSize(format byte) int {
+	switch format {
+	case formatV2:
+		return headerSizeV2
+	case formatV3:
+		return headerSizeV3
+	default:
+		return headerSize
+	}
+}
+
+// decodeRecord reads one record of a segment in the given format.
+func decodeRecord(reader *bufio.Reader, format byte) (decoded, error) {
+	hdrLen := recordHeaderSize(format)
+	hdr := make([]byte, hdrLen)
 	n, err := io.ReadFull(reader, hdr)
 	if err != nil {
 		if errors.Is(err, io.EOF) && n == 0 {
@@ -131,10 +171,20 @@ func decodeRecord(reader *bufio.Reader) (decoded, error) {
 		table:     string(body[:tableLen]),
 		key:       string(body[tableLen : tableLen+keyLen]),
 		tombstone: tombstone,
-		recSize:   int64(headerSize + bodyLen + crcSize),
+		recSize:   int64(hdrLen + bodyLen + crcSize),
+		valOff:    int64(hdrLen + tableLen + keyLen),
+	}
+	if hdrLen >= headerSizeV3 {
+		rec.lsn = binary.BigEndian.Uint64(hdr[8:16])
+	}
+	if hdrLen == headerSize {
+		rec.codec = hdr[16]
 	}
 	if !tombstone {
 		rec.value = string(body[tableLen+keyLen:])
+		if rec.rawLen, err = rawLength(rec.codec, body[tableLen+keyLen:]); err != nil {
+			return decoded{}, err
+		}
 	}
 	return rec, nil
 }
@@ -151,10 +201,14 @@ type store struct {
 	dir         string
 	segmentSize int64
 	sync        wal.SyncPolicy
+	logger      *slog.Logger
 
 	activeSeg uint32
 	readers   map[uint32]*os.File // open handles per segment (includes active)
 	sizes     map[uint32]int64    // bytes written per segment
+	formats   map[uint32]byte     // format version per segment; only the current one is appended to
+	// pending holds the hint of every record in the active segment, written out as its hint file when it is sealed
+	pending []hint
 
 	pinMu stdsync.Mutex
 	pins  map[uint32]int
@@ -170,7 +224,7 @@ func (s *store) dataSize(seg uint32) int64 {
 	return max(0, s.sizes[seg]-int64(len(segmentHeader)))
 }
 
-func openStore(dir string, segmentSize int64, sync wal.SyncPolicy) (*store, error) {
+func openStore(dir string, segmentSize int64, sync wal.SyncPolicy, logger *slog.Logger) (*store, error) {
 	if err := os.MkdirAll(dir, 0o750); err != nil {
 		return nil, fmt.Errorf("create data directory: %w", err)
 	}
@@ -178,8 +232,10 @@ func openStore(dir string, segmentSize int64, sync wal.SyncPolicy) (*store, erro
 		dir:         dir,
 		segmentSize: segmentSize,
 		sync:        sync,
+		logger:      logger,
 		readers:     make(map[uint32]*os.File),
 		sizes:       make(map[uint32]int64),
+		formats:     make(map[uint32]byte),
 		pins:        make(map[uint32]int),
 	}
 	s.cond = stdsync.NewCond(&s.pinMu)
@@ -199,6 +255,7 @@ func openStore(dir string, segmentSize int64, sync wal.SyncPolicy) (*store, erro
 			return nil, fmt.Errorf("stat segment %d: %w", num, statErr)
 		}
 		size := info.Size()
+		format := formatV4
 		if size == 0 {
 			// A crash between creating a segment and writing its header leaves an empty file; finish the job rather than
 			// rejecting it as unreadable.
@@ -206,10 +263,11 @@ func openStore(dir string, segmentSize int64, sync wal.SyncPolicy) (*store, erro
 				return nil, fmt.Errorf("write segment %d header: %w", num, err)
 			}
 			size = int64(len(segmentHeader))
-		} else if _, err = wal.RequireHeader(file, segmentHeader); err != nil {
+		} else if format, err = readFormat(file); err != nil {
 			return nil, fmt.Errorf("segment %d: %w", num, err)
 		}
 		s.sizes[num] = size
+		s.formats[num] = format
 	}
 	if len(nums) > 0 {
 		s.activeSeg = nums[len(nums)-1]
@@ -258,17 +316,35 @@ func (s *store) openNewActive(num uint32) error {
 	s.activeSeg = num
 	s.readers[num] = file
 	s.sizes[num] = int64(len(segmentHeader))
+	s.formats[num] = formatV4
 	return nil
 }
 
-// append writes rec to the active segment (rotating first if it would overflow) and returns the segment number and the
-// record's start offset.
-func (s *store) append(rec []byte) (uint32, int64, error) {
-	if dataSize := s.dataSize(s.activeSeg); dataSize > 0 && dataSize+int64(len(rec)) > s.segmentSize {
-		if err := s.syncActive(); err != nil {
-			return 0, 0, err
+// readFormat returns the format version of a non-empty segment from its header.
+func readFormat(file *os.File) (byte, error) {
+	versions := []struct {
+		header string
+		format byte
+	}{{segmentHeader, formatV4}, {segmentHeaderV3, formatV3}, {segmentHeaderV2, formatV2}}
+	var err error
+	for _, version := range versions {
+		if _, err = wal.RequireHeader(file, version.header); err == nil {
+			return version.format, nil
+		}
+		if !errors.Is(err, wal.ErrUnsupportedFormat) {
+			return 0, err
 		}
-		if err := s.openNewActive(s.activeSeg + 1); err != nil {
+	}
+	return 0, err
+}
+
+// append writes rec to the active segment (rotating first if it would overflow, which seals the old one with its hint
+// file) and returns the segment number and the record's start offset. An active segment left in an older format by a
+// previous build is rotated away on the first append, so a segment never mixes two record layouts.
+func (s *store) append(rec []byte) (uint32, int64, error) {
+	dataSize := s.dataSize(s.activeSeg)
+	if s.formats[s.activeSeg] != formatV4 || (dataSize > 0 && dataSize+int64(len(rec)) > s.segmentSize) {
+		if err := s.rotate(); err != nil {
 			return 0, 0, err
 		}
 	}
@@ -286,25 +362,43 @@ func (s *store) append(rec []byte) (uint32, int64, error) {
 		return 0, 0, fmt.Errorf("write record: %w", err)
 	}
 	s.sizes[s.activeSeg] += int64(written)
+	s.pending = append(s.pending, hintOfEncoded(rec, recPos))
 	return s.activeSeg, recPos, nil
 }
 
-// readValue reads valLen bytes at valPos from segment seg.
-func (s *store) readValue(seg uint32, valPos int64, valLen uint32) (string, error) {
-	file, ok := s.pin(seg)
+// rotate seals the active segment and opens the next one.
+func (s *store) rotate() error {
+	if err := s.syncActive(); err != nil {
+		return err
+	}
+	sealed := s.activeSeg
+	if err := s.openNewActive(s.activeSeg + 1); err != nil {
+		return err
+	}
+	s.seal(sealed)
+	return nil
+}
+
+// readValue reads the value at location, decompressing it if it was stored compressed.
+func (s *store) readValue(location loc) (string, error) {
+	file, ok := s.pin(location.seg)
 	if !ok {
-		return "", fmt.Errorf("segment %d not open", seg)
+		return "", fmt.Errorf("segment %d not open", location.seg)
 	}
-	defer s.unpin(seg)
-	return readPinnedValue(seg, file, valPos, valLen)
+	defer s.unpin(location.seg)
+	return readPinnedValue(file, location)
 }
 
-func readPinnedValue(seg uint32, file *os.File, valPos int64, valLen uint32) (string, error) {
-	buf := make([]byte, valLen)
-	if _, err := file.ReadAt(buf, valPos); err != nil {
-		return "", fmt.Errorf("read value from segment %d: %w", seg, err)
+func readPinnedValue(file *os.File, location loc) (string, error) {
+	buf := make([]byte, location.valLen)
+	if _, err := file.ReadAt(buf, location.valPos); err != nil {
+		return "", fmt.Errorf("read value from segment %d: %w", location.seg, err)
 	}
-	return string(buf), nil
+	value, err := decompress(location.codec, buf)
+	if err != nil {
+		return "", fmt.Errorf("read value from segment %d: %w", location.seg, err)
+	}
+	return value, nil
 }
 
 // scanBufSize buffers segment reads during recovery and compaction; the default bufio size would be one read syscall
@@ -320,7 +414,7 @@ func (s *store) scanSegment(seg uint32, allowTornTail bool, fn func(rec decoded,
 		return fmt.Errorf("segment %d not open", seg)
 	}
 	defer s.unpin(seg)
-	offset, err := scanPinnedSegment(seg, file, allowTornTail, fn)
+	offset, err := scanPinnedSegment(seg, file, s.formats[seg], allowTornTail, fn)
 	if err != nil {
 		return err
 	}
@@ -332,14 +426,20 @@ func (s *store) scanSegment(seg uint32, allowTornTail bool, fn func(rec decoded,
 // shared handle, so only one scan may run on a segment at a time: recovery scans before the engine serves anything, and
 // compaction is serialized by the compacting flag. Value reads are unaffected — they use ReadAt, which ignores the file
 // offset.
-func scanPinnedSegment(seg uint32, file *os.File, allowTornTail bool, fn func(rec decoded, recPos int64)) (int64, error) {
+func scanPinnedSegment(
+	seg uint32,
+	file *os.File,
+	format byte,
+	allowTornTail bool,
+	fn func(rec decoded, recPos int64),
+) (int64, error) {
 	offset := int64(len(segmentHeader))
 	if _, err := file.Seek(offset, io.SeekStart); err != nil {
 		return 0, fmt.Errorf("seek segment %d: %w", seg, err)
 	}
 	reader := bufio.NewReaderSize(file, scanBufSize)
 	for {
-		rec, err := decodeRecord(reader)
+		rec, err := decodeRecord(reader, format)
 		if errors.Is(err, io.EOF) {
 			break
 		}
@@ -358,24 +458,37 @@ func scanPinnedSegment(seg uint32, file *os.File, allowTornTail bool, fn func(re
 	return offset, nil
 }
 
-// removeSegment closes and deletes a segment (used by compaction).
+// removeSegment closes and deletes a segment and its hint file (used by compaction).
 func (s *store) removeSegment(seg uint32) error {
+	if err := s.detach(seg); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(s.dir, segFilename(seg))); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove segment %d: %w", seg, err)
+	}
+	// A hint outliving its segment is harmless (recovery only looks for the hints of segments it finds), but it would
+	// be litter.
+	if err := os.Remove(filepath.Join(s.dir, hintFilename(seg))); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove hint of segment %d: %w", seg, err)
+	}
+	return nil
+}
+
+// detach closes a segment, once no reader has it pinned, and forgets it, leaving its files where they are.
+func (s *store) detach(seg uint32) error {
 	s.pinMu.Lock()
+	defer s.pinMu.Unlock()
 	for s.pins[seg] > 0 {
 		s.cond.Wait()
 	}
 	if file, ok := s.readers[seg]; ok {
 		if err := file.Close(); err != nil {
-			s.pinMu.Unlock()
 			return fmt.Errorf("close segment %d: %w", seg, err)
 		}
 		delete(s.readers, seg)
 	}
-	s.pinMu.Unlock()
 	delete(s.sizes, seg)
-	if err := os.Remove(filepath.Join(s.dir, segFilename(seg))); err != nil && !os.IsNotExist(err) {
-		return fmt.Errorf("remove segment %d: %w", seg, err)
-	}
+	delete(s.formats, seg)
 	return nil
 }
 
@@ -460,17 +573,25 @@ func listSegments(dir string) ([]uint32, error) {
 	}
 	var nums []uint32
 	for _, entry := range entries {
-		name := entry.Name()
-		if entry.IsDir() || !strings.HasPrefix(name, SegPrefix) || !strings.HasSuffix(name, SegSuffix) {
+		if entry.IsDir() {
 			continue
 		}
-		text := strings.TrimSuffix(strings.TrimPrefix(name, SegPrefix), SegSuffix)
-		num, parseErr := strconv.ParseUint(text, 10, 32)
-		if parseErr != nil {
-			continue
+		if num, ok := segmentNumber(entry.Name()); ok {
+			nums = append(nums, num)
 		}
-		nums = append(nums, uint32(num))
 	}
 	slices.Sort(nums)
 	return nums, nil
 }
+
+// segmentNumber parses a segment filename.
+func segmentNumber(name string) (uint32, bool) {
+	if !strings.HasPrefix(name, SegPrefix) || !strings.HasSuffix(name, SegSuffix) {
+		return 0, false
+	}
+	num, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, SegPrefix), SegSuffix), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(num), true
+}
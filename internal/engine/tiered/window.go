@@ -0,0 +1,66 @@
+package tiered
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Window is a daily time range, "HH:MM-HH:MM" in the server's local time, during which background compaction may run,
+// so it can be kept out of peak hours. A range whose end comes before its start wraps past midnight ("22:00-06:00");
+// the empty window allows any time. Manual compaction ignores it.
+type Window string
+
+// window is a parsed Window: offsets from midnight, with always set for the empty one.
+type window struct {
+	start, end time.Duration
+	always     bool
+}
+
+// Validate reports whether w is a well-formed window.
+func (w Window) Validate() error {
+	_, err := w.parse()
+	return err
+}
+
+func (w Window) parse() (window, error) {
+	if w == "" {
+		return window{always: true}, nil
+	}
+	from, to, ok := strings.Cut(string(w), "-")
+	if !ok {
+		return window{}, fmt.Errorf("compaction window %q: want HH:MM-HH:MM", string(w))
+	}
+	start, err := timeOfDay(from)
+	if err != nil {
+		return window{}, fmt.Errorf("compaction window %q: %w", string(w), err)
+	}
+	end, err := timeOfDay(to)
+	if err != nil {
+		return window{}, fmt.Errorf("compaction window %q: %w", string(w), err)
+	}
+	if start == end {
+		return window{}, fmt.Errorf("compaction window %q is empty; leave it unset to allow any time", string(w))
+	}
+	return window{start: start, end: end}, nil
+}
+
+func timeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// contains reports whether t falls in the window.
+func (w window) contains(t time.Time) bool {
+	if w.always {
+		return true
+	}
+	now := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	if w.start < w.end {
+		return now >= w.start && now < w.end
+	}
+	return now >= w.start || now < w.end
+}
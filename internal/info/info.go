@@ -0,0 +1,109 @@
+// Package info assembles the reply to INFO. Each subsystem reports its own state as a Section through Provider, so the
+// server only decides which subsystems it has, and the text format lives in one place.
+package info
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field is one name:value line of a section.
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Section is a named group of fields, such as "keyspace" or "persistence". Names are lower case; INFO <section>
+// matches them case-insensitively.
+type Section struct {
+	Name   string
+	Fields []Field
+}
+
+// Provider reports one section. Several providers may report the same section name, in which case their fields are
+// joined in the order the providers were given.
+type Provider interface {
+	Info(ctx context.Context) Section
+}
+
+// ProviderFunc adapts a function to Provider.
+type ProviderFunc func(ctx context.Context) Section
+
+// Info calls f.
+func (f ProviderFunc) Info(ctx context.Context) Section {
+	return f(ctx)
+}
+
+// Add appends a field. Floats get two decimals, times become Unix seconds (0 for the zero time), durations seconds,
+// and booleans 1 or 0; anything else is formatted with fmt.Sprint.
+func (s *Section) Add(name string, value any) {
+	var text string
+	switch v := value.(type) {
+	case string:
+		text = v
+	case float64:
+		text = strconv.FormatFloat(v, 'f', 2, 64)
+	case bool:
+		text = "0"
+		if v {
+			text = "1"
+		}
+	case time.Time:
+		text = "0"
+		if !v.IsZero() {
+			text = strconv.FormatInt(v.Unix(), 10)
+		}
+	case time.Duration:
+		text = strconv.FormatInt(int64(v/time.Second), 10)
+	default:
+		text = fmt.Sprint(v)
+	}
+	s.Fields = append(s.Fields, Field{Name: name, Value: text})
+}
+
+// Collect asks every provider for its section and keeps the one named by section, or all of them when section is
+// empty or "all". Sections of the same name are merged, in order of their first appearance.
+func Collect(ctx context.Context, providers []Provider, section string) []Section {
+	section = strings.ToLower(section)
+	var sections []Section
+	index := make(map[string]int)
+	for _, provider := range providers {
+		reported := provider.Info(ctx)
+		if section != "" && section != "all" && reported.Name != section {
+			continue
+		}
+		if i, ok := index[reported.Name]; ok {
+			sections[i].Fields = append(sections[i].Fields, reported.Fields...)
+			continue
+		}
+		index[reported.Name] = len(sections)
+		sections = append(sections, reported)
+	}
+	return sections
+}
+
+// Format renders sections the way Redis does: a "# Name" header, one name:value line per field, and an empty line
+// between sections, all CRLF-terminated.
+func Format(sections []Section) string {
+	var b strings.Builder
+	for i, section := range sections {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# ")
+		if section.Name != "" {
+			b.WriteString(strings.ToUpper(section.Name[:1]) + section.Name[1:])
+		}
+		b.WriteString("\r\n")
+		for _, field := range section.Fields {
+			b.WriteString(field.Name)
+			b.WriteByte(':')
+			b.WriteString(field.Value)
+			b.WriteString("\r\n")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package info_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/OutOfStack/db/internal/info"
+)
+
+func section(name string, fields ...string) info.Provider {
+	return info.ProviderFunc(func(context.Context) info.Section {
+		s := info.Section{Name: name}
+		for i := 0; i+1 < len(fields); i += 2 {
+			s.Add(fields[i], fields[i+1])
+		}
+		return s
+	})
+}
+
+func TestCollectMergesAndFilters(t *testing.T) {
+	providers := []info.Provider{
+		section("server", "version", "dev"),
+		section("persistence", "engine_fsync", "always"),
+		section("keyspace", "tables", "0"),
+		section("persistence", "wal_last_lsn", "7"),
+	}
+
+	all := info.Format(info.Collect(t.Context(), providers, ""))
+	want := "# Server\r\nversion:dev\r\n\r\n" +
+		"# Persistence\r\nengine_fsync:always\r\nwal_last_lsn:7\r\n\r\n" +
+		"# Keyspace\r\ntables:0\r\n"
+	if all != want {
+		t.Fatalf("INFO =\n%q\nwant\n%q", all, want)
+	}
+	if got := info.Format(info.Collect(t.Context(), providers, "ALL")); got != want {
+		t.Fatalf("INFO ALL = %q", got)
+	}
+	if got := info.Format(info.Collect(t.Context(), providers, "Persistence")); got !=
+		"# Persistence\r\nengine_fsync:always\r\nwal_last_lsn:7\r\n" {
+		t.Fatalf("INFO persistence = %q", got)
+	}
+	if got := info.Collect(t.Context(), providers, "nonsense"); len(got) != 0 {
+		t.Fatalf("INFO nonsense = %v, want no sections", got)
+	}
+}
+
+func TestAddFormatsValues(t *testing.T) {
+	var s info.Section
+	s.Add("ratio", 1.5)
+	s.Add("on", true)
+	s.Add("off", false)
+	s.Add("never", time.Time{})
+	s.Add("at", time.Unix(1700000000, 0))
+	s.Add("uptime", 90*time.Second)
+	s.Add("keys", 42)
+	want := []info.Field{
+		{Name: "ratio", Value: "1.50"},
+		{Name: "on", Value: "1"},
+		{Name: "off", Value: "0"},
+		{Name: "never", Value: "0"},
+		{Name: "at", Value: "1700000000"},
+		{Name: "uptime", Value: "90"},
+		{Name: "keys", Value: "42"},
+	}
+	if len(s.Fields) != len(want) {
+		t.Fatalf("fields = %v", s.Fields)
+	}
+	for i, field := range want {
+		if s.Fields[i] != field {
+			t.Fatalf("field %d = %v, want %v", i, s.Fields[i], field)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+// Package metrics exposes the server's metrics in the Prometheus text format without a client library. Subsystems keep
+// their own counters and histograms, which cost an atomic add each, and implement Collector; a Registry asks every
+// collector for its families when /metrics is scraped, so values that already live elsewhere (engine stats, replication
+// lag) are read at scrape time rather than copied.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// contentType is the Prometheus text exposition format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// LatencyBuckets returns histogram bounds in seconds for request and I/O latencies, from 100µs to 10s.
+func LatencyBuckets() []float64 {
+	return []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+}
+
+// SizeBuckets returns histogram bounds for counts of things handled together, powers of two up to 1024.
+func SizeBuckets() []float64 {
+	return []float64{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024}
+}
+
+// Counter is a monotonically increasing count.
+type Counter struct {
+	value atomic.Uint64
+}
+
+// Inc adds one.
+func (c *Counter) Inc() { c.value.Add(1) }
+
+// Add adds n.
+func (c *Counter) Add(n uint64) { c.value.Add(n) }
+
+// Value returns the count.
+func (c *Counter) Value() uint64 { return c.value.Load() }
+
+// Histogram counts observations into buckets with fixed upper bounds, and sums them.
+type Histogram struct {
+	bounds []float64
+	counts []atomic.Uint64 // one per bound, plus the +Inf bucket
+	sum    atomic.Uint64   // float64 bits
+}
+
+// NewHistogram returns a histogram with the given upper bounds, which must be sorted.
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{bounds: bounds, counts: make([]atomic.Uint64, len(bounds)+1)}
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(value float64) {
+	i := 0
+	for i < len(h.bounds) && value > h.bounds[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	for {
+		old := h.sum.Load()
+		if h.sum.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+value)) {
+			return
+		}
+	}
+}
+
+// ObserveSince records the seconds elapsed since start.
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Label is a name="value" pair qualifying a sample.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Collector reports metric families. It must report all the samples of a family together, one family after another.
+type Collector interface {
+	Collect(enc *Encoder)
+}
+
+// Encoder writes samples in the text format, with a HELP and TYPE header before the first sample of each family; the
+// help of the family's later samples is not used.
+type Encoder struct {
+	w      *bufio.Writer
+	family string
+}
+
+// Counter writes a sample of a counter family.
+func (e *Encoder) Counter(name, help string, value float64, labels ...Label) {
+	e.header(name, help, "counter")
+	e.sample(name, labels, nil, value)
+}
+
+// Gauge writes a sample of a gauge family.
+func (e *Encoder) Gauge(name, help string, value float64, labels ...Label) {
+	e.header(name, help, "gauge")
+	e.sample(name, labels, nil, value)
+}
+
+// Histogram writes a histogram's cumulative buckets, sum and count.
+func (e *Encoder) Histogram(name, help string, h *Histogram, labels ...Label) {
+	e.header(name, help, "histogram")
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += h.counts[i].Load()
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = strconv.FormatFloat(h.bounds[i], 'g', -1, 64)
+		}
+		e.sample(name+"_bucket", labels, &Label{Name: "le", Value: le}, float64(cumulative))
+	}
+	e.sample(name+"_sum", labels, nil, math.Float64frombits(h.sum.Load()))
+	e.sample(name+"_count", labels, nil, float64(cumulative))
+}
+
+func (e *Encoder) header(name, help, kind string) {
+	if name == e.family {
+		return
+	}
+	e.family = name
+	_, _ = e.w.WriteString("# HELP " + name + " " + helpEscaper.Replace(help) + "\n")
+	_, _ = e.w.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+func (e *Encoder) sample(name string, labels []Label, extra *Label, value float64) {
+	_, _ = e.w.WriteString(name)
+	if len(labels) > 0 || extra != nil {
+		_ = e.w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				_ = e.w.WriteByte(',')
+			}
+			e.label(label)
+		}
+		if extra != nil {
+			if len(labels) > 0 {
+				_ = e.w.WriteByte(',')
+			}
+			e.label(*extra)
+		}
+		_ = e.w.WriteByte('}')
+	}
+	_ = e.w.WriteByte(' ')
+	_, _ = e.w.WriteString(formatValue(value))
+	_ = e.w.WriteByte('\n')
+}
+
+func (e *Encoder) label(label Label) {
+	_, _ = e.w.WriteString(label.Name + `="` + labelEscaper.Replace(label.Value) + `"`)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)            //nolint:gochecknoglobals // stateless
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`) //nolint:gochecknoglobals // stateless
+)
+
+// Registry holds the collectors a scrape asks, in the order they were registered. Two collectors must not report the
+// same family.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds collectors.
+func (r *Registry) Register(collectors ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, collectors...)
+}
+
+// WriteTo writes every collector's families to w.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	counter := &countingWriter{w: w}
+	enc := &Encoder{w: bufio.NewWriter(counter)}
+	for _, collector := range collectors {
+		collector.Collect(enc)
+	}
+	err := enc.w.Flush()
+	return counter.n, err
+}
+
+// ServeHTTP serves a scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	_, _ = r.WriteTo(w) // the scraper sees a truncated body; there is no one else to tell
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,77 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/OutOfStack/db/internal/metrics"
+)
+
+type collectorFunc func(enc *metrics.Encoder)
+
+func (f collectorFunc) Collect(enc *metrics.Encoder) { f(enc) }
+
+func scrape(t *testing.T, registry *metrics.Registry) string {
+	t.Helper()
+	var b strings.Builder
+	if _, err := registry.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestExposition(t *testing.T) {
+	latency := metrics.NewHistogram([]float64{0.1, 1})
+	for _, v := range []float64{0.05, 0.1, 0.5, 3} {
+		latency.Observe(v)
+	}
+	var requests metrics.Counter
+	requests.Add(2)
+	requests.Inc()
+
+	registry := metrics.NewRegistry()
+	registry.Register(collectorFunc(func(enc *metrics.Encoder) {
+		enc.Counter("requests_total", "Requests\nserved.", float64(requests.Value()),
+			metrics.Label{Name: "command", Value: `say "hi"\`})
+		enc.Counter("requests_total", "", 0, metrics.Label{Name: "command", Value: "GET"})
+		enc.Gauge("ratio", "A ratio.", 0.25)
+		enc.Histogram("latency_seconds", "Latency.", latency, metrics.Label{Name: "command", Value: "GET"})
+	}))
+
+	want := `# HELP requests_total Requests\nserved.
+# TYPE requests_total counter
+requests_total{command="say \"hi\"\\"} 3
+requests_total{command="GET"} 0
+# HELP ratio A ratio.
+# TYPE ratio gauge
+ratio 0.25
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{command="GET",le="0.1"} 2
+latency_seconds_bucket{command="GET",le="1"} 3
+latency_seconds_bucket{command="GET",le="+Inf"} 4
+latency_seconds_sum{command="GET"} 3.65
+latency_seconds_count{command="GET"} 4
+`
+	if got := scrape(t, registry); got != want {
+		t.Fatalf("exposition =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRegistryServesHTTP(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.Register(collectorFunc(func(enc *metrics.Encoder) { enc.Gauge("up", "Up.", 1) }))
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type = %q", recorder.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), "\nup 1\n") {
+		t.Fatalf("body = %q", body)
+	}
+}
@@ -0,0 +1,257 @@
+// Package migration moves keys from this server to another one over the normal client protocol: MIGRATE copies each
+// value to the target with SET and deletes it locally once the target has acknowledged it.
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/OutOfStack/db/internal/network"
+	"github.com/OutOfStack/db/internal/protocol"
+	"github.com/OutOfStack/db/internal/storage"
+)
+
+// Job states reported by MIGRATION STATUS
+const (
+	StateRunning   = "running"
+	StateDone      = "done"
+	StateFailed    = "failed"
+	StateCancelled = "cancelled"
+)
+
+// Store is the storage keys are migrated out of
+type Store interface {
+	Execute(ctx context.Context, cmd string, args []string) (protocol.Reply, error)
+	Transfer(ctx context.Context, table, key string, send func(context.Context, protocol.Value) error) error
+	ReadOnly() bool
+}
+
+// Migrator runs MIGRATE: one key at a time in the caller's request, or a whole table as a background job whose progress
+// MIGRATION STATUS reports.
+type Migrator struct {
+	store   Store
+	logger  *slog.Logger
+	local   string
+	options []network.TCPClientOption
+
+	ctx    context.Context //nolint:containedctx // bounds background jobs, cancelled by Close
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	jobs map[string]*job // by table; a finished job stays listed until the table is migrated again
+}
+
+// Option configures a Migrator
+type Option func(*Migrator)
+
+// WithLocalAddress sets the address this server listens on, so MIGRATE refuses to target it: a copy onto itself
+// followed by the local delete would lose the key.
+func WithLocalAddress(address string) Option {
+	return func(m *Migrator) { m.local = address }
+}
+
+// WithClientOptions sets the options of the connections opened to migration targets
+func WithClientOptions(options ...network.TCPClientOption) Option {
+	return func(m *Migrator) { m.options = options }
+}
+
+// New creates a Migrator over store
+func New(store Store, logger *slog.Logger, options ...Option) *Migrator {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := &Migrator{store: store, logger: logger, ctx: ctx, cancel: cancel, jobs: make(map[string]*job)}
+	for _, option := range options {
+		option(m)
+	}
+	return m
+}
+
+// job is the progress of one background table migration
+type job struct {
+	table   string
+	target  string
+	total   int
+	moved   int
+	skipped int // keys deleted after the table was listed
+	state   string
+	err     error
+}
+
+// MigrateKey moves one key to target and replies OK once it is there and gone from this server. A missing key is
+// storage.ErrNotFound.
+func (m *Migrator) MigrateKey(ctx context.Context, target, table, key string) (protocol.Reply, error) {
+	if err := m.check(target); err != nil {
+		return protocol.Reply{}, err
+	}
+	client := network.NewTCPClient(target, m.options...)
+	defer func() { _ = client.Close() }()
+
+	if err := m.store.Transfer(ctx, table, key, sender(client, table, key)); err != nil {
+		return protocol.Reply{}, err
+	}
+	return protocol.SimpleString("OK"), nil
+}
+
+// MigrateTable starts moving every key of table to target in the background and replies OK at once. The keys are those
+// the table held when the job started; keys written to it later stay here. Only one job per table runs at a time.
+func (m *Migrator) MigrateTable(ctx context.Context, target, table string) (protocol.Reply, error) {
+	if err := m.check(target); err != nil {
+		return protocol.Reply{}, err
+	}
+	if m.store.ReadOnly() {
+		return protocol.Reply{}, storage.ErrReadOnly
+	}
+	listing, err := m.store.Execute(ctx, "KEYS", []string{table})
+	if err != nil {
+		return protocol.Reply{}, err
+	}
+	keys := make([]string, 0, len(listing.Array))
+	for _, elem := range listing.Array {
+		keys = append(keys, elem.Value)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if running, ok := m.jobs[table]; ok && running.state == StateRunning {
+		return protocol.Reply{}, fmt.Errorf("table %s is already being migrated to %s", table, running.target)
+	}
+	if m.ctx.Err() != nil {
+		return protocol.Reply{}, errors.New("server is shutting down")
+	}
+	j := &job{table: table, target: target, total: len(keys), state: StateRunning}
+	m.jobs[table] = j
+	m.wg.Go(func() { m.run(j, keys) })
+	return protocol.SimpleString("OK"), nil
+}
+
+// run moves a job's keys one by one, stopping at the first key that fails so the operator can fix the cause and start
+// the table again: every key moved so far is already gone from here, so a rerun only moves the rest.
+func (m *Migrator) run(j *job, keys []string) {
+	client := network.NewTCPClient(j.target, m.options...)
+	defer func() { _ = client.Close() }()
+
+	var err error
+	for _, key := range keys {
+		err = m.store.Transfer(m.ctx, j.table, key, sender(client, j.table, key))
+		if errors.Is(err, storage.ErrNotFound) {
+			m.update(j, func() { j.skipped++ })
+			continue
+		}
+		if err != nil {
+			break
+		}
+		m.update(j, func() { j.moved++ })
+	}
+
+	var moved, skipped int
+	m.update(j, func() {
+		switch {
+		case err == nil:
+			j.state = StateDone
+		case m.ctx.Err() != nil:
+			j.state = StateCancelled
+		default:
+			j.state, j.err = StateFailed, err
+		}
+		moved, skipped = j.moved, j.skipped
+	})
+	if err != nil {
+		m.logger.Error("Table migration stopped", "table", j.table, "target", j.target, "moved", moved, "error", err)
+		return
+	}
+	m.logger.Info("Table migrated", "table", j.table, "target", j.target, "moved", moved, "skipped", skipped)
+}
+
+func (m *Migrator) update(j *job, fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn()
+}
+
+// Status lists every table migration started since the server came up, as a flat key/value array with one group of
+// fields per table: table, target, state, moved, skipped, total and, for a failed job, error.
+func (m *Migrator) Status(_ context.Context) (protocol.Reply, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var values []string
+	for _, table := range slices.Sorted(maps.Keys(m.jobs)) {
+		j := m.jobs[table]
+		values = append(values,
+			"table", j.table,
+			"target", j.target,
+			"state", j.state,
+			"moved", strconv.Itoa(j.moved),
+			"skipped", strconv.Itoa(j.skipped),
+			"total", strconv.Itoa(j.total),
+		)
+		if j.err != nil {
+			values = append(values, "error", j.err.Error())
+		}
+	}
+	return protocol.BulkStringArray(values), nil
+}
+
+// Close cancels the running jobs and waits for them to stop. A key in flight is never lost: at worst it is left both
+// here and on the target.
+func (m *Migrator) Close() error {
+	m.cancel()
+	m.wg.Wait()
+	return nil
+}
+
+// check refuses a target that is this server itself
+func (m *Migrator) check(target string) error {
+	if m.local != "" && sameServer(target, m.local) {
+		return fmt.Errorf("cannot migrate to %s: it is this server", target)
+	}
+	return nil
+}
+
+// sender copies a value to the target with SET. Only an OK reply counts as acknowledged: an error reply, or a command
+// whose outcome is unknown, leaves the key on this server.
+func sender(client *network.TCPClient, table, key string) func(context.Context, protocol.Value) error {
+	return func(ctx context.Context, value protocol.Value) error {
+		reply, err := client.Send(ctx, "SET", []string{table, key, protocol.Literal(value)})
+		if err != nil {
+			return fmt.Errorf("target: %w", err)
+		}
+		if reply.Kind == protocol.ReplyError {
+			return fmt.Errorf("target refused %s/%s: %s", table, key, reply.Value)
+		}
+		return nil
+	}
+}
+
+// sameServer reports whether target names the local listen address. It catches the likely mistakes (the same text, or
+// a loopback name for a server listening on a wildcard or loopback address) without resolving names over the network.
+func sameServer(target, local string) bool {
+	if target == local {
+		return true
+	}
+	targetHost, targetPort, err := net.SplitHostPort(target)
+	if err != nil {
+		return false
+	}
+	localHost, localPort, err := net.SplitHostPort(local)
+	if err != nil || targetPort != localPort {
+		return false
+	}
+	return isLocalHost(localHost, true) && isLocalHost(targetHost, false)
+}
+
+// isLocalHost reports whether host is loopback, or, when wildcard is set, the any-address a server listens on
+func isLocalHost(host string, wildcard bool) bool {
+	if host == "localhost" || (wildcard && host == "") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || (wildcard && ip.IsUnspecified()))
+}
@@ -0,0 +1,203 @@
+package migration_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfStack/db/internal/compute"
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/migration"
+	"github.com/OutOfStack/db/internal/network"
+	"github.com/OutOfStack/db/internal/parser"
+	"github.com/OutOfStack/db/internal/protocol"
+	"github.com/OutOfStack/db/internal/storage"
+)
+
+// startServer serves store on a free localhost port and returns its address
+func startServer(t *testing.T, store *storage.Storage) string {
+	t.Helper()
+	logger := slog.New(slog.DiscardHandler)
+	srv, err := network.NewTCPServer("127.0.0.1:0", logger)
+	if err != nil {
+		t.Fatalf("NewTCPServer: %v", err)
+	}
+	comp := compute.New(parser.New(), store, logger)
+	go func() {
+		_ = srv.Serve(func(ctx context.Context, cmd string, args []string) protocol.Reply {
+			res, rErr := comp.HandleRequest(ctx, cmd, args)
+			if rErr != nil {
+				if errors.Is(rErr, storage.ErrNotFound) {
+					return protocol.NullBulkString()
+				}
+				return protocol.Error(rErr.Error())
+			}
+			return res
+		})
+	}()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	})
+	return srv.Addr().String()
+}
+
+func newMigrator(t *testing.T, store *storage.Storage, options ...migration.Option) *migration.Migrator {
+	t.Helper()
+	m := migration.New(store, slog.New(slog.DiscardHandler), options...)
+	t.Cleanup(func() { _ = m.Close() })
+	return m
+}
+
+func execute(t *testing.T, store *storage.Storage, cmd string, args ...string) protocol.Reply {
+	t.Helper()
+	reply, err := store.Execute(t.Context(), cmd, args)
+	if err != nil {
+		t.Fatalf("%s %v: %v", cmd, args, err)
+	}
+	return reply
+}
+
+func TestMigrator_MigrateKey(t *testing.T) {
+	t.Parallel()
+	source := storage.New(engine.New())
+	target := storage.New(engine.New())
+	m := newMigrator(t, source)
+	addr := startServer(t, target)
+
+	// a string that spells an int has to arrive as a string
+	execute(t, source, "SET", "users", "u1", `"42"`)
+	reply, err := m.MigrateKey(t.Context(), addr, "users", "u1")
+	if err != nil {
+		t.Fatalf("MigrateKey: %v", err)
+	}
+	if reply.Value != "OK" {
+		t.Fatalf("MigrateKey reply = %q, want OK", reply.Value)
+	}
+
+	if kind := execute(t, target, "TYPE", "users", "u1").Value; kind != "string" {
+		t.Errorf("target TYPE = %q, want string", kind)
+	}
+	if value := execute(t, target, "GET", "users", "u1").Value; value != "42" {
+		t.Errorf("target GET = %q, want 42", value)
+	}
+	if _, err = source.Execute(t.Context(), "GET", []string{"users", "u1"}); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("source GET after migrate: err = %v, want ErrNotFound", err)
+	}
+
+	if _, err = m.MigrateKey(t.Context(), addr, "users", "u1"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("MigrateKey of a missing key: err = %v, want ErrNotFound", err)
+	}
+}
+
+// TestMigrator_KeepsKeyWhenTargetRefuses verifies nothing is deleted locally unless the target acknowledged the copy
+func TestMigrator_KeepsKeyWhenTargetRefuses(t *testing.T) {
+	t.Parallel()
+	source := storage.New(engine.New())
+	m := newMigrator(t, source)
+	readOnly := startServer(t, storage.New(engine.New(), storage.WithReadOnly(true)))
+
+	execute(t, source, "SET", "users", "u1", "alice")
+	if _, err := m.MigrateKey(t.Context(), readOnly, "users", "u1"); err == nil || !strings.Contains(err.Error(), "readonly") {
+		t.Fatalf("MigrateKey to a read-only target: err = %v, want readonly refusal", err)
+	}
+
+	// an unreachable target fails the same way
+	lc := net.ListenConfig{}
+	listener, err := lc.Listen(t.Context(), "tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("reserve address: %v", err)
+	}
+	closed := listener.Addr().String()
+	_ = listener.Close()
+	if _, err = m.MigrateKey(t.Context(), closed, "users", "u1"); err == nil {
+		t.Fatal("MigrateKey to an unreachable target succeeded")
+	}
+
+	if value := execute(t, source, "GET", "users", "u1").Value; value != "alice" {
+		t.Errorf("source GET = %q, want alice", value)
+	}
+}
+
+func TestMigrator_MigrateTable(t *testing.T) {
+	t.Parallel()
+	source := storage.New(engine.New())
+	target := storage.New(engine.New())
+	m := newMigrator(t, source)
+	addr := startServer(t, target)
+
+	const keys = 50
+	for i := range keys {
+		execute(t, source, "SET", "users", "u"+strconv.Itoa(i), strconv.Itoa(i))
+	}
+	execute(t, source, "SET", "other", "k", "stays")
+
+	if _, err := m.MigrateTable(t.Context(), addr, "users"); err != nil {
+		t.Fatalf("MigrateTable: %v", err)
+	}
+
+	var status map[string]string
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status = statusFields(t, m)
+		if status["state"] != migration.StateRunning || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	want := map[string]string{
+		"table": "users", "target": addr, "state": migration.StateDone,
+		"moved": strconv.Itoa(keys), "skipped": "0", "total": strconv.Itoa(keys),
+	}
+	for field, value := range want {
+		if status[field] != value {
+			t.Errorf("status %s = %q, want %q", field, status[field], value)
+		}
+	}
+
+	if got := len(execute(t, target, "KEYS", "users").Array); got != keys {
+		t.Errorf("target holds %d keys, want %d", got, keys)
+	}
+	if got := len(execute(t, source, "KEYS", "users").Array); got != 0 {
+		t.Errorf("source still holds %d keys", got)
+	}
+	if value := execute(t, source, "GET", "other", "k").Value; value != "stays" {
+		t.Errorf("other table GET = %q, want stays", value)
+	}
+}
+
+func TestMigrator_RefusesItself(t *testing.T) {
+	t.Parallel()
+	source := storage.New(engine.New())
+	m := newMigrator(t, source, migration.WithLocalAddress(":3223"))
+	execute(t, source, "SET", "users", "u1", "alice")
+
+	for _, target := range []string{":3223", "localhost:3223", "127.0.0.1:3223"} {
+		if _, err := m.MigrateKey(t.Context(), target, "users", "u1"); err == nil {
+			t.Errorf("MigrateKey to %s succeeded, want refusal", target)
+		}
+		if _, err := m.MigrateTable(t.Context(), target, "users"); err == nil {
+			t.Errorf("MigrateTable to %s succeeded, want refusal", target)
+		}
+	}
+}
+
+// statusFields reads the single job MIGRATION STATUS reports
+func statusFields(t *testing.T, m *migration.Migrator) map[string]string {
+	t.Helper()
+	reply, err := m.Status(t.Context())
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	fields := make(map[string]string, len(reply.Array)/2)
+	for i := 0; i+1 < len(reply.Array); i += 2 {
+		fields[reply.Array[i].Value] = reply.Array[i+1].Value
+	}
+	return fields
+}
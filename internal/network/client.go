@@ -49,6 +49,7 @@ type TCPClient struct {
 	dialCancel context.CancelFunc
 
 	address        string
+	name           string
 	idleTimeout    time.Duration
 	maxMessageSize int
 }
@@ -210,6 +211,13 @@ func (tc *TCPClient) dial(ctx context.Context) (net.Conn, *bufio.Reader, error)
 
 	var dialer net.Dialer
 	conn, err := dialer.DialContext(dialCtx, "tcp", tc.address)
+	var reader *bufio.Reader
+	if err == nil {
+		reader = bufio.NewReader(conn)
+		if err = tc.handshake(dialCtx, conn, reader); err != nil {
+			_ = conn.Close()
+		}
+	}
 
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
@@ -227,10 +235,36 @@ func (tc *TCPClient) dial(ctx context.Context) (net.Conn, *bufio.Reader, error)
 		return nil, nil, net.ErrClosed
 	}
 
-	tc.conn, tc.reader = conn, bufio.NewReader(conn)
+	tc.conn, tc.reader = conn, reader
 	return tc.conn, tc.reader, nil
 }
 
+// handshake names a new connection with CLIENT SETNAME when the client has a name. It runs before the connection
+// carries any command, so a failure here leaves the command unsent, like a failed dial.
+func (tc *TCPClient) handshake(ctx context.Context, conn net.Conn, reader *bufio.Reader) error {
+	if tc.name == "" {
+		return nil
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return fmt.Errorf("failed to set deadline: %w", err)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if err := protocol.WriteCommand(conn, "CLIENT", []string{"SETNAME", tc.name}); err != nil {
+		return fmt.Errorf("failed to set client name: %w", err)
+	}
+	resp, err := protocol.ReadReply(reader, tc.maxMessageSize)
+	if err != nil {
+		return fmt.Errorf("failed to set client name: %w", err)
+	}
+	if resp.Kind == protocol.ReplyError {
+		return fmt.Errorf("failed to set client name: %s", resp.Value)
+	}
+	return nil
+}
+
 // frameWriter forwards the command frame to the socket and records whether the socket ever refused part of a write.
 // Retry safety rests on a failed write having left the frame incomplete, and io.Writer permits a writer to return
 // len(p) alongside an error — net.Conn does not do that today, but the guarantee belongs in this package rather than in
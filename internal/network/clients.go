@@ -0,0 +1,217 @@
+package network
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OutOfStack/db/internal/parser"
+)
+
+// maxClientNameLen is the longest name CLIENT SETNAME takes, the same as for a table. The name goes into every WAL record
+// the connection writes, as part of its origin, so it is kept short.
+const maxClientNameLen = 128
+
+// ErrNoSuchClient is returned by SetClientName for a context that did not come from one of the server's connections.
+var ErrNoSuchClient = errors.New("no such client")
+
+type clientIDKey struct{}
+
+type clientNameKey struct{}
+
+// ClientName returns the name the client a request came from had set with CLIENT SETNAME when it sent the request, or
+// "" when it had none or ctx did not come from the server.
+func ClientName(ctx context.Context) string {
+	name, _ := ctx.Value(clientNameKey{}).(string)
+	return name
+}
+
+// clientConn is the server's record of one client connection. Reads and writes go through it, so it counts their
+// bytes. The fields after the counters are guarded by the server's mu.
+type clientConn struct {
+	net.Conn
+	id        uint64
+	addr      string
+	connected time.Time
+	bytesIn   atomic.Uint64
+	bytesOut  atomic.Uint64
+
+	active     bool
+	name       string
+	command    string
+	lastActive time.Time
+}
+
+func (c *clientConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.bytesIn.Add(uint64(n)) //nolint:gosec // n is never negative
+	return n, err
+}
+
+func (c *clientConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.bytesOut.Add(uint64(n)) //nolint:gosec // n is never negative
+	return n, err
+}
+
+// ClientInfo describes one client connection for CLIENT LIST.
+type ClientInfo struct {
+	ID   uint64
+	Addr string
+	// Name is what the client set with CLIENT SETNAME, empty until it does
+	Name string
+	// Age is how long the connection has been open; Idle is how long since it last started or finished a command
+	Age  time.Duration
+	Idle time.Duration
+	// Command is the command it is running, or the last one it ran
+	Command  string
+	BytesIn  uint64
+	BytesOut uint64
+}
+
+// Clients lists the open client connections in the order they connected.
+func (s *TCPServer) Clients() []ClientInfo {
+	now := time.Now()
+	s.mu.Lock()
+	clients := make([]ClientInfo, 0, len(s.connections))
+	for _, client := range s.connections {
+		clients = append(clients, ClientInfo{
+			ID:       client.id,
+			Addr:     client.addr,
+			Name:     client.name,
+			Age:      now.Sub(client.connected),
+			Idle:     now.Sub(client.lastActive),
+			Command:  client.command,
+			BytesIn:  client.bytesIn.Load(),
+			BytesOut: client.bytesOut.Load(),
+		})
+	}
+	s.mu.Unlock()
+	slices.SortFunc(clients, func(a, b ClientInfo) int { return cmp.Compare(a.ID, b.ID) })
+	return clients
+}
+
+// SetClientName names the connection a request came from, so CLIENT LIST can tell it apart; an empty name clears it.
+// A name is printable ASCII without spaces, which keeps each CLIENT LIST line one field per word, and at most
+// maxClientNameLen bytes long.
+func (s *TCPServer) SetClientName(ctx context.Context, name string) error {
+	if len(name) > maxClientNameLen {
+		return fmt.Errorf("client name too long (max %d characters)", maxClientNameLen)
+	}
+	if strings.ContainsFunc(name, func(r rune) bool { return r <= ' ' || r > '~' }) {
+		return errors.New("client names cannot contain spaces, newlines or special characters")
+	}
+	id, _ := ctx.Value(clientIDKey{}).(uint64)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, ok := s.connections[id]
+	if !ok {
+		return ErrNoSuchClient
+	}
+	client.name = name
+	return nil
+}
+
+// KillClient closes the connection with the given ID and reports whether there was one. A command it is running still
+// completes, but its reply is lost.
+func (s *TCPServer) KillClient(id uint64) bool {
+	s.mu.Lock()
+	client, ok := s.connections[id]
+	s.mu.Unlock()
+	if ok {
+		s.logger.Info("Killing client", "address", client.addr, "id", id)
+		_ = client.Close()
+	}
+	return ok
+}
+
+// KillClientAddr closes the connection from addr, as CLIENT LIST shows it, and reports whether there was one.
+func (s *TCPServer) KillClientAddr(addr string) bool {
+	s.mu.Lock()
+	var id uint64
+	for _, client := range s.connections {
+		if client.addr == addr {
+			id = client.id
+			break
+		}
+	}
+	s.mu.Unlock()
+	return id != 0 && s.KillClient(id)
+}
+
+// PauseClients holds client commands for duration: every command, or with writesOnly only those that write data (see
+// parser.IsWrite). Commands aimed at the node itself, such as INFO and CLIENT, are never held, so the server can still
+// be inspected and the pause lifted early. A new pause replaces the one in force.
+func (s *TCPServer) PauseClients(duration time.Duration, writesOnly bool) {
+	s.logger.Info("Pausing clients", "duration", duration, "writes_only", writesOnly)
+	s.pause.set(time.Now().Add(duration), writesOnly)
+}
+
+// UnpauseClients lifts a pause early, releasing the commands it holds.
+func (s *TCPServer) UnpauseClients() {
+	s.pause.set(time.Time{}, false)
+}
+
+// clientPause holds commands during CLIENT PAUSE.
+type clientPause struct {
+	// until is the end of the pause in Unix nanoseconds, 0 when there is none. Every command reads it without the lock.
+	until atomic.Int64
+
+	mu         sync.Mutex
+	writesOnly bool
+	// changed is closed when the pause is replaced or lifted, so the commands it holds check it again
+	changed chan struct{}
+}
+
+func (p *clientPause) set(until time.Time, writesOnly bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.writesOnly = writesOnly
+	if until.IsZero() {
+		p.until.Store(0)
+	} else {
+		p.until.Store(until.UnixNano())
+	}
+	if p.changed != nil {
+		close(p.changed)
+		p.changed = nil
+	}
+}
+
+// wait holds cmd until the pause in force, if any, is over or no longer covers it. It returns ctx's error if ctx ends
+// first.
+func (p *clientPause) wait(ctx context.Context, cmd string) error {
+	if time.Now().UnixNano() >= p.until.Load() || parser.IsAdmin(cmd) {
+		return nil
+	}
+	for {
+		p.mu.Lock()
+		remaining := time.Until(time.Unix(0, p.until.Load()))
+		if remaining <= 0 || (p.writesOnly && !parser.IsWrite(cmd)) {
+			p.mu.Unlock()
+			return nil
+		}
+		if p.changed == nil {
+			p.changed = make(chan struct{})
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-timer.C:
+		case <-changed:
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package network
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// monitorCommand turns the connection that sends it into a stream of every command the server receives.
+	monitorCommand = "MONITOR"
+	// monitorBacklog is how many lines a monitor may fall behind before it is dropped: the server never waits for a
+	// monitor, so a slow one loses its connection rather than slowing every client down.
+	monitorBacklog = 1024
+	// monitorMaxArgLen is how much of each argument a monitor sees. The rest is left out, so a monitor shows what is
+	// being written without streaming the values in full.
+	monitorMaxArgLen = 64
+)
+
+// monitor is one connection in MONITOR mode. lines is closed when the monitor is removed; dropped is set first when it
+// is removed for falling behind.
+type monitor struct {
+	lines   chan string
+	dropped atomic.Bool
+}
+
+// monitors fans the commands the server receives out to the connections in MONITOR mode.
+type monitors struct {
+	// count lets publish skip formatting when nobody is watching, which is nearly always
+	count atomic.Int32
+
+	mu  sync.Mutex
+	set map[*monitor]struct{}
+}
+
+func (m *monitors) add() *monitor {
+	watcher := &monitor{lines: make(chan string, monitorBacklog)}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.set == nil {
+		m.set = make(map[*monitor]struct{})
+	}
+	m.set[watcher] = struct{}{}
+	m.count.Add(1)
+	return watcher
+}
+
+// remove stops sending to watcher and closes its lines. It reports false when watcher was already removed.
+func (m *monitors) remove(watcher *monitor) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.removeLocked(watcher)
+}
+
+func (m *monitors) removeLocked(watcher *monitor) bool {
+	if _, ok := m.set[watcher]; !ok {
+		return false
+	}
+	delete(m.set, watcher)
+	m.count.Add(-1)
+	close(watcher.lines)
+	return true
+}
+
+// publish sends a command received from addr to every monitor, dropping those whose backlog is full.
+func (m *monitors) publish(addr, cmd string, args []string) {
+	if m.count.Load() == 0 {
+		return
+	}
+	line := monitorLine(time.Now(), addr, cmd, args)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for watcher := range m.set {
+		select {
+		case watcher.lines <- line:
+		default:
+			watcher.dropped.Store(true)
+			m.removeLocked(watcher)
+		}
+	}
+}
+
+// monitorLine formats a command as Redis' MONITOR does: the Unix time with microseconds, the client's address in
+// brackets, then the command and its arguments quoted. Arguments longer than monitorMaxArgLen are cut short with a note
+// of how many bytes were left out.
+func monitorLine(at time.Time, addr, cmd string, args []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d.%06d [%s] %s", at.Unix(), at.Nanosecond()/int(time.Microsecond), addr, strconv.Quote(cmd))
+	for _, arg := range args {
+		b.WriteByte(' ')
+		if len(arg) <= monitorMaxArgLen {
+			b.WriteString(strconv.Quote(arg))
+			continue
+		}
+		fmt.Fprintf(&b, "%s...(%d more bytes)", strconv.Quote(arg[:monitorMaxArgLen]), len(arg)-monitorMaxArgLen)
+	}
+	return b.String()
+}
@@ -21,13 +21,21 @@ func WithClientMaxMessageSize(size int) TCPClientOption {
 	}
 }
 
+// WithClientName names every connection a TCPClient opens with CLIENT SETNAME, so the server's CLIENT LIST shows which
+// program it belongs to. An empty name sends nothing.
+func WithClientName(name string) TCPClientOption {
+	return func(c *TCPClient) {
+		c.name = name
+	}
+}
+
 // TCPServerOption represents a functional option for configuring a TCPServer.
 type TCPServerOption func(*TCPServer)
 
 // WithServerIdleTimeout sets the idle timeout for a TCPServer.
 func WithServerIdleTimeout(d time.Duration) TCPServerOption {
 	return func(s *TCPServer) {
-		s.idleTimeout = d
+		s.SetIdleTimeout(d)
 	}
 }
 
@@ -43,8 +51,6 @@ func WithServerMaxMessageSize(size int) TCPServerOption {
 // WithServerMaxConnections sets the maximum number of concurrent connections for a TCPServer.
 func WithServerMaxConnections(maxConnections int) TCPServerOption {
 	return func(s *TCPServer) {
-		if maxConnections > 0 {
-			s.connectionSemaphore = make(chan struct{}, maxConnections)
-		}
+		s.SetMaxConnections(maxConnections)
 	}
 }
@@ -8,9 +8,13 @@ import (
 	"io"
 	"log/slog"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/OutOfStack/db/internal/info"
+	"github.com/OutOfStack/db/internal/metrics"
 	"github.com/OutOfStack/db/internal/protocol"
 )
 
@@ -18,6 +22,8 @@ const (
 	// defaultMaxMessageSize mirrors the 4KB config default (max_message_size)
 	defaultMaxMessageSize = 4096
 	defaultTimeout        = 1 * time.Minute
+	// defaultMaxConnections mirrors the config default (max_connections)
+	defaultMaxConnections = 100
 
 	// errorDrainTimeout bounds draining of unread request bytes before closing a connection after a protocol error, so the
 	// error reply is not lost to a TCP reset caused by closing with pending input
@@ -27,19 +33,41 @@ const (
 // RequestHandler is a function that handles a decoded client command.
 type RequestHandler func(context.Context, string, []string) protocol.Reply
 
+type clientAddrKey struct{}
+
+// WithClientAddr returns a context carrying the address of the client a request came from. The server adds it to the
+// context of every request it hands to the RequestHandler.
+func WithClientAddr(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, clientAddrKey{}, addr)
+}
+
+// ClientAddr returns the address of the client a request came from, or "" when ctx did not come from the server.
+func ClientAddr(ctx context.Context) string {
+	addr, _ := ctx.Value(clientAddrKey{}).(string)
+	return addr
+}
+
 // TCPServer represents a TCP server that handles multiple client connections
 type TCPServer struct {
-	logger              *slog.Logger
-	listener            net.Listener
-	wg                  sync.WaitGroup
-	connectionSemaphore chan struct{}
-	mu                  sync.Mutex
-	connections         map[net.Conn]bool
-	draining            bool
-	cancelHandlers      context.CancelFunc
-	serveDone           chan struct{}
-
-	idleTimeout    time.Duration
+	logger         *slog.Logger
+	listener       net.Listener
+	wg             sync.WaitGroup
+	mu             sync.Mutex
+	connections    map[uint64]*clientConn
+	lastClientID   uint64
+	draining       bool
+	cancelHandlers context.CancelFunc
+	serveDone      chan struct{}
+	accepted       atomic.Uint64
+	rejected       atomic.Uint64
+	monitors       monitors
+	pause          clientPause
+
+	// open counts the connections holding a slot under maxConnections. The limit and idleTimeout (in nanoseconds) can
+	// change while the server runs, so they are read without the lock.
+	open           atomic.Int64
+	maxConnections atomic.Int64
+	idleTimeout    atomic.Int64
 	maxMessageSize int
 }
 
@@ -57,14 +85,14 @@ func NewTCPServer(address string, logger *slog.Logger, options ...TCPServerOptio
 	}
 
 	server := &TCPServer{
-		listener:            listener,
-		logger:              logger,
-		connectionSemaphore: make(chan struct{}, 100),
-		connections:         make(map[net.Conn]bool),
-		serveDone:           make(chan struct{}),
-		maxMessageSize:      defaultMaxMessageSize,
-		idleTimeout:         defaultTimeout,
+		listener:       listener,
+		logger:         logger,
+		connections:    make(map[uint64]*clientConn),
+		serveDone:      make(chan struct{}),
+		maxMessageSize: defaultMaxMessageSize,
 	}
+	server.maxConnections.Store(defaultMaxConnections)
+	server.idleTimeout.Store(int64(defaultTimeout))
 
 	for _, option := range options {
 		option(server)
@@ -100,20 +128,51 @@ func (s *TCPServer) Serve(handler RequestHandler) error {
 			continue
 		}
 
-		select {
-		case s.connectionSemaphore <- struct{}{}:
-			if !s.trackConnection(conn) {
-				<-s.connectionSemaphore
-				_ = conn.Close()
-				continue
-			}
-			go s.handleConnection(handlerCtx, conn, handler)
-		default:
+		s.accepted.Add(1)
+		if !s.acquireSlot() {
+			s.rejected.Add(1)
 			s.logger.Warn("Connection limit reached, rejecting new connection", "client", conn.RemoteAddr())
 			if err = conn.Close(); err != nil {
 				s.logger.Error("Failed to close rejected connection", "error", err)
 			}
+			continue
 		}
+		client, tracked := s.trackConnection(conn)
+		if !tracked {
+			s.open.Add(-1)
+			_ = conn.Close()
+			continue
+		}
+		go s.handleConnection(handlerCtx, client, handler)
+	}
+}
+
+// acquireSlot takes a connection slot if fewer than maxConnections are open.
+func (s *TCPServer) acquireSlot() bool {
+	for {
+		open := s.open.Load()
+		if open >= s.maxConnections.Load() {
+			return false
+		}
+		if s.open.CompareAndSwap(open, open+1) {
+			return true
+		}
+	}
+}
+
+// SetMaxConnections changes the connection limit. Lowering it below the connections open now closes none of them; new
+// ones are rejected until enough have gone. A limit below 1 is ignored.
+func (s *TCPServer) SetMaxConnections(maxConnections int) {
+	if maxConnections > 0 {
+		s.maxConnections.Store(int64(maxConnections))
+	}
+}
+
+// SetIdleTimeout changes how long a connection may stay silent, and a reply take to write, before the server closes it.
+// A connection already waiting for its next command keeps the deadline it had. A timeout below 1ns is ignored.
+func (s *TCPServer) SetIdleTimeout(d time.Duration) {
+	if d > 0 {
+		s.idleTimeout.Store(int64(d))
 	}
 }
 
@@ -124,9 +183,9 @@ func (s *TCPServer) Shutdown(ctx context.Context) error {
 	s.mu.Lock()
 	s.draining = true
 	idle := make([]net.Conn, 0, len(s.connections))
-	for conn, active := range s.connections {
-		if !active {
-			idle = append(idle, conn)
+	for _, client := range s.connections {
+		if !client.active {
+			idle = append(idle, client)
 		}
 	}
 	s.mu.Unlock()
@@ -156,8 +215,8 @@ func (s *TCPServer) Shutdown(ctx context.Context) error {
 		s.cancelActiveHandlers()
 		s.mu.Lock()
 		active := make([]net.Conn, 0, len(s.connections))
-		for conn := range s.connections {
-			active = append(active, conn)
+		for _, client := range s.connections {
+			active = append(active, client)
 		}
 		s.mu.Unlock()
 		for _, conn := range active {
@@ -170,6 +229,43 @@ func (s *TCPServer) Shutdown(ctx context.Context) error {
 	}
 }
 
+// Info reports the clients section of INFO: the connections open now and how many of them are running a command, the
+// connection limit, and the connections accepted and rejected at the limit since the server started.
+func (s *TCPServer) Info(_ context.Context) info.Section {
+	connected, active := s.connectionCounts()
+	section := info.Section{Name: "clients"}
+	section.Add("connected_clients", connected)
+	section.Add("active_clients", active)
+	section.Add("max_clients", s.maxConnections.Load())
+	section.Add("total_connections_received", s.accepted.Load())
+	section.Add("rejected_connections", s.rejected.Load())
+	return section
+}
+
+// Collect reports the same figures as Info as metrics.
+func (s *TCPServer) Collect(enc *metrics.Encoder) {
+	connected, active := s.connectionCounts()
+	enc.Gauge("db_connections", "Client connections open.", float64(connected))
+	enc.Gauge("db_connections_active", "Client connections running a command.", float64(active))
+	enc.Gauge("db_connections_max", "Client connection limit.", float64(s.maxConnections.Load()))
+	enc.Counter("db_connections_received_total", "Client connections accepted, including those rejected at the limit.",
+		float64(s.accepted.Load()))
+	enc.Counter("db_connections_rejected_total", "Client connections rejected at the limit.", float64(s.rejected.Load()))
+}
+
+// connectionCounts returns how many connections are open and how many of them are running a command.
+func (s *TCPServer) connectionCounts() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active := 0
+	for _, client := range s.connections {
+		if client.active {
+			active++
+		}
+	}
+	return len(s.connections), active
+}
+
 func (s *TCPServer) cancelActiveHandlers() {
 	s.mu.Lock()
 	cancel := s.cancelHandlers
@@ -179,55 +275,65 @@ func (s *TCPServer) cancelActiveHandlers() {
 	}
 }
 
-func (s *TCPServer) trackConnection(conn net.Conn) bool {
+func (s *TCPServer) trackConnection(conn net.Conn) (*clientConn, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.draining {
-		return false
+		return nil, false
 	}
-	s.connections[conn] = false
+	s.lastClientID++
+	now := time.Now()
+	client := &clientConn{Conn: conn, id: s.lastClientID, addr: conn.RemoteAddr().String(), connected: now, lastActive: now}
+	s.connections[client.id] = client
 	s.wg.Add(1)
-	return true
+	return client, true
 }
 
-func (s *TCPServer) beginCommand(conn net.Conn) bool {
+// beginCommand marks client as running cmd and returns the client's name, or false when cmd must not be dispatched.
+func (s *TCPServer) beginCommand(client *clientConn, cmd string) (string, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.draining {
 		// Shutdown won the race after this command was decoded, so it is not dispatched. The closed connection can make
 		// the client report ErrOutcomeUnknown even though the command did not execute.
-		return false
+		return "", false
 	}
-	s.connections[conn] = true
-	return true
+	client.active = true
+	client.command = strings.ToUpper(cmd)
+	client.lastActive = time.Now()
+	return client.name, true
 }
 
-func (s *TCPServer) finishCommand(conn net.Conn) bool {
+func (s *TCPServer) finishCommand(client *clientConn) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.connections[conn] = false
+	client.active = false
+	client.lastActive = time.Now()
 	return s.draining
 }
 
-func (s *TCPServer) handleConnection(handlerCtx context.Context, conn net.Conn, handler RequestHandler) {
+func (s *TCPServer) handleConnection(handlerCtx context.Context, client *clientConn, handler RequestHandler) {
 	defer func() {
-		if err := conn.Close(); err != nil {
+		// CLIENT KILL may have closed it already
+		if err := client.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 			s.logger.Error("Failed to close connection", "error", err)
 		}
 		// release connection slot
-		<-s.connectionSemaphore
+		s.open.Add(-1)
 		s.mu.Lock()
-		delete(s.connections, conn)
+		delete(s.connections, client.id)
 		s.mu.Unlock()
 		s.wg.Done()
 	}()
 
-	s.logger.Info("Client connected", "address", conn.RemoteAddr())
+	s.logger.Info("Client connected", "address", client.addr, "id", client.id)
 
-	reader := bufio.NewReader(conn)
+	requestCtx := context.WithValue(WithClientAddr(handlerCtx, client.addr), clientIDKey{}, client.id)
+	// reads and writes go through client, which counts their bytes for CLIENT LIST
+	reader := bufio.NewReader(client)
 
 	for {
-		cmd, args, ok := s.readCommand(conn, reader)
+		cmd, args, ok := s.readCommand(client, reader)
 		if !ok {
 			return
 		}
@@ -235,23 +341,74 @@ func (s *TCPServer) handleConnection(handlerCtx context.Context, conn net.Conn,
 		// Process the request. Dispatch happens only after ReadCommand has decoded the frame whole, so a truncated request
 		// returns above without ever reaching the handler. Clients rely on that to tell a failed send apart from a lost
 		// reply: a command they could not finish writing provably did not run.
-		if !s.beginCommand(conn) {
+		name, ok := s.beginCommand(client, cmd)
+		if !ok {
 			return
 		}
-		response := handler(handlerCtx, cmd, args)
-		if err := s.writeReply(conn, response); err != nil {
+		if strings.EqualFold(cmd, monitorCommand) && len(args) == 0 {
+			s.serveMonitor(client, reader)
+			return
+		}
+		s.monitors.publish(client.addr, cmd, args)
+		if err := s.pause.wait(handlerCtx, cmd); err != nil {
+			// Shutdown's grace period ran out while the command was held, so it never ran
+			return
+		}
+		ctx := requestCtx
+		if name != "" {
+			ctx = context.WithValue(requestCtx, clientNameKey{}, name)
+		}
+		response := handler(ctx, cmd, args)
+		if err := s.writeReply(client, response); err != nil {
 			s.logger.Error("Failed to send response", "error", err)
 			return
 		}
 
-		if s.finishCommand(conn) {
+		if s.finishCommand(client) {
 			return
 		}
 	}
 }
 
+// serveMonitor turns conn into a MONITOR stream: it replies OK, then writes every command the server receives until the
+// client disconnects, Shutdown closes the connection, or the monitor falls monitorBacklog lines behind and is dropped.
+// The connection counts as idle while it streams, so Shutdown closes it rather than waiting for it.
+func (s *TCPServer) serveMonitor(conn *clientConn, reader *bufio.Reader) {
+	watcher := s.monitors.add()
+	defer s.monitors.remove(watcher)
+	if err := s.writeReply(conn, protocol.SimpleString("OK")); err != nil {
+		s.logger.Error("Failed to send response", "error", err)
+		return
+	}
+	if s.finishCommand(conn) {
+		return
+	}
+	s.logger.Info("Client started monitoring", "address", conn.RemoteAddr())
+
+	// a monitor sends nothing more; the read returns once it disconnects or the connection is closed
+	go func() {
+		if err := conn.SetReadDeadline(time.Time{}); err == nil {
+			_, _ = io.Copy(io.Discard, reader)
+		}
+		s.monitors.remove(watcher)
+	}()
+	for line := range watcher.lines {
+		// a dropped monitor's backlog is not worth sending: it is closed once the write in flight returns
+		if watcher.dropped.Load() {
+			break
+		}
+		if err := s.writeReply(conn, protocol.SimpleString(line)); err != nil {
+			s.logger.Info("Monitor disconnected", "address", conn.RemoteAddr(), "error", err)
+			return
+		}
+	}
+	if watcher.dropped.Load() {
+		s.logger.Warn("Dropped a monitor that fell behind", "address", conn.RemoteAddr(), "backlog", monitorBacklog)
+	}
+}
+
 func (s *TCPServer) readCommand(conn net.Conn, reader *bufio.Reader) (string, []string, bool) {
-	if err := conn.SetReadDeadline(time.Now().Add(s.idleTimeout)); err != nil {
+	if err := conn.SetReadDeadline(time.Now().Add(time.Duration(s.idleTimeout.Load()))); err != nil {
 		s.logger.Error("Failed to set read deadline", "error", err)
 		return "", nil, false
 	}
@@ -286,7 +443,7 @@ func (s *TCPServer) isDraining() bool {
 }
 
 func (s *TCPServer) writeReply(conn net.Conn, reply protocol.Reply) error {
-	if err := conn.SetWriteDeadline(time.Now().Add(s.idleTimeout)); err != nil {
+	if err := conn.SetWriteDeadline(time.Now().Add(time.Duration(s.idleTimeout.Load()))); err != nil {
 		return fmt.Errorf("failed to set write deadline: %w", err)
 	}
 	if err := protocol.WriteReply(conn, reply); err != nil {
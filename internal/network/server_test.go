@@ -4,9 +4,12 @@ import (
 	"bufio"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -123,3 +126,257 @@ func TestShutdownTimeoutCancelsStalledHandlerWithoutCloseError(t *testing.T) {
 	_, err = protocol.ReadReply(bufio.NewReader(conn), 1024)
 	require.True(t, errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed), "ReadReply() error = %v", err)
 }
+
+// TestInfoCountsConnections verifies the clients section counts open connections and those refused at the limit, and
+// follows the limit when it changes.
+func TestInfoCountsConnections(t *testing.T) {
+	t.Parallel()
+	srv, err := network.NewTCPServer("127.0.0.1:0", slog.New(slog.DiscardHandler), network.WithServerMaxConnections(1))
+	require.NoError(t, err)
+	serveDone := make(chan error, 1)
+	go func() {
+		serveDone <- srv.Serve(func(context.Context, string, []string) protocol.Reply { return protocol.SimpleString("OK") })
+	}()
+	fields := func() map[string]string {
+		values := make(map[string]string)
+		for _, field := range srv.Info(t.Context()).Fields {
+			values[field.Name] = field.Value
+		}
+		return values
+	}
+
+	dialer := net.Dialer{}
+	kept, err := dialer.DialContext(t.Context(), "tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = kept.Close() }()
+	require.Eventually(t, func() bool { return fields()["connected_clients"] == "1" }, time.Second, time.Millisecond)
+
+	refused, err := dialer.DialContext(t.Context(), "tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = refused.Close() }()
+	require.Eventually(t, func() bool { return fields()["rejected_connections"] == "1" }, time.Second, time.Millisecond)
+	got := fields()
+	require.Equal(t, "2", got["total_connections_received"])
+	require.Equal(t, "1", got["max_clients"])
+
+	// a raised limit admits the next connection without a restart
+	srv.SetMaxConnections(2)
+	require.Equal(t, "2", fields()["max_clients"])
+	admitted, err := dialer.DialContext(t.Context(), "tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = admitted.Close() }()
+	require.Eventually(t, func() bool { return fields()["connected_clients"] == "2" }, time.Second, time.Millisecond)
+	require.Equal(t, "1", fields()["rejected_connections"])
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+	require.NoError(t, <-serveDone)
+}
+
+// TestRequestCarriesClientAddr verifies the handler can tell which client a request came from.
+func TestRequestCarriesClientAddr(t *testing.T) {
+	t.Parallel()
+	srv, serveDone := startTCPServer(t, func(ctx context.Context, _ string, _ []string) protocol.Reply {
+		return protocol.BulkString(network.ClientAddr(ctx))
+	})
+
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(t.Context(), "tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	require.NoError(t, protocol.WriteCommand(conn, "PING", nil))
+	reply, err := protocol.ReadReply(bufio.NewReader(conn), 4096)
+	require.NoError(t, err)
+	require.Equal(t, protocol.BulkString(conn.LocalAddr().String()), reply)
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+	require.NoError(t, <-serveDone)
+}
+
+// TestMonitorStreamsCommands verifies a MONITOR connection sees the commands other clients send, with their address
+// and long arguments cut short.
+func TestMonitorStreamsCommands(t *testing.T) {
+	t.Parallel()
+	srv, serveDone := startTCPServer(t, func(context.Context, string, []string) protocol.Reply {
+		return protocol.SimpleString("OK")
+	})
+
+	dialer := net.Dialer{}
+	watcher, err := dialer.DialContext(t.Context(), "tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = watcher.Close() }()
+	watcherReader := bufio.NewReader(watcher)
+	require.NoError(t, protocol.WriteCommand(watcher, "monitor", nil))
+	reply, err := protocol.ReadReply(watcherReader, 4096)
+	require.NoError(t, err)
+	require.Equal(t, protocol.SimpleString("OK"), reply)
+
+	conn, err := dialer.DialContext(t.Context(), "tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	long := strings.Repeat("x", 100)
+	require.NoError(t, protocol.WriteCommand(conn, "SET", []string{"t", "k", long}))
+	_, err = protocol.ReadReply(bufio.NewReader(conn), 4096)
+	require.NoError(t, err)
+
+	reply, err = protocol.ReadReply(watcherReader, 4096)
+	require.NoError(t, err)
+	want := fmt.Sprintf(` [%s] "SET" "t" "k" %q...(36 more bytes)`, conn.LocalAddr(), long[:64])
+	require.True(t, strings.HasSuffix(reply.Value, want), reply.Value)
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+	require.NoError(t, <-serveDone)
+}
+
+// TestMonitorDropsSlowClient verifies a monitor that stops reading is disconnected instead of holding up the clients
+// whose commands it is sent.
+func TestMonitorDropsSlowClient(t *testing.T) {
+	t.Parallel()
+	srv, serveDone := startTCPServer(t, func(context.Context, string, []string) protocol.Reply {
+		return protocol.SimpleString("OK")
+	})
+
+	dialer := net.Dialer{}
+	watcher, err := dialer.DialContext(t.Context(), "tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = watcher.Close() }()
+	require.NoError(t, protocol.WriteCommand(watcher, "MONITOR", nil))
+
+	conn, err := dialer.DialContext(t.Context(), "tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	reader, writer := bufio.NewReader(conn), bufio.NewWriter(conn)
+	args := make([]string, 50)
+	for i := range args {
+		args[i] = strings.Repeat("x", 64)
+	}
+	// enough to fill the monitor's backlog and both socket buffers several times over
+	for range 5000 {
+		require.NoError(t, protocol.WriteCommand(writer, "SET", args))
+		require.NoError(t, writer.Flush())
+		_, err = protocol.ReadReply(reader, 4096)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, watcher.SetReadDeadline(time.Now().Add(5*time.Second)))
+	_, err = io.Copy(io.Discard, watcher)
+	require.NoError(t, err, "the monitor was not disconnected")
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+	require.NoError(t, <-serveDone)
+}
+
+// TestClientsListNameAndKill verifies the server lists its connections with their names and traffic, hands a named
+// client's requests its name, and closes the connection it is asked to kill.
+func TestClientsListNameAndKill(t *testing.T) {
+	t.Parallel()
+	srv, err := network.NewTCPServer("127.0.0.1:0", slog.New(slog.DiscardHandler))
+	require.NoError(t, err)
+	serveDone := make(chan error, 1)
+	go func() {
+		serveDone <- srv.Serve(func(ctx context.Context, cmd string, args []string) protocol.Reply {
+			switch cmd {
+			case "NAME":
+				if nameErr := srv.SetClientName(ctx, args[0]); nameErr != nil {
+					return protocol.Error(nameErr.Error())
+				}
+			case "WHO":
+				return protocol.BulkString(network.ClientName(ctx))
+			}
+			return protocol.SimpleString("OK")
+		})
+	}()
+	roundTrip := func(conn net.Conn, cmd string, args ...string) protocol.Reply {
+		t.Helper()
+		require.NoError(t, protocol.WriteCommand(conn, cmd, args))
+		reply, readErr := protocol.ReadReply(bufio.NewReader(conn), 4096)
+		require.NoError(t, readErr)
+		return reply
+	}
+
+	dialer := net.Dialer{}
+	named, err := dialer.DialContext(t.Context(), "tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = named.Close() }()
+	other, err := dialer.DialContext(t.Context(), "tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = other.Close() }()
+	require.Equal(t, protocol.SimpleString("OK"), roundTrip(named, "NAME", "worker-1"))
+	require.Equal(t, protocol.Error("client names cannot contain spaces, newlines or special characters"),
+		roundTrip(other, "NAME", "bad name"))
+	require.Equal(t, protocol.Error("client name too long (max 128 characters)"),
+		roundTrip(other, "NAME", strings.Repeat("n", 129)))
+	require.Equal(t, protocol.SimpleString("OK"), roundTrip(other, "NAME", strings.Repeat("n", 128)))
+	require.Equal(t, protocol.SimpleString("OK"), roundTrip(other, "NAME", ""))
+	require.Equal(t, protocol.BulkString("worker-1"), roundTrip(named, "WHO"))
+	require.Equal(t, protocol.BulkString(""), roundTrip(other, "WHO"))
+
+	clients := srv.Clients()
+	require.Len(t, clients, 2)
+	require.Less(t, clients[0].ID, clients[1].ID)
+	require.Equal(t, named.LocalAddr().String(), clients[0].Addr)
+	require.Equal(t, "worker-1", clients[0].Name)
+	require.Equal(t, "WHO", clients[0].Command)
+	require.Positive(t, clients[0].BytesIn)
+	require.Equal(t, uint64(len("+OK\r\n$8\r\nworker-1\r\n")), clients[0].BytesOut)
+	require.Empty(t, clients[1].Name)
+
+	require.False(t, srv.KillClient(clients[1].ID+100))
+	require.True(t, srv.KillClientAddr(named.LocalAddr().String()))
+	_, err = named.Read(make([]byte, 1))
+	require.ErrorIs(t, err, io.EOF)
+	require.Eventually(t, func() bool { return len(srv.Clients()) == 1 }, time.Second, time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+	require.NoError(t, <-serveDone)
+}
+
+// TestPauseClientsHoldsWrites verifies a pause of writes holds writes only, never commands aimed at the node, and
+// releases what it holds when lifted.
+func TestPauseClientsHoldsWrites(t *testing.T) {
+	t.Parallel()
+	srv, serveDone := startTCPServer(t, func(_ context.Context, cmd string, _ []string) protocol.Reply {
+		return protocol.SimpleString(cmd)
+	})
+	dialer := net.Dialer{}
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := dialer.DialContext(t.Context(), "tcp", srv.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+		return conn, bufio.NewReader(conn)
+	}
+	writer, writerReader := dial()
+	reader, readerReader := dial()
+
+	srv.PauseClients(time.Hour, true)
+	require.NoError(t, protocol.WriteCommand(writer, "SET", []string{"t", "k", "v"}))
+	for _, cmd := range []string{"GET", "INFO"} {
+		require.NoError(t, protocol.WriteCommand(reader, cmd, nil))
+		reply, err := protocol.ReadReply(readerReader, 4096)
+		require.NoError(t, err)
+		require.Equal(t, protocol.SimpleString(cmd), reply)
+	}
+	require.NoError(t, writer.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err := writerReader.Peek(1)
+	require.ErrorIs(t, err, os.ErrDeadlineExceeded, "the write was not held")
+
+	srv.UnpauseClients()
+	require.NoError(t, writer.SetReadDeadline(time.Time{}))
+	reply, err := protocol.ReadReply(writerReader, 4096)
+	require.NoError(t, err)
+	require.Equal(t, protocol.SimpleString("SET"), reply)
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+	require.NoError(t, <-serveDone)
+}
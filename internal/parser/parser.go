@@ -3,6 +3,7 @@ package parser
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -12,6 +13,15 @@ const maxTableNameLen = 128
 const (
 	commandTables  = "TABLES"
 	commandPromote = "PROMOTE"
+	commandPing    = "PING"
+	commandDump    = "DUMP"
+	commandRestore = "RESTORE"
+)
+
+// DUMP page sizes: DefaultDumpCount keys when no COUNT is given, and at most MaxDumpCount.
+const (
+	DefaultDumpCount = 100
+	MaxDumpCount     = 10000
 )
 
 // Parser implements a parser for a simple key-value store
@@ -24,6 +34,10 @@ type commandSpec struct {
 	// admin marks a control-plane command (e.g. replication management) whose arguments are not table-scoped and so skip
 	// table/key validation.
 	admin bool
+	// target marks a command whose first argument is another server's address, followed by the usual table and key.
+	target bool
+	// pairs marks a command whose arguments after the table are key/value pairs, as many as the client sends.
+	pairs bool
 	usage string
 }
 
@@ -33,6 +47,7 @@ var commands = map[string]commandSpec{ //nolint:gochecknoglobals // a single reg
 	"GET":          {args: 2, readOnly: true, usage: "GET <table> <key>"},
 	"DEL":          {args: 2, readOnly: false, usage: "DEL <table> <key>"},
 	commandTables:  {args: 0, readOnly: true, usage: commandTables},
+	commandPing:    {args: 0, optional: 1, readOnly: true, usage: "PING [message]"},
 	"EXISTS":       {args: 1, readOnly: true, usage: "EXISTS <table>"},
 	"KEYS":         {args: 1, readOnly: true, usage: "KEYS <table>"},
 	"INCR":         {args: 2, optional: 1, readOnly: false, usage: "INCR <table> <key> [delta]"},
@@ -40,8 +55,20 @@ var commands = map[string]commandSpec{ //nolint:gochecknoglobals // a single reg
 	"HSET":         {args: 4, readOnly: false, usage: "HSET <table> <key> <field> <value>"},
 	"HGET":         {args: 3, readOnly: true, usage: "HGET <table> <key> <field>"},
 	"TYPE":         {args: 2, readOnly: true, usage: "TYPE <table> <key>"},
+	commandDump:    {args: 1, optional: 4, readOnly: true, usage: "DUMP <table> [AFTER <key>] [COUNT <n>]"},
+	commandRestore: {args: 3, readOnly: false, pairs: true, usage: "RESTORE <table> <key> <value> [<key> <value> ...]"},
 	commandPromote: {args: 0, readOnly: false, admin: true, usage: commandPromote},
 	"REPLICATION":  {args: 1, readOnly: true, admin: true, usage: "REPLICATION STATUS"},
+	"MIGRATE":      {args: 2, optional: 1, readOnly: false, admin: true, target: true, usage: "MIGRATE <host:port> <table> [key]"},
+	"MIGRATION":    {args: 1, readOnly: true, admin: true, usage: "MIGRATION STATUS"},
+	"VERIFY":       {args: 0, optional: 2, readOnly: false, admin: true, usage: "VERIFY [tiered|wal|snapshot] [QUARANTINE]"},
+	"COMPACT":      {args: 0, optional: 1, readOnly: false, admin: true, usage: "COMPACT [FORCE]"},
+	"CHECKPOINT":   {args: 1, readOnly: false, admin: true, usage: "CHECKPOINT <dir>"},
+	"INFO":         {args: 0, optional: 1, readOnly: true, admin: true, usage: "INFO [section]"},
+	"SLOWLOG":      {args: 1, optional: 1, readOnly: true, admin: true, usage: "SLOWLOG GET [count]|LEN|RESET"},
+	"CLIENT":       {args: 1, optional: 2, readOnly: false, admin: true, usage: "CLIENT LIST|SETNAME|KILL|PAUSE|UNPAUSE [args]"},
+	"CONFIG":       {args: 1, optional: 2, readOnly: false, admin: true, usage: "CONFIG GET <pattern>|SET <param> <value>|REWRITE"},
+	"MONITOR":      {args: 0, readOnly: true, admin: true, usage: "MONITOR"}, // served by the network layer
 }
 
 // IsWrite reports whether cmd mutates state and so has to be routed to a master. The pool asks this rather than keeping
@@ -98,22 +125,87 @@ func (p *Parser) Parse(cmd string, args []string) (string, []string, error) {
 	if !ok {
 		return "", nil, errors.New("unknown command: " + cmd)
 	}
-	if len(args) < spec.args || len(args) > spec.args+spec.optional {
+	arity := len(args) >= spec.args && len(args) <= spec.args+spec.optional
+	if spec.pairs {
+		arity = len(args) >= spec.args && len(args)%2 == 1
+	}
+	if !arity {
 		return "", nil, fmt.Errorf("%s requires %d arguments: %s", cmd, spec.args, spec.usage)
 	}
 
+	if spec.target {
+		if args[0] == "" {
+			return "", nil, errors.New("target address cannot be empty")
+		}
+		if err := validateScope(args[1:]); err != nil {
+			return "", nil, err
+		}
+		return cmd, args, nil
+	}
 	if spec.args == 0 || spec.admin {
 		return cmd, args, nil
 	}
+	if err := validateScope(args); err != nil {
+		return "", nil, err
+	}
+	switch {
+	case spec.pairs:
+		for i := 1; i < len(args); i += 2 {
+			if args[i] == "" {
+				return "", nil, errors.New("key cannot be empty")
+			}
+		}
+	case cmd == commandDump:
+		if _, err := ParseDump(args); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return cmd, args, nil
+}
+
+// Dump is a parsed DUMP request: a page of up to Count keys of Table, in key order, starting after the key After (from
+// the first key when it is empty).
+type Dump struct {
+	Table string
+	After string
+	Count int
+}
+
+// ParseDump parses the arguments of DUMP. The server and the sharded client, which merges the pages of several groups,
+// both need them.
+func ParseDump(args []string) (Dump, error) {
+	dump := Dump{Table: args[0], Count: DefaultDumpCount}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return Dump{}, errors.New("DUMP option " + args[i] + " needs a value")
+		}
+		switch strings.ToUpper(args[i]) {
+		case "AFTER":
+			dump.After = args[i+1]
+		case "COUNT":
+			count, err := strconv.Atoi(args[i+1])
+			if err != nil || count < 1 || count > MaxDumpCount {
+				return Dump{}, fmt.Errorf("DUMP COUNT must be between 1 and %d", MaxDumpCount)
+			}
+			dump.Count = count
+		default:
+			return Dump{}, errors.New("unknown DUMP option: " + args[i])
+		}
+	}
+	return dump, nil
+}
+
+// validateScope checks the table and, when present, the key that lead a table-scoped command's arguments
+func validateScope(args []string) error {
 	if len(args[0]) > maxTableNameLen {
-		return "", nil, errors.New("table name too long")
+		return errors.New("table name too long")
 	}
 	if args[0] == "" {
-		return "", nil, errors.New("table cannot be empty")
+		return errors.New("table cannot be empty")
 	}
-	if spec.args >= 2 && args[1] == "" {
-		return "", nil, errors.New("key cannot be empty")
+	if len(args) >= 2 && args[1] == "" {
+		return errors.New("key cannot be empty")
 	}
-
-	return cmd, args, nil
+	return nil
 }
@@ -47,6 +47,44 @@ func TestParse(t *testing.T) {
 		{"HGET", []string{"t", "k", "f"}, "HGET", []string{"t", "k", "f"}, false},
 		{"TYPE", []string{"t", "k"}, "TYPE", []string{"t", "k"}, false},
 		{"TYPE", []string{"t", ""}, "", nil, true},
+		{"dump", []string{"t"}, "DUMP", []string{"t"}, false},
+		{"DUMP", []string{"t", "after", "k", "COUNT", "50"}, "DUMP", []string{"t", "after", "k", "COUNT", "50"}, false},
+		{"DUMP", []string{"t", "COUNT", "0"}, "", nil, true},
+		{"DUMP", []string{"t", "COUNT", "10001"}, "", nil, true},
+		{"DUMP", []string{"t", "AFTER"}, "", nil, true},
+		{"DUMP", []string{"t", "FROM", "k"}, "", nil, true},
+		{"RESTORE", []string{"t", "k", "v"}, "RESTORE", []string{"t", "k", "v"}, false},
+		{"RESTORE", []string{"t", "a", "1", "b", "2"}, "RESTORE", []string{"t", "a", "1", "b", "2"}, false},
+		{"RESTORE", []string{"t", "a", "1", "b"}, "", nil, true},
+		{"RESTORE", []string{"t", "a", "1", "", "2"}, "", nil, true},
+		{"RESTORE", []string{"t"}, "", nil, true},
+		{"ping", nil, "PING", nil, false},
+		{"PING", []string{"hello"}, "PING", []string{"hello"}, false},
+		{"PING", []string{"a", "b"}, "", nil, true},
+		{"migrate", []string{"db2:3223", "users"}, "MIGRATE", []string{"db2:3223", "users"}, false},
+		{"MIGRATE", []string{"db2:3223", "users", "u1"}, "MIGRATE", []string{"db2:3223", "users", "u1"}, false},
+		{"MIGRATE", []string{"db2:3223"}, "", nil, true},
+		{"MIGRATE", []string{"", "users"}, "", nil, true},
+		{"MIGRATE", []string{"db2:3223", ""}, "", nil, true},
+		{"MIGRATE", []string{"db2:3223", "users", ""}, "", nil, true},
+		{"MIGRATE", []string{"db2:3223", strings.Repeat("t", 129)}, "", nil, true},
+		{"MIGRATION", []string{"STATUS"}, "MIGRATION", []string{"STATUS"}, false},
+		{"verify", nil, "VERIFY", nil, false},
+		{"VERIFY", []string{"tiered", "QUARANTINE"}, "VERIFY", []string{"tiered", "QUARANTINE"}, false},
+		{"VERIFY", []string{"wal", "QUARANTINE", "extra"}, "", nil, true},
+		{"compact", []string{"force"}, "COMPACT", []string{"force"}, false},
+		{"COMPACT", []string{"force", "now"}, "", nil, true},
+		{"checkpoint", []string{"/backups/db"}, "CHECKPOINT", []string{"/backups/db"}, false},
+		{"CHECKPOINT", nil, "", nil, true},
+		{"info", nil, "INFO", nil, false},
+		{"INFO", []string{"keyspace"}, "INFO", []string{"keyspace"}, false},
+		{"INFO", []string{"keyspace", "tiered"}, "", nil, true},
+		{"slowlog", []string{"get", "5"}, "SLOWLOG", []string{"get", "5"}, false},
+		{"SLOWLOG", nil, "", nil, true},
+		{"client", []string{"pause", "100", "write"}, "CLIENT", []string{"pause", "100", "write"}, false},
+		{"CLIENT", nil, "", nil, true},
+		{"config", []string{"set", "logging.level", "debug"}, "CONFIG", []string{"set", "logging.level", "debug"}, false},
+		{"CONFIG", []string{"set", "logging.level", "debug", "extra"}, "", nil, true},
 	}
 
 	for _, tt := range tests {
@@ -79,14 +117,26 @@ func TestIsWrite(t *testing.T) {
 		"INCR":        true,
 		"APPEND":      true,
 		"HSET":        true,
+		"RESTORE":     true,
 		"GET":         false,
 		"HGET":        false,
 		"TYPE":        false,
+		"DUMP":        false,
 		"TABLES":      false,
 		"EXISTS":      false,
 		"KEYS":        false,
 		"PROMOTE":     false,
 		"REPLICATION": false,
+		"MIGRATE":     false,
+		"MIGRATION":   false,
+		"VERIFY":      false,
+		"COMPACT":     false,
+		"CHECKPOINT":  false,
+		"INFO":        false,
+		"SLOWLOG":     false,
+		"MONITOR":     false,
+		"CLIENT":      false,
+		"CONFIG":      false,
 		"NONSENSE":    false,
 	}
 	for cmd, want := range tests {
@@ -106,6 +156,16 @@ func TestIsAdmin(t *testing.T) {
 	tests := map[string]bool{
 		"PROMOTE":     true,
 		"REPLICATION": true,
+		"MIGRATE":     true,
+		"MIGRATION":   true,
+		"VERIFY":      true,
+		"COMPACT":     true,
+		"CHECKPOINT":  true,
+		"INFO":        true,
+		"SLOWLOG":     true,
+		"MONITOR":     true,
+		"CLIENT":      true,
+		"CONFIG":      true,
 		"SET":         false,
 		"GET":         false,
 		"NONSENSE":    false,
@@ -132,14 +192,26 @@ func TestIsMutation(t *testing.T) {
 		"APPEND":      true,
 		"HSET":        true,
 		"PROMOTE":     true,
+		"MIGRATE":     true,
+		"VERIFY":      true,
+		"COMPACT":     true,
+		"CHECKPOINT":  true,
+		"RESTORE":     true,
 		"NONSENSE":    true,
 		"GET":         false,
+		"DUMP":        false,
 		"HGET":        false,
+		"INFO":        false,
+		"SLOWLOG":     false,
+		"MONITOR":     false,
+		"CLIENT":      true,
+		"CONFIG":      true,
 		"TYPE":        false,
 		"TABLES":      false,
 		"EXISTS":      false,
 		"KEYS":        false,
 		"REPLICATION": false,
+		"MIGRATION":   false,
 	}
 	for cmd, want := range tests {
 		if got := parser.IsMutation(cmd); got != want {
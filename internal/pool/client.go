@@ -14,6 +14,9 @@ import (
 	"github.com/OutOfStack/db/internal/protocol"
 )
 
+// ErrServersUnavailable is returned when every server that could take a command has its circuit open
+var ErrServersUnavailable = errors.New("all servers unavailable")
+
 // readOnlyReply is the error value a standby returns for a mutating command (wire "-ERR readonly", decoded with the
 // "ERR " prefix stripped). It signals that the selected server is not actually a writable master.
 const readOnlyReply = "readonly"
@@ -28,6 +31,14 @@ type Client struct {
 	closed      bool
 	// done is closed by Close, so a call parked in a retry delay stops waiting instead of sleeping it out
 	done chan struct{}
+
+	// probes holds the health check connections, one per server; it is nil when health checks are disabled
+	probes  map[string]*network.TCPClient
+	probing sync.WaitGroup
+
+	// latencies holds recent read latencies for the hedge percentile
+	latencies latencyWindow
+	stats     stats
 }
 
 // NewClient creates a new pooled client
@@ -36,28 +47,53 @@ func NewClient(config *PoolConfig, options ...network.TCPClientOption) (*Client,
 		return nil, fmt.Errorf("invalid pool config: %w", err)
 	}
 
-	return &Client{
+	client := &Client{
 		config:      config,
 		selector:    NewSelector(config),
 		connections: make(map[string]*network.TCPClient),
 		options:     options,
 		done:        make(chan struct{}),
-	}, nil
+	}
+
+	if config.HealthCheckInterval > 0 {
+		timeout := config.HealthCheckTimeout
+		if timeout <= 0 {
+			timeout = config.HealthCheckInterval
+		}
+		client.probes = make(map[string]*network.TCPClient, len(config.Servers))
+		for _, server := range config.Servers {
+			client.probes[server.Address] = network.NewTCPClient(server.Address, options...)
+		}
+		client.probing.Add(1)
+		go client.healthLoop(config.HealthCheckInterval, timeout)
+	}
+
+	return client, nil
 }
 
 // Send sends a command using the pool. Mutating commands route to the master; reads follow the configured strategy and
 // retry on another server after a failure. A server that replies "ERR readonly" to a write marks the routing stale, so
-// the pool treats it as failed and retries. Admin commands are refused client-side: they target one specific node, and
-// the pool cannot promise which server a routed command reaches.
+// the pool treats it as failed and retries. Every outcome is reported to the selector's circuit breakers: a reply closes
+// the server's circuit, a failure counts towards opening it. Admin commands are refused client-side: they target one
+// specific node, and the pool cannot promise which server a routed command reaches.
 //
 // Whether a failure may be retried is decided by the transport, not here: an error carrying network.ErrOutcomeUnknown
 // means the command may already have run, so it is never sent to another server. Every other failure provably did not
 // execute, which is what makes trying the next server safe.
+//
+// With hedging configured, a command that does not mutate state is also sent to a second server when the first has not
+// replied within the hedge delay; the first reply is used and the other request cancelled. Commands that mutate are
+// never hedged: running one twice is exactly what the pool must not do.
 func (c *Client) Send(ctx context.Context, cmd string, args []string) (protocol.Reply, error) {
 	if parser.IsAdmin(cmd) {
 		return protocol.Reply{}, fmt.Errorf("admin command %s cannot be sent through a pool; connect to the target server directly", cmd)
 	}
 	write := parser.IsWrite(cmd)
+	read := !parser.IsMutation(cmd)
+	if read {
+		c.stats.reads.Add(1)
+	}
+	hedge := read && c.hedging()
 	var lastErr error
 	maxAttempts := c.config.MaxRetries + 1 // initial attempt + retries
 
@@ -70,7 +106,7 @@ func (c *Client) Send(ctx context.Context, cmd string, args []string) (protocol.
 
 		server := c.selectServer(write)
 		if server == nil {
-			return protocol.Reply{}, noServersError(write)
+			return protocol.Reply{}, errors.Join(noServersError(write), lastErr)
 		}
 
 		conn, err := c.getConnection(server.Address)
@@ -78,7 +114,12 @@ func (c *Client) Send(ctx context.Context, cmd string, args []string) (protocol.
 			return protocol.Reply{}, err
 		}
 
-		resp, err := conn.Send(ctx, cmd, args)
+		var resp protocol.Reply
+		if delay, ok := c.hedgeDelay(); hedge && ok {
+			server, resp, err = c.sendHedged(ctx, server, conn, cmd, args, delay)
+		} else {
+			resp, err = c.sendOn(ctx, server.Address, conn, cmd, args, hedge)
+		}
 		if err != nil {
 			// A call the caller abandoned says nothing about the server: it may have given up while queued for the
 			// connection, before a single byte reached the network. Marking the server failed would route later reads away
@@ -96,14 +137,14 @@ func (c *Client) Send(ctx context.Context, cmd string, args []string) (protocol.
 		}
 
 		// A write that reached a read-only server means our master routing is stale (the server was demoted); mark it
-		// failed and retry. A pool holds one master, so the retry revisits it: the attempts drain and the caller gets the
-		// read-only error rather than a false success.
+		// failed and retry, so the caller gets the read-only error rather than a false success.
 		if write && isReadOnlyReply(resp) {
 			c.selector.MarkFailed(server.Address)
 			lastErr = fmt.Errorf("server %s is read-only", server.Address)
 			continue
 		}
 
+		c.selector.MarkSuccess(server.Address)
 		return resp, nil
 	}
 
@@ -112,6 +153,20 @@ func (c *Client) Send(ctx context.Context, cmd string, args []string) (protocol.
 	return protocol.Reply{}, fmt.Errorf("all servers failed after %d attempts: %w", maxAttempts, lastErr)
 }
 
+// sendOn sends the command on conn, reporting its start, finish and latency to the selector. sample adds the latency of
+// a reply to the window the hedge percentile is computed from.
+func (c *Client) sendOn(ctx context.Context, address string, conn *network.TCPClient, cmd string, args []string, sample bool) (protocol.Reply, error) {
+	c.selector.RequestStarted(address)
+	start := time.Now()
+	resp, err := conn.Send(ctx, cmd, args)
+	latency := time.Since(start)
+	c.selector.RequestFinished(address, latency, err == nil)
+	if err == nil && sample {
+		c.latencies.add(latency)
+	}
+	return resp, err
+}
+
 // wait pauses between attempts, giving up as soon as the caller cancels or the pool is closed. Closing has to reach it:
 // a retry delay is configurable and can be far longer than a caller expects a closed pool to keep working.
 func (c *Client) wait(ctx context.Context, d time.Duration) error {
@@ -128,11 +183,14 @@ func (c *Client) wait(ctx context.Context, d time.Duration) error {
 	}
 }
 
-// selectServer picks a server for the command, resetting the selector once if all candidates are currently marked
-// failed.
+// selectServer picks a server for the command, or returns nil when every candidate's circuit is open. With health checks
+// running, open circuits are left to the probes, which readmit a server as soon as it answers: closing them all here
+// would send traffic straight back to the servers that failed. Without them nothing else closes a circuit before its
+// failure timeout, so the selector is reset once instead; otherwise a single failure of a lone master would fail every
+// write for the whole timeout, and no retry could help.
 func (c *Client) selectServer(write bool) *ServerConfig {
 	server := c.pick(write)
-	if server == nil {
+	if server == nil && c.probes == nil {
 		c.selector.Reset()
 		server = c.pick(write)
 	}
@@ -148,9 +206,9 @@ func (c *Client) pick(write bool) *ServerConfig {
 
 func noServersError(write bool) error {
 	if write {
-		return errors.New("no master servers available in pool")
+		return fmt.Errorf("%w: the circuit of every master in the pool is open", ErrServersUnavailable)
 	}
-	return errors.New("no servers available in pool")
+	return fmt.Errorf("%w: the circuit of every server in the pool is open", ErrServersUnavailable)
 }
 
 // isReadOnlyReply reports whether resp is a standby's "ERR readonly" response.
@@ -191,8 +249,8 @@ func (c *Client) getConnection(address string) (*network.TCPClient, error) {
 	return conn, nil
 }
 
-// Close closes all connections and retires the pool: later commands fail with net.ErrClosed rather than reconnecting.
-// It is safe to call more than once.
+// Close closes all connections, stops health checks and retires the pool: later commands fail with net.ErrClosed rather
+// than reconnecting. It is safe to call more than once.
 func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -208,6 +266,13 @@ func (c *Client) Close() error {
 			lastErr = fmt.Errorf("failed to close connection to %s: %w", address, err)
 		}
 	}
+	// closing a probe connection interrupts a probe in flight, so the loop notices done without waiting out a timeout
+	for address, conn := range c.probes {
+		if err := conn.Close(); err != nil {
+			lastErr = fmt.Errorf("failed to close health check connection to %s: %w", address, err)
+		}
+	}
+	c.probing.Wait()
 
 	c.connections = make(map[string]*network.TCPClient)
 	return lastErr
@@ -218,6 +283,15 @@ func (c *Client) Reset() {
 	c.selector.Reset()
 }
 
+// ServerStates returns the circuit state of every server in the pool, keyed by address
+func (c *Client) ServerStates() map[string]CircuitState {
+	states := make(map[string]CircuitState, len(c.config.Servers))
+	for _, server := range c.config.Servers {
+		states[server.Address] = c.selector.State(server.Address)
+	}
+	return states
+}
+
 // GetActiveServers returns the addresses the pool has sent to. Connections are lazy and self-healing, so an address
 // here has been used at some point, not necessarily an open socket right now.
 func (c *Client) GetActiveServers() []string {
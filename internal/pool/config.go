@@ -17,36 +17,54 @@ const (
 type SelectionStrategy string
 
 const (
-	StrategyMasterFirst SelectionStrategy = "master_first" // Try master first, fallback to standby
-	StrategyRoundRobin  SelectionStrategy = "round_robin"  // Rotate through all servers
-	StrategyRandom      SelectionStrategy = "random"       // Pick random server
+	StrategyMasterFirst      SelectionStrategy = "master_first"      // Try master first, fallback to standby
+	StrategyRoundRobin       SelectionStrategy = "round_robin"       // Rotate through all servers
+	StrategyRandom           SelectionStrategy = "random"            // Pick random server
+	StrategyLeastLatency     SelectionStrategy = "least_latency"     // Pick the server with the lowest average latency
+	StrategyLeastOutstanding SelectionStrategy = "least_outstanding" // Pick the server with the fewest commands in flight
+	StrategyZonePreference   SelectionStrategy = "zone_preference"   // Prefer servers in the client's zone
 )
 
 // ServerConfig represents a single server in the pool
 type ServerConfig struct {
 	Address string     `yaml:"address"`
 	Role    ServerRole `yaml:"role"`
+	Weight  int        `yaml:"weight"` // Relative share of reads (0 = 1); ignored by master_first
+	Zone    string     `yaml:"zone"`   // Zone the server runs in, matched against the pool's zone by zone_preference
+}
+
+// weight returns the server's effective weight: an unset weight counts as 1
+func (s ServerConfig) weight() int {
+	return max(s.Weight, 1)
 }
 
 // PoolConfig represents the configuration for a connection pool
 type PoolConfig struct {
-	Enabled           bool              `yaml:"enabled"`
-	Servers           []ServerConfig    `yaml:"servers"`
-	SelectionStrategy SelectionStrategy `yaml:"selection_strategy"`
-	MaxRetries        int               `yaml:"max_retries"`
-	RetryDelay        time.Duration     `yaml:"retry_delay"`
-	FailureTimeout    time.Duration     `yaml:"failure_timeout"` // Time after which failed servers are retried
+	Enabled             bool              `yaml:"enabled"`
+	Servers             []ServerConfig    `yaml:"servers"`
+	SelectionStrategy   SelectionStrategy `yaml:"selection_strategy"`
+	MaxRetries          int               `yaml:"max_retries"`
+	RetryDelay          time.Duration     `yaml:"retry_delay"`
+	FailureTimeout      time.Duration     `yaml:"failure_timeout"`       // Time after which failed servers are retried
+	FailureThreshold    int               `yaml:"failure_threshold"`     // Failures in a row that open a circuit (0 = 1)
+	HealthCheckInterval time.Duration     `yaml:"health_check_interval"` // Background PING period (0 disables probes)
+	HealthCheckTimeout  time.Duration     `yaml:"health_check_timeout"`  // Deadline for one probe (0 = the interval)
+	Zone                string            `yaml:"zone"`                  // Zone the client runs in (zone_preference)
+	HedgeDelay          time.Duration     `yaml:"hedge_delay"`           // Wait before hedging a read (0 disables)
+	HedgePercentile     float64           `yaml:"hedge_percentile"`      // Hedge after this latency percentile (0 = off)
 }
 
 // DefaultPoolConfig returns a PoolConfig with sensible defaults
 func DefaultPoolConfig() *PoolConfig {
 	return &PoolConfig{
-		Enabled:           false,
-		Servers:           []ServerConfig{},
-		SelectionStrategy: StrategyMasterFirst,
-		MaxRetries:        3,
-		RetryDelay:        time.Second,
-		FailureTimeout:    30 * time.Second, // Retry failed servers after 30 seconds
+		Enabled:            false,
+		Servers:            []ServerConfig{},
+		SelectionStrategy:  StrategyMasterFirst,
+		MaxRetries:         3,
+		RetryDelay:         time.Second,
+		FailureTimeout:     30 * time.Second, // Retry failed servers after 30 seconds
+		FailureThreshold:   1,
+		HealthCheckTimeout: time.Second,
 	}
 }
 
@@ -72,6 +90,14 @@ func (p *PoolConfig) Validate() error {
 		return err
 	}
 
+	if err := p.validateHealthSettings(); err != nil {
+		return err
+	}
+
+	if err := p.validateHedgeSettings(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -114,6 +140,9 @@ func validateServer(server ServerConfig) error {
 	if server.Role != RoleMaster && server.Role != RoleStandby {
 		return errors.New("server role must be 'master' or 'standby'")
 	}
+	if server.Weight < 0 {
+		return errors.New("server weight cannot be negative: " + server.Address)
+	}
 	return nil
 }
 
@@ -129,12 +158,17 @@ func checkDuplicateAddress(address string, remaining []ServerConfig) error {
 
 // validateStrategy validates the selection strategy
 func (p *PoolConfig) validateStrategy() error {
-	if p.SelectionStrategy != StrategyMasterFirst &&
-		p.SelectionStrategy != StrategyRoundRobin &&
-		p.SelectionStrategy != StrategyRandom {
+	switch p.SelectionStrategy {
+	case StrategyMasterFirst, StrategyRoundRobin, StrategyRandom, StrategyLeastLatency, StrategyLeastOutstanding:
+		return nil
+	case StrategyZonePreference:
+		if p.Zone == "" {
+			return errors.New("zone_preference strategy requires the pool zone")
+		}
+		return nil
+	default:
 		return errors.New("invalid selection strategy")
 	}
-	return nil
 }
 
 // validateRetrySettings validates retry-related settings
@@ -150,6 +184,36 @@ func (p *PoolConfig) validateRetrySettings() error {
 	return nil
 }
 
+// validateHealthSettings validates circuit breaker and health check settings
+func (p *PoolConfig) validateHealthSettings() error {
+	if p.FailureThreshold < 0 {
+		return errors.New("failure_threshold cannot be negative")
+	}
+
+	if p.HealthCheckInterval < 0 {
+		return errors.New("health_check_interval cannot be negative")
+	}
+
+	if p.HealthCheckTimeout < 0 {
+		return errors.New("health_check_timeout cannot be negative")
+	}
+
+	return nil
+}
+
+// validateHedgeSettings validates hedged read settings
+func (p *PoolConfig) validateHedgeSettings() error {
+	if p.HedgeDelay < 0 {
+		return errors.New("hedge_delay cannot be negative")
+	}
+
+	if p.HedgePercentile < 0 || p.HedgePercentile >= 100 {
+		return errors.New("hedge_percentile must be between 0 and 100")
+	}
+
+	return nil
+}
+
 // GetMasters returns all servers with master role
 func (p *PoolConfig) GetMasters() []ServerConfig {
 	masters := []ServerConfig{}
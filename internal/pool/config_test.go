@@ -125,6 +125,101 @@ func TestPoolConfig_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "negative hedge delay",
+			config: &pool.PoolConfig{
+				Enabled: true,
+				Servers: []pool.ServerConfig{
+					{Address: "127.0.0.1:3223", Role: pool.RoleMaster},
+				},
+				SelectionStrategy: pool.StrategyMasterFirst,
+				HedgeDelay:        -time.Millisecond,
+			},
+			wantErr: true,
+		},
+		{
+			name: "hedge percentile out of range",
+			config: &pool.PoolConfig{
+				Enabled: true,
+				Servers: []pool.ServerConfig{
+					{Address: "127.0.0.1:3223", Role: pool.RoleMaster},
+				},
+				SelectionStrategy: pool.StrategyMasterFirst,
+				HedgePercentile:   100,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative server weight",
+			config: &pool.PoolConfig{
+				Enabled: true,
+				Servers: []pool.ServerConfig{
+					{Address: "127.0.0.1:3223", Role: pool.RoleMaster, Weight: -1},
+				},
+				SelectionStrategy: pool.StrategyRandom,
+			},
+			wantErr: true,
+		},
+		{
+			name: "zone preference without pool zone",
+			config: &pool.PoolConfig{
+				Enabled: true,
+				Servers: []pool.ServerConfig{
+					{Address: "127.0.0.1:3223", Role: pool.RoleMaster, Zone: "a"},
+				},
+				SelectionStrategy: pool.StrategyZonePreference,
+			},
+			wantErr: true,
+		},
+		{
+			name: "zone preference with pool zone",
+			config: &pool.PoolConfig{
+				Enabled: true,
+				Servers: []pool.ServerConfig{
+					{Address: "127.0.0.1:3223", Role: pool.RoleMaster, Zone: "a"},
+					{Address: "127.0.0.1:3224", Role: pool.RoleStandby, Zone: "b", Weight: 3},
+				},
+				SelectionStrategy: pool.StrategyZonePreference,
+				Zone:              "b",
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative failure threshold",
+			config: &pool.PoolConfig{
+				Enabled: true,
+				Servers: []pool.ServerConfig{
+					{Address: "127.0.0.1:3223", Role: pool.RoleMaster},
+				},
+				SelectionStrategy: pool.StrategyMasterFirst,
+				FailureThreshold:  -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative health check interval",
+			config: &pool.PoolConfig{
+				Enabled: true,
+				Servers: []pool.ServerConfig{
+					{Address: "127.0.0.1:3223", Role: pool.RoleMaster},
+				},
+				SelectionStrategy:   pool.StrategyMasterFirst,
+				HealthCheckInterval: -time.Second,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative health check timeout",
+			config: &pool.PoolConfig{
+				Enabled: true,
+				Servers: []pool.ServerConfig{
+					{Address: "127.0.0.1:3223", Role: pool.RoleMaster},
+				},
+				SelectionStrategy:  pool.StrategyMasterFirst,
+				HealthCheckTimeout: -time.Second,
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,215 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/OutOfStack/db/internal/network"
+)
+
+// CircuitState is the state of one server's circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed means the server is healthy and receives traffic
+	CircuitClosed CircuitState = iota
+	// CircuitOpen means the server failed and is skipped until the failure timeout has passed
+	CircuitOpen
+	// CircuitHalfOpen means the failure timeout has passed and one trial request is let through to decide whether the
+	// circuit closes again or reopens
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	case CircuitClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+// breaker is one server's circuit breaker. A server without one is closed, so the tracker only holds servers that have
+// failed recently.
+type breaker struct {
+	state    CircuitState
+	failures int       // consecutive failures while closed
+	openedAt time.Time // when the circuit last opened
+	trialAt  time.Time // when the half-open trial request was handed out
+}
+
+// healthTracker holds the circuit breakers of a selector's servers. Selectors ask it which servers may take a request;
+// the pool feeds it the outcome of every request and, when enabled, of every background probe.
+type healthTracker struct {
+	mu        sync.Mutex
+	breakers  map[string]*breaker
+	threshold int           // consecutive failures that open a closed circuit
+	cooldown  time.Duration // how long an open circuit stays open before a trial request
+}
+
+func newHealthTracker(config *PoolConfig) *healthTracker {
+	return &healthTracker{
+		breakers:  make(map[string]*breaker),
+		threshold: max(config.FailureThreshold, 1),
+		cooldown:  config.FailureTimeout,
+	}
+}
+
+// allow reports whether a request may be sent to address now. Once an open circuit's cooldown has passed, the first
+// caller to ask is handed the half-open trial and everyone else keeps skipping the server until that trial reports back.
+func (h *healthTracker) allow(address string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b, ok := h.breakers[address]
+	if !ok {
+		return true
+	}
+	now := time.Now()
+	switch b.state {
+	case CircuitOpen:
+		if now.Sub(b.openedAt) < h.cooldown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.trialAt = now
+		return true
+	case CircuitHalfOpen:
+		// A trial whose caller gave up never reports an outcome. Handing out another one after a further cooldown keeps such
+		// a trial from holding the circuit half-open forever.
+		if now.Sub(b.trialAt) < h.cooldown {
+			return false
+		}
+		b.trialAt = now
+		return true
+	case CircuitClosed:
+		return true
+	default:
+		return true
+	}
+}
+
+// closedExcept returns an allow function that admits only servers other than exclude whose circuit is closed. Unlike
+// allow it never hands out a half-open trial: a hedge request is cancelled when it loses, and a trial cancelled that way
+// would report nothing and hold the circuit half-open for another cooldown.
+func (h *healthTracker) closedExcept(exclude string) func(string) bool {
+	return func(address string) bool {
+		return address != exclude && h.State(address) == CircuitClosed
+	}
+}
+
+// ReleaseTrial hands back a half-open server's trial whose request was cancelled without an outcome, so the next
+// request to ask may take it instead of waiting out another cooldown. It does nothing to a circuit in any other state.
+func (h *healthTracker) ReleaseTrial(address string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if b, ok := h.breakers[address]; ok && b.state == CircuitHalfOpen {
+		b.trialAt = time.Time{}
+	}
+}
+
+// MarkFailed records a failed request or probe. A closed circuit opens once the failures in a row reach the threshold;
+// a half-open one reopens at once, since its trial has just failed.
+func (h *healthTracker) MarkFailed(address string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b, ok := h.breakers[address]
+	if !ok {
+		b = &breaker{}
+		h.breakers[address] = b
+	}
+	if b.state == CircuitClosed {
+		b.failures++
+		if b.failures < h.threshold {
+			return
+		}
+	}
+	b.state = CircuitOpen
+	b.openedAt = time.Now()
+}
+
+// MarkSuccess records a successful request or probe, which closes the server's circuit and clears its failure count.
+func (h *healthTracker) MarkSuccess(address string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.breakers, address)
+}
+
+// State reports the circuit state of a server
+func (h *healthTracker) State(address string) CircuitState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b, ok := h.breakers[address]
+	if !ok {
+		return CircuitClosed
+	}
+	if b.state == CircuitOpen && time.Since(b.openedAt) >= h.cooldown {
+		return CircuitHalfOpen // the next allow hands out the trial
+	}
+	return b.state
+}
+
+// reset closes every circuit
+func (h *healthTracker) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.breakers = make(map[string]*breaker)
+}
+
+// healthLoop PINGs every server on connections of its own until the pool is closed. A dead server is then found by a
+// probe rather than by a user request, and a recovered one is readmitted without waiting out the failure timeout. The
+// probe connections are separate from the command connections so a probe never queues behind a slow command and reports
+// a healthy server as dead.
+func (c *Client) healthLoop(interval, timeout time.Duration) {
+	defer c.probing.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	c.probeAll(timeout)
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.probeAll(timeout)
+		}
+	}
+}
+
+// probeAll probes every server concurrently, so one unresponsive server cannot delay the verdict on the others.
+func (c *Client) probeAll(timeout time.Duration) {
+	var wg sync.WaitGroup
+	for address, conn := range c.probes {
+		wg.Go(func() { c.probe(address, conn, timeout) })
+	}
+	wg.Wait()
+}
+
+func (c *Client) probe(address string, conn *network.TCPClient, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Any reply proves the server is reading and answering commands, so the probe does not insist on PONG: an error reply
+	// from a server that predates PING is as good a sign of life.
+	_, err := conn.Send(ctx, "PING", nil)
+	select {
+	case <-c.done:
+		return // Close interrupted the probe, which says nothing about the server
+	default:
+	}
+	if err != nil {
+		c.selector.MarkFailed(address)
+		return
+	}
+	c.selector.MarkSuccess(address)
+}
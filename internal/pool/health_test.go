@@ -0,0 +1,184 @@
+package pool_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OutOfStack/db/internal/pool"
+)
+
+// waitFor polls cond until it holds or the deadline passes. Health checks run on their own schedule, so a test can only
+// wait for the state they converge to.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestCircuitBreaker_Threshold verifies a circuit opens only once the failures in a row reach the threshold, and that a
+// success in between starts the count over.
+func TestCircuitBreaker_Threshold(t *testing.T) {
+	t.Parallel()
+	selector := pool.NewRoundRobinSelector(&pool.PoolConfig{
+		Servers:          []pool.ServerConfig{{Address: "m1", Role: pool.RoleMaster}},
+		FailureTimeout:   time.Hour,
+		FailureThreshold: 3,
+	})
+
+	selector.MarkFailed("m1")
+	selector.MarkFailed("m1")
+	selector.MarkSuccess("m1")
+	selector.MarkFailed("m1")
+	selector.MarkFailed("m1")
+	if state := selector.State("m1"); state != pool.CircuitClosed {
+		t.Fatalf("state after 2 failures in a row = %s, want closed", state)
+	}
+	if selector.SelectWrite() == nil {
+		t.Fatal("closed server was not selected")
+	}
+
+	selector.MarkFailed("m1")
+	if state := selector.State("m1"); state != pool.CircuitOpen {
+		t.Fatalf("state after 3 failures in a row = %s, want open", state)
+	}
+	if server := selector.SelectWrite(); server != nil {
+		t.Fatalf("open server %s was selected", server.Address)
+	}
+}
+
+func TestCircuitState_String(t *testing.T) {
+	t.Parallel()
+	for state, want := range map[pool.CircuitState]string{
+		pool.CircuitClosed:   "closed",
+		pool.CircuitOpen:     "open",
+		pool.CircuitHalfOpen: "half_open",
+		pool.CircuitState(7): "CircuitState(7)",
+	} {
+		if got := state.String(); got != want {
+			t.Errorf("CircuitState(%d).String() = %q, want %q", int(state), got, want)
+		}
+	}
+}
+
+// TestCircuitBreaker_HalfOpen verifies that once the failure timeout passes exactly one trial request is let through,
+// that a failed trial reopens the circuit, and that a successful one closes it.
+func TestCircuitBreaker_HalfOpen(t *testing.T) {
+	t.Parallel()
+	const cooldown = 50 * time.Millisecond
+	selector := pool.NewMasterFirstSelector(&pool.PoolConfig{
+		Servers:        []pool.ServerConfig{{Address: "m1", Role: pool.RoleMaster}},
+		FailureTimeout: cooldown,
+	})
+
+	selector.MarkFailed("m1")
+	if server := selector.SelectRead(); server != nil {
+		t.Fatal("open server was selected before the failure timeout")
+	}
+
+	time.Sleep(cooldown)
+	if state := selector.State("m1"); state != pool.CircuitHalfOpen {
+		t.Fatalf("state after the failure timeout = %s, want half_open", state)
+	}
+	if selector.SelectRead() == nil {
+		t.Fatal("half-open server did not get its trial request")
+	}
+	if server := selector.SelectRead(); server != nil {
+		t.Fatal("half-open server got a second request while its trial was outstanding")
+	}
+
+	// a failed trial reopens the circuit for another full timeout
+	selector.MarkFailed("m1")
+	if state := selector.State("m1"); state != pool.CircuitOpen {
+		t.Fatalf("state after a failed trial = %s, want open", state)
+	}
+
+	time.Sleep(cooldown)
+	if selector.SelectRead() == nil {
+		t.Fatal("reopened server did not get a second trial")
+	}
+	selector.MarkSuccess("m1")
+	if state := selector.State("m1"); state != pool.CircuitClosed {
+		t.Fatalf("state after a successful trial = %s, want closed", state)
+	}
+	for range 3 {
+		if selector.SelectRead() == nil {
+			t.Fatal("closed server was not selected")
+		}
+	}
+}
+
+// TestClient_HealthChecks verifies background probes open the circuit of a dead server before any request is sent, so
+// reads never pay for discovering it, and leave a live server closed.
+func TestClient_HealthChecks(t *testing.T) {
+	t.Parallel()
+	var hits atomic.Int32
+	liveAddr := startHandler(t, okHandler(&hits))
+	dead := deadAddr(t)
+
+	client, err := pool.NewClient(&pool.PoolConfig{
+		Enabled: true,
+		Servers: []pool.ServerConfig{
+			{Address: liveAddr, Role: pool.RoleMaster},
+			{Address: dead, Role: pool.RoleStandby},
+		},
+		SelectionStrategy:   pool.StrategyRoundRobin,
+		RetryDelay:          time.Millisecond,
+		FailureTimeout:      time.Hour,
+		HealthCheckInterval: 10 * time.Millisecond,
+		HealthCheckTimeout:  time.Second,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	waitFor(t, "the dead server's circuit to open", func() bool {
+		return client.ServerStates()[dead] == pool.CircuitOpen
+	})
+	if state := client.ServerStates()[liveAddr]; state != pool.CircuitClosed {
+		t.Fatalf("live server state = %s, want closed", state)
+	}
+
+	// with no retries allowed, a read routed to the dead server would fail outright
+	for range 4 {
+		if _, err = client.Send(t.Context(), "GET", []string{"t", "k"}); err != nil {
+			t.Fatalf("Send GET: %v", err)
+		}
+	}
+}
+
+// TestClient_CloseStopsHealthChecks verifies Close returns promptly even while a probe waits on an unresponsive server.
+func TestClient_CloseStopsHealthChecks(t *testing.T) {
+	t.Parallel()
+	silent := startSilent(t)
+
+	client, err := pool.NewClient(&pool.PoolConfig{
+		Enabled:             true,
+		Servers:             []pool.ServerConfig{{Address: silent.addr, Role: pool.RoleMaster}},
+		SelectionStrategy:   pool.StrategyMasterFirst,
+		FailureTimeout:      time.Hour,
+		HealthCheckInterval: time.Millisecond,
+		HealthCheckTimeout:  time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	waitFor(t, "a probe to reach the server", func() bool { return silent.received.Load() > 0 })
+
+	closed := make(chan struct{})
+	go func() {
+		_ = client.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not interrupt a probe in flight")
+	}
+}
@@ -0,0 +1,170 @@
+package pool
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OutOfStack/db/internal/network"
+	"github.com/OutOfStack/db/internal/protocol"
+)
+
+const (
+	// hedgeWindow is how many recent read latencies the hedge percentile is computed over
+	hedgeWindow = 256
+	// hedgeMinSamples is how many latencies the window needs before its percentile is trusted; until then the fixed
+	// hedge delay applies
+	hedgeMinSamples = 20
+)
+
+// Stats is a point-in-time snapshot of pool counters, used for observability and tests.
+type Stats struct {
+	Reads     uint64 // read-only commands sent through the pool
+	Hedged    uint64 // reads that sent a second, hedge request
+	HedgeWins uint64 // hedged reads answered by the hedge request first
+}
+
+// stats holds the live counters behind Stats
+type stats struct {
+	reads     atomic.Uint64
+	hedged    atomic.Uint64
+	hedgeWins atomic.Uint64
+}
+
+// latencyWindow keeps the most recent read latencies across the pool, to derive the hedge delay from
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration // ring buffer of up to hedgeWindow samples
+	next    int
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.samples) < hedgeWindow {
+		w.samples = append(w.samples, latency)
+		return
+	}
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % hedgeWindow
+}
+
+// percentile returns the p-th percentile (0 < p < 100) of the window, or false while it holds too few samples
+func (w *latencyWindow) percentile(p float64) (time.Duration, bool) {
+	w.mu.Lock()
+	sorted := slices.Clone(w.samples)
+	w.mu.Unlock()
+
+	if len(sorted) < hedgeMinSamples {
+		return 0, false
+	}
+	slices.Sort(sorted)
+	idx := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	return sorted[max(idx, 0)], true
+}
+
+// hedging reports whether reads are hedged at all
+func (c *Client) hedging() bool {
+	return c.config.HedgeDelay > 0 || c.config.HedgePercentile > 0
+}
+
+// hedgeDelay returns how long a read waits for its first server before a hedge request is sent, and false when no
+// hedge should be sent. A percentile follows the latencies the pool actually sees; until enough have been observed the
+// fixed delay stands in for it.
+func (c *Client) hedgeDelay() (time.Duration, bool) {
+	if c.config.HedgePercentile > 0 {
+		if delay, ok := c.latencies.percentile(c.config.HedgePercentile); ok {
+			return delay, true
+		}
+	}
+	return c.config.HedgeDelay, c.config.HedgeDelay > 0
+}
+
+// hedgeResult is the outcome of one of the two requests of a hedged read
+type hedgeResult struct {
+	server *ServerConfig
+	resp   protocol.Reply
+	err    error
+	hedge  bool
+}
+
+// sendHedged sends a read to primary and, when it has not answered within the hedge delay, the same read to a second
+// server. The first reply wins and the other request is cancelled. A request that fails does not end the read while the
+// other is still out: it is marked failed here, and the read waits for the survivor instead.
+//
+// The returned server is the one whose outcome the result reports; Send records it like any other attempt. Cancelling
+// the loser drops its connection mid-reply, which the transport redials on the next command. A hedge only goes to a
+// closed circuit, but the primary may hold a half-open server's trial: when the hedge wins, that trial is released
+// rather than counted either way, since the request was cut short and says nothing about the server.
+func (c *Client) sendHedged(ctx context.Context, primary *ServerConfig, conn *network.TCPClient, cmd string, args []string, delay time.Duration) (*ServerConfig, protocol.Reply, error) {
+	results := make(chan hedgeResult, 2) // buffered for both, so the loser never blocks after the read has returned
+
+	primaryCtx, cancelPrimary := context.WithCancel(ctx)
+	defer cancelPrimary()
+	go func() {
+		resp, err := c.sendOn(primaryCtx, primary.Address, conn, cmd, args, true)
+		results <- hedgeResult{server: primary, resp: resp, err: err}
+	}()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		return r.server, r.resp, r.err
+	case <-timer.C:
+	}
+
+	secondary := c.hedgeServer(primary.Address)
+	if secondary == nil {
+		r := <-results
+		return r.server, r.resp, r.err
+	}
+	hedgeConn, err := c.getConnection(secondary.Address)
+	if err != nil {
+		r := <-results
+		return r.server, r.resp, r.err
+	}
+
+	hedgeCtx, cancelHedge := context.WithCancel(ctx)
+	defer cancelHedge()
+	c.stats.hedged.Add(1)
+	go func() {
+		resp, err := c.sendOn(hedgeCtx, secondary.Address, hedgeConn, cmd, args, true)
+		results <- hedgeResult{server: secondary, resp: resp, err: err, hedge: true}
+	}()
+
+	r := <-results
+	primaryOut := r.hedge
+	if r.err != nil && ctx.Err() == nil {
+		c.selector.MarkFailed(r.server.Address)
+		r = <-results
+		primaryOut = false
+	}
+	if r.hedge && r.err == nil {
+		c.stats.hedgeWins.Add(1)
+	}
+	if primaryOut {
+		c.selector.ReleaseTrial(primary.Address)
+	}
+	return r.server, r.resp, r.err
+}
+
+// hedgeServer picks a server for a hedge request other than exclude, or nil when no other server is available. The
+// strategy chooses among the servers whose circuit is closed: a hedge is not a trial request, so a half-open server is
+// left alone.
+func (c *Client) hedgeServer(exclude string) *ServerConfig {
+	return c.selector.SelectHedge(exclude)
+}
+
+// Stats returns a snapshot of the pool's counters
+func (c *Client) Stats() Stats {
+	return Stats{
+		Reads:     c.stats.reads.Load(),
+		Hedged:    c.stats.hedged.Load(),
+		HedgeWins: c.stats.hedgeWins.Load(),
+	}
+}
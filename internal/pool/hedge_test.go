@@ -0,0 +1,251 @@
+package pool_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OutOfStack/db/internal/network"
+	"github.com/OutOfStack/db/internal/pool"
+	"github.com/OutOfStack/db/internal/protocol"
+)
+
+// slowHandler replies "OK" after delay while slow is set, and at once otherwise. It gives up when the server shuts down,
+// so a hedge loser still sleeping does not outlive the test by the whole delay.
+func slowHandler(hits *atomic.Int32, slow *atomic.Bool, delay time.Duration) network.RequestHandler {
+	return func(ctx context.Context, _ string, _ []string) protocol.Reply {
+		hits.Add(1)
+		if slow.Load() {
+			select {
+			case <-ctx.Done():
+			case <-time.After(delay):
+			}
+		}
+		return protocol.SimpleString("OK")
+	}
+}
+
+func newHedgedPool(t *testing.T, master, standby string, delay time.Duration, percentile float64) *pool.Client {
+	t.Helper()
+	client, err := pool.NewClient(&pool.PoolConfig{
+		Enabled: true,
+		Servers: []pool.ServerConfig{
+			{Address: master, Role: pool.RoleMaster},
+			{Address: standby, Role: pool.RoleStandby},
+		},
+		SelectionStrategy: pool.StrategyMasterFirst,
+		RetryDelay:        time.Millisecond,
+		FailureTimeout:    time.Hour,
+		HedgeDelay:        delay,
+		HedgePercentile:   percentile,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+// TestClient_HedgedRead verifies a read stuck on a slow server is answered by the hedge request to another one.
+func TestClient_HedgedRead(t *testing.T) {
+	t.Parallel()
+	var masterHits, standbyHits atomic.Int32
+	var slow atomic.Bool
+	slow.Store(true)
+	master := startHandler(t, slowHandler(&masterHits, &slow, 5*time.Second))
+	standby := startHandler(t, okHandler(&standbyHits))
+	client := newHedgedPool(t, master, standby, 20*time.Millisecond, 0)
+
+	start := time.Now()
+	if _, err := client.Send(t.Context(), "GET", []string{"t", "k"}); err != nil {
+		t.Fatalf("Send GET: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("hedged read took %v, want the standby's reply", elapsed)
+	}
+	if masterHits.Load() != 1 || standbyHits.Load() != 1 {
+		t.Fatalf("hits master=%d standby=%d, want 1 each", masterHits.Load(), standbyHits.Load())
+	}
+	if stats := client.Stats(); stats.Reads != 1 || stats.Hedged != 1 || stats.HedgeWins != 1 {
+		t.Fatalf("Stats = %+v, want one read hedged and won by the hedge", stats)
+	}
+	// the loser lost the race, not its health
+	if state := client.ServerStates()[master]; state != pool.CircuitClosed {
+		t.Fatalf("master state = %s, want closed", state)
+	}
+}
+
+// TestClient_FastReadNotHedged verifies no hedge is sent when the first server replies within the delay.
+func TestClient_FastReadNotHedged(t *testing.T) {
+	t.Parallel()
+	var masterHits, standbyHits atomic.Int32
+	master := startHandler(t, okHandler(&masterHits))
+	standby := startHandler(t, okHandler(&standbyHits))
+	client := newHedgedPool(t, master, standby, time.Second, 0)
+
+	for range 5 {
+		if _, err := client.Send(t.Context(), "GET", []string{"t", "k"}); err != nil {
+			t.Fatalf("Send GET: %v", err)
+		}
+	}
+	if standbyHits.Load() != 0 {
+		t.Fatalf("standby got %d hedge requests, want 0", standbyHits.Load())
+	}
+	if stats := client.Stats(); stats.Reads != 5 || stats.Hedged != 0 {
+		t.Fatalf("Stats = %+v, want 5 reads and no hedges", stats)
+	}
+}
+
+// TestClient_MutationsNotHedged verifies a command that mutates state is never sent twice, however slow its server.
+func TestClient_MutationsNotHedged(t *testing.T) {
+	t.Parallel()
+	var masterHits, standbyHits atomic.Int32
+	var slow atomic.Bool
+	slow.Store(true)
+	master := startHandler(t, slowHandler(&masterHits, &slow, 100*time.Millisecond))
+	standby := startHandler(t, okHandler(&standbyHits))
+	client := newHedgedPool(t, master, standby, time.Millisecond, 0)
+
+	for _, cmd := range []struct {
+		name string
+		args []string
+	}{
+		{"SET", []string{"t", "k", "v"}},
+		{"INCR", []string{"t", "k"}},
+		{"UNKNOWN", nil}, // an unknown command might mutate, so it is not hedged either
+	} {
+		if _, err := client.Send(t.Context(), cmd.name, cmd.args); err != nil {
+			t.Fatalf("Send %s: %v", cmd.name, err)
+		}
+	}
+	if standbyHits.Load() != 0 {
+		t.Fatalf("standby got %d requests, want 0", standbyHits.Load())
+	}
+	if stats := client.Stats(); stats.Reads != 0 || stats.Hedged != 0 {
+		t.Fatalf("Stats = %+v, want no reads and no hedges", stats)
+	}
+}
+
+// TestClient_HedgePercentile verifies a percentile hedge derives its delay from observed latencies, so a read far slower
+// than usual is hedged even with no fixed delay configured.
+func TestClient_HedgePercentile(t *testing.T) {
+	t.Parallel()
+	var masterHits, standbyHits atomic.Int32
+	var slow atomic.Bool
+	master := startHandler(t, slowHandler(&masterHits, &slow, 5*time.Second))
+	standby := startHandler(t, okHandler(&standbyHits))
+	client := newHedgedPool(t, master, standby, 0, 90)
+
+	for range 30 {
+		if _, err := client.Send(t.Context(), "GET", []string{"t", "k"}); err != nil {
+			t.Fatalf("Send GET: %v", err)
+		}
+	}
+	// by definition a tenth of fast reads outlast the 90th percentile, so some may already have been hedged
+	before := client.Stats()
+
+	slow.Store(true)
+	start := time.Now()
+	if _, err := client.Send(t.Context(), "GET", []string{"t", "k"}); err != nil {
+		t.Fatalf("Send GET: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("read took %v, want it hedged after the observed percentile", elapsed)
+	}
+	if stats := client.Stats(); stats.Hedged != before.Hedged+1 || stats.HedgeWins != before.HedgeWins+1 {
+		t.Fatalf("Stats = %+v after %+v, want one more hedge won", stats, before)
+	}
+}
+
+// TestSelectHedge_LeavesHalfOpenAlone verifies, for every strategy, that a hedge target is never the excluded primary
+// nor a server whose circuit is not closed, and that choosing one leaves a half-open server's trial for a real request.
+func TestSelectHedge_LeavesHalfOpenAlone(t *testing.T) {
+	t.Parallel()
+	const cooldown = 50 * time.Millisecond
+	for _, strategy := range []pool.SelectionStrategy{
+		pool.StrategyMasterFirst, pool.StrategyRoundRobin, pool.StrategyRandom, pool.StrategyLeastLatency,
+		pool.StrategyLeastOutstanding, pool.StrategyZonePreference,
+	} {
+		selector := pool.NewSelector(&pool.PoolConfig{
+			Servers: []pool.ServerConfig{
+				{Address: "primary", Role: pool.RoleStandby, Zone: "a"},
+				{Address: "recovering", Role: pool.RoleMaster, Zone: "a"},
+				{Address: "healthy", Role: pool.RoleStandby, Zone: "b"},
+			},
+			SelectionStrategy: strategy,
+			Zone:              "a",
+			FailureTimeout:    cooldown,
+		})
+		selector.MarkFailed("recovering")
+		time.Sleep(cooldown)
+		for range 20 {
+			if server := selector.SelectHedge("primary"); server == nil || server.Address != "healthy" {
+				t.Fatalf("%s: SelectHedge(primary) = %v, want healthy", strategy, server)
+			}
+		}
+		if server := selector.SelectWrite(); server == nil || server.Address != "recovering" {
+			t.Fatalf("%s: SelectWrite() = %v, want the half-open master's trial still available", strategy, server)
+		}
+		selector.MarkFailed("healthy")
+		if server := selector.SelectHedge("primary"); server != nil {
+			t.Fatalf("%s: SelectHedge(primary) with no other closed circuit = %s, want nil", strategy, server.Address)
+		}
+	}
+}
+
+// TestClient_HedgeReleasesCancelledTrial verifies that a hedge winning over a half-open primary hands the primary's
+// trial back instead of leaving it taken: the next read is the trial again, rather than skipping the server for another
+// cooldown.
+func TestClient_HedgeReleasesCancelledTrial(t *testing.T) {
+	t.Parallel()
+	const cooldown = 300 * time.Millisecond
+	var masterReads, standbyHits atomic.Int32
+	master := startHandler(t, func(ctx context.Context, cmd string, _ []string) protocol.Reply {
+		if cmd == "SET" {
+			return protocol.Error("readonly")
+		}
+		masterReads.Add(1)
+		select {
+		case <-ctx.Done():
+		case <-time.After(5 * time.Second):
+		}
+		return protocol.SimpleString("OK")
+	})
+	standby := startHandler(t, okHandler(&standbyHits))
+	client, err := pool.NewClient(&pool.PoolConfig{
+		Enabled: true,
+		Servers: []pool.ServerConfig{
+			{Address: master, Role: pool.RoleMaster},
+			{Address: standby, Role: pool.RoleStandby},
+		},
+		SelectionStrategy: pool.StrategyMasterFirst,
+		RetryDelay:        time.Millisecond,
+		FailureTimeout:    cooldown,
+		HedgeDelay:        20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	// a demoted master's readonly reply opens its circuit; once the cooldown passes, the next read is its trial
+	if _, err = client.Send(t.Context(), "SET", []string{"t", "k", "v"}); err == nil {
+		t.Fatal("Send SET against a read-only master succeeded, want error")
+	}
+	time.Sleep(cooldown)
+	for i := range 2 {
+		if _, err = client.Send(t.Context(), "GET", []string{"t", "k"}); err != nil {
+			t.Fatalf("Send GET %d: %v", i, err)
+		}
+	}
+	if masterReads.Load() != 2 {
+		t.Fatalf("master got %d reads, want 2: the trial the first hedge cancelled is handed out again", masterReads.Load())
+	}
+	if stats := client.Stats(); stats.HedgeWins != 2 {
+		t.Fatalf("Stats = %+v, want both reads won by the hedge", stats)
+	}
+	if state := client.ServerStates()[master]; state != pool.CircuitHalfOpen {
+		t.Fatalf("master state = %s, want half_open: a cancelled trial is neither a success nor a failure", state)
+	}
+}
@@ -0,0 +1,154 @@
+package pool
+
+import (
+	"cmp"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// latencyAlpha is the weight of the newest sample in a server's latency average. 0.3 follows a change in a few dozen
+// requests while one slow reply cannot flip the ranking on its own.
+const latencyAlpha = 0.3
+
+// serverLoad is the observed load of one server
+type serverLoad struct {
+	latency     time.Duration // exponentially weighted moving average of reply times; zero before the first reply
+	outstanding int           // commands sent and not yet answered
+}
+
+// loadTracker records the observed load of a selector's servers. Every selector carries one, so the pool reports request
+// starts and finishes the same way whatever the strategy; only the load-aware strategies read it back.
+type loadTracker struct {
+	mu      sync.Mutex
+	servers map[string]*serverLoad
+}
+
+func newLoadTracker() *loadTracker {
+	return &loadTracker{servers: make(map[string]*serverLoad)}
+}
+
+func (l *loadTracker) serverLocked(address string) *serverLoad {
+	load, ok := l.servers[address]
+	if !ok {
+		load = &serverLoad{}
+		l.servers[address] = load
+	}
+	return load
+}
+
+// RequestStarted records a command sent to address
+func (l *loadTracker) RequestStarted(address string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.serverLocked(address).outstanding++
+}
+
+// RequestFinished records the end of a command sent to address. Only a reply is a latency sample: a failure's duration
+// measures the timeout or the dial error, not the server, and the circuit breaker already accounts for it.
+func (l *loadTracker) RequestFinished(address string, latency time.Duration, replied bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	load := l.serverLocked(address)
+	load.outstanding = max(load.outstanding-1, 0)
+	if !replied {
+		return
+	}
+	if load.latency == 0 {
+		load.latency = latency
+		return
+	}
+	load.latency = time.Duration(latencyAlpha*float64(latency) + (1-latencyAlpha)*float64(load.latency))
+}
+
+// Latency returns the average reply time observed for address, or zero before its first reply
+func (l *loadTracker) Latency(address string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if load, ok := l.servers[address]; ok {
+		return load.latency
+	}
+	return 0
+}
+
+// Outstanding returns the number of commands sent to address and not yet answered
+func (l *loadTracker) Outstanding(address string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if load, ok := l.servers[address]; ok {
+		return load.outstanding
+	}
+	return 0
+}
+
+// latencyScores scores servers by average latency per unit of weight. A server with no replies yet scores zero, so it is
+// tried before the others and gets a latency of its own.
+func (l *loadTracker) latencyScores(servers []ServerConfig) []float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	scores := make([]float64, len(servers))
+	for i, server := range servers {
+		if load, ok := l.servers[server.Address]; ok {
+			scores[i] = float64(load.latency) / float64(server.weight())
+		}
+	}
+	return scores
+}
+
+// outstandingScores scores servers by the commands they would have in flight after taking this one, per unit of weight.
+// Counting the new command is what lets weight break the tie between idle servers.
+func (l *loadTracker) outstandingScores(servers []ServerConfig) []float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	scores := make([]float64, len(servers))
+	for i, server := range servers {
+		outstanding := 0
+		if load, ok := l.servers[server.Address]; ok {
+			outstanding = load.outstanding
+		}
+		scores[i] = float64(outstanding+1) / float64(server.weight())
+	}
+	return scores
+}
+
+// pickLowest returns the lowest-scoring server that allow admits. Candidates are offered to allow in score order, so it
+// only ever claims the half-open trial of the server actually chosen; equal scores are broken at random, so idle servers
+// share the load instead of the first one in the config taking all of it.
+func pickLowest(servers []ServerConfig, scores []float64, allow func(string) bool) *ServerConfig {
+	//nolint:gosec // Non-cryptographic random is sufficient for server selection
+	order := rand.Perm(len(servers))
+	slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(scores[a], scores[b]) })
+	for _, idx := range order {
+		if allow(servers[idx].Address) {
+			return &servers[idx]
+		}
+	}
+	return nil
+}
+
+// pickWeighted returns a random server that allow admits, each with a probability proportional to its weight. It orders
+// the candidates by a weighted random key (u^(1/w), Efraimidis–Spirakis) and takes the first one admitted: the order is a
+// weighted sample without replacement, so skipping an unavailable server leaves the rest in proportion.
+func pickWeighted(servers []ServerConfig, allow func(string) bool) *ServerConfig {
+	keys := make([]float64, len(servers))
+	for i, server := range servers {
+		//nolint:gosec // Non-cryptographic random is sufficient for server selection
+		keys[i] = math.Pow(rand.Float64(), 1/float64(server.weight()))
+	}
+	order := make([]int, len(servers))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int { return cmp.Compare(keys[b], keys[a]) })
+	for _, idx := range order {
+		if allow(servers[idx].Address) {
+			return &servers[idx]
+		}
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package pool_test
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"strings"
 	"sync/atomic"
@@ -72,7 +73,11 @@ func TestSelectWrite_OnlyMasters(t *testing.T) {
 		},
 		FailureTimeout: time.Hour,
 	}
-	for _, strategy := range []pool.SelectionStrategy{pool.StrategyMasterFirst, pool.StrategyRoundRobin, pool.StrategyRandom} {
+	strategies := []pool.SelectionStrategy{
+		pool.StrategyMasterFirst, pool.StrategyRoundRobin, pool.StrategyRandom,
+		pool.StrategyLeastLatency, pool.StrategyLeastOutstanding, pool.StrategyZonePreference,
+	}
+	for _, strategy := range strategies {
 		config.SelectionStrategy = strategy
 		selector := pool.NewSelector(config)
 		for range 20 {
@@ -186,6 +191,42 @@ func TestClient_ReadOnlyFailover(t *testing.T) {
 	}
 }
 
+// TestClient_AllCircuitsOpenWithHealthChecks verifies that a pool with health checks running leaves an open circuit to
+// its probes: once the only master fails, a write fails at once with ErrServersUnavailable instead of reaching it again.
+func TestClient_AllCircuitsOpenWithHealthChecks(t *testing.T) {
+	t.Parallel()
+	var writes atomic.Int32
+	readOnlyAddr := startHandler(t, func(_ context.Context, cmd string, _ []string) protocol.Reply {
+		if cmd != "SET" {
+			return protocol.SimpleString("PONG")
+		}
+		writes.Add(1)
+		return protocol.Error("readonly")
+	})
+
+	client, err := pool.NewClient(&pool.PoolConfig{
+		Enabled:             true,
+		Servers:             []pool.ServerConfig{{Address: readOnlyAddr, Role: pool.RoleMaster}},
+		SelectionStrategy:   pool.StrategyMasterFirst,
+		MaxRetries:          3,
+		RetryDelay:          time.Millisecond,
+		FailureTimeout:      time.Hour,
+		HealthCheckInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	_, err = client.Send(t.Context(), "SET", []string{"t", "k", "v"})
+	if err == nil || !strings.Contains(err.Error(), "read-only") || !errors.Is(err, pool.ErrServersUnavailable) {
+		t.Fatalf("error = %v, want it to name the read-only server and ErrServersUnavailable", err)
+	}
+	if writes.Load() != 1 {
+		t.Errorf("read-only master got %d writes, want 1: its circuit opened on the first failure", writes.Load())
+	}
+}
+
 // TestClient_RejectsAdminCommands verifies control-plane commands never leave the client: they target one specific
 // node, and the pool cannot promise which server a routed command reaches.
 func TestClient_RejectsAdminCommands(t *testing.T) {
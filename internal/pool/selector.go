@@ -1,7 +1,8 @@
 package pool
 
 import (
-	"math/rand/v2"
+	"cmp"
+	"slices"
 	"sync"
 	"time"
 )
@@ -10,58 +11,71 @@ import (
 type ServerSelector interface {
 	// SelectRead returns the next server for a read, following the strategy.
 	SelectRead() *ServerConfig
+	// SelectHedge returns a server for a hedge request, following the strategy like SelectRead but only among servers
+	// other than exclude whose circuit is closed, or nil if there is none. It never hands out a half-open trial.
+	SelectHedge(exclude string) *ServerConfig
 	// SelectWrite returns the next master for a write, or nil if none available. Standbys are never returned: writes must
 	// reach a master.
 	SelectWrite() *ServerConfig
-	// MarkFailed marks a server as failed
+	// MarkFailed records a failed request or probe against a server, opening its circuit once the failures in a row reach
+	// the configured threshold
 	MarkFailed(address string)
-	// Reset resets the selector state
+	// MarkSuccess records a successful request or probe, closing the server's circuit
+	MarkSuccess(address string)
+	// ReleaseTrial hands back the trial of a half-open server whose request was cancelled before it had an outcome
+	ReleaseTrial(address string)
+	// State reports the circuit state of a server
+	State(address string) CircuitState
+	// RequestStarted records a command sent to a server
+	RequestStarted(address string)
+	// RequestFinished records the end of a command sent to a server, and its latency when the server replied
+	RequestFinished(address string, latency time.Duration, replied bool)
+	// Reset resets the selector state, closing every circuit
 	Reset()
 }
 
 // MasterFirstSelector tries master servers first, then falls back to standbys
 type MasterFirstSelector struct {
-	mu             sync.RWMutex
+	*healthTracker
+	*loadTracker
+
+	mu             sync.Mutex
 	masters        []ServerConfig
 	standbys       []ServerConfig
-	failedServers  map[string]time.Time
 	currentMaster  int
 	currentStandby int
-	failureTimeout time.Duration // Time after which failed servers are retried
 }
 
 // NewMasterFirstSelector creates a new master-first selector
 func NewMasterFirstSelector(config *PoolConfig) *MasterFirstSelector {
 	return &MasterFirstSelector{
-		masters:        config.GetMasters(),
-		standbys:       config.GetStandbys(),
-		failedServers:  make(map[string]time.Time),
-		failureTimeout: config.FailureTimeout,
+		healthTracker: newHealthTracker(config),
+		loadTracker:   newLoadTracker(),
+		masters:       config.GetMasters(),
+		standbys:      config.GetStandbys(),
 	}
 }
 
-// Select picks the next available server (master first, then standby)
-
 // SelectRead picks the next available server (master first, then standby)
 func (s *MasterFirstSelector) SelectRead() *ServerConfig {
+	return s.selectRead(s.allow)
+}
+
+// SelectHedge picks the next server other than exclude with a closed circuit, master first
+func (s *MasterFirstSelector) SelectHedge(exclude string) *ServerConfig {
+	return s.selectRead(s.closedExcept(exclude))
+}
+
+func (s *MasterFirstSelector) selectRead(allow func(string) bool) *ServerConfig {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if server := s.selectMasterLocked(); server != nil {
+	if server := rotate(s.masters, &s.currentMaster, allow); server != nil {
 		return server
 	}
 
 	// Fall back to standbys
-	for i := range len(s.standbys) {
-		idx := (s.currentStandby + i) % len(s.standbys)
-		server := &s.standbys[idx]
-		if !s.isFailed(server.Address) {
-			s.currentStandby = (idx + 1) % len(s.standbys)
-			return server
-		}
-	}
-
-	return nil
+	return rotate(s.standbys, &s.currentStandby, allow)
 }
 
 // SelectWrite picks the next available master, or nil when none are available.
@@ -72,92 +86,94 @@ func (s *MasterFirstSelector) SelectWrite() *ServerConfig {
 }
 
 func (s *MasterFirstSelector) selectMasterLocked() *ServerConfig {
-	for i := range len(s.masters) {
-		idx := (s.currentMaster + i) % len(s.masters)
-		server := &s.masters[idx]
-		if !s.isFailed(server.Address) {
-			s.currentMaster = (idx + 1) % len(s.masters)
-			return server
-		}
-	}
-	return nil
-}
-
-// MarkFailed marks a server as failed
-func (s *MasterFirstSelector) MarkFailed(address string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.failedServers[address] = time.Now()
+	return rotate(s.masters, &s.currentMaster, s.allow)
 }
 
-// Reset resets the failed servers list
+// Reset closes every circuit and rewinds the cursors
 func (s *MasterFirstSelector) Reset() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.failedServers = make(map[string]time.Time)
+	s.reset()
 	s.currentMaster = 0
 	s.currentStandby = 0
 }
 
-func (s *MasterFirstSelector) isFailed(address string) bool {
-	failedTime, failed := s.failedServers[address]
-	if !failed {
-		return false
-	}
-
-	// If failure timeout has passed, remove from failed list and allow retry
-	if time.Since(failedTime) >= s.failureTimeout {
-		delete(s.failedServers, address)
-		return false
-	}
-
-	return true
-}
-
-// RoundRobinSelector rotates through all servers in order
+// RoundRobinSelector rotates through all servers in order, giving each as many turns per cycle as its weight
 type RoundRobinSelector struct {
-	mu             sync.RWMutex
-	servers        []ServerConfig
-	masters        []ServerConfig
-	current        int
-	currentMaster  int
-	failedServers  map[string]time.Time
-	failureTimeout time.Duration
+	*healthTracker
+	*loadTracker
+
+	mu            sync.Mutex
+	servers       []ServerConfig
+	masters       []ServerConfig
+	credits       []int // smooth weighted round-robin state, one entry per server
+	currentMaster int
 }
 
 // NewRoundRobinSelector creates a new round-robin selector
 func NewRoundRobinSelector(config *PoolConfig) *RoundRobinSelector {
 	return &RoundRobinSelector{
-		servers:        config.Servers,
-		masters:        config.GetMasters(),
-		failedServers:  make(map[string]time.Time),
-		failureTimeout: config.FailureTimeout,
+		healthTracker: newHealthTracker(config),
+		loadTracker:   newLoadTracker(),
+		servers:       config.Servers,
+		masters:       config.GetMasters(),
+		credits:       make([]int, len(config.Servers)),
 	}
 }
 
-// Select picks the next server in round-robin order
-
-// SelectRead picks the next server in round-robin order across all servers
+// SelectRead picks the next server across all servers by smooth weighted round-robin: every pick credits each server
+// its weight, and the server holding the most credit is chosen and pays back the total. Equal weights make this a plain
+// rotation, and a server of weight 2 gets two turns per cycle, interleaved with the others rather than back to back.
 func (s *RoundRobinSelector) SelectRead() *ServerConfig {
+	return s.selectRead(s.allow)
+}
+
+// SelectHedge picks the next server other than exclude with a closed circuit, in the same weighted rotation as reads
+func (s *RoundRobinSelector) SelectHedge(exclude string) *ServerConfig {
+	return s.selectRead(s.closedExcept(exclude))
+}
+
+func (s *RoundRobinSelector) selectRead(allow func(string) bool) *ServerConfig {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return rotate(s.servers, &s.current, s.isFailed)
+
+	total := 0
+	next := make([]int, len(s.servers))
+	order := make([]int, len(s.servers))
+	for i, server := range s.servers {
+		next[i] = s.credits[i] + server.weight()
+		total += server.weight()
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return cmp.Compare(next[b], next[a]) })
+
+	for _, idx := range order {
+		if allow(s.servers[idx].Address) {
+			next[idx] -= total
+			s.credits = next
+			return &s.servers[idx]
+		}
+		// a server out of rotation banks no turns, or it would take a burst of them back to back when it returns
+		next[idx] = 0
+	}
+	return nil
 }
 
 // SelectWrite picks the next master in round-robin order
 func (s *RoundRobinSelector) SelectWrite() *ServerConfig {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return rotate(s.masters, &s.currentMaster, s.isFailed)
+	return rotate(s.masters, &s.currentMaster, s.allow)
 }
 
-// rotate returns the next non-failed server from servers starting at *cursor, advancing the cursor past the chosen
-// server.
-func rotate(servers []ServerConfig, cursor *int, isFailed func(string) bool) *ServerConfig {
+// rotate returns the next server from servers starting at *cursor that allow admits, advancing the cursor past the
+// chosen server. allow may claim a half-open trial, so it is asked about each candidate in turn and the first one it
+// admits is used.
+func rotate(servers []ServerConfig, cursor *int, allow func(string) bool) *ServerConfig {
 	for i := range servers {
 		idx := (*cursor + i) % len(servers)
 		server := &servers[idx]
-		if !isFailed(server.Address) {
+		if allow(server.Address) {
 			*cursor = (idx + 1) % len(servers)
 			return server
 		}
@@ -165,113 +181,168 @@ func rotate(servers []ServerConfig, cursor *int, isFailed func(string) bool) *Se
 	return nil
 }
 
-// MarkFailed marks a server as failed
-func (s *RoundRobinSelector) MarkFailed(address string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.failedServers[address] = time.Now()
-}
-
-// Reset resets the failed servers list
+// Reset closes every circuit and rewinds the rotation
 func (s *RoundRobinSelector) Reset() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.failedServers = make(map[string]time.Time)
-	s.current = 0
-}
-
-func (s *RoundRobinSelector) isFailed(address string) bool {
-	failedTime, failed := s.failedServers[address]
-	if !failed {
-		return false
-	}
-
-	// If failure timeout has passed, remove from failed list and allow retry
-	if time.Since(failedTime) >= s.failureTimeout {
-		delete(s.failedServers, address)
-		return false
-	}
-
-	return true
+	s.reset()
+	s.credits = make([]int, len(s.servers))
 }
 
-// RandomSelector picks servers randomly
+// RandomSelector picks servers randomly, each with a probability proportional to its weight
 type RandomSelector struct {
-	mu             sync.RWMutex
-	servers        []ServerConfig
-	masters        []ServerConfig
-	failedServers  map[string]time.Time
-	failureTimeout time.Duration
+	*healthTracker
+	*loadTracker
+
+	servers []ServerConfig
+	masters []ServerConfig
 }
 
 // NewRandomSelector creates a new random selector
 func NewRandomSelector(config *PoolConfig) *RandomSelector {
 	return &RandomSelector{
-		servers:        config.Servers,
-		masters:        config.GetMasters(),
-		failedServers:  make(map[string]time.Time),
-		failureTimeout: config.FailureTimeout,
+		healthTracker: newHealthTracker(config),
+		loadTracker:   newLoadTracker(),
+		servers:       config.Servers,
+		masters:       config.GetMasters(),
 	}
 }
 
-// Select picks a random available server
-
 // SelectRead picks a random available server across all servers
 func (s *RandomSelector) SelectRead() *ServerConfig {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.pickRandom(s.servers)
+	return pickWeighted(s.servers, s.allow)
+}
+
+// SelectHedge picks a random server other than exclude with a closed circuit
+func (s *RandomSelector) SelectHedge(exclude string) *ServerConfig {
+	return pickWeighted(s.servers, s.closedExcept(exclude))
 }
 
 // SelectWrite picks a random available master
 func (s *RandomSelector) SelectWrite() *ServerConfig {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	return s.pickRandom(s.masters)
+	return pickWeighted(s.masters, s.allow)
 }
 
-func (s *RandomSelector) pickRandom(servers []ServerConfig) *ServerConfig {
-	available := []int{}
-	for i := range servers {
-		if !s.isFailed(servers[i].Address) {
-			available = append(available, i)
-		}
-	}
-	if len(available) == 0 {
-		return nil
+// Reset closes every circuit
+func (s *RandomSelector) Reset() {
+	s.reset()
+}
+
+// scoredSelector picks the available server with the lowest load score. The load-aware strategies differ only in how
+// they score a server.
+type scoredSelector struct {
+	*healthTracker
+	*loadTracker
+
+	servers []ServerConfig
+	masters []ServerConfig
+	score   func(*loadTracker, []ServerConfig) []float64
+}
+
+func newScoredSelector(config *PoolConfig, score func(*loadTracker, []ServerConfig) []float64) scoredSelector {
+	return scoredSelector{
+		healthTracker: newHealthTracker(config),
+		loadTracker:   newLoadTracker(),
+		servers:       config.Servers,
+		masters:       config.GetMasters(),
+		score:         score,
 	}
-	//nolint:gosec // Non-cryptographic random is sufficient for server selection
-	idx := available[rand.IntN(len(available))]
-	return &servers[idx]
 }
 
-// MarkFailed marks a server as failed
-func (s *RandomSelector) MarkFailed(address string) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.failedServers[address] = time.Now()
+// SelectRead picks the lowest-scoring available server across all servers
+func (s *scoredSelector) SelectRead() *ServerConfig {
+	return pickLowest(s.servers, s.score(s.loadTracker, s.servers), s.allow)
 }
 
-// Reset resets the failed servers list
-func (s *RandomSelector) Reset() {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.failedServers = make(map[string]time.Time)
+// SelectHedge picks the lowest-scoring server other than exclude with a closed circuit
+func (s *scoredSelector) SelectHedge(exclude string) *ServerConfig {
+	return pickLowest(s.servers, s.score(s.loadTracker, s.servers), s.closedExcept(exclude))
+}
+
+// SelectWrite picks the lowest-scoring available master
+func (s *scoredSelector) SelectWrite() *ServerConfig {
+	return pickLowest(s.masters, s.score(s.loadTracker, s.masters), s.allow)
 }
 
-func (s *RandomSelector) isFailed(address string) bool {
-	failedTime, failed := s.failedServers[address]
-	if !failed {
-		return false
+// Reset closes every circuit. The observed load is kept: it describes the servers, not the selector's state.
+func (s *scoredSelector) Reset() {
+	s.reset()
+}
+
+// LeastLatencySelector picks the server with the lowest average reply time, divided by its weight. A server that has not
+// replied yet is tried first, so every server gets measured.
+type LeastLatencySelector struct {
+	scoredSelector
+}
+
+// NewLeastLatencySelector creates a new least-latency selector
+func NewLeastLatencySelector(config *PoolConfig) *LeastLatencySelector {
+	return &LeastLatencySelector{scoredSelector: newScoredSelector(config, (*loadTracker).latencyScores)}
+}
+
+// LeastOutstandingSelector picks the server with the fewest commands in flight, divided by its weight
+type LeastOutstandingSelector struct {
+	scoredSelector
+}
+
+// NewLeastOutstandingSelector creates a new least-outstanding selector
+func NewLeastOutstandingSelector(config *PoolConfig) *LeastOutstandingSelector {
+	return &LeastOutstandingSelector{scoredSelector: newScoredSelector(config, (*loadTracker).outstandingScores)}
+}
+
+// ZonePreferenceSelector sends reads to servers in the client's own zone, picked at random by weight, and crosses to
+// another zone only when none in its own is available
+type ZonePreferenceSelector struct {
+	*healthTracker
+	*loadTracker
+
+	local   []ServerConfig
+	remote  []ServerConfig
+	masters []ServerConfig
+}
+
+// NewZonePreferenceSelector creates a new zone-preference selector for a client in config.Zone
+func NewZonePreferenceSelector(config *PoolConfig) *ZonePreferenceSelector {
+	s := &ZonePreferenceSelector{
+		healthTracker: newHealthTracker(config),
+		loadTracker:   newLoadTracker(),
+		masters:       config.GetMasters(),
+	}
+	for _, server := range config.Servers {
+		if server.Zone == config.Zone {
+			s.local = append(s.local, server)
+		} else {
+			s.remote = append(s.remote, server)
+		}
 	}
+	return s
+}
+
+// SelectRead picks an available server in the client's zone, falling back to the other zones
+func (s *ZonePreferenceSelector) SelectRead() *ServerConfig {
+	return s.selectRead(s.allow)
+}
 
-	// If failure timeout has passed, remove from failed list and allow retry
-	if time.Since(failedTime) >= s.failureTimeout {
-		delete(s.failedServers, address)
-		return false
+// SelectHedge picks a server other than exclude with a closed circuit, in the client's zone first
+func (s *ZonePreferenceSelector) SelectHedge(exclude string) *ServerConfig {
+	return s.selectRead(s.closedExcept(exclude))
+}
+
+func (s *ZonePreferenceSelector) selectRead(allow func(string) bool) *ServerConfig {
+	if server := pickWeighted(s.local, allow); server != nil {
+		return server
 	}
+	return pickWeighted(s.remote, allow)
+}
+
+// SelectWrite picks an available master, wherever it runs: writes have nowhere else to go
+func (s *ZonePreferenceSelector) SelectWrite() *ServerConfig {
+	return pickWeighted(s.masters, s.allow)
+}
 
-	return true
+// Reset closes every circuit
+func (s *ZonePreferenceSelector) Reset() {
+	s.reset()
 }
 
 // NewSelector creates a selector based on the strategy
@@ -285,6 +356,12 @@ func NewSelector(config *PoolConfig) ServerSelector {
 		return NewRoundRobinSelector(config)
 	case StrategyRandom:
 		return NewRandomSelector(config)
+	case StrategyLeastLatency:
+		return NewLeastLatencySelector(config)
+	case StrategyLeastOutstanding:
+		return NewLeastOutstandingSelector(config)
+	case StrategyZonePreference:
+		return NewZonePreferenceSelector(config)
 	default:
 		return NewMasterFirstSelector(config)
 	}
@@ -167,6 +167,21 @@ func TestNewSelector(t *testing.T) {
 			strategy: pool.StrategyRandom,
 			wantType: "*pool.RandomSelector",
 		},
+		{
+			name:     "least latency strategy",
+			strategy: pool.StrategyLeastLatency,
+			wantType: "*pool.LeastLatencySelector",
+		},
+		{
+			name:     "least outstanding strategy",
+			strategy: pool.StrategyLeastOutstanding,
+			wantType: "*pool.LeastOutstandingSelector",
+		},
+		{
+			name:     "zone preference strategy",
+			strategy: pool.StrategyZonePreference,
+			wantType: "*pool.ZonePreferenceSelector",
+		},
 		{
 			name:     "default to master first",
 			strategy: "invalid",
@@ -205,7 +220,189 @@ func TestNewSelector(t *testing.T) {
 				if _, ok := selector.(*pool.RandomSelector); !ok {
 					t.Errorf("Expected RandomSelector, got %T", selector)
 				}
+			case "*pool.LeastLatencySelector":
+				if _, ok := selector.(*pool.LeastLatencySelector); !ok {
+					t.Errorf("Expected LeastLatencySelector, got %T", selector)
+				}
+			case "*pool.LeastOutstandingSelector":
+				if _, ok := selector.(*pool.LeastOutstandingSelector); !ok {
+					t.Errorf("Expected LeastOutstandingSelector, got %T", selector)
+				}
+			case "*pool.ZonePreferenceSelector":
+				if _, ok := selector.(*pool.ZonePreferenceSelector); !ok {
+					t.Errorf("Expected ZonePreferenceSelector, got %T", selector)
+				}
 			}
 		})
 	}
 }
+
+func TestRoundRobinSelector_Weighted(t *testing.T) {
+	t.Parallel()
+
+	config := &pool.PoolConfig{
+		Servers: []pool.ServerConfig{
+			{Address: "heavy", Role: pool.RoleMaster, Weight: 2},
+			{Address: "light", Role: pool.RoleStandby},
+		},
+		FailureTimeout: time.Hour,
+	}
+
+	selector := pool.NewRoundRobinSelector(config)
+
+	// Smooth weighted round-robin interleaves the heavy server's turns instead of running them back to back
+	var picks []string
+	for range 6 {
+		server := selector.SelectRead()
+		if server == nil {
+			t.Fatal("Expected server, got nil")
+		}
+		picks = append(picks, server.Address)
+	}
+	want := []string{"heavy", "light", "heavy", "heavy", "light", "heavy"}
+	for i := range want {
+		if picks[i] != want[i] {
+			t.Fatalf("Expected picks %v, got %v", want, picks)
+		}
+	}
+}
+
+func TestRandomSelector_Weighted(t *testing.T) {
+	t.Parallel()
+
+	config := &pool.PoolConfig{
+		Servers: []pool.ServerConfig{
+			{Address: "heavy", Role: pool.RoleMaster, Weight: 9},
+			{Address: "light", Role: pool.RoleStandby, Weight: 1},
+		},
+		FailureTimeout: time.Hour,
+	}
+
+	selector := pool.NewRandomSelector(config)
+
+	seen := make(map[string]int)
+	for range 2000 {
+		seen[selector.SelectRead().Address]++
+	}
+	// the expected share is 90%; the bounds are wide enough that a fair implementation never fails them
+	if seen["heavy"] < 1600 || seen["light"] < 100 {
+		t.Errorf("Expected roughly 9:1 picks, got %v", seen)
+	}
+}
+
+func TestLeastLatencySelector(t *testing.T) {
+	t.Parallel()
+
+	config := &pool.PoolConfig{
+		Servers: []pool.ServerConfig{
+			{Address: "master", Role: pool.RoleMaster},
+			{Address: "near", Role: pool.RoleStandby},
+			{Address: "far", Role: pool.RoleStandby},
+		},
+		FailureTimeout: time.Hour,
+	}
+
+	selector := pool.NewLeastLatencySelector(config)
+	observe := func(address string, latency time.Duration) {
+		selector.RequestStarted(address)
+		selector.RequestFinished(address, latency, true)
+	}
+	observe("master", 20*time.Millisecond)
+	observe("near", time.Millisecond)
+
+	// a server that has never replied is tried first, so it gets measured
+	if server := selector.SelectRead(); server.Address != "far" {
+		t.Fatalf("Expected unmeasured server far, got %s", server.Address)
+	}
+	observe("far", 80*time.Millisecond)
+
+	for range 5 {
+		if server := selector.SelectRead(); server.Address != "near" {
+			t.Fatalf("Expected near, got %s", server.Address)
+		}
+	}
+
+	// the average follows a server that slows down
+	for range 20 {
+		observe("near", 50*time.Millisecond)
+	}
+	if server := selector.SelectRead(); server.Address != "master" {
+		t.Fatalf("Expected master after near slowed down, got %s", server.Address)
+	}
+
+	// failed requests are skipped like in every other strategy
+	selector.MarkFailed("master")
+	if server := selector.SelectRead(); server.Address != "near" {
+		t.Fatalf("Expected near with master failed, got %s", server.Address)
+	}
+}
+
+func TestLeastOutstandingSelector(t *testing.T) {
+	t.Parallel()
+
+	config := &pool.PoolConfig{
+		Servers: []pool.ServerConfig{
+			{Address: "master", Role: pool.RoleMaster},
+			{Address: "standby", Role: pool.RoleStandby, Weight: 2},
+		},
+		FailureTimeout: time.Hour,
+	}
+
+	selector := pool.NewLeastOutstandingSelector(config)
+
+	// idle servers tie on in-flight commands, and weight breaks the tie
+	if server := selector.SelectRead(); server.Address != "standby" {
+		t.Fatalf("Expected heavier idle standby, got %s", server.Address)
+	}
+
+	selector.RequestStarted("standby")
+	selector.RequestStarted("standby")
+	if server := selector.SelectRead(); server.Address != "master" {
+		t.Fatalf("Expected master with the standby busy, got %s", server.Address)
+	}
+
+	selector.RequestFinished("standby", time.Millisecond, true)
+	selector.RequestFinished("standby", time.Millisecond, false)
+	if server := selector.SelectRead(); server.Address != "standby" {
+		t.Fatalf("Expected standby once its commands finished, got %s", server.Address)
+	}
+}
+
+func TestZonePreferenceSelector(t *testing.T) {
+	t.Parallel()
+
+	config := &pool.PoolConfig{
+		Servers: []pool.ServerConfig{
+			{Address: "master", Role: pool.RoleMaster, Zone: "a"},
+			{Address: "local1", Role: pool.RoleStandby, Zone: "b"},
+			{Address: "local2", Role: pool.RoleStandby, Zone: "b"},
+			{Address: "remote", Role: pool.RoleStandby, Zone: "c"},
+		},
+		Zone:           "b",
+		FailureTimeout: time.Hour,
+	}
+
+	selector := pool.NewZonePreferenceSelector(config)
+
+	for range 20 {
+		server := selector.SelectRead()
+		if server == nil || server.Zone != "b" {
+			t.Fatalf("Expected a server in zone b, got %v", server)
+		}
+	}
+
+	// with the local zone down, reads cross to the others
+	selector.MarkFailed("local1")
+	selector.MarkFailed("local2")
+	for range 20 {
+		server := selector.SelectRead()
+		if server == nil || server.Zone == "b" {
+			t.Fatalf("Expected a server outside zone b, got %v", server)
+		}
+	}
+
+	// writes go to the master whatever its zone
+	if server := selector.SelectWrite(); server == nil || server.Address != "master" {
+		t.Fatalf("Expected master for writes, got %v", server)
+	}
+}
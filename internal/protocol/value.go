@@ -363,6 +363,15 @@ func Render(v Value) string {
 	return out.String()
 }
 
+// Literal renders v so that ParseLiteral reads back exactly v. Unlike Render it quotes a top-level string too, which
+// bare would be read as whatever literal its text happens to spell ("42" as an int). It is the form to send when a value
+// is copied to another server with SET.
+func Literal(v Value) string {
+	var out strings.Builder
+	render(&out, v)
+	return out.String()
+}
+
 func render(out *strings.Builder, v Value) {
 	switch v.Kind {
 	case KindString:
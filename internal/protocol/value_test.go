@@ -219,6 +219,33 @@ func TestRenderParsesBack(t *testing.T) {
 	}
 }
 
+// TestLiteralParsesBack covers the case Render exempts: a top-level string whose text spells another literal still reads
+// back as a string.
+func TestLiteralParsesBack(t *testing.T) {
+	t.Parallel()
+
+	values := []protocol.Value{
+		protocol.StringValue("42"),
+		protocol.StringValue("true"),
+		protocol.StringValue(`[1,"two"]`),
+		protocol.StringValue(""),
+		protocol.IntValue(42),
+		protocol.FloatValue(1),
+		protocol.MapValue(map[string]protocol.Value{"a": protocol.StringValue("1")}),
+	}
+
+	for _, value := range values {
+		literal := protocol.Literal(value)
+		got, err := protocol.ParseLiteral(literal)
+		if err != nil {
+			t.Fatalf("ParseLiteral(%q) error = %v", literal, err)
+		}
+		if !equalValues(got, value) {
+			t.Errorf("ParseLiteral(Literal(%v)) = %v", value, got)
+		}
+	}
+}
+
 func FuzzValueCodec(f *testing.F) {
 	seeds := []string{"", "42", "-0.0", "true", `"x"`, "[1,[2,[3]]]", `{"a":{"b":[1,2]}}`, "\x00\x01\x02", "hello",
 		// Found by this fuzzer while strings were stored untagged: these bytes are also a valid encoding of int 24, so the
@@ -9,8 +9,10 @@ import (
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/OutOfStack/db/internal/engine"
 	"github.com/OutOfStack/db/internal/wal"
 )
 
@@ -26,14 +28,37 @@ type Master struct {
 	dir      string
 	listener net.Listener
 	logger   *slog.Logger
+	segments SegmentSource // nil: resync from the latest snapshot
 
 	heartbeatInterval time.Duration
 	wg                sync.WaitGroup
+	standbys          atomic.Int64
+}
+
+// SegmentSource ships the segment files of an engine that keeps no snapshots (tiered); it is satisfied by
+// *storage.Storage. fn receives the files frozen at lsn: they hold every mutation up to it.
+type SegmentSource interface {
+	ShipSegments(ctx context.Context, fn func(ctx context.Context, lsn uint64, set engine.SegmentSet) error) error
+}
+
+// MasterOption configures a Master
+type MasterOption func(*Master)
+
+// WithSegmentSource resyncs a standby whose position the WAL no longer covers by shipping the engine's segment files
+// instead of the latest snapshot.
+func WithSegmentSource(source SegmentSource) MasterOption {
+	return func(m *Master) { m.segments = source }
 }
 
 // NewMaster starts listening for standby connections on listenAddr. writer and dir are the server's live WAL writer and
 // its data directory.
-func NewMaster(listenAddr string, writer *wal.Writer, dir string, logger *slog.Logger) (*Master, error) {
+func NewMaster(
+	listenAddr string,
+	writer *wal.Writer,
+	dir string,
+	logger *slog.Logger,
+	options ...MasterOption,
+) (*Master, error) {
 	if logger == nil {
 		logger = slog.New(slog.DiscardHandler)
 	}
@@ -42,18 +67,25 @@ func NewMaster(listenAddr string, writer *wal.Writer, dir string, logger *slog.L
 	if err != nil {
 		return nil, fmt.Errorf("start replication listener: %w", err)
 	}
-	return &Master{
+	m := &Master{
 		writer:            writer,
 		dir:               dir,
 		listener:          listener,
 		logger:            logger,
 		heartbeatInterval: defaultHeartbeatInterval,
-	}, nil
+	}
+	for _, option := range options {
+		option(m)
+	}
+	return m, nil
 }
 
 // Addr returns the address the master is listening on for standbys.
 func (m *Master) Addr() net.Addr { return m.listener.Addr() }
 
+// Standbys returns how many standbys are streaming from this master.
+func (m *Master) Standbys() int { return int(m.standbys.Load()) }
+
 // Serve accepts standby connections until ctx is cancelled or Close is called.
 func (m *Master) Serve(ctx context.Context) {
 	for {
@@ -92,6 +124,8 @@ func (m *Master) handleConn(ctx context.Context, conn net.Conn) {
 		return
 	}
 	m.logger.Info("Standby connected", "remote", conn.RemoteAddr(), "from_lsn", requestedLSN)
+	m.standbys.Add(1)
+	defer m.standbys.Add(-1)
 
 	writer := bufio.NewWriter(conn)
 	if err = m.stream(ctx, writer, requestedLSN); err != nil && !errors.Is(err, context.Canceled) {
@@ -117,7 +151,7 @@ func (m *Master) stream(ctx context.Context, w *bufio.Writer, requestedLSN uint6
 			return err
 		}
 		if nextLSN < oldest {
-			snapLSN, serr := m.sendSnapshot(w)
+			snapLSN, serr := m.resync(ctx, w)
 			if serr != nil {
 				return serr
 			}
@@ -202,6 +236,30 @@ func (m *Master) streamDisk(w *bufio.Writer, nextLSN *uint64) error {
 	})
 }
 
+// resync sends a standby the full state it can no longer build from the WAL and returns the LSN that state is at.
+func (m *Master) resync(ctx context.Context, w *bufio.Writer) (uint64, error) {
+	if m.segments != nil {
+		return m.sendSegments(ctx, w)
+	}
+	return m.sendSnapshot(w)
+}
+
+func (m *Master) sendSegments(ctx context.Context, w *bufio.Writer) (uint64, error) {
+	var shipped uint64
+	err := m.segments.ShipSegments(ctx, func(_ context.Context, lsn uint64, set engine.SegmentSet) error {
+		if err := writeSegmentsFrame(w, lsn, set); err != nil {
+			return err
+		}
+		shipped = lsn
+		return w.Flush()
+	})
+	if err != nil {
+		return 0, fmt.Errorf("ship segments: %w", err)
+	}
+	m.logger.Info("Sent segment files to standby", "lsn", shipped)
+	return shipped, nil
+}
+
 func (m *Master) sendSnapshot(w *bufio.Writer) (uint64, error) {
 	lsn, path, ok, err := wal.LatestSnapshotInfo(m.dir)
 	if err != nil {
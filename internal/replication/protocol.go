@@ -10,11 +10,19 @@
 // where <lsn> is the highest LSN the standby has already applied. The master then streams framed messages, each
 // prefixed by a one-byte frame type:
 //
-//	'R' record    — a WAL record (wal.EncodeRecord bytes; self-delimiting)
+//	'W' record    — a WAL record with its commit time and origin
+//	                (wal.EncodeRecord bytes; self-delimiting)
+//	'R' record    — a WAL record without them, sent by masters of older
+//	                builds (wal.ReadRecordV2 reads it); a standby can be
+//	                upgraded before its master
 //	'S' snapshot  — resync payload: 8-byte LSN, 8-byte length, then that many
 //	                bytes of protocol-encoded SET commands (a snapshot blob)
 //	'H' heartbeat — 8-byte master LastLSN, sent while idle so the standby can
 //	                report replication lag even when no records are flowing
+//	'G' segments  — resync payload of a master whose engine keeps segment files
+//	                (tiered) instead of snapshots: 8-byte LSN, 4-byte file count,
+//	                then per file a 2-byte name length, the name, an 8-byte
+//	                length and that many bytes of the file
 package replication
 
 import (
@@ -23,8 +31,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"strconv"
 
+	"github.com/OutOfStack/db/internal/engine"
 	"github.com/OutOfStack/db/internal/protocol"
 	"github.com/OutOfStack/db/internal/wal"
 )
@@ -33,9 +43,11 @@ const (
 	// handshakeCommand is the RESP command a standby sends to begin streaming.
 	handshakeCommand = "REPLICATE"
 
-	frameRecord    byte = 'R'
+	frameRecord    byte = 'W'
+	frameRecordV2  byte = 'R'
 	frameSnapshot  byte = 'S'
 	frameHeartbeat byte = 'H'
+	frameSegments  byte = 'G'
 
 	// handshakeMaxSize bounds the REPLICATE handshake command decode.
 	handshakeMaxSize = 128
@@ -105,6 +117,42 @@ func writeSnapshotFrame(w io.Writer, lsn uint64, length int64, src io.Reader) er
 	return nil
 }
 
+// writeSegmentsFrame streams every file of a frozen segment set.
+func writeSegmentsFrame(w io.Writer, lsn uint64, set engine.SegmentSet) error {
+	count := 0
+	if err := set.Each(func(string, int64, io.Reader) error {
+		count++
+		return nil
+	}); err != nil {
+		return err
+	}
+	if count > math.MaxUint32 {
+		return fmt.Errorf("too many segment files: %d", count)
+	}
+	header := make([]byte, 1+8+4)
+	header[0] = frameSegments
+	binary.BigEndian.PutUint64(header[1:9], lsn)
+	binary.BigEndian.PutUint32(header[9:13], uint32(count)) // #nosec G115 -- bounded above
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	return set.Each(func(name string, size int64, data io.Reader) error {
+		if len(name) > math.MaxUint16 || size < 0 {
+			return fmt.Errorf("cannot ship segment file %q of %d bytes", name, size)
+		}
+		fileHeader := binary.BigEndian.AppendUint16(nil, uint16(len(name))) // #nosec G115 -- bounded above
+		fileHeader = append(fileHeader, name...)
+		fileHeader = binary.BigEndian.AppendUint64(fileHeader, uint64(size)) // #nosec G115 -- checked non-negative
+		if _, err := w.Write(fileHeader); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(w, data, size); err != nil {
+			return fmt.Errorf("stream segment file %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
 func parseUint(s string) (uint64, error) {
 	var n uint64
 	if s == "" {
@@ -1,8 +1,15 @@
 package replication_test
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
 	"log/slog"
+	"net"
+	"reflect"
 	"testing"
 	"time"
 
@@ -236,3 +243,81 @@ func TestReplication_SnapshotResync(t *testing.T) {
 		t.Fatalf("standby snapshot info = %d, %v, %v; want a snapshot", lsn, ok, err)
 	}
 }
+
+// TestReplication_ShipsRecordMetadata verifies the standby's log keeps the commit time and origin of the master's
+// records, and that the standby reports when the master committed the last record it applied.
+func TestReplication_ShipsRecordMetadata(t *testing.T) {
+	t.Parallel()
+	master := newNode(t, t.TempDir())
+	standby := newNode(t, t.TempDir())
+	m := startMaster(t, master)
+
+	ctx := wal.WithOrigin(context.Background(), "loader@127.0.0.1:5000")
+	if _, err := master.store.Execute(ctx, "SET", []string{"t", "k", "v"}); err != nil {
+		t.Fatalf("SET: %v", err)
+	}
+	sb := replication.NewStandby(m.Addr().String(), standby.store, standby.dir, 0, 10*time.Millisecond, nil)
+	sb.Start(context.Background())
+	t.Cleanup(sb.Stop)
+	waitFor(t, "standby to apply the write", func() bool { return sb.AppliedLSN() >= 1 })
+
+	records := func(dir string) []wal.Record {
+		var read []wal.Record
+		if err := wal.ReadRecordsFrom(dir, 1, func(record wal.Record) error {
+			read = append(read, record)
+			return nil
+		}); err != nil {
+			t.Fatalf("ReadRecordsFrom: %v", err)
+		}
+		return read
+	}
+	want, got := records(master.dir), records(standby.dir)
+	if len(want) != 1 || want[0].Time.IsZero() || want[0].Origin != "loader@127.0.0.1:5000" {
+		t.Fatalf("master records = %#v, want one with a commit time and origin", want)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("standby records = %#v, want %#v", got, want)
+	}
+	if applied := sb.AppliedTime(); !applied.Equal(want[0].Time) {
+		t.Fatalf("standby applied time = %v, want %v", applied, want[0].Time)
+	}
+}
+
+// TestReplication_ReadsVersion2RecordFrames verifies a standby replicates from a master of an older build, which sends
+// records without a commit time or origin.
+func TestReplication_ReadsVersion2RecordFrames(t *testing.T) {
+	t.Parallel()
+	standby := newNode(t, t.TempDir())
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		conn, acceptErr := listener.Accept()
+		if acceptErr != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		if _, _, readErr := protocol.ReadCommand(bufio.NewReader(conn), 128); readErr != nil {
+			return
+		}
+		var body bytes.Buffer
+		body.Write(binary.BigEndian.AppendUint64(nil, 1))
+		_ = protocol.WriteCommand(&body, wal.CommandSet, []string{"t", "k", "old"})
+		frame := append([]byte{'R'}, body.Bytes()...)
+		_, _ = conn.Write(binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(body.Bytes())))
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	sb := replication.NewStandby(listener.Addr().String(), standby.store, standby.dir, 0, 10*time.Millisecond, nil)
+	sb.Start(context.Background())
+	t.Cleanup(sb.Stop)
+	waitFor(t, "standby to apply the record", func() bool { return sb.AppliedLSN() >= 1 })
+	if got := mustGet(t, standby, "t", "k"); got != "old" {
+		t.Errorf("standby t/k = %q, want old", got)
+	}
+	if applied := sb.AppliedTime(); !applied.IsZero() {
+		t.Errorf("standby applied time = %v, want none", applied)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"io"
 	"log/slog"
 	"net"
+	"os"
+	"path/filepath"
 	"sync/atomic"
 	"time"
 
@@ -22,14 +24,20 @@ type Applier interface {
 	ApplyReplicated(ctx context.Context, record wal.Record) error
 	// ResetToSnapshot replaces all state with a resync snapshot at lsn.
 	ResetToSnapshot(ctx context.Context, dir string, lsn uint64, entries []engine.Entry) error
+	// ResetToSegments replaces all state with the segment files shipped into dir, at lsn.
+	ResetToSegments(ctx context.Context, dir string, lsn uint64) error
 }
 
 // defaultReconnectBackoff is the pause between replication reconnect attempts.
 const defaultReconnectBackoff = time.Second
 
-// maxSnapshotBytes bounds the snapshot blob so a malformed length cannot drive an unbounded read.
+// maxSnapshotBytes bounds the snapshot blob so a malformed length cannot drive an unbounded read. It bounds each shipped
+// segment file too.
 const maxSnapshotBytes = 1 << 40
 
+// resyncDir is the directory under the standby's WAL directory that shipped segment files are received into
+const resyncDir = "resync"
+
 // Standby connects to a master, persists the streamed WAL to its own log, and applies it to its engine in order. It
 // reconnects with backoff and tracks the applied LSN and lag so a promoted standby has a complete, contiguous log.
 type Standby struct {
@@ -43,6 +51,8 @@ type Standby struct {
 	appliedLSN atomic.Uint64
 	masterLSN  atomic.Uint64
 	connected  atomic.Bool
+	// appliedTime is the commit time, in Unix nanoseconds, of the last record applied that carried one
+	appliedTime atomic.Int64
 
 	cancel context.CancelFunc
 	done   chan struct{}
@@ -96,6 +106,16 @@ func (s *Standby) Stop() {
 // AppliedLSN returns the highest LSN this standby has persisted and applied.
 func (s *Standby) AppliedLSN() uint64 { return s.appliedLSN.Load() }
 
+// AppliedTime returns when the master committed the last record this standby applied, or the zero time when no record
+// it applied since it started carried one.
+func (s *Standby) AppliedTime() time.Time {
+	nanos := s.appliedTime.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos).UTC()
+}
+
 // Lag returns how many LSNs the standby trails the master by, based on the latest record or heartbeat seen. It is a
 // best-effort, eventually-consistent estimate given asynchronous replication.
 func (s *Standby) Lag() uint64 {
@@ -161,8 +181,12 @@ func (s *Standby) readFrame(ctx context.Context, reader *bufio.Reader) error {
 		return err
 	}
 	switch frameType {
-	case frameRecord:
-		record, rErr := wal.ReadRecord(reader)
+	case frameRecord, frameRecordV2:
+		read := wal.ReadRecord
+		if frameType == frameRecordV2 {
+			read = wal.ReadRecordV2
+		}
+		record, rErr := read(reader)
 		if rErr != nil {
 			return fmt.Errorf("read record frame: %w", rErr)
 		}
@@ -176,6 +200,8 @@ func (s *Standby) readFrame(ctx context.Context, reader *bufio.Reader) error {
 		return nil
 	case frameSnapshot:
 		return s.applySnapshot(ctx, reader)
+	case frameSegments:
+		return s.applySegments(ctx, reader)
 	default:
 		return fmt.Errorf("unknown replication frame %q", frameType)
 	}
@@ -186,6 +212,9 @@ func (s *Standby) applyRecord(ctx context.Context, record wal.Record) error {
 		return fmt.Errorf("apply replicated record %d: %w", record.LSN, err)
 	}
 	s.appliedLSN.Store(record.LSN)
+	if !record.Time.IsZero() {
+		s.appliedTime.Store(record.Time.UnixNano())
+	}
 	s.observeMasterLSN(record.LSN)
 	return nil
 }
@@ -219,6 +248,85 @@ func (s *Standby) applySnapshot(ctx context.Context, reader *bufio.Reader) error
 	return nil
 }
 
+// applySegments handles a resync from a master that ships its segment files: they are received into a directory of
+// their own and only then swapped in, so a stream cut off halfway leaves the standby's state as it was.
+func (s *Standby) applySegments(ctx context.Context, reader *bufio.Reader) error {
+	lsn, err := readUint64(reader)
+	if err != nil {
+		return fmt.Errorf("read segments lsn: %w", err)
+	}
+	countBytes := make([]byte, 4)
+	if _, err = io.ReadFull(reader, countBytes); err != nil {
+		return fmt.Errorf("read segment count: %w", err)
+	}
+	count := binary.BigEndian.Uint32(countBytes)
+
+	dir := filepath.Join(s.dir, resyncDir)
+	if err = os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("clear resync directory: %w", err)
+	}
+	if err = os.MkdirAll(dir, 0o750); err != nil {
+		return fmt.Errorf("create resync directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	for range count {
+		if err = receiveFile(reader, dir); err != nil {
+			return err
+		}
+	}
+	if err = wal.SyncDirectory(dir); err != nil {
+		return fmt.Errorf("sync resync directory: %w", err)
+	}
+	if err = s.applier.ResetToSegments(ctx, dir, lsn); err != nil {
+		return fmt.Errorf("apply resync segments: %w", err)
+	}
+	s.appliedLSN.Store(lsn)
+	s.observeMasterLSN(lsn)
+	s.logger.Info("Applied resync segment files", "lsn", lsn, "files", count)
+	return nil
+}
+
+// receiveFile reads one shipped file into dir and fsyncs it. The name comes from the master, so anything but a plain
+// file name is refused.
+func receiveFile(reader *bufio.Reader, dir string) error {
+	lenBytes := make([]byte, 2)
+	if _, err := io.ReadFull(reader, lenBytes); err != nil {
+		return fmt.Errorf("read segment name length: %w", err)
+	}
+	name := make([]byte, binary.BigEndian.Uint16(lenBytes))
+	if _, err := io.ReadFull(reader, name); err != nil {
+		return fmt.Errorf("read segment name: %w", err)
+	}
+	if !filepath.IsLocal(string(name)) || filepath.Base(string(name)) != string(name) {
+		return fmt.Errorf("refusing shipped file name %q", name)
+	}
+	size, err := readUint64(reader)
+	if err != nil {
+		return fmt.Errorf("read segment length: %w", err)
+	}
+	if size > maxSnapshotBytes {
+		return fmt.Errorf("segment length %d exceeds maximum %d", size, uint64(maxSnapshotBytes))
+	}
+
+	// #nosec G304 -- the name was checked to be a plain file name inside dir
+	file, err := os.OpenFile(filepath.Join(dir, string(name)), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("create shipped file: %w", err)
+	}
+	_, err = io.CopyN(file, reader, int64(size)) // #nosec G115 -- size bounded by maxSnapshotBytes above
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("receive shipped file %s: %w", name, err)
+	}
+	return nil
+}
+
 func (s *Standby) observeMasterLSN(lsn uint64) {
 	for {
 		current := s.masterLSN.Load()
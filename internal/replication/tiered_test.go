@@ -0,0 +1,126 @@
+package replication_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfStack/db/internal/engine/tiered"
+	"github.com/OutOfStack/db/internal/protocol"
+	"github.com/OutOfStack/db/internal/replication"
+	"github.com/OutOfStack/db/internal/storage"
+	"github.com/OutOfStack/db/internal/wal"
+)
+
+// tieredNode is a server running the tiered engine, with its replication log inside the engine's data directory as the
+// server lays it out.
+type tieredNode struct {
+	logDir string
+	engine *tiered.Engine
+	writer *wal.Writer
+	store  *storage.Storage
+}
+
+func newTieredNode(t *testing.T) *tieredNode {
+	t.Helper()
+	dataDir := t.TempDir()
+	eng, err := tiered.Open(tiered.Config{
+		Dir:                 dataDir,
+		MaxMemoryBytes:      1 << 20,
+		MaxStorageBytes:     1 << 20,
+		SegmentSize:         1 << 10,
+		Sync:                wal.SyncNo,
+		CompactionThreshold: 0.5,
+	}, nil)
+	if err != nil {
+		t.Fatalf("tiered.Open: %v", err)
+	}
+	logDir := filepath.Join(dataDir, "replication")
+	writer, err := wal.OpenWriter(wal.WriterConfig{Dir: logDir, Sync: wal.SyncNo, SegmentSize: 4 << 10}, 0)
+	if err != nil {
+		t.Fatalf("OpenWriter: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = writer.Close()
+		_ = eng.Close()
+	})
+	return &tieredNode{logDir: logDir, engine: eng, writer: writer, store: storage.New(eng, storage.WithWAL(writer))}
+}
+
+func (n *tieredNode) get(t *testing.T, table, key string) string {
+	t.Helper()
+	value, err := n.engine.Get(context.Background(), table, key)
+	if err != nil {
+		t.Fatalf("Get %s/%s: %v", table, key, err)
+	}
+	return protocol.Render(protocol.Decode(value))
+}
+
+// TestReplication_TieredSegmentResync verifies a tiered standby too far behind a tiered master's pruned log bootstraps
+// from the master's segment files, then streams as usual.
+func TestReplication_TieredSegmentResync(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	master := newTieredNode(t)
+	standby := newTieredNode(t)
+
+	value := strings.Repeat("v", 100)
+	for i := range 100 {
+		if _, err := master.store.Execute(ctx, "SET", []string{"t", fmt.Sprintf("k%03d", i), value}); err != nil {
+			t.Fatalf("SET: %v", err)
+		}
+	}
+	if _, err := master.store.Execute(ctx, "DEL", []string{"t", "k000"}); err != nil {
+		t.Fatalf("DEL: %v", err)
+	}
+	pruned, err := master.store.PruneLog(ctx)
+	if err != nil {
+		t.Fatalf("PruneLog: %v", err)
+	}
+	if pruned != 100 {
+		t.Fatalf("pruned up to %d, want 100: the newest record is kept", pruned)
+	}
+	oldest, err := wal.OldestRecordLSN(master.logDir, master.writer.LastLSN()+1)
+	if err != nil || oldest <= 1 {
+		t.Fatalf("oldest logged LSN = %d, %v; want the log pruned", oldest, err)
+	}
+
+	m, err := replication.NewMaster("127.0.0.1:0", master.writer, master.logDir, slog.New(slog.DiscardHandler),
+		replication.WithSegmentSource(master.store))
+	if err != nil {
+		t.Fatalf("NewMaster: %v", err)
+	}
+	serveCtx, cancel := context.WithCancel(ctx)
+	go m.Serve(serveCtx)
+	t.Cleanup(func() {
+		cancel()
+		_ = m.Close()
+	})
+
+	sb := replication.NewStandby(m.Addr().String(), standby.store, standby.logDir, 0, 10*time.Millisecond, nil)
+	sb.Start(ctx)
+	t.Cleanup(sb.Stop)
+
+	waitFor(t, "standby to resync from segments", func() bool { return sb.AppliedLSN() >= 101 })
+	if got := standby.get(t, "t", "k099"); got != value {
+		t.Errorf("standby t/k099 = %q, want the shipped value", got)
+	}
+	if _, err = standby.engine.Get(ctx, "t", "k000"); err == nil {
+		t.Error("standby still has t/k000, deleted before the resync")
+	}
+	if got := standby.engine.AppliedLSN(); got != 101 {
+		t.Errorf("standby engine applied LSN = %d, want 101", got)
+	}
+
+	if _, err = master.store.Execute(ctx, "SET", []string{"t", "after", "live"}); err != nil {
+		t.Fatalf("SET: %v", err)
+	}
+	waitFor(t, "standby to apply the live write", func() bool { return sb.AppliedLSN() >= 102 })
+	if got := standby.get(t, "t", "after"); got != "live" {
+		t.Errorf("standby t/after = %q, want live", got)
+	}
+}
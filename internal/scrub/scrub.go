@@ -0,0 +1,218 @@
+// Package scrub finds damage in the files a server keeps on disk — tiered segments, WAL segments and snapshots —
+// before a read or a restart trips over it. Each kind of file is a Target that re-reads its files and checks every record; a
+// Scrubber runs the targets in the background at a throttled read rate and answers the VERIFY command on demand.
+package scrub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/OutOfStack/db/internal/protocol"
+)
+
+// QuarantineDir is the directory, inside the directory a damaged file was found in, that quarantine moves it to. Files
+// there are never read again; an operator inspects or deletes them.
+const QuarantineDir = "quarantine"
+
+// Corruption is a damaged file found by verification. Offset is where the first damaged record starts: records after it
+// cannot be located reliably once a length field may be the damaged part.
+type Corruption struct {
+	File   string
+	Offset int64
+	Err    error
+}
+
+// Target verifies one kind of file.
+type Target interface {
+	// Name is the target's VERIFY argument: tiered, wal or snapshot.
+	Name() string
+	// Verify reads every file of the target through throttle and returns how many it checked and the damaged ones.
+	Verify(ctx context.Context, throttle *Throttle) (int, []Corruption, error)
+	// Quarantine moves a damaged file out of the way, recovering what it can first, and describes what it did.
+	Quarantine(ctx context.Context, corruption Corruption) (string, error)
+}
+
+// Scrubber runs verification passes over its targets. The background loop and VERIFY may run at the same time; each
+// target takes whatever locks it needs itself.
+type Scrubber struct {
+	targets []Target
+	logger  *slog.Logger
+
+	mu     sync.Mutex
+	passes uint64
+	found  uint64
+}
+
+// New creates a scrubber over targets.
+func New(logger *slog.Logger, targets ...Target) *Scrubber {
+	return &Scrubber{targets: targets, logger: logger}
+}
+
+// Run verifies every target once per interval, reading at most bytesPerSecond, until ctx is done. Damage is logged,
+// not quarantined: moving files is left to an operator running VERIFY with QUARANTINE.
+func (s *Scrubber) Run(ctx context.Context, interval time.Duration, bytesPerSecond int64) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.pass(ctx, bytesPerSecond)
+		}
+	}
+}
+
+func (s *Scrubber) pass(ctx context.Context, bytesPerSecond int64) {
+	start := time.Now()
+	var checked, found int
+	for _, target := range s.targets {
+		files, corruptions, err := target.Verify(ctx, NewThrottle(bytesPerSecond))
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			s.logger.Error("Scrub failed", "target", target.Name(), "error", err)
+			continue
+		}
+		checked += files
+		found += len(corruptions)
+		for _, corruption := range corruptions {
+			s.logger.Error("Scrub found a damaged file; run VERIFY with QUARANTINE to move it aside",
+				"target", target.Name(), "file", corruption.File, "offset", corruption.Offset, "error", corruption.Err)
+		}
+	}
+	s.mu.Lock()
+	s.passes++
+	s.found += uint64(found) // #nosec G115 -- a count is never negative
+	s.mu.Unlock()
+	s.logger.Info("Scrub pass finished", "files", checked, "corrupt", found, "duration", time.Since(start))
+}
+
+// Stats returns the number of background passes finished and the damaged files they found.
+func (s *Scrubber) Stats() (passes, found uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.passes, s.found
+}
+
+// Verify runs one unthrottled pass over the named target, or over every target when name is empty, and quarantines what
+// it finds when asked to. The reply has a summary line per target followed by a line per damaged file.
+func (s *Scrubber) Verify(ctx context.Context, name string, quarantine bool) (protocol.Reply, error) {
+	targets := s.targets
+	if name != "" {
+		targets = nil
+		for _, target := range s.targets {
+			if strings.EqualFold(target.Name(), name) {
+				targets = append(targets, target)
+			}
+		}
+		if len(targets) == 0 {
+			return protocol.Reply{}, fmt.Errorf("nothing to verify for %s on this server (available: %s)",
+				name, strings.Join(s.names(), ", "))
+		}
+	}
+	if len(targets) == 0 {
+		return protocol.Reply{}, errors.New("this server keeps no files to verify")
+	}
+
+	var lines []string
+	for _, target := range targets {
+		files, corruptions, err := target.Verify(ctx, nil)
+		if err != nil {
+			return protocol.Reply{}, fmt.Errorf("verify %s: %w", target.Name(), err)
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d files checked, %d corrupt", target.Name(), files, len(corruptions)))
+		for _, corruption := range corruptions {
+			line := target.Name() + " " + filepath.Base(corruption.File) + " offset " +
+				strconv.FormatInt(corruption.Offset, 10) + ": " + corruption.Err.Error()
+			if quarantine {
+				note, quarantineErr := target.Quarantine(ctx, corruption)
+				if quarantineErr != nil {
+					line += "; not quarantined: " + quarantineErr.Error()
+				} else {
+					line += "; quarantined: " + note
+				}
+				s.logger.Warn("VERIFY quarantine", "target", target.Name(), "file", corruption.File,
+					"note", note, "error", quarantineErr)
+			}
+			lines = append(lines, line)
+		}
+	}
+	return protocol.BulkStringArray(lines), nil
+}
+
+func (s *Scrubber) names() []string {
+	names := make([]string, 0, len(s.targets))
+	for _, target := range s.targets {
+		names = append(names, target.Name())
+	}
+	return names
+}
+
+// Throttle paces reads to a byte rate. A nil Throttle does not limit. It is not safe for concurrent use: each pass
+// makes its own.
+type Throttle struct {
+	rate  float64 // bytes per second
+	start time.Time
+	read  int64
+}
+
+// NewThrottle returns a throttle allowing bytesPerSecond, or nil (unlimited) when it is not positive.
+func NewThrottle(bytesPerSecond int64) *Throttle {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &Throttle{rate: float64(bytesPerSecond)}
+}
+
+// Wait accounts for n bytes read and sleeps until the rate allows them, or until ctx is done.
+func (t *Throttle) Wait(ctx context.Context, n int) error {
+	if t == nil {
+		return ctx.Err()
+	}
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	t.read += int64(n)
+	due := t.start.Add(time.Duration(float64(t.read) / t.rate * float64(time.Second)))
+	delay := time.Until(due)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Reader wraps r so every read is paced by throttle and stops once ctx is done.
+func Reader(ctx context.Context, r io.Reader, throttle *Throttle) io.Reader {
+	return &throttledReader{ctx: ctx, r: r, throttle: throttle}
+}
+
+type throttledReader struct {
+	ctx      context.Context //nolint:containedctx // the reader is used within one verification call
+	r        io.Reader
+	throttle *Throttle
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if waitErr := t.throttle.Wait(t.ctx, n); waitErr != nil && err == nil {
+		err = waitErr
+	}
+	return n, err
+}
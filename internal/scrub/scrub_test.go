@@ -0,0 +1,161 @@
+package scrub_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfStack/db/internal/protocol"
+	"github.com/OutOfStack/db/internal/scrub"
+)
+
+type fakeTarget struct {
+	name        string
+	corruptions []scrub.Corruption
+	quarantined []string
+	passes      int
+}
+
+func (f *fakeTarget) Name() string { return f.name }
+
+func (f *fakeTarget) Verify(context.Context, *scrub.Throttle) (int, []scrub.Corruption, error) {
+	f.passes++
+	return 2, f.corruptions, nil
+}
+
+func (f *fakeTarget) Quarantine(_ context.Context, corruption scrub.Corruption) (string, error) {
+	if strings.HasSuffix(corruption.File, ".log") {
+		return "", errors.New("still being written")
+	}
+	f.quarantined = append(f.quarantined, corruption.File)
+	return "moved", nil
+}
+
+func TestVerifyReportsAndQuarantines(t *testing.T) {
+	t.Parallel()
+	tiered := &fakeTarget{name: "tiered", corruptions: []scrub.Corruption{
+		{File: "/data/seg-0000000002.data", Offset: 52, Err: errors.New("checksum mismatch")},
+	}}
+	wal := &fakeTarget{name: "wal", corruptions: []scrub.Corruption{
+		{File: "/wal/wal-00000000000000000009.log", Offset: 7, Err: errors.New("checksum mismatch")},
+	}}
+	s := scrub.New(slog.New(slog.DiscardHandler), tiered, wal)
+
+	reply, err := s.Verify(t.Context(), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"tiered: 2 files checked, 1 corrupt",
+		"tiered seg-0000000002.data offset 52: checksum mismatch",
+		"wal: 2 files checked, 1 corrupt",
+		"wal wal-00000000000000000009.log offset 7: checksum mismatch",
+	}
+	if got := lines(reply); !slices.Equal(got, want) {
+		t.Fatalf("Verify() = %q, want %q", got, want)
+	}
+	if len(tiered.quarantined) != 0 {
+		t.Fatal("Verify() quarantined without being asked to")
+	}
+
+	reply, err = s.Verify(t.Context(), "TIERED", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(lines(reply), "\n"); !strings.Contains(got, "quarantined: moved") || strings.Contains(got, "wal") {
+		t.Fatalf("Verify(tiered, quarantine) = %s", got)
+	}
+	if len(tiered.quarantined) != 1 || wal.passes != 1 {
+		t.Fatalf("quarantined %v with %d wal passes; want only the tiered segment", tiered.quarantined, wal.passes)
+	}
+
+	reply, err = s.Verify(t.Context(), "wal", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(lines(reply), "\n"); !strings.Contains(got, "not quarantined: still being written") {
+		t.Fatalf("Verify(wal, quarantine) = %s", got)
+	}
+
+	if _, err = s.Verify(t.Context(), "snapshot", false); err == nil || !strings.Contains(err.Error(), "tiered, wal") {
+		t.Fatalf("Verify(snapshot) error = %v, want the available targets", err)
+	}
+	if _, err = scrub.New(slog.New(slog.DiscardHandler)).Verify(t.Context(), "", false); err == nil {
+		t.Fatal("Verify() with no targets succeeded")
+	}
+}
+
+func lines(reply protocol.Reply) []string {
+	values := make([]string, 0, len(reply.Array))
+	for _, line := range reply.Array {
+		values = append(values, line.Value)
+	}
+	return values
+}
+
+func TestRunLogsDamage(t *testing.T) {
+	t.Parallel()
+	var logs bytes.Buffer
+	target := &fakeTarget{name: "wal", corruptions: []scrub.Corruption{
+		{File: "/wal/wal-00000000000000000001.log", Offset: 7, Err: errors.New("checksum mismatch")},
+	}}
+	s := scrub.New(slog.New(slog.NewTextHandler(&logs, nil)), target)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx, time.Millisecond, 0)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if passes, _ := s.Stats(); passes > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no scrub pass finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if passes, found := s.Stats(); found < passes {
+		t.Fatalf("Stats() = %d passes, %d found; want the damage counted every pass", passes, found)
+	}
+	if !strings.Contains(logs.String(), "wal-00000000000000000001.log") {
+		t.Fatalf("logs do not name the damaged file:\n%s", logs.String())
+	}
+	if len(target.quarantined) != 0 {
+		t.Fatal("a background pass quarantined a file")
+	}
+}
+
+func TestThrottlePacesReads(t *testing.T) {
+	t.Parallel()
+	throttle := scrub.NewThrottle(64 << 10)
+	start := time.Now()
+	n, err := io.Copy(io.Discard, scrub.Reader(t.Context(), bytes.NewReader(make([]byte, 16<<10)), throttle))
+	if err != nil || n != 16<<10 {
+		t.Fatalf("copy = %d, %v", n, err)
+	}
+	// 16 KiB at 64 KiB/s takes a quarter of a second
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("read 16 KiB in %v, want it paced to 64 KiB/s", elapsed)
+	}
+
+	if scrub.NewThrottle(0) != nil {
+		t.Fatal("NewThrottle(0) limits reads, want unlimited")
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	if err = scrub.NewThrottle(1).Wait(ctx, 1<<20); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait() on a canceled context = %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/OutOfStack/db/internal/network"
+	"github.com/OutOfStack/db/internal/parser"
+	"github.com/OutOfStack/db/internal/pool"
+	"github.com/OutOfStack/db/internal/protocol"
+)
+
+const (
+	commandTables  = "TABLES"
+	commandKeys    = "KEYS"
+	commandExists  = "EXISTS"
+	commandPing    = "PING"
+	commandDump    = "DUMP"
+	commandRestore = "RESTORE"
+)
+
+// Client spreads commands over independent shard groups, each a master/standby pool of its own. A table-scoped command
+// goes to the one group that owns its table (or table+key, see Config.By); TABLES, and KEYS, EXISTS and DUMP when tables
+// are split across groups, are sent to every group and their replies merged, and a RESTORE split across groups is split
+// up to match.
+type Client struct {
+	config *Config
+	shared *pool.PoolConfig
+	ring   *Ring
+	groups map[string]*pool.Client
+	names  []string // group names in config order, for fan-out
+	// options are the connection options of every group, kept for the connections Rebalance opens of its own
+	options []network.TCPClientOption
+}
+
+// NewClient creates a sharded client. shared carries the pool settings every group runs with; its servers are ignored.
+func NewClient(config *Config, shared *pool.PoolConfig, options ...network.TCPClientOption) (*Client, error) {
+	if !config.Enabled {
+		return nil, errors.New("invalid shard config: sharding is not enabled")
+	}
+	if err := config.Validate(shared); err != nil {
+		return nil, fmt.Errorf("invalid shard config: %w", err)
+	}
+
+	client := &Client{
+		config:  config,
+		shared:  shared,
+		groups:  make(map[string]*pool.Client, len(config.Groups)),
+		options: options,
+	}
+	for _, group := range config.Groups {
+		p, err := pool.NewClient(group.poolConfig(shared), options...)
+		if err != nil {
+			_ = client.Close()
+			return nil, fmt.Errorf("failed to create pool for shard group %s: %w", group.Name, err)
+		}
+		client.groups[group.Name] = p
+		client.names = append(client.names, group.Name)
+	}
+	client.ring = NewRing(client.names, config.virtualNodes())
+
+	return client, nil
+}
+
+// Send routes a command to the shard group that owns it, or to every group for the commands that span them. Admin
+// commands are refused, for the same reason a pool refuses them: they target one specific node. A DUMP or RESTORE that
+// is split across groups is checked by the parser first, since splitting it reads its arguments.
+func (c *Client) Send(ctx context.Context, cmd string, args []string) (protocol.Reply, error) {
+	if parser.IsAdmin(cmd) {
+		return protocol.Reply{}, fmt.Errorf("admin command %s cannot be sent through a sharded client; connect to the target server directly", cmd)
+	}
+
+	switch strings.ToUpper(strings.TrimSpace(cmd)) {
+	case commandTables:
+		return c.fanOutList(ctx, cmd, args)
+	case commandKeys:
+		if c.byKey() {
+			return c.fanOutList(ctx, cmd, args)
+		}
+	case commandExists:
+		if c.byKey() {
+			return c.fanOutExists(ctx, cmd, args)
+		}
+	case commandDump:
+		if c.byKey() {
+			if _, _, err := parser.New().Parse(cmd, args); err != nil {
+				return protocol.Reply{}, err
+			}
+			return c.fanOutDump(ctx, cmd, args)
+		}
+	case commandRestore:
+		if c.byKey() {
+			if _, _, err := parser.New().Parse(cmd, args); err != nil {
+				return protocol.Reply{}, err
+			}
+			return c.splitRestore(ctx, cmd, args)
+		}
+	case commandPing:
+		return c.fanOutPing(ctx, cmd, args)
+	}
+
+	return c.groups[c.Owner(args)].Send(ctx, cmd, args)
+}
+
+// Owner returns the name of the group that owns a table-scoped command's arguments (table first, then key). A command
+// without arguments, which no table-scoped command is, goes to the first group.
+func (c *Client) Owner(args []string) string {
+	switch {
+	case len(args) == 0:
+		return c.names[0]
+	case len(args) == 1 || !c.byKey():
+		return c.ring.Locate(args[0])
+	default:
+		return c.ring.Locate(placementKey(args[0], args[1]))
+	}
+}
+
+func (c *Client) byKey() bool {
+	return c.config.By == KeyKey
+}
+
+// placementKey is the string a table+key pair is hashed by. The NUL separator keeps ("ab", "c") and ("a", "bc") apart.
+func placementKey(table, key string) string {
+	return table + "\x00" + key
+}
+
+// fanOut sends the command to every group concurrently, so one slow group cannot delay the others, and returns the
+// replies in group order. It fails when any group fails or answers with an error, naming every group that did: a
+// partial TABLES or KEYS would silently hide data.
+func (c *Client) fanOut(ctx context.Context, cmd string, args []string) ([]protocol.Reply, error) {
+	replies := make([]protocol.Reply, len(c.names))
+	errs := make([]error, len(c.names))
+
+	var wg sync.WaitGroup
+	for i, name := range c.names {
+		wg.Go(func() {
+			reply, err := c.groups[name].Send(ctx, cmd, args)
+			if err == nil && reply.Kind == protocol.ReplyError {
+				err = fmt.Errorf("shard group %s: %s", name, reply.Value)
+			} else if err != nil {
+				err = fmt.Errorf("shard group %s: %w", name, err)
+			}
+			replies[i], errs[i] = reply, err
+		})
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return replies, nil
+}
+
+// fanOutList merges the string lists every group returns into one sorted list. A name reported by several groups (a
+// table split across them, or a key caught mid-rebalance) is listed once.
+func (c *Client) fanOutList(ctx context.Context, cmd string, args []string) (protocol.Reply, error) {
+	replies, err := c.fanOut(ctx, cmd, args)
+	if err != nil {
+		return protocol.Reply{}, err
+	}
+
+	var merged []string
+	for _, reply := range replies {
+		for _, elem := range reply.Array {
+			merged = append(merged, elem.Value)
+		}
+	}
+	slices.Sort(merged)
+	return protocol.BulkStringArray(slices.Compact(merged)), nil
+}
+
+// fanOutExists reports a table as existing when any group holds part of it
+func (c *Client) fanOutExists(ctx context.Context, cmd string, args []string) (protocol.Reply, error) {
+	replies, err := c.fanOut(ctx, cmd, args)
+	if err != nil {
+		return protocol.Reply{}, err
+	}
+	for _, reply := range replies {
+		if reply.Value == "true" {
+			return reply, nil
+		}
+	}
+	return replies[0], nil
+}
+
+// fanOutDump merges the DUMP pages of every group into one page of the whole table: the first keys of their union, as
+// many as the request asked for. Each group returned its own first keys after the cursor, so none of its keys before the
+// last one kept can be missing. A key caught mid-rebalance, on two groups at once, takes the value its owner holds.
+func (c *Client) fanOutDump(ctx context.Context, cmd string, args []string) (protocol.Reply, error) {
+	request, err := parser.ParseDump(args)
+	if err != nil {
+		return protocol.Reply{}, err
+	}
+	replies, err := c.fanOut(ctx, cmd, args)
+	if err != nil {
+		return protocol.Reply{}, err
+	}
+
+	values := make(map[string]string)
+	for i, reply := range replies {
+		for j := 0; j+1 < len(reply.Array); j += 2 {
+			key := reply.Array[j].Value
+			if _, seen := values[key]; !seen || c.Owner([]string{request.Table, key}) == c.names[i] {
+				values[key] = reply.Array[j+1].Value
+			}
+		}
+	}
+	keys := slices.Sorted(maps.Keys(values))
+	keys = keys[:min(len(keys), request.Count)]
+	page := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		page = append(page, key, values[key])
+	}
+	return protocol.BulkStringArray(page), nil
+}
+
+// splitRestore sends each group the RESTORE pairs it owns and replies with how many keys they stored in all. Groups are
+// written one after another, so when one fails, those before it have stored their share; repeating the RESTORE
+// overwrites it with the same values.
+func (c *Client) splitRestore(ctx context.Context, cmd string, args []string) (protocol.Reply, error) {
+	table := args[0]
+	batches := make(map[string][]string)
+	for i := 1; i+1 < len(args); i += 2 {
+		owner := c.Owner([]string{table, args[i]})
+		if batches[owner] == nil {
+			batches[owner] = []string{table}
+		}
+		batches[owner] = append(batches[owner], args[i], args[i+1])
+	}
+
+	var stored int64
+	for _, name := range c.names {
+		batch, ok := batches[name]
+		if !ok {
+			continue
+		}
+		reply, err := c.groups[name].Send(ctx, cmd, batch)
+		if err != nil {
+			return protocol.Reply{}, fmt.Errorf("shard group %s: %w", name, err)
+		}
+		if reply.Kind == protocol.ReplyError {
+			return reply, nil
+		}
+		stored += reply.Integer
+	}
+	return protocol.Integer(stored), nil
+}
+
+// fanOutPing checks every group, so a PING through a sharded client only succeeds when all of the data is reachable
+func (c *Client) fanOutPing(ctx context.Context, cmd string, args []string) (protocol.Reply, error) {
+	replies, err := c.fanOut(ctx, cmd, args)
+	if err != nil {
+		return protocol.Reply{}, err
+	}
+	return replies[0], nil
+}
+
+// Groups returns the pool of every shard group, keyed by group name
+func (c *Client) Groups() map[string]*pool.Client {
+	return maps.Clone(c.groups)
+}
+
+// Close closes every group's pool. It is safe to call more than once.
+func (c *Client) Close() error {
+	var errs []error
+	for name, p := range c.groups {
+		if err := p.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("shard group %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
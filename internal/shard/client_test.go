@@ -0,0 +1,295 @@
+package shard_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfStack/db/internal/compute"
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/migration"
+	"github.com/OutOfStack/db/internal/network"
+	"github.com/OutOfStack/db/internal/parser"
+	"github.com/OutOfStack/db/internal/pool"
+	"github.com/OutOfStack/db/internal/protocol"
+	"github.com/OutOfStack/db/internal/shard"
+	"github.com/OutOfStack/db/internal/storage"
+)
+
+// startServer starts an in-process database server on an ephemeral port and returns its address
+func startServer(t *testing.T) string {
+	t.Helper()
+	logger := slog.New(slog.DiscardHandler)
+	srv, err := network.NewTCPServer("127.0.0.1:0", logger)
+	if err != nil {
+		t.Fatalf("NewTCPServer: %v", err)
+	}
+	// Rebalance moves keys with MIGRATE, which needs the server's migrator
+	store := storage.New(engine.New())
+	migrator := migration.New(store, logger, migration.WithLocalAddress(srv.Addr().String()))
+	comp := compute.New(parser.New(), store, logger, compute.WithMigrator(migrator))
+	go func() {
+		_ = srv.Serve(func(ctx context.Context, cmd string, args []string) protocol.Reply {
+			res, rErr := comp.HandleRequest(ctx, cmd, args)
+			if rErr != nil {
+				if errors.Is(rErr, storage.ErrNotFound) {
+					return protocol.NullBulkString()
+				}
+				return protocol.Error(rErr.Error())
+			}
+			return res
+		})
+	}()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+		_ = migrator.Close()
+	})
+	return srv.Addr().String()
+}
+
+// groups starts one single-master group per name
+func groups(t *testing.T, names ...string) []shard.GroupConfig {
+	t.Helper()
+	out := make([]shard.GroupConfig, 0, len(names))
+	for _, name := range names {
+		out = append(out, shard.GroupConfig{
+			Name:    name,
+			Servers: []pool.ServerConfig{{Address: startServer(t), Role: pool.RoleMaster}},
+		})
+	}
+	return out
+}
+
+func newClient(t *testing.T, by shard.Key, groups []shard.GroupConfig) *shard.Client {
+	t.Helper()
+	shared := pool.DefaultPoolConfig()
+	shared.RetryDelay = time.Millisecond
+	client, err := shard.NewClient(&shard.Config{Enabled: true, By: by, Groups: groups}, shared)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func send(t *testing.T, client interface {
+	Send(context.Context, string, []string) (protocol.Reply, error)
+}, cmd string, args ...string) protocol.Reply {
+	t.Helper()
+	reply, err := client.Send(t.Context(), cmd, args)
+	if err != nil {
+		t.Fatalf("Send %s %v: %v", cmd, args, err)
+	}
+	if reply.Kind == protocol.ReplyError {
+		t.Fatalf("Send %s %v: error reply %s", cmd, args, reply.Value)
+	}
+	return reply
+}
+
+func values(reply protocol.Reply) []string {
+	out := make([]string, 0, len(reply.Array))
+	for _, elem := range reply.Array {
+		out = append(out, elem.Value)
+	}
+	return out
+}
+
+func TestClient_RoutesByTable(t *testing.T) {
+	t.Parallel()
+	client := newClient(t, shard.KeyTable, groups(t, "a", "b", "c"))
+
+	var tables []string
+	for i := range 30 {
+		table := "t" + strconv.Itoa(i)
+		tables = append(tables, table)
+		send(t, client, "SET", table, "k1", "v")
+		send(t, client, "SET", table, "k2", "42")
+	}
+
+	// every table lives whole on its owner and nowhere else
+	for _, table := range tables {
+		owner := client.Owner([]string{table})
+		for name, p := range client.Groups() {
+			keys := values(send(t, p, "KEYS", table))
+			if name == owner && !slices.Equal(keys, []string{"k1", "k2"}) {
+				t.Fatalf("owner %s of %s holds %v, want [k1 k2]", name, table, keys)
+			}
+			if name != owner && len(keys) != 0 {
+				t.Fatalf("group %s holds %v of %s, owned by %s", name, keys, table, owner)
+			}
+		}
+	}
+
+	slices.Sort(tables)
+	if got := values(send(t, client, "TABLES")); !slices.Equal(got, tables) {
+		t.Fatalf("TABLES = %v, want %v", got, tables)
+	}
+	if got := send(t, client, "GET", "t7", "k2"); got.Value != "42" {
+		t.Fatalf("GET = %q, want 42", got.Value)
+	}
+	if got := send(t, client, "EXISTS", "t7"); got.Value != "true" {
+		t.Fatalf("EXISTS = %q, want true", got.Value)
+	}
+}
+
+func TestClient_RoutesByKey(t *testing.T) {
+	t.Parallel()
+	client := newClient(t, shard.KeyKey, groups(t, "a", "b", "c"))
+
+	var keys []string
+	for i := range 60 {
+		key := "k" + strconv.Itoa(i)
+		keys = append(keys, key)
+		send(t, client, "SET", "users", key, key)
+	}
+
+	// the table is spread over the groups, and KEYS puts it back together
+	spread := 0
+	for _, p := range client.Groups() {
+		if len(values(send(t, p, "KEYS", "users"))) > 0 {
+			spread++
+		}
+	}
+	if spread < 2 {
+		t.Fatalf("table held by %d groups, want it spread", spread)
+	}
+
+	slices.Sort(keys)
+	if got := values(send(t, client, "KEYS", "users")); !slices.Equal(got, keys) {
+		t.Fatalf("KEYS = %v, want %v", got, keys)
+	}
+	if got := send(t, client, "EXISTS", "users"); got.Value != "true" {
+		t.Fatalf("EXISTS = %q, want true", got.Value)
+	}
+	if got := send(t, client, "EXISTS", "missing"); got.Value != "false" {
+		t.Fatalf("EXISTS missing = %q, want false", got.Value)
+	}
+	for _, key := range keys {
+		if got := send(t, client, "GET", "users", key); got.Value != key {
+			t.Fatalf("GET %s = %q", key, got.Value)
+		}
+	}
+	if got := send(t, client, "PING"); got.Value != "PONG" {
+		t.Fatalf("PING = %q, want PONG", got.Value)
+	}
+}
+
+// TestClient_DumpAndRestoreByKey checks a RESTORE of a table spread over groups stores each key on its owner, and DUMP
+// pages through the whole table in key order as if it lived on one server.
+func TestClient_DumpAndRestoreByKey(t *testing.T) {
+	t.Parallel()
+	client := newClient(t, shard.KeyKey, groups(t, "a", "b", "c"))
+
+	restore := []string{"users"}
+	var want []string
+	for i := range 30 {
+		key := fmt.Sprintf("k%02d", i)
+		restore = append(restore, key, strconv.Itoa(i))
+		want = append(want, key, strconv.Itoa(i))
+	}
+	if got := send(t, client, "RESTORE", restore...); got.Integer != 30 {
+		t.Fatalf("RESTORE stored %d keys, want 30", got.Integer)
+	}
+	for _, key := range []string{"k00", "k17"} {
+		owner := client.Owner([]string{"users", key})
+		if got := send(t, client.Groups()[owner], "GET", "users", key); got.Kind != protocol.ReplyBulkString {
+			t.Fatalf("owner %s of %s does not hold it: %+v", owner, key, got)
+		}
+	}
+
+	var got []string
+	after := ""
+	for {
+		page := values(send(t, client, "DUMP", "users", "AFTER", after, "COUNT", "7"))
+		if len(page) == 0 {
+			break
+		}
+		if len(page) > 14 {
+			t.Fatalf("DUMP COUNT 7 returned %d keys", len(page)/2)
+		}
+		got = append(got, page...)
+		after = page[len(page)-2]
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("DUMP pages = %v, want %v", got, want)
+	}
+}
+
+// TestClient_RejectsMalformedDumpAndRestore checks a DUMP or RESTORE split across groups fails with the parser's arity
+// error instead of reading arguments it was not given.
+func TestClient_RejectsMalformedDumpAndRestore(t *testing.T) {
+	t.Parallel()
+	client := newClient(t, shard.KeyKey, groups(t, "a", "b"))
+
+	for _, cmd := range []string{"DUMP", "RESTORE"} {
+		if _, err := client.Send(t.Context(), cmd, nil); err == nil || !strings.Contains(err.Error(), "requires") {
+			t.Fatalf("%s without arguments: err = %v, want the arity error", cmd, err)
+		}
+	}
+	if _, err := client.Send(t.Context(), "RESTORE", []string{"users", "k"}); err == nil {
+		t.Fatal("RESTORE with a key and no value: want error")
+	}
+}
+
+func TestClient_RejectsAdminCommands(t *testing.T) {
+	t.Parallel()
+	client := newClient(t, shard.KeyTable, groups(t, "a"))
+
+	if _, err := client.Send(t.Context(), "PROMOTE", nil); err == nil {
+		t.Fatal("PROMOTE through a sharded client: want error")
+	}
+}
+
+// TestClient_Rebalance verifies that after a group is added, Rebalance moves exactly the keys the new ring assigns to
+// it, keeping their types, and that every key reads back through the new topology.
+func TestClient_Rebalance(t *testing.T) {
+	t.Parallel()
+	existing := groups(t, "a", "b")
+	before := newClient(t, shard.KeyKey, existing)
+
+	const n = 200
+	for i := range n {
+		key := strconv.Itoa(i)
+		send(t, before, "SET", "t", "s"+key, `"`+key+`"`) // a string that reads like an int
+		send(t, before, "SET", "t", "i"+key, key)
+	}
+
+	after := newClient(t, shard.KeyKey, append(existing, groups(t, "c")...))
+	result, err := after.Rebalance(t.Context())
+	if err != nil {
+		t.Fatalf("Rebalance: %v", err)
+	}
+	if result.Scanned != 2*n {
+		t.Fatalf("Scanned = %d, want %d", result.Scanned, 2*n)
+	}
+	newKeys := len(values(send(t, after.Groups()["c"], "KEYS", "t")))
+	if result.Moved == 0 || result.Moved != newKeys {
+		t.Fatalf("Moved = %d, new group holds %d keys, want the same non-zero count", result.Moved, newKeys)
+	}
+
+	for i := range n {
+		key := strconv.Itoa(i)
+		if got := send(t, after, "TYPE", "t", "s"+key); got.Value != "string" {
+			t.Fatalf("TYPE s%s = %s, want string", key, got.Value)
+		}
+		if got := send(t, after, "TYPE", "t", "i"+key); got.Value != "int" {
+			t.Fatalf("TYPE i%s = %s, want int", key, got.Value)
+		}
+	}
+	if got := values(send(t, after, "KEYS", "t")); len(got) != 2*n {
+		t.Fatalf("KEYS returned %d keys, want %d", len(got), 2*n)
+	}
+
+	// a second run finds nothing left to move
+	if result, err = after.Rebalance(t.Context()); err != nil || result.Moved != 0 {
+		t.Fatalf("second Rebalance = %+v, %v, want nothing moved", result, err)
+	}
+}
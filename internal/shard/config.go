@@ -0,0 +1,98 @@
+package shard
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/OutOfStack/db/internal/pool"
+)
+
+// defaultVirtualNodes is how many points each shard gets on the ring when the config leaves it unset. A hundred or so
+// keeps the spread between shards within a few percent while the ring stays small enough to search in a few steps.
+const defaultVirtualNodes = 128
+
+// Key selects what a command is sharded by
+type Key string
+
+const (
+	KeyTable Key = "table" // Every key of a table lives on one shard, so KEYS and EXISTS reach a single shard
+	KeyKey   Key = "key"   // Each table+key pair is placed on its own, spreading large tables across shards
+)
+
+// GroupConfig is one shard: a master/standby group served by a pool of its own
+type GroupConfig struct {
+	Name    string              `yaml:"name"`
+	Servers []pool.ServerConfig `yaml:"servers"`
+}
+
+// Config is the configuration of a sharded client. The pool settings (strategy, retries, health checks...) are shared by
+// every group and come from the client's pool section; each group only brings its servers.
+type Config struct {
+	Enabled      bool          `yaml:"enabled"`
+	By           Key           `yaml:"by"`            // What commands are sharded by (default: table)
+	VirtualNodes int           `yaml:"virtual_nodes"` // Ring points per shard (0 = 128)
+	Groups       []GroupConfig `yaml:"groups"`
+}
+
+// DefaultConfig returns a Config with sensible defaults
+func DefaultConfig() *Config {
+	return &Config{
+		Enabled:      false,
+		By:           KeyTable,
+		VirtualNodes: defaultVirtualNodes,
+		Groups:       []GroupConfig{},
+	}
+}
+
+// Validate checks the sharding configuration, including the pool each group would run with the shared settings
+func (c *Config) Validate(shared *pool.PoolConfig) error {
+	if !c.Enabled {
+		return nil
+	}
+
+	if len(c.Groups) == 0 {
+		return errors.New("sharding enabled but no groups configured")
+	}
+
+	switch c.By {
+	case KeyTable, KeyKey, "":
+	default:
+		return fmt.Errorf("invalid shard key %q: must be 'table' or 'key'", c.By)
+	}
+
+	if c.VirtualNodes < 0 {
+		return errors.New("virtual_nodes cannot be negative")
+	}
+
+	names := make(map[string]struct{}, len(c.Groups))
+	for _, group := range c.Groups {
+		if group.Name == "" {
+			return errors.New("shard group name cannot be empty")
+		}
+		if _, dup := names[group.Name]; dup {
+			return errors.New("duplicate shard group name: " + group.Name)
+		}
+		names[group.Name] = struct{}{}
+
+		if err := group.poolConfig(shared).Validate(); err != nil {
+			return fmt.Errorf("shard group %s: %w", group.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// poolConfig returns the pool configuration of the group: the shared settings with the group's own servers
+func (g GroupConfig) poolConfig(shared *pool.PoolConfig) *pool.PoolConfig {
+	config := *shared
+	config.Enabled = true
+	config.Servers = g.Servers
+	return &config
+}
+
+func (c *Config) virtualNodes() int {
+	if c.VirtualNodes == 0 {
+		return defaultVirtualNodes
+	}
+	return c.VirtualNodes
+}
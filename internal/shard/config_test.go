@@ -0,0 +1,76 @@
+package shard_test
+
+import (
+	"testing"
+
+	"github.com/OutOfStack/db/internal/pool"
+	"github.com/OutOfStack/db/internal/shard"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	group := func(name, address string) shard.GroupConfig {
+		return shard.GroupConfig{Name: name, Servers: []pool.ServerConfig{{Address: address, Role: pool.RoleMaster}}}
+	}
+
+	tests := []struct {
+		name    string
+		config  *shard.Config
+		wantErr bool
+	}{
+		{
+			name:    "disabled is valid",
+			config:  &shard.Config{},
+			wantErr: false,
+		},
+		{
+			name:    "valid groups",
+			config:  &shard.Config{Enabled: true, By: shard.KeyKey, Groups: []shard.GroupConfig{group("a", "h:1"), group("b", "h:2")}},
+			wantErr: false,
+		},
+		{
+			name:    "no groups",
+			config:  &shard.Config{Enabled: true},
+			wantErr: true,
+		},
+		{
+			name:    "invalid shard key",
+			config:  &shard.Config{Enabled: true, By: "column", Groups: []shard.GroupConfig{group("a", "h:1")}},
+			wantErr: true,
+		},
+		{
+			name:    "negative virtual nodes",
+			config:  &shard.Config{Enabled: true, VirtualNodes: -1, Groups: []shard.GroupConfig{group("a", "h:1")}},
+			wantErr: true,
+		},
+		{
+			name:    "empty group name",
+			config:  &shard.Config{Enabled: true, Groups: []shard.GroupConfig{group("", "h:1")}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate group name",
+			config:  &shard.Config{Enabled: true, Groups: []shard.GroupConfig{group("a", "h:1"), group("a", "h:2")}},
+			wantErr: true,
+		},
+		{
+			name: "group without master",
+			config: &shard.Config{Enabled: true, Groups: []shard.GroupConfig{
+				{Name: "a", Servers: []pool.ServerConfig{{Address: "h:1", Role: pool.RoleStandby}}},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tt.config.Validate(pool.DefaultPoolConfig())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
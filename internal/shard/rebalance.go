@@ -0,0 +1,143 @@
+package shard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/OutOfStack/db/internal/network"
+	"github.com/OutOfStack/db/internal/pool"
+	"github.com/OutOfStack/db/internal/protocol"
+)
+
+// RebalanceResult reports what a rebalance did
+type RebalanceResult struct {
+	Scanned int // keys examined across all groups
+	Moved   int // keys copied to the group that now owns them and deleted from the one that held them
+}
+
+// Rebalance moves every key that sits on a group other than its owner under the current ring to that owner. Run it after
+// adding a group to the config: the new group's share of the keys is still on the groups that owned them before, and
+// reads routed by the new ring miss them until they have moved.
+//
+// Every group is listed before anything moves, so each key is examined once; the key names (not the values) of the
+// whole dataset are held in memory meanwhile. Each key is moved by a MIGRATE sent to the master of the group holding
+// it, which copies the value to the owner's master and deletes its own only if the key still holds the value copied:
+// a write landing on the old group mid-move is copied again rather than lost. So a rebalance that stops partway loses
+// nothing, and running it again picks up where it left off. A write sent to the owner, by a client already routing by
+// the new ring, before the key has moved is still overwritten by the copy, so rebalance while writes are paused.
+func (c *Client) Rebalance(ctx context.Context) (RebalanceResult, error) {
+	sources := make(map[string]*pool.Client, len(c.names))
+	admins := make(map[string]*network.TCPClient, len(c.names))
+	defer func() {
+		for _, source := range sources {
+			_ = source.Close()
+		}
+		for _, admin := range admins {
+			_ = admin.Close()
+		}
+	}()
+
+	listings := make(map[string]map[string][]string, len(c.names))
+	for _, name := range c.names {
+		// a pool over the master alone, so nothing is listed from a standby that has not caught up yet
+		master := c.masterConfig(name)
+		source, err := pool.NewClient(master, c.options...)
+		if err != nil {
+			return RebalanceResult{}, fmt.Errorf("shard group %s: %w", name, err)
+		}
+		sources[name] = source
+		// MIGRATE is an admin command, which a pool refuses, so it goes to the master over a connection of its own
+		admins[name] = network.NewTCPClient(master.Servers[0].Address, c.options...)
+
+		if listings[name], err = listGroup(ctx, source); err != nil {
+			return RebalanceResult{}, fmt.Errorf("shard group %s: %w", name, err)
+		}
+	}
+
+	var result RebalanceResult
+	for _, name := range c.names {
+		for table, keys := range listings[name] {
+			for _, key := range keys {
+				result.Scanned++
+				owner := c.Owner([]string{table, key})
+				if owner == name {
+					continue
+				}
+				moved, err := c.move(ctx, admins[name], owner, table, key)
+				if err != nil {
+					return result, fmt.Errorf("failed to move %s/%s from %s to %s: %w", table, key, name, owner, err)
+				}
+				if moved {
+					result.Moved++
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// listGroup returns the keys of every table a group holds
+func listGroup(ctx context.Context, source *pool.Client) (map[string][]string, error) {
+	tables, err := list(ctx, source, commandTables)
+	if err != nil {
+		return nil, err
+	}
+	listing := make(map[string][]string, len(tables))
+	for _, table := range tables {
+		if listing[table], err = list(ctx, source, commandKeys, table); err != nil {
+			return nil, err
+		}
+	}
+	return listing, nil
+}
+
+// masterConfig returns the pool configuration of a group reduced to its master
+func (c *Client) masterConfig(name string) *pool.PoolConfig {
+	var group GroupConfig
+	for _, g := range c.config.Groups {
+		if g.Name == name {
+			group = g
+		}
+	}
+	config := group.poolConfig(c.shared)
+	config.Servers = config.GetMasters()
+	config.SelectionStrategy = pool.StrategyMasterFirst
+	config.HealthCheckInterval = 0
+	config.HedgeDelay, config.HedgePercentile = 0, 0
+	return config
+}
+
+// move has the master holding a key migrate it to the master of its owner. It reports false for a key deleted since it
+// was listed.
+func (c *Client) move(ctx context.Context, source *network.TCPClient, to, table, key string) (bool, error) {
+	target := c.masterConfig(to).Servers[0].Address
+	reply, err := source.Send(ctx, "MIGRATE", []string{target, table, key})
+	if err != nil {
+		return false, err
+	}
+	switch reply.Kind {
+	case protocol.ReplyNull:
+		return false, nil
+	case protocol.ReplyError:
+		return false, errors.New(reply.Value)
+	default:
+		return true, nil
+	}
+}
+
+// list sends a command whose reply is a list of names
+func list(ctx context.Context, p *pool.Client, cmd string, args ...string) ([]string, error) {
+	reply, err := p.Send(ctx, cmd, args)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Kind == protocol.ReplyError {
+		return nil, errors.New(reply.Value)
+	}
+	names := make([]string, 0, len(reply.Array))
+	for _, elem := range reply.Array {
+		names = append(names, elem.Value)
+	}
+	return names, nil
+}
@@ -0,0 +1,66 @@
+package shard
+
+import (
+	"cmp"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Ring maps keys to shards by consistent hashing. Each shard is hashed onto the ring at several virtual points, and a
+// key belongs to the shard owning the first point at or after the key's hash. Adding a shard therefore only takes over
+// the keys between its new points and their predecessors, about 1/n of the data, and leaves every other key in place.
+type Ring struct {
+	points []point
+}
+
+type point struct {
+	hash  uint64
+	shard string
+}
+
+// NewRing builds a ring of the given shards with vnodes points each. The ring depends only on the shard names, not on
+// their order, so every client configured with the same shards routes every key the same way.
+func NewRing(shards []string, vnodes int) *Ring {
+	points := make([]point, 0, len(shards)*vnodes)
+	for _, shard := range shards {
+		for i := range vnodes {
+			points = append(points, point{hash: hash(shard + "#" + strconv.Itoa(i)), shard: shard})
+		}
+	}
+	// a collision between two shards' points is astronomically rare, but the winner must not depend on config order
+	slices.SortFunc(points, func(a, b point) int {
+		return cmp.Or(cmp.Compare(a.hash, b.hash), strings.Compare(a.shard, b.shard))
+	})
+	return &Ring{points: points}
+}
+
+// Locate returns the shard that owns key, or "" for an empty ring
+func (r *Ring) Locate(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	idx, _ := slices.BinarySearchFunc(r.points, hash(key), func(p point, h uint64) int { return cmp.Compare(p.hash, h) })
+	if idx == len(r.points) {
+		idx = 0 // past the last point the ring wraps around to the first
+	}
+	return r.points[idx].shard
+}
+
+func hash(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s)) // hash.Hash never returns an error
+	return mix(h.Sum64())
+}
+
+// mix scrambles an FNV hash (the splitmix64 finalizer). FNV alone clusters on inputs that differ only in their last
+// bytes, which is exactly what "name#0", "name#1"... do, and would leave the virtual points bunched on the ring.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,71 @@
+package shard_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/OutOfStack/db/internal/shard"
+)
+
+func TestRing_Deterministic(t *testing.T) {
+	t.Parallel()
+
+	a := shard.NewRing([]string{"s1", "s2", "s3"}, 64)
+	b := shard.NewRing([]string{"s3", "s1", "s2"}, 64)
+	for i := range 1000 {
+		key := "key" + strconv.Itoa(i)
+		if a.Locate(key) != b.Locate(key) {
+			t.Fatalf("key %s: %s vs %s, want placement independent of shard order", key, a.Locate(key), b.Locate(key))
+		}
+	}
+}
+
+func TestRing_Empty(t *testing.T) {
+	t.Parallel()
+
+	if got := shard.NewRing(nil, 64).Locate("key"); got != "" {
+		t.Fatalf("Locate on empty ring = %q, want empty", got)
+	}
+}
+
+func TestRing_Balance(t *testing.T) {
+	t.Parallel()
+
+	ring := shard.NewRing([]string{"s1", "s2", "s3", "s4"}, 128)
+	counts := make(map[string]int)
+	const keys = 40000
+	for i := range keys {
+		counts[ring.Locate("key"+strconv.Itoa(i))]++
+	}
+	// an even split is 10000 each; 128 virtual nodes keep every shard well within a third of that
+	for name, n := range counts {
+		if n < 6500 || n > 13500 {
+			t.Errorf("shard %s got %d of %d keys, want about a quarter: %v", name, n, keys, counts)
+		}
+	}
+}
+
+// TestRing_AddShardMovesOnlyItsShare verifies adding a shard moves keys only onto the new shard, about 1/n of them.
+func TestRing_AddShardMovesOnlyItsShare(t *testing.T) {
+	t.Parallel()
+
+	before := shard.NewRing([]string{"s1", "s2", "s3"}, 128)
+	after := shard.NewRing([]string{"s1", "s2", "s3", "s4"}, 128)
+
+	const keys = 20000
+	moved := 0
+	for i := range keys {
+		key := "key" + strconv.Itoa(i)
+		from, to := before.Locate(key), after.Locate(key)
+		if from == to {
+			continue
+		}
+		if to != "s4" {
+			t.Fatalf("key %s moved from %s to %s, want moves onto the new shard only", key, from, to)
+		}
+		moved++
+	}
+	if moved < keys/8 || moved > keys/3 {
+		t.Fatalf("%d of %d keys moved, want about a quarter", moved, keys)
+	}
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/parser"
+	"github.com/OutOfStack/db/internal/protocol"
+)
+
+const (
+	// maxDumpCursors bounds the key listings kept for DUMPs in progress; the least recently used is dropped past it
+	maxDumpCursors = 16
+	// dumpCursorTTL is how long a key listing is kept after its last page was read
+	dumpCursorTTL = time.Minute
+)
+
+// dumpCursor is the sorted key listing of a table being paged through by DUMP, and how far the pages got. The next page
+// carries on from it rather than listing and sorting the whole table again, so a full pass costs one listing.
+type dumpCursor struct {
+	keys []string
+	next int // index of the first key not returned yet
+	used time.Time
+}
+
+// dumpCursorKey finds the cursor of a DUMP in progress: the page asked for after the last key of the previous page
+type dumpCursorKey struct {
+	table string
+	after string
+}
+
+// dumpCursors are the cursors of the DUMPs in progress, by table and last key returned
+type dumpCursors struct {
+	mu     sync.Mutex
+	byPage map[dumpCursorKey]*dumpCursor
+}
+
+// take removes and returns the cursor that ended at after, if one is kept and has not expired
+func (c *dumpCursors) take(table, after string, now time.Time) (*dumpCursor, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := dumpCursorKey{table: table, after: after}
+	cursor, ok := c.byPage[key]
+	if !ok {
+		return nil, false
+	}
+	delete(c.byPage, key)
+	return cursor, now.Sub(cursor.used) < dumpCursorTTL
+}
+
+// put keeps cursor for the page after the key after, dropping expired cursors and, past maxDumpCursors, the least
+// recently used one
+func (c *dumpCursors) put(table, after string, cursor *dumpCursor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byPage == nil {
+		c.byPage = make(map[dumpCursorKey]*dumpCursor)
+	}
+	var oldest dumpCursorKey
+	var oldestUsed time.Time
+	for key, kept := range c.byPage {
+		if cursor.used.Sub(kept.used) >= dumpCursorTTL {
+			delete(c.byPage, key)
+		} else if oldestUsed.IsZero() || kept.used.Before(oldestUsed) {
+			oldest, oldestUsed = key, kept.used
+		}
+	}
+	if len(c.byPage) >= maxDumpCursors {
+		delete(c.byPage, oldest)
+	}
+	c.byPage[dumpCursorKey{table: table, after: after}] = cursor
+}
+
+// dump returns a page of a table for DUMP: the keys after the cursor in key order, each followed by its value as a
+// literal, which SET and RESTORE read back as the same value. The table is listed once, at the page a DUMP starts from,
+// and each later page asked for after the last key of the one before carries on from that listing: a key added
+// meanwhile is not in it, a key deleted meanwhile is skipped, and values are read as they stand when their page is.
+// Another AFTER key lists the table again.
+func (s *Storage) dump(ctx context.Context, args []string) (protocol.Reply, error) {
+	request, err := parser.ParseDump(args)
+	if err != nil {
+		return protocol.Reply{}, err
+	}
+	now := time.Now()
+	cursor, ok := s.cursors.take(request.Table, request.After, now)
+	if !ok {
+		keys := s.engine.Keys(ctx, request.Table)
+		start, found := slices.BinarySearch(keys, request.After)
+		if found {
+			start++
+		}
+		cursor = &dumpCursor{keys: keys, next: start}
+	}
+
+	page := make([]string, 0, 2*min(request.Count, len(cursor.keys)-cursor.next))
+	for ; cursor.next < len(cursor.keys) && len(page) < 2*request.Count; cursor.next++ {
+		key := cursor.keys[cursor.next]
+		stored, getErr := s.peek(ctx, request.Table, key)
+		if errors.Is(getErr, engine.ErrNotFound) {
+			continue // deleted since the listing
+		}
+		if getErr != nil {
+			return protocol.Reply{}, getErr
+		}
+		page = append(page, key, protocol.Literal(protocol.Decode(stored)))
+	}
+	if cursor.next < len(cursor.keys) && len(page) > 0 {
+		cursor.used = now
+		s.cursors.put(request.Table, page[len(page)-2], cursor)
+	}
+	return protocol.BulkStringArray(page), nil
+}
+
+// peek reads a value through the engine's Peek when it has one, and through Get otherwise
+func (s *Storage) peek(ctx context.Context, table, key string) (string, error) {
+	if peeker, ok := s.engine.(Peeker); ok {
+		return peeker.Peek(ctx, table, key)
+	}
+	return s.engine.Get(ctx, table, key)
+}
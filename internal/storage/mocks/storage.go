@@ -165,6 +165,264 @@ func (mr *MockEngineMockRecorder) Update(ctx, table, key, fn any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockEngine)(nil).Update), ctx, table, key, fn)
 }
 
+// MockSegmentEngine is a mock of SegmentEngine interface.
+type MockSegmentEngine struct {
+	ctrl     *gomock.Controller
+	recorder *MockSegmentEngineMockRecorder
+	isgomock struct{}
+}
+
+// MockSegmentEngineMockRecorder is the mock recorder for MockSegmentEngine.
+type MockSegmentEngineMockRecorder struct {
+	mock *MockSegmentEngine
+}
+
+// NewMockSegmentEngine creates a new mock instance.
+func NewMockSegmentEngine(ctrl *gomock.Controller) *MockSegmentEngine {
+	mock := &MockSegmentEngine{ctrl: ctrl}
+	mock.recorder = &MockSegmentEngineMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSegmentEngine) EXPECT() *MockSegmentEngineMockRecorder {
+	return m.recorder
+}
+
+// AppliedLSN mocks base method.
+func (m *MockSegmentEngine) AppliedLSN() uint64 {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AppliedLSN")
+	ret0, _ := ret[0].(uint64)
+	return ret0
+}
+
+// AppliedLSN indicates an expected call of AppliedLSN.
+func (mr *MockSegmentEngineMockRecorder) AppliedLSN() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppliedLSN", reflect.TypeOf((*MockSegmentEngine)(nil).AppliedLSN))
+}
+
+// Del mocks base method.
+func (m *MockSegmentEngine) Del(ctx context.Context, table, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Del", ctx, table, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Del indicates an expected call of Del.
+func (mr *MockSegmentEngineMockRecorder) Del(ctx, table, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Del", reflect.TypeOf((*MockSegmentEngine)(nil).Del), ctx, table, key)
+}
+
+// Freeze mocks base method.
+func (m *MockSegmentEngine) Freeze() (engine.SegmentSet, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Freeze")
+	ret0, _ := ret[0].(engine.SegmentSet)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Freeze indicates an expected call of Freeze.
+func (mr *MockSegmentEngineMockRecorder) Freeze() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Freeze", reflect.TypeOf((*MockSegmentEngine)(nil).Freeze))
+}
+
+// Get mocks base method.
+func (m *MockSegmentEngine) Get(ctx context.Context, table, key string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, table, key)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockSegmentEngineMockRecorder) Get(ctx, table, key any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockSegmentEngine)(nil).Get), ctx, table, key)
+}
+
+// HoldCompaction mocks base method.
+func (m *MockSegmentEngine) HoldCompaction() (func(), error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HoldCompaction")
+	ret0, _ := ret[0].(func())
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HoldCompaction indicates an expected call of HoldCompaction.
+func (mr *MockSegmentEngineMockRecorder) HoldCompaction() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HoldCompaction", reflect.TypeOf((*MockSegmentEngine)(nil).HoldCompaction))
+}
+
+// Keys mocks base method.
+func (m *MockSegmentEngine) Keys(ctx context.Context, table string) []string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Keys", ctx, table)
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// Keys indicates an expected call of Keys.
+func (mr *MockSegmentEngineMockRecorder) Keys(ctx, table any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Keys", reflect.TypeOf((*MockSegmentEngine)(nil).Keys), ctx, table)
+}
+
+// Range mocks base method.
+func (m *MockSegmentEngine) Range(fn func(string, string, string) bool) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Range", fn)
+}
+
+// Range indicates an expected call of Range.
+func (mr *MockSegmentEngineMockRecorder) Range(fn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Range", reflect.TypeOf((*MockSegmentEngine)(nil).Range), fn)
+}
+
+// Replace mocks base method.
+func (m *MockSegmentEngine) Replace(entries []engine.Entry) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Replace", entries)
+}
+
+// Replace indicates an expected call of Replace.
+func (mr *MockSegmentEngineMockRecorder) Replace(entries any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Replace", reflect.TypeOf((*MockSegmentEngine)(nil).Replace), entries)
+}
+
+// ReplaceSegments mocks base method.
+func (m *MockSegmentEngine) ReplaceSegments(dir string, lsn uint64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReplaceSegments", dir, lsn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReplaceSegments indicates an expected call of ReplaceSegments.
+func (mr *MockSegmentEngineMockRecorder) ReplaceSegments(dir, lsn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReplaceSegments", reflect.TypeOf((*MockSegmentEngine)(nil).ReplaceSegments), dir, lsn)
+}
+
+// Set mocks base method.
+func (m *MockSegmentEngine) Set(ctx context.Context, table, key, value string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Set", ctx, table, key, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Set indicates an expected call of Set.
+func (mr *MockSegmentEngineMockRecorder) Set(ctx, table, key, value any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Set", reflect.TypeOf((*MockSegmentEngine)(nil).Set), ctx, table, key, value)
+}
+
+// SyncLSN mocks base method.
+func (m *MockSegmentEngine) SyncLSN() (uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SyncLSN")
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SyncLSN indicates an expected call of SyncLSN.
+func (mr *MockSegmentEngineMockRecorder) SyncLSN() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SyncLSN", reflect.TypeOf((*MockSegmentEngine)(nil).SyncLSN))
+}
+
+// TableExists mocks base method.
+func (m *MockSegmentEngine) TableExists(ctx context.Context, table string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TableExists", ctx, table)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// TableExists indicates an expected call of TableExists.
+func (mr *MockSegmentEngineMockRecorder) TableExists(ctx, table any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TableExists", reflect.TypeOf((*MockSegmentEngine)(nil).TableExists), ctx, table)
+}
+
+// Tables mocks base method.
+func (m *MockSegmentEngine) Tables(ctx context.Context) []string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Tables", ctx)
+	ret0, _ := ret[0].([]string)
+	return ret0
+}
+
+// Tables indicates an expected call of Tables.
+func (mr *MockSegmentEngineMockRecorder) Tables(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Tables", reflect.TypeOf((*MockSegmentEngine)(nil).Tables), ctx)
+}
+
+// Update mocks base method.
+func (m *MockSegmentEngine) Update(ctx context.Context, table, key string, fn func(string, bool) (string, error)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, table, key, fn)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockSegmentEngineMockRecorder) Update(ctx, table, key, fn any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockSegmentEngine)(nil).Update), ctx, table, key, fn)
+}
+
+// MockKeyCounter is a mock of KeyCounter interface.
+type MockKeyCounter struct {
+	ctrl     *gomock.Controller
+	recorder *MockKeyCounterMockRecorder
+	isgomock struct{}
+}
+
+// MockKeyCounterMockRecorder is the mock recorder for MockKeyCounter.
+type MockKeyCounterMockRecorder struct {
+	mock *MockKeyCounter
+}
+
+// NewMockKeyCounter creates a new mock instance.
+func NewMockKeyCounter(ctrl *gomock.Controller) *MockKeyCounter {
+	mock := &MockKeyCounter{ctrl: ctrl}
+	mock.recorder = &MockKeyCounterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockKeyCounter) EXPECT() *MockKeyCounterMockRecorder {
+	return m.recorder
+}
+
+// KeyCounts mocks base method.
+func (m *MockKeyCounter) KeyCounts(ctx context.Context) map[string]int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "KeyCounts", ctx)
+	ret0, _ := ret[0].(map[string]int)
+	return ret0
+}
+
+// KeyCounts indicates an expected call of KeyCounts.
+func (mr *MockKeyCounterMockRecorder) KeyCounts(ctx any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "KeyCounts", reflect.TypeOf((*MockKeyCounter)(nil).KeyCounts), ctx)
+}
+
 // MockWAL is a mock of WAL interface.
 type MockWAL struct {
 	ctrl     *gomock.Controller
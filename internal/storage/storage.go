@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/info"
 	"github.com/OutOfStack/db/internal/protocol"
 	"github.com/OutOfStack/db/internal/wal"
 )
@@ -19,8 +22,13 @@ var (
 	// ErrReadOnly is returned for mutating commands on a replication standby. It maps to the "ERR readonly" wire reply so
 	// a pool client can re-route the write to a master.
 	ErrReadOnly = errors.New("readonly")
+	// ErrTransferConflict is returned by Transfer when the key was written to every time its value was being sent
+	ErrTransferConflict = errors.New("key kept changing while it was being transferred")
 )
 
+// maxTransferAttempts is how many times Transfer sends a key that is written to while it is being sent
+const maxTransferAttempts = 3
+
 // Engine is an interface for a storage engine
 type Engine interface {
 	Set(ctx context.Context, table, key, value string) error
@@ -37,6 +45,35 @@ type Engine interface {
 	Replace(entries []engine.Entry)
 }
 
+// SegmentEngine is an Engine whose durable state is its own set of segment files (the tiered engine). With a WAL beside
+// it as the replication log, it stamps each record with the mutation's LSN (engine.WithLSN), so it knows how far into
+// the log it is; it takes the place of snapshots, and a standby is resynced by shipping its files.
+type SegmentEngine interface {
+	Engine
+	// AppliedLSN returns the highest LSN the engine holds.
+	AppliedLSN() uint64
+	// SyncLSN makes the engine's files durable and returns the highest LSN they hold.
+	SyncLSN() (uint64, error)
+	// HoldCompaction waits out a running compaction pass and keeps new ones from starting until release is called.
+	HoldCompaction() (release func(), err error)
+	// Freeze captures the segment files for shipping; the set must be released.
+	Freeze() (engine.SegmentSet, error)
+	// ReplaceSegments swaps all state for the segment files in dir, shipped at lsn.
+	ReplaceSegments(dir string, lsn uint64) error
+}
+
+// Peeker is an Engine with a read that leaves its cache as it was: DUMP reads through it when the engine has it, so
+// paging through a table neither caches what it reads nor counts as use.
+type Peeker interface {
+	Peek(ctx context.Context, table, key string) (string, error)
+}
+
+// KeyCounter is an Engine that counts the keys of every table without listing them. INFO uses it when the engine has
+// it, and lists each table's keys when it does not.
+type KeyCounter interface {
+	KeyCounts(ctx context.Context) map[string]int
+}
+
 // WAL is the persistence stream used for mutating commands.
 type WAL interface {
 	Append(ctx context.Context, command string, args []string) (uint64, error)
@@ -71,11 +108,13 @@ func WithReadOnly(readOnly bool) Option {
 type Storage struct {
 	engine Engine
 	wal    WAL
-	// mu serializes snapshots (write lock) against mutations (read lock); many mutations may run concurrently so their WAL
-	// appends can be group-committed. It also serializes Promote's gate swap against in-flight mutations.
+	// mu serializes snapshots and transfers (write lock) against mutations (read lock); many mutations may run
+	// concurrently so their WAL appends can be group-committed. It also serializes Promote's gate swap against in-flight
+	// mutations.
 	mu       sync.RWMutex
 	gate     *applyGate
 	readOnly atomic.Bool
+	cursors  dumpCursors
 }
 
 // New returns a new Storage instance
@@ -163,8 +202,41 @@ func captureState(source SnapshotSource) captured {
 	return entries
 }
 
+// Timing breaks down the time a command spent in Execute: waiting for its WAL append to be durable, waiting at the
+// apply gate for the mutations logged before it, and the rest, spent in the engine. A caller that wants it passes one
+// in the context (WithTiming); commands that do not log leave WAL and Gate zero.
+type Timing struct {
+	WAL    time.Duration
+	Gate   time.Duration
+	Engine time.Duration
+}
+
+type timingKey struct{}
+
+// WithTiming returns a context in which Execute records the breakdown of the command's time into timing.
+func WithTiming(ctx context.Context, timing *Timing) context.Context {
+	return context.WithValue(ctx, timingKey{}, timing)
+}
+
+// timingFrom returns the Timing carried by ctx, or nil.
+func timingFrom(ctx context.Context) *Timing {
+	timing, _ := ctx.Value(timingKey{}).(*Timing)
+	return timing
+}
+
 // Execute executes the given command with arguments and returns the result or an error
 func (s *Storage) Execute(ctx context.Context, cmd string, args []string) (protocol.Reply, error) {
+	timing := timingFrom(ctx)
+	if timing == nil {
+		return s.execute(ctx, cmd, args)
+	}
+	start := time.Now()
+	reply, err := s.execute(ctx, cmd, args)
+	timing.Engine = max(time.Since(start)-timing.WAL-timing.Gate, 0)
+	return reply, err
+}
+
+func (s *Storage) execute(ctx context.Context, cmd string, args []string) (protocol.Reply, error) {
 	switch cmd {
 	case "SET":
 		return s.literalMutation(ctx, wal.CommandSet, args)
@@ -188,6 +260,10 @@ func (s *Storage) Execute(ctx context.Context, cmd string, args []string) (proto
 		return protocol.BulkString(fmtBool(s.engine.TableExists(ctx, args[0]))), nil
 	case "KEYS":
 		return protocol.BulkStringArray(s.engine.Keys(ctx, args[0])), nil
+	case "DUMP":
+		return s.dump(ctx, args)
+	case "RESTORE":
+		return s.restore(ctx, args)
 	default:
 		return protocol.Reply{}, nil
 	}
@@ -251,6 +327,26 @@ func (s *Storage) valueType(ctx context.Context, args []string) (protocol.Reply,
 	return protocol.SimpleString(protocol.Decode(stored).Kind.String()), nil
 }
 
+// restore stores the key/value pairs of RESTORE, each logged and applied as a SET, and replies with how many it stored.
+// Every literal is parsed before the first is stored, so a malformed one fails the batch without applying part of it.
+func (s *Storage) restore(ctx context.Context, args []string) (protocol.Reply, error) {
+	table := args[0]
+	encoded := make([]string, 0, len(args)/2)
+	for i := 2; i < len(args); i += 2 {
+		value, err := protocol.ParseLiteral(args[i])
+		if err != nil {
+			return protocol.Reply{}, fmt.Errorf("key %s: %w", args[i-1], err)
+		}
+		encoded = append(encoded, protocol.Encode(value))
+	}
+	for i, value := range encoded {
+		if _, err := s.mutation(ctx, wal.CommandSet, []string{table, args[2*i+1], value}); err != nil {
+			return protocol.Reply{}, fmt.Errorf("restored %d of %d keys: %w", i, len(encoded), err)
+		}
+	}
+	return protocol.Integer(int64(len(encoded))), nil
+}
+
 func (s *Storage) load(ctx context.Context, table, key string) (string, error) {
 	value, err := s.engine.Get(ctx, table, key)
 	if err != nil {
@@ -265,7 +361,7 @@ func (s *Storage) load(ctx context.Context, table, key string) (string, error) {
 // mutation logs encoded arguments before applying them to the engine.
 func (s *Storage) mutation(ctx context.Context, cmd string, args []string) (protocol.Reply, error) {
 	var reply protocol.Reply
-	err := s.mutate(ctx, cmd, args, func() error {
+	err := s.mutate(ctx, cmd, args, func(ctx context.Context) error {
 		var applyErr error
 		reply, applyErr = Apply(ctx, s.engine, cmd, args)
 		return applyErr
@@ -281,23 +377,101 @@ func (s *Storage) mutation(ctx context.Context, cmd string, args []string) (prot
 
 // mutate durably logs a mutation, then applies it to the engine. When the WAL is enabled, appends run concurrently
 // (under the shared read lock) so the writer can group-commit them, while the apply gate replays them into the engine
-// in LSN order.
-func (s *Storage) mutate(ctx context.Context, command string, args []string, apply func() error) error {
+// in LSN order. apply receives ctx carrying the mutation's LSN (engine.WithLSN).
+func (s *Storage) mutate(
+	ctx context.Context,
+	command string,
+	args []string,
+	apply func(context.Context) error,
+) error {
 	if s.readOnly.Load() {
 		return ErrReadOnly
 	}
-	if s.wal == nil {
-		return apply()
-	}
 
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
+	if s.wal == nil {
+		return apply(ctx)
+	}
+	timing := timingFrom(ctx)
+	start := time.Now()
 	lsn, err := s.wal.Append(ctx, command, args)
 	if err != nil {
 		return err
 	}
-	return s.gate.run(lsn, apply)
+	logged := time.Now()
+	return s.gate.run(lsn, func() error {
+		if timing != nil {
+			timing.WAL = logged.Sub(start)
+			timing.Gate = time.Since(logged)
+		}
+		return apply(engine.WithLSN(ctx, lsn))
+	})
+}
+
+// Transfer hands one stored value to send and, once send returns nil, deletes the key through the WAL like a DEL, so
+// standbys and recovery see the delete. send is expected to return only when another server holds the value; if it
+// fails the key is left in place. Nothing is locked while send runs, so writes go on during the round trip; the key is
+// only deleted if it still holds the value sent, and one written to meanwhile is sent again, up to
+// maxTransferAttempts times, before Transfer gives up with ErrTransferConflict. A key deleted while it was being sent
+// is ErrNotFound, and the target keeps the copy it was sent. Reads keep seeing the value until the delete.
+func (s *Storage) Transfer(
+	ctx context.Context,
+	table, key string,
+	send func(context.Context, protocol.Value) error,
+) error {
+	for range maxTransferAttempts {
+		if s.readOnly.Load() {
+			return ErrReadOnly
+		}
+		stored, err := s.load(ctx, table, key)
+		if err != nil {
+			return err
+		}
+		if err = send(ctx, protocol.Decode(stored)); err != nil {
+			return err
+		}
+		deleted, err := s.deleteIfUnchanged(ctx, table, key, stored)
+		if err != nil || deleted {
+			return err
+		}
+	}
+	return ErrTransferConflict
+}
+
+// deleteIfUnchanged deletes key through the WAL like a DEL if it still holds stored, and reports whether it did.
+// Mutations are paused from the comparison to the delete, so no write can land between them and be lost with the key.
+func (s *Storage) deleteIfUnchanged(ctx context.Context, table, key, stored string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// checked under the lock, which Promote also takes, so the check cannot race a promotion
+	if s.readOnly.Load() {
+		return false, ErrReadOnly
+	}
+	current, err := s.load(ctx, table, key)
+	if errors.Is(err, ErrNotFound) || (err == nil && current != stored) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	args := []string{table, key}
+	apply := func(ctx context.Context) error {
+		_, applyErr := Apply(ctx, s.engine, wal.CommandDel, args)
+		return applyErr
+	}
+	if s.wal == nil {
+		return true, apply(ctx)
+	}
+	lsn, err := s.wal.Append(ctx, wal.CommandDel, args)
+	if err != nil {
+		return false, err
+	}
+	// with the write lock held no other mutation is between its append and its apply, so lsn is next at the gate
+	return true, s.gate.run(lsn, func() error { return apply(engine.WithLSN(ctx, lsn)) })
 }
 
 // ReadOnly reports whether mutating commands are currently rejected.
@@ -325,7 +499,7 @@ func (s *Storage) ApplyReplicated(ctx context.Context, record wal.Record) error
 	if err := s.wal.AppendRecord(ctx, record); err != nil {
 		return err
 	}
-	return ApplyReplay(ctx, s.engine, record.Command, record.Args)
+	return ApplyReplay(engine.WithLSN(ctx, record.LSN), s.engine, record.Command, record.Args)
 }
 
 // ResetToSnapshot replaces all state with a snapshot received during resync: it persists the snapshot, resets the WAL
@@ -334,6 +508,11 @@ func (s *Storage) ResetToSnapshot(ctx context.Context, dir string, lsn uint64, e
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if _, ok := s.engine.(SegmentEngine); ok {
+		return errors.New("master sent a snapshot, but this standby's engine resyncs from segment files: " +
+			"master and standby must run the same engine type")
+	}
+
 	// Reset the WAL before publishing the snapshot. If we crash between the two, recovery falls back to the previous
 	// snapshot plus an empty WAL and re-syncs — safe. The reverse order would leave a high-LSN snapshot alongside old
 	// low-LSN segments, so the reopened writer appends a non-contiguous tail that recovery refuses.
@@ -347,6 +526,97 @@ func (s *Storage) ResetToSnapshot(ctx context.Context, dir string, lsn uint64, e
 	return nil
 }
 
+// ShipSegments freezes the segment files of a SegmentEngine at the current log position and hands them to fn with that
+// LSN: the files hold every mutation up to it, and the log holds the ones after. Mutations are paused only while the set
+// is frozen, not while fn reads it.
+func (s *Storage) ShipSegments(ctx context.Context, fn func(context.Context, uint64, engine.SegmentSet) error) error {
+	segmented, ok := s.engine.(SegmentEngine)
+	if !ok || s.wal == nil {
+		return errors.New("engine has no segment files to ship")
+	}
+
+	// a compaction pass can run for long under its rate limit, so it is waited out before s.mu is taken: under the lock
+	// Freeze only pins the files, and writes stall no longer than that
+	release, err := segmented.HoldCompaction()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	lsn := s.wal.LastLSN()
+	set, err := segmented.Freeze()
+	s.mu.Unlock()
+	release()
+	if err != nil {
+		return err
+	}
+	defer set.Release()
+	return fn(ctx, lsn, set)
+}
+
+// ResetToSegments replaces all state with the segment files in dir, shipped by a master during resync at lsn. As in
+// ResetToSnapshot the WAL is reset first: a crash before the engine swap leaves the old segments and an empty log, and
+// the standby simply resyncs again. A crash during the swap leaves it marked in progress, and the engine reopens empty
+// at LSN 0, so the standby asks for its whole history and is resynced again too.
+func (s *Storage) ResetToSegments(ctx context.Context, dir string, lsn uint64) error {
+	segmented, ok := s.engine.(SegmentEngine)
+	if !ok {
+		return errors.New("master sent segment files, but this standby's engine has none: " +
+			"master and standby must run the same engine type")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.wal.Reset(ctx, lsn); err != nil {
+		return err
+	}
+	return segmented.ReplaceSegments(dir, lsn)
+}
+
+// PruneLog drops the WAL records a SegmentEngine already holds durably and returns the LSN pruned up to. It is what a
+// snapshot does for the in-memory engine, without writing one: the segments are the snapshot. The newest record is
+// always kept, so a restarted master can still tell a standby that is caught up from one that needs a resync.
+func (s *Storage) PruneLog(ctx context.Context) (uint64, error) {
+	segmented, ok := s.engine.(SegmentEngine)
+	if !ok || s.wal == nil {
+		return 0, nil
+	}
+	lsn, err := segmented.SyncLSN()
+	if err != nil {
+		return 0, err
+	}
+	if last := s.wal.LastLSN(); lsn >= last {
+		lsn = max(last, 1) - 1
+	}
+	return lsn, s.wal.Prune(ctx, lsn)
+}
+
+// Info reports the keyspace section of INFO: the number of tables and keys, then the keys of each table as
+// table_<name>:keys=<n>, in table order.
+func (s *Storage) Info(ctx context.Context) info.Section {
+	var counts map[string]int
+	if counter, ok := s.engine.(KeyCounter); ok {
+		counts = counter.KeyCounts(ctx)
+	} else {
+		counts = make(map[string]int)
+		for _, table := range s.engine.Tables(ctx) {
+			counts[table] = len(s.engine.Keys(ctx, table))
+		}
+	}
+	tables := slices.Sorted(maps.Keys(counts))
+	total := 0
+	for _, table := range tables {
+		total += counts[table]
+	}
+
+	section := info.Section{Name: "keyspace"}
+	section.Add("tables", len(tables))
+	section.Add("keys", total)
+	for _, table := range tables {
+		section.Add("table_"+table, fmt.Sprintf("keys=%d", counts[table]))
+	}
+	return section
+}
+
 // entrySource adapts recovered entries to the wal.SnapshotSource interface.
 type entrySource []engine.Entry
 
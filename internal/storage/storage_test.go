@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/info"
 	"github.com/OutOfStack/db/internal/protocol"
 	"github.com/OutOfStack/db/internal/storage"
 	mocks "github.com/OutOfStack/db/internal/storage/mocks"
@@ -65,7 +66,7 @@ func TestStorage_WALBeforeMutation(t *testing.T) {
 		appended = true
 		return 1, nil
 	}}
-	mockEngine.EXPECT().Set(ctx, "t", "k", encoded("v")).DoAndReturn(func(context.Context, string, string, string) error {
+	mockEngine.EXPECT().Set(engine.WithLSN(ctx, 1), "t", "k", encoded("v")).DoAndReturn(func(context.Context, string, string, string) error {
 		assert.True(t, appended, "engine mutation happened before WAL append")
 		return nil
 	})
@@ -86,6 +87,33 @@ func TestStorage_WALFailurePreventsMutation(t *testing.T) {
 	assert.Empty(t, result)
 }
 
+// TestStorage_Timing checks Execute splits a mutation's time into its WAL append, its wait at the apply gate and the
+// engine, and a read's into the engine alone.
+func TestStorage_Timing(t *testing.T) {
+	t.Parallel()
+	const delay = 20 * time.Millisecond
+	eng := engine.New()
+	log := &fakeWAL{append: func(context.Context, string, []string) (uint64, error) {
+		time.Sleep(delay)
+		return 1, nil
+	}}
+	store := storage.New(eng, storage.WithWAL(log))
+
+	var timing storage.Timing
+	_, err := store.Execute(storage.WithTiming(t.Context(), &timing), "SET", []string{"t", "k", "v"})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, timing.WAL, delay)
+	assert.Less(t, timing.Gate, delay)
+	assert.Less(t, timing.Engine, delay)
+
+	timing = storage.Timing{}
+	_, err = store.Execute(storage.WithTiming(t.Context(), &timing), "GET", []string{"t", "k"})
+	require.NoError(t, err)
+	assert.Zero(t, timing.WAL)
+	assert.Zero(t, timing.Gate)
+	assert.Positive(t, timing.Engine)
+}
+
 // TestStorage_ConcurrentMutationsApplyInLSNOrder verifies that when many mutations append concurrently (so the WAL can
 // group-commit them), they still land in the engine in LSN order: the surviving value is the highest-LSN write.
 func TestStorage_ConcurrentMutationsApplyInLSNOrder(t *testing.T) {
@@ -332,8 +360,208 @@ func TestStorage_Promote(t *testing.T) {
 	store.Promote()
 	require.False(t, store.ReadOnly())
 
-	mockEngine.EXPECT().Set(ctx, "t", "k", encoded("v")).Return(nil)
+	mockEngine.EXPECT().Set(engine.WithLSN(ctx, 6), "t", "k", encoded("v")).Return(nil)
 	res, err := store.Execute(ctx, "SET", []string{"t", "k", "v"})
 	require.NoError(t, err)
 	assert.Equal(t, "OK", res.Value)
 }
+
+func TestStorage_Transfer(t *testing.T) {
+	t.Parallel()
+	ctx := t.Context()
+	var logged []string
+	log := &fakeWAL{append: func(_ context.Context, command string, args []string) (uint64, error) {
+		logged = append(logged, command+" "+args[0]+" "+args[1])
+		return uint64(len(logged)), nil
+	}}
+	store := storage.New(engine.New(), storage.WithWAL(log))
+	_, err := store.Execute(ctx, "SET", []string{"users", "u1", "42"})
+	require.NoError(t, err)
+
+	// a failed send leaves the key in place and logs nothing
+	sendErr := errors.New("target unreachable")
+	err = store.Transfer(ctx, "users", "u1", func(context.Context, protocol.Value) error { return sendErr })
+	require.ErrorIs(t, err, sendErr)
+	res, err := store.Execute(ctx, "GET", []string{"users", "u1"})
+	require.NoError(t, err)
+	assert.Equal(t, "42", res.Value)
+
+	var sent protocol.Value
+	err = store.Transfer(ctx, "users", "u1", func(_ context.Context, value protocol.Value) error {
+		sent = value
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, protocol.IntValue(42), sent)
+	assert.Equal(t, []string{wal.CommandSet + " users u1", wal.CommandDel + " users u1"}, logged)
+	_, err = store.Execute(ctx, "GET", []string{"users", "u1"})
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	err = store.Transfer(ctx, "users", "u1", func(context.Context, protocol.Value) error { return nil })
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+// TestStorage_TransferConcurrentWrite writes to the key while its value is being sent: the key is not deleted with the
+// write in it, the new value is sent again, and a key that changes on every attempt is given up on.
+func TestStorage_TransferConcurrentWrite(t *testing.T) {
+	t.Parallel()
+	ctx := t.Context()
+	store := storage.New(engine.New())
+	_, err := store.Execute(ctx, "SET", []string{"users", "u1", "1"})
+	require.NoError(t, err)
+
+	var sent []protocol.Value
+	err = store.Transfer(ctx, "users", "u1", func(_ context.Context, value protocol.Value) error {
+		sent = append(sent, value)
+		if len(sent) == 1 {
+			// no lock is held during the send, so this write does not deadlock
+			_, setErr := store.Execute(ctx, "SET", []string{"users", "u1", "2"})
+			return setErr
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []protocol.Value{protocol.IntValue(1), protocol.IntValue(2)}, sent)
+	_, err = store.Execute(ctx, "GET", []string{"users", "u1"})
+	require.ErrorIs(t, err, storage.ErrNotFound)
+
+	_, err = store.Execute(ctx, "SET", []string{"users", "u2", "0"})
+	require.NoError(t, err)
+	attempts := 0
+	err = store.Transfer(ctx, "users", "u2", func(context.Context, protocol.Value) error {
+		attempts++
+		_, setErr := store.Execute(ctx, "INCR", []string{"users", "u2"})
+		return setErr
+	})
+	require.ErrorIs(t, err, storage.ErrTransferConflict)
+	assert.Equal(t, 3, attempts)
+	res, err := store.Execute(ctx, "GET", []string{"users", "u2"})
+	require.NoError(t, err)
+	assert.Equal(t, "3", res.Value)
+}
+
+func TestStorage_TransferReadOnly(t *testing.T) {
+	t.Parallel()
+	store := storage.New(engine.New(), storage.WithReadOnly(true))
+	err := store.Transfer(t.Context(), "users", "u1", func(context.Context, protocol.Value) error {
+		t.Fatal("send called on a read-only storage")
+		return nil
+	})
+	require.ErrorIs(t, err, storage.ErrReadOnly)
+}
+
+// TestStorage_Info verifies the keyspace section, from the engine's own counts and, for an engine without them, from
+// its key lists.
+func TestStorage_Info(t *testing.T) {
+	t.Parallel()
+	ctx := t.Context()
+	want := []info.Field{
+		{Name: "tables", Value: "2"},
+		{Name: "keys", Value: "3"},
+		{Name: "table_a", Value: "keys=2"},
+		{Name: "table_b", Value: "keys=1"},
+	}
+
+	memory := engine.New()
+	for _, tk := range [][2]string{{"b", "x"}, {"a", "x"}, {"a", "y"}} {
+		require.NoError(t, memory.Set(ctx, tk[0], tk[1], "v"))
+	}
+	section := storage.New(memory).Info(ctx)
+	assert.Equal(t, "keyspace", section.Name)
+	assert.Equal(t, want, section.Fields)
+
+	mockEngine := mocks.NewMockEngine(gomock.NewController(t))
+	mockEngine.EXPECT().Tables(ctx).Return([]string{"a", "b"})
+	mockEngine.EXPECT().Keys(ctx, "a").Return([]string{"x", "y"})
+	mockEngine.EXPECT().Keys(ctx, "b").Return([]string{"x"})
+	assert.Equal(t, want, storage.New(mockEngine).Info(ctx).Fields)
+}
+
+// TestStorage_DumpCursor pages through a table while it is written to: the table is listed once for the whole pass, a
+// key deleted meanwhile is skipped without shortening the page, and a DUMP from another key lists the table again.
+func TestStorage_DumpCursor(t *testing.T) {
+	t.Parallel()
+	ctx := t.Context()
+	eng := &listingEngine{Engine: engine.New()}
+	store := storage.New(eng)
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		_, err := store.Execute(ctx, "SET", []string{"t", key, "1"})
+		require.NoError(t, err)
+	}
+
+	dump := func(after string) []string {
+		t.Helper()
+		reply, err := store.Execute(ctx, "DUMP", []string{"t", "AFTER", after, "COUNT", "2"})
+		require.NoError(t, err)
+		var keys []string
+		for i := 0; i < len(reply.Array); i += 2 {
+			keys = append(keys, reply.Array[i].Value)
+		}
+		return keys
+	}
+	assert.Equal(t, []string{"a", "b"}, dump(""))
+	_, err := store.Execute(ctx, "DEL", []string{"t", "c"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"d", "e"}, dump("b"))
+	assert.Equal(t, []string{"f"}, dump("e"))
+	assert.Equal(t, 1, eng.listings)
+
+	assert.Equal(t, []string{"e", "f"}, dump("d"))
+	assert.Equal(t, 2, eng.listings)
+}
+
+// listingEngine counts how often a table's keys are listed
+type listingEngine struct {
+	*engine.Engine
+	listings int
+}
+
+func (e *listingEngine) Keys(ctx context.Context, table string) []string {
+	e.listings++
+	return e.Engine.Keys(ctx, table)
+}
+
+// TestStorage_DumpRestore copies a table page by page with DUMP into another storage with RESTORE, and checks every
+// value keeps its type and a malformed literal fails its batch before any of it is stored.
+func TestStorage_DumpRestore(t *testing.T) {
+	t.Parallel()
+	ctx := t.Context()
+	source := storage.New(engine.New())
+	for key, literal := range map[string]string{"a": "42", "b": "42.0", "c": `"42"`, "d": `[1,{"x":true}]`, "e": "text"} {
+		_, err := source.Execute(ctx, "SET", []string{"t", key, literal})
+		require.NoError(t, err)
+	}
+	target := storage.New(engine.New())
+
+	var pages [][]string
+	after := ""
+	for {
+		reply, err := source.Execute(ctx, "DUMP", []string{"t", "AFTER", after, "COUNT", "2"})
+		require.NoError(t, err)
+		if len(reply.Array) == 0 {
+			break
+		}
+		page := make([]string, 0, len(reply.Array))
+		for _, item := range reply.Array {
+			page = append(page, item.Value)
+		}
+		pages = append(pages, page)
+		reply, err = target.Execute(ctx, "RESTORE", append([]string{"t"}, page...))
+		require.NoError(t, err)
+		assert.Equal(t, protocol.Integer(int64(len(page)/2)), reply)
+		after = page[len(page)-2]
+	}
+	assert.Equal(t, [][]string{{"a", "42", "b", "42.0"}, {"c", `"42"`, "d", `[1,{"x":true}]`}, {"e", `"text"`}}, pages)
+	for key, kind := range map[string]string{"a": "int", "b": "float", "c": "string", "d": "array", "e": "string"} {
+		reply, err := target.Execute(ctx, "TYPE", []string{"t", key})
+		require.NoError(t, err)
+		assert.Equal(t, kind, reply.Value, key)
+	}
+
+	_, err := target.Execute(ctx, "RESTORE", []string{"t", "x", "1", "y", "[broken"})
+	require.ErrorContains(t, err, "key y")
+	_, err = target.Execute(ctx, "GET", []string{"t", "x"})
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	_, err = storage.New(engine.New(), storage.WithReadOnly(true)).Execute(ctx, "RESTORE", []string{"t", "x", "1"})
+	require.ErrorIs(t, err, storage.ErrReadOnly)
+}
@@ -0,0 +1,336 @@
+// Package transfer copies tables between a server and a file of JSON lines, one key per line: Export pages through
+// tables with DUMP, Import writes them back in batches with RESTORE. Each line holds the table, the key and the value
+// as its literal, which JSON reads natively, so a value keeps its type (42, 42.0 and "42" stay an int, a float and a
+// string) and the file does not depend on the engine or the data directory it came from.
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/OutOfStack/db/client"
+	"github.com/OutOfStack/db/internal/scrub"
+)
+
+// DefaultBatch is the keys per DUMP page, and the keys per RESTORE, when a Config leaves Batch at 0
+const DefaultBatch = 100
+
+// Record is one key as a line of the file holds it. Value is a literal, as client.Entry carries it.
+type Record struct {
+	Table string
+	Key   string
+	Value string
+}
+
+// line is the JSON form of a Record. The value is embedded as JSON rather than as the literal's text, so the file
+// reads naturally; a literal that is not valid JSON (a NaN or infinite float) is written as a string, which is also
+// what the server reads it back as.
+type line struct {
+	Table string          `json:"table"`
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Encode returns record as one line of the file, newline included
+func Encode(record Record) ([]byte, error) {
+	value := json.RawMessage(record.Value)
+	if !json.Valid(value) {
+		quoted, err := json.Marshal(record.Value)
+		if err != nil {
+			return nil, err
+		}
+		value = quoted
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(line{Table: record.Table, Key: record.Key, Value: value}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode reads one line of the file, with or without its newline
+func Decode(data []byte) (Record, error) {
+	var l line
+	if err := json.Unmarshal(data, &l); err != nil {
+		return Record{}, err
+	}
+	if l.Table == "" || l.Key == "" {
+		return Record{}, errors.New("table and key must not be empty")
+	}
+	if len(l.Value) == 0 {
+		return Record{}, errors.New("value is missing")
+	}
+	var value bytes.Buffer
+	if err := json.Compact(&value, l.Value); err != nil {
+		return Record{}, err
+	}
+	return Record{Table: l.Table, Key: l.Key, Value: value.String()}, nil
+}
+
+// Config controls an Export or an Import
+type Config struct {
+	// Tables are path.Match patterns a table must match one of to be copied; empty copies every table
+	Tables []string
+	// Batch is the keys per DUMP page or per RESTORE; 0 is DefaultBatch
+	Batch int
+	// Rate caps the bytes of the file written or read per second; 0 is unlimited
+	Rate int64
+}
+
+func (c Config) batch() int {
+	if c.Batch <= 0 {
+		return DefaultBatch
+	}
+	return c.Batch
+}
+
+// ParsePatterns splits a comma-separated list of table patterns, as the tools take it, and rejects a malformed one,
+// which path.Match would otherwise only report as a table that matches nothing
+func ParsePatterns(list string) ([]string, error) {
+	var patterns []string
+	for pattern := range strings.SplitSeq(list, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("table pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func (c Config) selected(table string) bool {
+	if len(c.Tables) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(c.Tables, func(pattern string) bool {
+		matched, err := path.Match(pattern, table)
+		return err == nil && matched
+	})
+}
+
+// Export writes the selected tables to w, in table then key order, and returns the number of keys written. A
+// non-zero after resumes an earlier export that stopped after that record: tables before its table and keys up to
+// its key are skipped. Each page is read as the table stands, so an export of tables that are being written is not a
+// copy as of a single moment.
+func Export(ctx context.Context, c *client.Client, w io.Writer, cfg Config, after Record) (int, error) {
+	tables, err := c.Tables(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("list tables: %w", err)
+	}
+	throttle := scrub.NewThrottle(cfg.Rate)
+	written := 0
+	for _, table := range tables {
+		if !cfg.selected(table) || table < after.Table {
+			continue
+		}
+		cursor := ""
+		if table == after.Table {
+			cursor = after.Key
+		}
+		n, tErr := exportTable(ctx, c, w, cfg.batch(), throttle, table, cursor)
+		written += n
+		if tErr != nil {
+			return written, fmt.Errorf("export table %s: %w", table, tErr)
+		}
+	}
+	return written, nil
+}
+
+func exportTable(ctx context.Context, c *client.Client, w io.Writer, batch int, throttle *scrub.Throttle, table,
+	cursor string) (int, error) {
+	written := 0
+	for {
+		page, err := c.Dump(ctx, table, cursor, batch)
+		if err != nil {
+			return written, err
+		}
+		for _, entry := range page {
+			data, eErr := Encode(Record{Table: table, Key: entry.Key, Value: entry.Value})
+			if eErr != nil {
+				return written, fmt.Errorf("key %s: %w", entry.Key, eErr)
+			}
+			if err = throttle.Wait(ctx, len(data)); err != nil {
+				return written, err
+			}
+			if _, err = w.Write(data); err != nil {
+				return written, err
+			}
+			written++
+		}
+		if len(page) < batch {
+			return written, nil
+		}
+		cursor = page[len(page)-1].Key
+	}
+}
+
+// Import restores the records of r that belong to the selected tables, after skipping the first skip lines. It
+// returns the number of keys restored and the number of lines done with: restored, filtered out or skipped. On an
+// error the records up to done are stored, so an import run again with skip set to done carries on where this one
+// stopped; running it again from the start stores the same values again.
+func Import(ctx context.Context, c *client.Client, r io.Reader, cfg Config, skip int) (restored int64, done int,
+	err error) {
+	reader := bufio.NewReader(r)
+	throttle := scrub.NewThrottle(cfg.Rate)
+	batch := importBatch{client: c, size: cfg.batch()}
+	for lineNo := 1; ; lineNo++ {
+		data, readErr := reader.ReadBytes('\n')
+		if errors.Is(readErr, io.EOF) && len(bytes.TrimSpace(data)) == 0 {
+			break
+		}
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return batch.restored, batch.done, readErr
+		}
+		if err = throttle.Wait(ctx, len(data)); err != nil {
+			return batch.restored, batch.done, err
+		}
+		if lineNo <= skip {
+			batch.skip()
+			continue
+		}
+		record, dErr := Decode(data)
+		if dErr != nil {
+			// store the lines before it, so the skip count an import run again starts from is this line
+			err = errors.Join(fmt.Errorf("line %d: %w", lineNo, dErr), batch.flush(ctx))
+			return batch.restored, batch.done, err
+		}
+		if !cfg.selected(record.Table) {
+			batch.skip()
+			continue
+		}
+		if err = batch.add(ctx, record); err != nil {
+			return batch.restored, batch.done, err
+		}
+	}
+	if err = batch.flush(ctx); err != nil {
+		return batch.restored, batch.done, err
+	}
+	return batch.restored, batch.done, nil
+}
+
+// importBatch collects consecutive records of one table into a RESTORE. done counts the lines behind the last RESTORE
+// that succeeded; lines skipped while a batch is pending count once it is sent.
+type importBatch struct {
+	client   *client.Client
+	size     int
+	table    string
+	entries  []client.Entry
+	pending  int // lines since done, including the batched ones
+	restored int64
+	done     int
+}
+
+func (b *importBatch) skip() {
+	if len(b.entries) == 0 {
+		b.done++
+		return
+	}
+	b.pending++
+}
+
+func (b *importBatch) add(ctx context.Context, record Record) error {
+	if record.Table != b.table || len(b.entries) == b.size {
+		if err := b.flush(ctx); err != nil {
+			return err
+		}
+		b.table = record.Table
+	}
+	b.entries = append(b.entries, client.Entry{Key: record.Key, Value: record.Value})
+	b.pending++
+	return nil
+}
+
+func (b *importBatch) flush(ctx context.Context) error {
+	if len(b.entries) == 0 {
+		return nil
+	}
+	n, err := b.client.Restore(ctx, b.table, b.entries)
+	if err != nil {
+		return fmt.Errorf("restore table %s: %w", b.table, err)
+	}
+	b.restored += n
+	b.done += b.pending
+	b.entries, b.pending = b.entries[:0], 0
+	return nil
+}
+
+// Resume prepares the export file at path to be continued: it drops a line cut short at the end, which is what an
+// export that was stopped mid-write leaves, and returns the last record that was written in full. The record is zero
+// when the file is missing or empty, and the file is created then.
+func Resume(path string) (*os.File, Record, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600) // #nosec G304 -- the operator names the export file
+	if err != nil {
+		return nil, Record{}, err
+	}
+	record, err := lastRecord(file)
+	if err != nil {
+		return nil, Record{}, errors.Join(err, file.Close())
+	}
+	return file, record, nil
+}
+
+// lastRecord truncates file after its last newline, reads back the line before it and leaves the offset at the end
+func lastRecord(file *os.File) (Record, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return Record{}, err
+	}
+	end, err := lastNewline(file, info.Size())
+	if err != nil {
+		return Record{}, err
+	}
+	end++ // keep the newline; -1 when there is none truncates everything
+	if err = file.Truncate(end); err != nil {
+		return Record{}, err
+	}
+	if _, err = file.Seek(end, io.SeekStart); err != nil {
+		return Record{}, err
+	}
+	if end == 0 {
+		return Record{}, nil
+	}
+	start, err := lastNewline(file, end-1)
+	if err != nil {
+		return Record{}, err
+	}
+	data := make([]byte, end-start-1)
+	if _, err = file.ReadAt(data, start+1); err != nil {
+		return Record{}, err
+	}
+	record, err := Decode(data)
+	if err != nil {
+		return Record{}, fmt.Errorf("last line of %s: %w", file.Name(), err)
+	}
+	return record, nil
+}
+
+// lastNewline returns the offset of the last newline in the first size bytes of file, or -1 when there is none
+func lastNewline(file *os.File, size int64) (int64, error) {
+	const chunk = 64 << 10
+	buf := make([]byte, chunk)
+	for end := size; end > 0; {
+		start := max(end-chunk, 0)
+		part := buf[:end-start]
+		if _, err := file.ReadAt(part, start); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(part, '\n'); i >= 0 {
+			return start + int64(i), nil
+		}
+		end = start
+	}
+	return -1, nil
+}
@@ -0,0 +1,194 @@
+package transfer_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfStack/db/client"
+	"github.com/OutOfStack/db/internal/compute"
+	"github.com/OutOfStack/db/internal/engine"
+	"github.com/OutOfStack/db/internal/network"
+	"github.com/OutOfStack/db/internal/parser"
+	"github.com/OutOfStack/db/internal/protocol"
+	"github.com/OutOfStack/db/internal/storage"
+	"github.com/OutOfStack/db/internal/transfer"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	t.Parallel()
+	for _, tt := range []struct{ value, line string }{
+		{`"42"`, `{"table":"t","key":"k","value":"42"}`},
+		{"42", `{"table":"t","key":"k","value":42}`},
+		{"2.0", `{"table":"t","key":"k","value":2.0}`},
+		{`{"a":[1,"<b>"]}`, `{"table":"t","key":"k","value":{"a":[1,"<b>"]}}`},
+		{"NaN", `{"table":"t","key":"k","value":"NaN"}`},
+	} {
+		data, err := transfer.Encode(transfer.Record{Table: "t", Key: "k", Value: tt.value})
+		if err != nil || string(data) != tt.line+"\n" {
+			t.Fatalf("Encode(%s) = %q, %v; want %q", tt.value, data, err, tt.line)
+		}
+	}
+
+	record, err := transfer.Decode([]byte(`{"table":"t", "key":"k", "value": [1, 2.5, "x"]}`))
+	if err != nil || record != (transfer.Record{Table: "t", Key: "k", Value: `[1,2.5,"x"]`}) {
+		t.Fatalf("Decode() = %+v, %v", record, err)
+	}
+	for _, data := range []string{`{"table":"t","key":"k"}`, `{"key":"k","value":1}`, `{"table":"t","key":"k","value":`} {
+		if _, err = transfer.Decode([]byte(data)); err == nil {
+			t.Errorf("Decode(%s) error = nil, want one", data)
+		}
+	}
+}
+
+// TestExportImport copies tables from one server to another through a file and checks the values keep their types,
+// that table patterns select what is copied, and that an import stopped by a bad line carries on with the skip count
+// it reported.
+func TestExportImport(t *testing.T) {
+	t.Parallel()
+	ctx := t.Context()
+	src := newClient(t)
+	for _, set := range [][3]string{
+		{"users", "a", `"42"`}, {"users", "b", "42"}, {"users", "c", "2.0"}, {"users", "d", `{"tags":["x",true]}`},
+		{"orders", "1", "[1,2]"}, {"logs", "x", "plain text"},
+	} {
+		if err := src.Set(ctx, set[0], set[1], set[2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	cfg := transfer.Config{Tables: []string{"users", "ord*"}, Batch: 3}
+	n, err := transfer.Export(ctx, src, &out, cfg, transfer.Record{})
+	if err != nil || n != 5 {
+		t.Fatalf("Export() = %d, %v; want 5", n, err)
+	}
+	want := `{"table":"orders","key":"1","value":[1,2]}
+{"table":"users","key":"a","value":"42"}
+{"table":"users","key":"b","value":42}
+{"table":"users","key":"c","value":2.0}
+{"table":"users","key":"d","value":{"tags":["x",true]}}
+`
+	if out.String() != want {
+		t.Fatalf("Export() wrote\n%s\nwant\n%s", out.String(), want)
+	}
+
+	var rest bytes.Buffer
+	if n, err = transfer.Export(ctx, src, &rest, cfg, transfer.Record{Table: "users", Key: "b"}); err != nil || n != 2 {
+		t.Fatalf("Export() after users/b = %d, %v; want 2", n, err)
+	}
+	if !strings.HasPrefix(rest.String(), `{"table":"users","key":"c"`) {
+		t.Fatalf("Export() after users/b wrote %s", rest.String())
+	}
+
+	dst := newClient(t)
+	input := strings.Replace(want, "\n{\"table\":\"users\",\"key\":\"c\"", "\nnot json\n{\"table\":\"users\",\"key\":\"c\"", 1)
+	restored, done, err := transfer.Import(ctx, dst, strings.NewReader(input), transfer.Config{Batch: 2}, 0)
+	if err == nil || !strings.Contains(err.Error(), "line 4") || restored != 3 || done != 3 {
+		t.Fatalf("Import() of a bad line = %d, %d, %v; want 3 restored, 3 done and an error at line 4", restored,
+			done, err)
+	}
+	input = strings.Replace(input, "not json", `{"table":"logs","key":"y","value":1}`, 1)
+	restored, done, err = transfer.Import(ctx, dst, strings.NewReader(input), transfer.Config{Tables: []string{"users"}},
+		done)
+	if err != nil || restored != 2 || done != 6 {
+		t.Fatalf("Import() with skip = %d, %d, %v; want 2 restored, 6 done", restored, done, err)
+	}
+
+	for key, kind := range map[string]string{"a": "string", "b": "int", "c": "float", "d": "map"} {
+		if got, tErr := dst.Type(ctx, "users", key); tErr != nil || got != kind {
+			t.Errorf("Type(users %s) = %q, %v; want %q", key, got, tErr, kind)
+		}
+	}
+	if _, gErr := dst.Get(ctx, "logs", "y"); !errors.Is(gErr, client.ErrNotFound) {
+		t.Errorf("Get(logs y) error = %v, want ErrNotFound: the table was filtered out", gErr)
+	}
+}
+
+// TestResume checks a line cut short at the end of an export file is dropped and the record before it returned.
+func TestResume(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "export.jsonl")
+
+	file, record, err := transfer.Resume(path)
+	if err != nil || record != (transfer.Record{}) {
+		t.Fatalf("Resume() of a missing file = %+v, %v", record, err)
+	}
+	if err = file.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	complete := `{"table":"t","key":"a","value":1}` + "\n" + `{"table":"t","key":"b","value":"x"}` + "\n"
+	if err = os.WriteFile(path, []byte(complete+`{"table":"t","ke`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, record, err = transfer.Resume(path)
+	if err != nil || record != (transfer.Record{Table: "t", Key: "b", Value: `"x"`}) {
+		t.Fatalf("Resume() = %+v, %v; want t/b", record, err)
+	}
+	if _, err = file.WriteString(`{"table":"t","key":"c","value":2}` + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err = file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != complete+`{"table":"t","key":"c","value":2}`+"\n" {
+		t.Fatalf("file after Resume() = %q, %v", data, err)
+	}
+}
+
+func TestParsePatterns(t *testing.T) {
+	t.Parallel()
+	patterns, err := transfer.ParsePatterns(" users, log_*,,")
+	if err != nil || len(patterns) != 2 || patterns[0] != "users" || patterns[1] != "log_*" {
+		t.Fatalf("ParsePatterns() = %q, %v; want [users log_*]", patterns, err)
+	}
+	if _, err = transfer.ParsePatterns("users,[a-"); err == nil {
+		t.Fatal("ParsePatterns() of a malformed pattern error = nil, want one")
+	}
+}
+
+// newClient starts an in-process server and returns a client connected to it
+func newClient(t *testing.T) *client.Client {
+	t.Helper()
+	logger := slog.New(slog.DiscardHandler)
+	srv, err := network.NewTCPServer("127.0.0.1:0", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comp := compute.New(parser.New(), storage.New(engine.New()), logger)
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(func(ctx context.Context, cmd string, args []string) protocol.Reply {
+			res, rErr := comp.HandleRequest(ctx, cmd, args)
+			if rErr != nil {
+				if errors.Is(rErr, storage.ErrNotFound) {
+					return protocol.NullBulkString()
+				}
+				return protocol.Error(rErr.Error())
+			}
+			return res
+		})
+	}()
+	c, err := client.New(client.WithAddress(srv.Addr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = c.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if sErr := srv.Shutdown(ctx); sErr != nil {
+			t.Errorf("Shutdown: %v", sErr)
+		}
+		<-done
+	})
+	return c
+}
@@ -0,0 +1,350 @@
+package wal
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// archiveCompressedSuffix is added to the name of an archived file that is gzipped.
+const archiveCompressedSuffix = ".gz"
+
+// ArchiveConfig says where a WAL keeps copies of the segments and snapshots it is about to delete, so the log can be
+// replayed later to any point it covered (see ReplayArchive). An empty Dir turns archiving off. With Compress the
+// copies are gzipped and their names get a ".gz" suffix.
+type ArchiveConfig struct {
+	Dir      string
+	Compress bool
+}
+
+// ArchiveSnapshot copies the snapshot at lsn in dir into the archive. The server calls it for every snapshot it
+// writes, before pruning the segments the snapshot covers.
+func ArchiveSnapshot(dir string, lsn uint64, archive ArchiveConfig) error {
+	if archive.Dir == "" {
+		return nil
+	}
+	if err := archive.copyFile(filepath.Join(dir, snapshotFilename(lsn))); err != nil {
+		return fmt.Errorf("archive snapshot: %w", err)
+	}
+	return nil
+}
+
+// archiveSegments copies into the archive the sealed segments a prune up to uptoLSN removes, and returns the numbers
+// of those it copied. It runs outside the writer goroutine, so appends do not wait for the copies: sealed segments no
+// longer change. The segment being appended to is left to prune, which copies it in the writer goroutine, where no
+// append runs alongside; copied here, it could end in a record half written. So is a segment sealed after the listing.
+func (w *Writer) archiveSegments(uptoLSN uint64) (map[uint64]struct{}, error) {
+	archived := make(map[uint64]struct{})
+	if w.config.Archive.Dir == "" {
+		return archived, nil
+	}
+	segments, err := listNumberedFiles(w.config.Dir, WALPrefix, WALSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("list WAL segments for archive: %w", err)
+	}
+	for index := 0; index+1 < len(segments); index++ {
+		if segments[index+1].number > uptoLSN+1 {
+			break
+		}
+		if err = w.config.Archive.copyFile(segments[index].path); err != nil {
+			return nil, fmt.Errorf("archive WAL segment: %w", err)
+		}
+		archived[segments[index].number] = struct{}{}
+	}
+	return archived, nil
+}
+
+// archiveRemoved copies segment into the archive before prune removes it, unless archiveSegments already did
+func (w *Writer) archiveRemoved(segment numberedFile, archived map[uint64]struct{}) error {
+	if w.config.Archive.Dir == "" {
+		return nil
+	}
+	if _, ok := archived[segment.number]; ok {
+		return nil
+	}
+	if err := w.config.Archive.copyFile(segment.path); err != nil {
+		return fmt.Errorf("archive WAL segment: %w", err)
+	}
+	return nil
+}
+
+// copyFile copies src into the archive under its own name, replacing an earlier copy. The copy is written to a
+// temporary file and renamed into place, so the archive never holds a partial copy under a real name.
+func (a ArchiveConfig) copyFile(src string) error {
+	if err := os.MkdirAll(a.Dir, 0o750); err != nil {
+		return fmt.Errorf("create archive directory: %w", err)
+	}
+	name := filepath.Base(src)
+	if a.Compress {
+		name += archiveCompressedSuffix
+	}
+	source, err := os.Open(src) // #nosec G304 -- src comes from the WAL directory listing
+	if err != nil {
+		return err
+	}
+	defer func() { _ = source.Close() }()
+	temporary, err := os.CreateTemp(a.Dir, name+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	temporaryName := temporary.Name()
+	defer func() { _ = os.Remove(temporaryName) }()
+
+	if err = a.write(temporary, source); err != nil {
+		_ = temporary.Close()
+		return err
+	}
+	if err = temporary.Sync(); err != nil {
+		_ = temporary.Close()
+		return err
+	}
+	if err = temporary.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(temporaryName, filepath.Join(a.Dir, name)); err != nil {
+		return err
+	}
+	return SyncDirectory(a.Dir)
+}
+
+func (a ArchiveConfig) write(dst io.Writer, src io.Reader) error {
+	if !a.Compress {
+		_, err := io.Copy(dst, src)
+		return err
+	}
+	compressed := gzip.NewWriter(dst)
+	if _, err := io.Copy(compressed, src); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// ReplayArchive rebuilds the state at targetLSN from the archive in dir. It loads the newest archived snapshot at or
+// before targetLSN, then applies the archived records after it, stopping at targetLSN. It returns the snapshot's LSN,
+// 0 when the replay starts from an empty state, and the last LSN applied, which is below targetLSN when the archive
+// ends first.
+//
+// A gap between the snapshot and the records, or between two records, is an error, and so is a damaged record: unlike
+// the tail of a data directory, nothing in an archive was being written when the server stopped.
+func ReplayArchive(
+	dir string,
+	targetLSN uint64,
+	load func(table, key, value string) error,
+	apply func(Record) error,
+) (uint64, uint64, error) {
+	snapshots, err := listArchived(dir, SnapshotPrefix, SnapshotSuffix)
+	if err != nil {
+		return 0, 0, fmt.Errorf("list archived snapshots: %w", err)
+	}
+	var snapshotLSN uint64
+	base := -1
+	for index, snapshot := range snapshots {
+		if snapshot.number > targetLSN {
+			break
+		}
+		base, snapshotLSN = index, snapshot.number
+	}
+	if base >= 0 {
+		if err = loadArchivedSnapshot(snapshots[base].path, load); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	segments, err := listArchived(dir, WALPrefix, WALSuffix)
+	if err != nil {
+		return snapshotLSN, snapshotLSN, fmt.Errorf("list archived WAL segments: %w", err)
+	}
+	last := snapshotLSN
+	for index, segment := range segments {
+		if last >= targetLSN {
+			break
+		}
+		// a segment whose successor starts at or before the snapshot holds nothing past it
+		if index+1 < len(segments) && segments[index+1].number <= snapshotLSN+1 {
+			continue
+		}
+		if segment.number > last+1 {
+			return snapshotLSN, last, fmt.Errorf("archived WAL has no records from LSN %d to %d", last+1, segment.number-1)
+		}
+		if last, err = replayArchivedSegment(segment.path, last, targetLSN, apply); err != nil {
+			return snapshotLSN, last, err
+		}
+	}
+	return snapshotLSN, last, nil
+}
+
+// loadArchivedSnapshot applies every entry of an archived snapshot.
+func loadArchivedSnapshot(path string, load func(table, key, value string) error) error {
+	file, reader, err := openArchived(path)
+	if err != nil {
+		return fmt.Errorf("open archived snapshot: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	if err = ReadSnapshot(bufio.NewReader(reader), load); err != nil {
+		return fmt.Errorf("read archived snapshot %s: %w", path, err)
+	}
+	return nil
+}
+
+// replayArchivedSegment applies the records of one archived segment that follow last, up to targetLSN, and returns
+// the last LSN applied.
+func replayArchivedSegment(path string, last, targetLSN uint64, apply func(Record) error) (uint64, error) {
+	err := eachArchivedRecord(path, func(record Record) (bool, error) {
+		if record.LSN <= last {
+			return true, nil
+		}
+		if record.LSN > targetLSN {
+			return false, nil
+		}
+		if record.LSN != last+1 {
+			return false, fmt.Errorf("archived WAL jumps from LSN %d to %d", last, record.LSN)
+		}
+		if err := apply(record); err != nil {
+			return false, fmt.Errorf("apply archived WAL record %d: %w", record.LSN, err)
+		}
+		last = record.LSN
+		return true, nil
+	})
+	return last, err
+}
+
+// ArchiveLSNAt returns the LSN of the last archived record committed at or before at, the LSN to replay the archive to
+// for the state at that time. Records are searched in LSN order up to the first one committed after at, so a clock
+// stepped back while they were written cannot pull a later record in. Records of segments written before records
+// carried a commit time cannot be placed in time; a search that ends among them is an error.
+func ArchiveLSNAt(dir string, at time.Time) (uint64, error) {
+	segments, err := listArchived(dir, WALPrefix, WALSuffix)
+	if err != nil {
+		return 0, fmt.Errorf("list archived WAL segments: %w", err)
+	}
+	var last, untimed uint64
+	for _, segment := range segments {
+		after := false
+		err = eachArchivedRecord(segment.path, func(record Record) (bool, error) {
+			switch {
+			case record.Time.IsZero():
+				untimed = record.LSN
+			case record.Time.After(at):
+				after = true
+				return false, nil
+			default:
+				last, untimed = record.LSN, 0
+			}
+			return true, nil
+		})
+		if err != nil {
+			return 0, err
+		}
+		if after {
+			break
+		}
+	}
+	if untimed > 0 {
+		return 0, fmt.Errorf("archived WAL records up to LSN %d carry no commit time; restore to an LSN instead", untimed)
+	}
+	if last == 0 {
+		return 0, fmt.Errorf("no archived WAL record was committed at or before %s", at.Format(time.RFC3339Nano))
+	}
+	return last, nil
+}
+
+// ArchiveLastLSN returns the highest LSN the archive in dir holds, in a snapshot or a record, or 0 for an empty or
+// missing archive. A server whose log ends before it must not archive into dir: its segments would take the names of
+// archived ones holding another history, and a later restore would mix the two.
+func ArchiveLastLSN(dir string) (uint64, error) {
+	snapshots, err := listArchived(dir, SnapshotPrefix, SnapshotSuffix)
+	if err != nil {
+		return 0, fmt.Errorf("list archived snapshots: %w", err)
+	}
+	var last uint64
+	if len(snapshots) > 0 {
+		last = snapshots[len(snapshots)-1].number
+	}
+	segments, err := listArchived(dir, WALPrefix, WALSuffix)
+	if err != nil {
+		return 0, fmt.Errorf("list archived WAL segments: %w", err)
+	}
+	if len(segments) == 0 {
+		return last, nil
+	}
+	err = eachArchivedRecord(segments[len(segments)-1].path, func(record Record) (bool, error) {
+		last = max(last, record.LSN)
+		return true, nil
+	})
+	return last, err
+}
+
+// eachArchivedRecord calls fn with the records of an archived segment in order, until fn returns false or an error.
+func eachArchivedRecord(path string, fn func(Record) (bool, error)) error {
+	file, source, err := openArchived(path)
+	if err != nil {
+		return fmt.Errorf("open archived WAL segment: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	reader := bufio.NewReader(source)
+	format, err := consumeSegmentHeader(reader)
+	if err != nil {
+		return fmt.Errorf("read archived WAL segment header %s: %w", path, err)
+	}
+	for {
+		record, readErr := readRecord(reader, format)
+		if errors.Is(readErr, io.EOF) {
+			return nil
+		}
+		if readErr != nil {
+			return fmt.Errorf("corrupt archived WAL segment %s: %w", path, readErr)
+		}
+		if more, fnErr := fn(record); fnErr != nil || !more {
+			return fnErr
+		}
+	}
+}
+
+// openArchived opens an archived file, decompressing it when its name says it is gzipped. The file is returned so
+// the caller can close it.
+func openArchived(path string) (*os.File, io.Reader, error) {
+	file, err := os.Open(path) // #nosec G304 -- path comes from the archive directory listing
+	if err != nil {
+		return nil, nil, err
+	}
+	if filepath.Ext(path) != archiveCompressedSuffix {
+		return file, file, nil
+	}
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	return file, reader, nil
+}
+
+// listArchived lists the archived files of one kind, plain or gzipped, in order. Should both copies of a file be
+// there, the plain one is used.
+func listArchived(dir, prefix, suffix string) ([]numberedFile, error) {
+	plain, err := listNumberedFiles(dir, prefix, suffix)
+	if err != nil {
+		return nil, err
+	}
+	compressed, err := listNumberedFiles(dir, prefix, suffix+archiveCompressedSuffix)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[uint64]bool, len(plain))
+	for _, file := range plain {
+		seen[file.number] = true
+	}
+	files := plain
+	for _, file := range compressed {
+		if !seen[file.number] {
+			files = append(files, file)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].number < files[j].number })
+	return files, nil
+}
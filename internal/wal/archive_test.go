@@ -0,0 +1,200 @@
+package wal_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OutOfStack/db/internal/wal"
+)
+
+// TestArchiveReplaysToTarget writes a WAL that archives its snapshots and pruned segments, then rebuilds the state at
+// several LSNs from the archive alone, plain and compressed.
+func TestArchiveReplaysToTarget(t *testing.T) {
+	t.Parallel()
+	for _, compress := range []bool{false, true} {
+		t.Run("compress="+strconv.FormatBool(compress), func(t *testing.T) {
+			t.Parallel()
+			archive := wal.ArchiveConfig{Dir: t.TempDir(), Compress: compress}
+			states := writeArchivedWAL(t, archive)
+
+			for _, target := range []uint64{1, 2, 4, 5} {
+				got, snapshotLSN, lastLSN, err := replayArchive(archive.Dir, target)
+				if err != nil {
+					t.Fatalf("ReplayArchive(%d) error = %v", target, err)
+				}
+				if lastLSN != target || !reflect.DeepEqual(got.values, states[target].values) {
+					t.Fatalf("ReplayArchive(%d) = LSN %d, state %v; want %d, %v", target, lastLSN, got.values, target,
+						states[target].values)
+				}
+				if wantSnapshot := map[uint64]uint64{1: 0, 2: 2, 4: 2, 5: 5}[target]; snapshotLSN != wantSnapshot {
+					t.Fatalf("ReplayArchive(%d) snapshot LSN = %d, want %d", target, snapshotLSN, wantSnapshot)
+				}
+			}
+			if _, _, lastLSN, err := replayArchive(archive.Dir, 100); err != nil || lastLSN != 5 {
+				t.Fatalf("ReplayArchive(100) = LSN %d, %v; want 5, nil", lastLSN, err)
+			}
+		})
+	}
+}
+
+// TestArchiveReplayRejectsGap checks a replay that would skip records fails rather than rebuild a state that never was.
+func TestArchiveReplayRejectsGap(t *testing.T) {
+	t.Parallel()
+	archive := wal.ArchiveConfig{Dir: t.TempDir()}
+	writeArchivedWAL(t, archive)
+	segments, err := filepath.Glob(filepath.Join(archive.Dir, "wal-*.log"))
+	if err != nil || len(segments) < 2 {
+		t.Fatalf("archived segments = %v, %v", segments, err)
+	}
+	if err = os.Remove(segments[0]); err != nil {
+		t.Fatal(err)
+	}
+	// the snapshot at LSN 2 covers the missing segment, so only targets before it hit the gap
+	if _, _, _, err = replayArchive(archive.Dir, 1); err == nil || !strings.Contains(err.Error(), "no records") {
+		t.Fatalf("ReplayArchive(1) error = %v, want a gap", err)
+	}
+	if _, _, lastLSN, replayErr := replayArchive(archive.Dir, 4); replayErr != nil || lastLSN != 4 {
+		t.Fatalf("ReplayArchive(4) = LSN %d, %v; want 4, nil", lastLSN, replayErr)
+	}
+}
+
+// writeArchivedWAL appends five records, one segment each, snapshotting and pruning at LSNs 2 and 5, and returns the
+// state after each LSN.
+// TestArchiveWhileAppending prunes the whole log over and over while records are appended, and checks the archive
+// reads cleanly after every prune and replays to its last record: the segment being appended to is copied only where
+// no append runs alongside, so the archive never ends in a record half written.
+func TestArchiveWhileAppending(t *testing.T) {
+	t.Parallel()
+	archive := wal.ArchiveConfig{Dir: t.TempDir()}
+	writer, err := wal.OpenWriter(wal.WriterConfig{Dir: t.TempDir(), Sync: wal.SyncNo, SegmentSize: 1 << 20,
+		Archive: archive}, 0)
+	if err != nil {
+		t.Fatalf("OpenWriter() error = %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		for i := range 2000 {
+			value := strings.Repeat("v", i%200)
+			if _, appendErr := writer.Append(t.Context(), wal.CommandSet, []string{"t", "k", value}); appendErr != nil {
+				done <- appendErr
+				return
+			}
+		}
+		done <- nil
+	}()
+	for appending := true; appending; {
+		select {
+		case err = <-done:
+			if err != nil {
+				t.Fatalf("Append() error = %v", err)
+			}
+			appending = false
+		default:
+		}
+		if err = writer.Prune(t.Context(), writer.LastLSN()); err != nil {
+			t.Fatalf("Prune() error = %v", err)
+		}
+		if _, err = wal.ArchiveLastLSN(archive.Dir); err != nil {
+			t.Fatalf("ArchiveLastLSN() after a prune error = %v", err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	last, err := wal.ArchiveLastLSN(archive.Dir)
+	if err != nil || last == 0 {
+		t.Fatalf("ArchiveLastLSN() = %d, %v", last, err)
+	}
+	if _, _, lastLSN, replayErr := replayArchive(archive.Dir, last); replayErr != nil || lastLSN != last {
+		t.Fatalf("ReplayArchive(%d) = LSN %d, %v", last, lastLSN, replayErr)
+	}
+}
+
+func writeArchivedWAL(t *testing.T, archive wal.ArchiveConfig) map[uint64]*testState {
+	t.Helper()
+	dir := t.TempDir()
+	writer, err := wal.OpenWriter(wal.WriterConfig{Dir: dir, Sync: wal.SyncAlways, SegmentSize: 1, Archive: archive}, 0)
+	if err != nil {
+		t.Fatalf("OpenWriter() error = %v", err)
+	}
+	state := newTestState()
+	states := map[uint64]*testState{0: cloneState(state)}
+	for lsn := uint64(1); lsn <= 5; lsn++ {
+		key := strconv.FormatUint(lsn%3, 10)
+		if _, err = writer.Append(t.Context(), wal.CommandSet, []string{"t", key, strconv.FormatUint(lsn, 10)}); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+		state.set("t", key, strconv.FormatUint(lsn, 10))
+		states[lsn] = cloneState(state)
+		if lsn != 2 && lsn != 5 {
+			continue
+		}
+		if err = wal.WriteSnapshot(t.Context(), dir, lsn, state); err != nil {
+			t.Fatalf("WriteSnapshot() error = %v", err)
+		}
+		if err = wal.ArchiveSnapshot(dir, lsn, archive); err != nil {
+			t.Fatalf("ArchiveSnapshot() error = %v", err)
+		}
+		if err = writer.Prune(t.Context(), lsn); err != nil {
+			t.Fatalf("Prune() error = %v", err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	return states
+}
+
+func replayArchive(dir string, target uint64) (*testState, uint64, uint64, error) {
+	got := newTestState()
+	snapshotLSN, lastLSN, err := wal.ReplayArchive(dir, target,
+		func(table, key, value string) error {
+			got.set(table, key, value)
+			return nil
+		},
+		func(record wal.Record) error {
+			got.set(record.Args[0], record.Args[1], record.Args[2])
+			return nil
+		})
+	return got, snapshotLSN, lastLSN, err
+}
+
+func cloneState(state *testState) *testState {
+	clone := newTestState()
+	state.Range(func(table, key, value string) bool {
+		clone.set(table, key, value)
+		return true
+	})
+	return clone
+}
+
+// TestArchiveLSNAt checks a time resolves to the last record committed by then, and that records without a commit time
+// cannot be placed in time.
+func TestArchiveLSNAt(t *testing.T) {
+	t.Parallel()
+	archive := wal.ArchiveConfig{Dir: t.TempDir()}
+	before := time.Now()
+	writeArchivedWAL(t, archive)
+	if lsn, err := wal.ArchiveLSNAt(archive.Dir, time.Now()); err != nil || lsn != 5 {
+		t.Fatalf("ArchiveLSNAt(now) = %d, %v; want 5, nil", lsn, err)
+	}
+	if _, err := wal.ArchiveLSNAt(archive.Dir, before.Add(-time.Second)); err == nil {
+		t.Fatal("ArchiveLSNAt() before the first record succeeded")
+	}
+
+	legacy := t.TempDir()
+	segment := append([]byte("DBWAL\x00\x02"),
+		encodeRecordV2(t, wal.Record{LSN: 1, Command: wal.CommandDel, Args: []string{"t", "k"}})...)
+	if err := os.WriteFile(filepath.Join(legacy, "wal-00000000000000000001.log"), segment, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wal.ArchiveLSNAt(legacy, time.Now()); err == nil || !strings.Contains(err.Error(), "no commit time") {
+		t.Fatalf("ArchiveLSNAt() over untimed records error = %v", err)
+	}
+}
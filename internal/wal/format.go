@@ -9,11 +9,21 @@ import (
 )
 
 // Format headers identify the files this package writes; the trailing byte is the format version. A non-empty file that
-// does not carry the current header is rejected at open rather than parsed: misreading one would look like a torn tail
-// and get truncated away.
+// does not carry a header this build reads is rejected at open rather than parsed: misreading one would look like a
+// torn tail and get truncated away. Segments of WAL version 2, whose records carry no commit time or origin, are still
+// read; new records always go to a segment of the current version. Snapshots of version 2, which carry no checksum, are
+// read too; new snapshots are always written in the current version.
 const (
-	walHeader      = "DBWAL\x00\x02"
-	snapshotHeader = "DBSNP\x00\x02"
+	walHeader        = "DBWAL\x00\x03"
+	walHeaderV2      = "DBWAL\x00\x02"
+	snapshotHeader   = "DBSNP\x00\x03"
+	snapshotHeaderV2 = "DBSNP\x00\x02"
+)
+
+// WAL segment format versions, the last byte of their header
+const (
+	formatV2 byte = 2
+	formatV3 byte = 3
 )
 
 // ErrUnsupportedFormat is returned for a file written in a format this build does not read.
@@ -53,6 +63,28 @@ func consumeHeader(reader *bufio.Reader, header string) error {
 	return err
 }
 
+// segmentFormat returns the format version of a WAL segment and the offset its records begin at. An empty file reads
+// as one of the current version with no records.
+func segmentFormat(file *os.File) (byte, int64, error) {
+	offset, err := RequireHeader(file, walHeader)
+	if errors.Is(err, ErrUnsupportedFormat) {
+		if offset, err = RequireHeader(file, walHeaderV2); err == nil {
+			return formatV2, offset, nil
+		}
+	}
+	return formatV3, offset, err
+}
+
+// consumeSegmentHeader verifies and skips the header of a WAL segment on a buffered reader, returning its format
+// version.
+func consumeSegmentHeader(reader *bufio.Reader) (byte, error) {
+	if buf, _ := reader.Peek(len(walHeaderV2)); string(buf) == walHeaderV2 {
+		_, err := reader.Discard(len(walHeaderV2))
+		return formatV2, err
+	}
+	return formatV3, consumeHeader(reader, walHeader)
+}
+
 // WriteHeader writes a format header at the start of a freshly opened, empty file, treating a short write as an error.
 func WriteHeader(file *os.File, header string) error {
 	written, err := file.WriteString(header)
@@ -64,7 +96,9 @@ func WriteHeader(file *os.File, header string) error {
 
 // openTailSegment opens the newest segment for appending and returns it with the size to append at. An empty file is a
 // crash between creating a segment and writing its header: the header is written now, since records appended into it
-// would otherwise sit where the header belongs and the next open would reject the whole segment.
+// would otherwise sit where the header belongs and the next open would reject the whole segment. A segment of an older
+// format is not appended to: it is left as it is and a nil file returned, so the next record starts a new segment,
+// unless it holds no records, in which case it is started again in the current format.
 func openTailSegment(path string) (*os.File, int64, error) {
 	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o600) // #nosec G304 -- path comes from the WAL directory listing
 	if err != nil {
@@ -75,12 +109,23 @@ func openTailSegment(path string) (*os.File, int64, error) {
 		_ = file.Close()
 		return nil, 0, fmt.Errorf("stat WAL segment: %w", err)
 	}
-	if size := info.Size(); size > 0 {
-		if _, err = RequireHeader(file, walHeader); err != nil {
+	size := info.Size()
+	if size > 0 {
+		format, offset, formatErr := segmentFormat(file)
+		if formatErr != nil {
+			_ = file.Close()
+			return nil, 0, fmt.Errorf("read WAL segment header: %w", formatErr)
+		}
+		if format == formatV3 {
+			return file, size, nil
+		}
+		if size > offset {
+			return nil, 0, file.Close()
+		}
+		if err = file.Truncate(0); err != nil {
 			_ = file.Close()
-			return nil, 0, fmt.Errorf("read WAL segment header: %w", err)
+			return nil, 0, fmt.Errorf("truncate WAL segment: %w", err)
 		}
-		return file, size, nil
 	}
 	if err = WriteHeader(file, walHeader); err != nil {
 		_ = file.Close()
@@ -89,18 +134,19 @@ func openTailSegment(path string) (*os.File, int64, error) {
 	return file, int64(len(walHeader)), nil
 }
 
-func openWALSegment(path string) (*os.File, *bufio.Reader, error) {
+// openWALSegment opens a segment for reading its records, returning its format version with it.
+func openWALSegment(path string) (*os.File, *bufio.Reader, byte, error) {
 	file, err := os.Open(path) // #nosec G304 -- path comes from the WAL directory listing
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, err
 	}
-	offset, err := RequireHeader(file, walHeader)
+	format, offset, err := segmentFormat(file)
 	if err == nil {
 		_, err = file.Seek(offset, io.SeekStart)
 	}
 	if err != nil {
 		_ = file.Close()
-		return nil, nil, fmt.Errorf("read WAL segment header: %w", err)
+		return nil, nil, 0, fmt.Errorf("read WAL segment header: %w", err)
 	}
-	return file, bufio.NewReader(file), nil
+	return file, bufio.NewReader(file), format, nil
 }
@@ -0,0 +1,140 @@
+package wal
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SegmentReport describes one WAL segment as InspectSegment read it. LSNs and times are those of the records read, so
+// they are zero for a segment without any. Damage is the first record that failed to read, nil when every record did,
+// and DamageOffset is where that record starts.
+type SegmentReport struct {
+	Path         string
+	Format       byte
+	NameLSN      uint64 // the first LSN the segment's name promises
+	Records      int
+	FirstLSN     uint64
+	LastLSN      uint64
+	FirstTime    time.Time
+	LastTime     time.Time
+	Damage       error
+	DamageOffset int64
+}
+
+// TornTail reports whether the damage is a record cut short at the end of the segment, which is what a crash during an
+// append leaves. Recovery truncates one at the end of the newest segment; anywhere else it is lost data.
+func (r SegmentReport) TornTail() bool {
+	return errors.Is(r.Damage, ErrPartialRecord)
+}
+
+// InspectSegment reads the WAL segment at path without changing it, calling fn (which may be nil) for each record up to
+// the first damaged one. A record whose LSN does not follow the one before it, or for the first record the LSN the
+// name promises, counts as damage, as in VerifySegments. A segment archived with compression is read decompressed, and
+// its offsets are those of the decompressed bytes. The error is for a file that cannot be read at all, or from fn.
+func InspectSegment(path string, fn func(Record) error) (SegmentReport, error) {
+	report := SegmentReport{Path: path}
+	report.NameLSN, _ = fileNumber(path, WALPrefix, WALSuffix)
+	file, source, err := openArchived(path)
+	if err != nil {
+		return report, err
+	}
+	defer func() { _ = file.Close() }()
+	counter := &countingReader{r: source}
+	reader := bufio.NewReader(counter)
+	if report.Format, err = consumeSegmentHeader(reader); err != nil {
+		return report, fmt.Errorf("read WAL segment header: %w", err)
+	}
+
+	next := report.NameLSN
+	for {
+		position := counter.n - int64(reader.Buffered())
+		record, readErr := readRecord(reader, report.Format)
+		if errors.Is(readErr, io.EOF) {
+			return report, nil
+		}
+		if readErr == nil && next > 0 && record.LSN != next {
+			readErr = fmt.Errorf("non-contiguous WAL LSN: got %d, want %d", record.LSN, next)
+		}
+		if readErr != nil {
+			report.Damage, report.DamageOffset = readErr, position
+			return report, nil
+		}
+		if report.Records == 0 {
+			report.FirstLSN, report.FirstTime = record.LSN, record.Time
+		}
+		report.Records++
+		report.LastLSN, report.LastTime = record.LSN, record.Time
+		next = record.LSN + 1
+		if fn != nil {
+			if err = fn(record); err != nil {
+				return report, err
+			}
+		}
+	}
+}
+
+// SnapshotReport describes one snapshot as InspectSnapshot read it. Damage is the first entry that failed to read, nil
+// when every entry did, and DamageOffset is where that entry starts; in the current format, where entries are read a
+// block at a time, it is where the block starts. Tables and Blocks are 0 for a version 2 snapshot, which has no blocks.
+type SnapshotReport struct {
+	Path         string
+	LSN          uint64 // from the name
+	Format       byte
+	Entries      int
+	Tables       int
+	Blocks       int
+	Compressed   bool // some block is compressed
+	Damage       error
+	DamageOffset int64
+}
+
+// InspectSnapshot reads the snapshot at path without changing it, calling fn (which may be nil) for each entry up to
+// the first damaged one. Like InspectSegment it reads archived snapshots too, compressed or not.
+func InspectSnapshot(path string, fn func(table, key, value string) error) (SnapshotReport, error) {
+	report := SnapshotReport{Path: path}
+	report.LSN, _ = fileNumber(path, SnapshotPrefix, SnapshotSuffix)
+	file, source, err := openArchived(path)
+	if err != nil {
+		return report, err
+	}
+	defer func() { _ = file.Close() }()
+	snapshot, err := newSnapshotReader(source)
+	if err != nil {
+		return report, fmt.Errorf("read snapshot header: %w", err)
+	}
+	report.Format = snapshot.format
+	for {
+		table, key, value, readErr := snapshot.next()
+		if readErr != nil {
+			if !errors.Is(readErr, io.EOF) {
+				report.Damage, report.DamageOffset = readErr, snapshot.position()
+			}
+			break
+		}
+		report.Entries++
+		if fn != nil {
+			if err = fn(table, key, value); err != nil {
+				break
+			}
+		}
+	}
+	report.Tables = SnapshotIndex{Blocks: snapshot.blocks}.Tables()
+	report.Blocks, report.Compressed = len(snapshot.blocks), snapshot.compressed
+	return report, err
+}
+
+// fileNumber parses the number in the name of a WAL file, archived or not.
+func fileNumber(path, prefix, suffix string) (uint64, bool) {
+	name := strings.TrimSuffix(filepath.Base(path), archiveCompressedSuffix)
+	if !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, suffix) {
+		return 0, false
+	}
+	number, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffix), 10, 64)
+	return number, err == nil
+}
@@ -0,0 +1,72 @@
+package wal_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/OutOfStack/db/internal/wal"
+)
+
+// TestInspectSegment checks a segment reads back with its LSN range and records, that a record cut short at its end is
+// reported as a torn tail and a flipped byte as damage at the record's offset, and that neither changes the file.
+func TestInspectSegment(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	writer, err := wal.OpenWriter(wal.WriterConfig{Dir: dir, Sync: wal.SyncAlways, SegmentSize: 1 << 20}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := wal.WithOrigin(t.Context(), "tester")
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err = writer.Append(ctx, wal.CommandSet, []string{"t", key, "v"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := walSegmentFiles(t, dir)[0]
+
+	var keys []string
+	report, err := wal.InspectSegment(path, func(record wal.Record) error {
+		if record.Origin != "tester" || record.Time.IsZero() {
+			t.Fatalf("record %d origin %q, time %v; want tester and a commit time", record.LSN, record.Origin, record.Time)
+		}
+		keys = append(keys, record.Args[1])
+		return nil
+	})
+	if err != nil || report.Damage != nil || report.Records != 3 || report.FirstLSN != 1 || report.LastLSN != 3 {
+		t.Fatalf("InspectSegment() = %+v, %v; want 3 undamaged records from LSN 1 to 3", report, err)
+	}
+	if len(keys) != 3 || keys[2] != "c" {
+		t.Fatalf("InspectSegment() records = %v", keys)
+	}
+
+	appendBytes(t, path, []byte{0, 0, 0})
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report, err = wal.InspectSegment(path, nil); err != nil || !report.TornTail() || report.Records != 3 {
+		t.Fatalf("InspectSegment() of a torn tail = %+v, %v", report, err)
+	}
+	tornAt := report.DamageOffset
+
+	damaged := append([]byte(nil), before...)
+	damaged[len(damaged)-4] ^= 0xff // the checksum of the last record, before the torn tail
+	if err = os.WriteFile(path, damaged, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	report, err = wal.InspectSegment(path, nil)
+	if err != nil || report.TornTail() || !errors.Is(report.Damage, wal.ErrChecksum) || report.Records != 2 {
+		t.Fatalf("InspectSegment() of a damaged record = %+v, %v; want a checksum mismatch after 2 records", report, err)
+	}
+	if report.DamageOffset >= tornAt {
+		t.Fatalf("damage at offset %d, want before the torn tail at %d", report.DamageOffset, tornAt)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil || len(after) != len(before) {
+		t.Fatalf("InspectSegment() changed the segment: %d bytes, want %d", len(after), len(before))
+	}
+}
@@ -57,7 +57,7 @@ func (r *Reader) replaySegment( //nolint:gocyclo // recovery deliberately keeps
 	lastApplied uint64,
 	apply func(Record) error,
 ) (replayPosition, error) {
-	file, reader, err := openWALSegment(segment.path)
+	file, reader, format, err := openWALSegment(segment.path)
 	if err != nil {
 		return replayPosition{}, fmt.Errorf("open WAL segment %s: %w", segment.path, err)
 	}
@@ -71,7 +71,7 @@ func (r *Reader) replaySegment( //nolint:gocyclo // recovery deliberately keeps
 		}
 		offset -= int64(reader.Buffered())
 
-		record, readErr := readRecord(reader)
+		record, readErr := readRecord(reader, format)
 		if errors.Is(readErr, io.EOF) {
 			break
 		}
@@ -3,11 +3,13 @@ package wal
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
+	"time"
 
 	"github.com/OutOfStack/db/internal/protocol"
 )
@@ -15,7 +17,11 @@ import (
 const (
 	checksumSize  = 4
 	lsnSize       = 8
+	timeSize      = 8
+	originLenSize = 2
 	maxRecordSize = 64 << 20
+	// maxOriginLen is the longest origin a record keeps; its length is stored in two bytes.
+	maxOriginLen = 1<<16 - 1
 
 	// CommandSet and CommandDel are the mutating operations accepted by the WAL.
 	CommandSet = "SET"
@@ -33,30 +39,67 @@ var (
 	ErrPartialRecord = errors.New("partial wal record")
 )
 
-// Record is one mutation stored in the write-ahead log.
+// Record is one mutation stored in the write-ahead log. Time is when the writer committed it, and Origin who it came
+// from: for a client's write, the client's name and address (see WithOrigin). A record replicated from a master keeps
+// the master's. Both are zero in records of segments written before they were kept.
 type Record struct {
 	LSN     uint64
+	Time    time.Time
+	Origin  string
 	Command string
 	Args    []string
 }
 
-// EncodeRecord serializes a record to its on-disk/on-wire form (LSN, protocol command, CRC32). Replication reuses this
-// so the master ships the exact bytes a standby persists to its own WAL.
+type originKey struct{}
+
+// WithOrigin returns a context whose WAL appends record origin as the origin of their records.
+func WithOrigin(ctx context.Context, origin string) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFrom returns the origin set by WithOrigin, or "" when there is none.
+func OriginFrom(ctx context.Context) string {
+	origin, _ := ctx.Value(originKey{}).(string)
+	return origin
+}
+
+// EncodeRecord serializes a record to its on-disk/on-wire form in the current format: LSN, commit time in Unix
+// nanoseconds, origin, protocol command, CRC32. Replication reuses this so the master ships the exact bytes a standby
+// persists to its own WAL.
 func EncodeRecord(record Record) ([]byte, error) {
-	return encodeRecord(record)
+	return encodeRecord(record, formatV3)
 }
 
 // ReadRecord decodes a single record previously written by EncodeRecord. It is used by standbys reading the master's
 // replication stream. A partial or checksum-invalid record returns ErrPartialRecord/ErrChecksum.
 func ReadRecord(reader *bufio.Reader) (Record, error) {
-	return readRecord(reader)
+	return readRecord(reader, formatV3)
 }
 
-func encodeRecord(record Record) ([]byte, error) {
+// ReadRecordV2 decodes a record of the older format, which has no commit time or origin. Standbys use it for the
+// replication stream of a master that still sends it.
+func ReadRecordV2(reader *bufio.Reader) (Record, error) {
+	return readRecord(reader, formatV2)
+}
+
+func encodeRecord(record Record, format byte) ([]byte, error) {
 	var body bytes.Buffer
 	if err := binary.Write(&body, binary.BigEndian, record.LSN); err != nil {
 		return nil, fmt.Errorf("encode LSN: %w", err)
 	}
+	if format >= formatV3 {
+		if len(record.Origin) > maxOriginLen {
+			return nil, fmt.Errorf("WAL record origin of %d bytes exceeds maximum %d", len(record.Origin), maxOriginLen)
+		}
+		var nanos int64
+		if !record.Time.IsZero() {
+			nanos = record.Time.UnixNano()
+		}
+		header := binary.BigEndian.AppendUint64(nil, uint64(nanos))                // #nosec G115 -- stored as its bits
+		header = binary.BigEndian.AppendUint16(header, uint16(len(record.Origin))) // #nosec G115 -- bounded above
+		body.Write(header)
+		body.WriteString(record.Origin)
+	}
 	if err := protocol.WriteCommand(&body, record.Command, record.Args); err != nil {
 		return nil, fmt.Errorf("encode command: %w", err)
 	}
@@ -69,7 +112,7 @@ func encodeRecord(record Record) ([]byte, error) {
 	return result, nil
 }
 
-func readRecord(reader *bufio.Reader) (Record, error) {
+func readRecord(reader *bufio.Reader, format byte) (Record, error) {
 	lsnBytes := make([]byte, lsnSize)
 	n, err := io.ReadFull(reader, lsnBytes)
 	if err != nil {
@@ -78,8 +121,14 @@ func readRecord(reader *bufio.Reader) (Record, error) {
 		}
 		return Record{}, fmt.Errorf("%w: read LSN: %w", ErrPartialRecord, err)
 	}
+	record := Record{LSN: binary.BigEndian.Uint64(lsnBytes)}
+	if format >= formatV3 {
+		if record.Time, record.Origin, err = readMetadata(reader); err != nil {
+			return Record{}, err
+		}
+	}
 
-	command, args, err := protocol.ReadCommand(reader, maxRecordSize)
+	record.Command, record.Args, err = protocol.ReadCommand(reader, maxRecordSize)
 	if err != nil {
 		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
 			return Record{}, fmt.Errorf("%w: read command: %w", ErrPartialRecord, err)
@@ -92,8 +141,7 @@ func readRecord(reader *bufio.Reader) (Record, error) {
 		return Record{}, fmt.Errorf("%w: read checksum: %w", ErrPartialRecord, err)
 	}
 
-	record := Record{LSN: binary.BigEndian.Uint64(lsnBytes), Command: command, Args: args}
-	encoded, err := encodeRecord(record)
+	encoded, err := encodeRecord(record, format)
 	if err != nil {
 		return Record{}, err
 	}
@@ -108,6 +156,23 @@ func readRecord(reader *bufio.Reader) (Record, error) {
 	return record, nil
 }
 
+// readMetadata reads the commit time and origin that follow the LSN in a record of the current format.
+func readMetadata(reader *bufio.Reader) (time.Time, string, error) {
+	header := make([]byte, timeSize+originLenSize)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return time.Time{}, "", fmt.Errorf("%w: read record metadata: %w", ErrPartialRecord, err)
+	}
+	var committed time.Time
+	if nanos := int64(binary.BigEndian.Uint64(header)); nanos != 0 { // #nosec G115 -- stored as its bits
+		committed = time.Unix(0, nanos).UTC()
+	}
+	origin := make([]byte, binary.BigEndian.Uint16(header[timeSize:]))
+	if _, err := io.ReadFull(reader, origin); err != nil {
+		return time.Time{}, "", fmt.Errorf("%w: read record origin: %w", ErrPartialRecord, err)
+	}
+	return committed, string(origin), nil
+}
+
 func validateRecord(record Record) error {
 	var want int
 	switch record.Command {
@@ -123,5 +188,8 @@ func validateRecord(record Record) error {
 	if len(record.Args) != want {
 		return fmt.Errorf("invalid %s WAL record: got %d arguments, want %d", record.Command, len(record.Args), want)
 	}
+	if len(record.Origin) > maxOriginLen {
+		return fmt.Errorf("WAL record origin of %d bytes exceeds maximum %d", len(record.Origin), maxOriginLen)
+	}
 	return nil
 }
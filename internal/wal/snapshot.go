@@ -17,8 +17,26 @@ type SnapshotSource interface {
 	Range(fn func(table, key, value string) bool)
 }
 
-// WriteSnapshot atomically writes the full state as protocol-encoded SET commands.
-func WriteSnapshot(ctx context.Context, dir string, lsn uint64, source SnapshotSource) error {
+// SnapshotOption configures WriteSnapshot.
+type SnapshotOption func(*snapshotOptions)
+
+type snapshotOptions struct {
+	compress bool
+}
+
+// WithSnapshotCompression compresses the blocks of the snapshot with DEFLATE (compress/flate), each one only when that
+// makes it smaller. A compressed snapshot reads like any other.
+func WithSnapshotCompression(enabled bool) SnapshotOption {
+	return func(o *snapshotOptions) { o.compress = enabled }
+}
+
+// WriteSnapshot atomically writes the full state as a snapshot of the current format: checksummed blocks of entries,
+// then an index of the blocks.
+func WriteSnapshot(ctx context.Context, dir string, lsn uint64, source SnapshotSource, opts ...SnapshotOption) error {
+	var options snapshotOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
 	if err := os.MkdirAll(dir, 0o750); err != nil {
 		return fmt.Errorf("create snapshot directory: %w", err)
 	}
@@ -34,7 +52,7 @@ func WriteSnapshot(ctx context.Context, dir string, lsn uint64, source SnapshotS
 		_ = temporary.Close()
 		return fmt.Errorf("write snapshot header: %w", err)
 	}
-	if err = writeSnapshotRecords(ctx, temporary, source); err != nil {
+	if err = writeSnapshotRecords(ctx, newSnapshotWriter(temporary, options.compress), source); err != nil {
 		_ = temporary.Close()
 		return err
 	}
@@ -56,19 +74,22 @@ func WriteSnapshot(ctx context.Context, dir string, lsn uint64, source SnapshotS
 	return removeOldSnapshots(dir, lsn)
 }
 
-func writeSnapshotRecords(ctx context.Context, file io.Writer, source SnapshotSource) error {
+func writeSnapshotRecords(ctx context.Context, writer *snapshotWriter, source SnapshotSource) error {
 	var writeErr error
 	source.Range(func(table, key, value string) bool {
 		if ctx.Err() != nil {
 			writeErr = ctx.Err()
 			return false
 		}
-		if err := protocol.WriteCommand(file, CommandSet, []string{table, key, value}); err != nil {
+		if err := writer.add(table, key, value); err != nil {
 			writeErr = err
 			return false
 		}
 		return true
 	})
+	if writeErr == nil {
+		writeErr = writer.finish()
+	}
 	if writeErr != nil {
 		return fmt.Errorf("write snapshot: %w", writeErr)
 	}
@@ -116,25 +137,44 @@ func LoadLatestSnapshot(dir string, apply func(table, key, value string) error)
 	return latest.number, nil
 }
 
-// ReadSnapshot applies every record of a snapshot in order.
+// ReadSnapshot applies every entry of a snapshot in order. A snapshot of the current format is checked as it is read:
+// a block that does not match its checksum, or an index that does not match the blocks, is an error.
 func ReadSnapshot(reader *bufio.Reader, apply func(table, key, value string) error) error {
-	if err := consumeHeader(reader, snapshotHeader); err != nil {
+	snapshot, err := newSnapshotReader(reader)
+	if err != nil {
 		return fmt.Errorf("read snapshot header: %w", err)
 	}
 	for {
-		command, args, readErr := protocol.ReadCommand(reader, maxRecordSize)
+		table, key, value, readErr := snapshot.next()
 		if errors.Is(readErr, io.EOF) {
 			break
 		}
 		if readErr != nil {
 			return readErr
 		}
-		if command != CommandSet || len(args) != 3 {
-			return fmt.Errorf("invalid snapshot record %q with %d arguments", command, len(args))
-		}
-		if err := apply(args[0], args[1], args[2]); err != nil {
+		if err = apply(table, key, value); err != nil {
 			return fmt.Errorf("apply snapshot: %w", err)
 		}
 	}
 	return nil
 }
+
+// readSnapshotRecord reads the next record of a version 2 snapshot, returning io.EOF only at the end of the last whole one. A
+// snapshot is published complete, so one that ends inside a record has been damaged since, and that is an error rather
+// than the end of the data.
+func readSnapshotRecord(reader *bufio.Reader) (string, string, string, error) {
+	if _, err := reader.Peek(1); errors.Is(err, io.EOF) {
+		return "", "", "", io.EOF
+	}
+	command, args, err := protocol.ReadCommand(reader, maxRecordSize)
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return "", "", "", fmt.Errorf("truncated or damaged snapshot record: %w", err)
+	}
+	if command != CommandSet || len(args) != 3 {
+		return "", "", "", fmt.Errorf("invalid snapshot record %q with %d arguments", command, len(args))
+	}
+	return args[0], args[1], args[2], nil
+}
@@ -0,0 +1,521 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Snapshot format versions, the last byte of their header. Version 2 is a bare stream of SET commands after the
+// header, with no checksum. Version 3 groups entries into checksummed blocks, each holding entries of one table and
+// optionally compressed, followed by the index blocks and a trailer:
+//
+//	header   "DBSNP\x00\x03"
+//	block    kind (1) | codec (1) | raw length (4) | stored length (4) | CRC-32 of the payload (4) | payload
+//	data     uvarint-prefixed table, then uvarint-prefixed key and value pairs
+//	index    block count, then per block its table, offset and entry count, then the total entry count, all uvarints
+//	trailer  offset of the first index block (8) | "DBSNPEND"
+//
+// The index is split into blocks of at most snapshotBlockSize, so it grows with the number of blocks rather than
+// running into the per-block limit: every block but the last is an index part, and their payloads joined in order are
+// the index. Every block is read and checked in order, so a snapshot can be loaded from a stream (a replication resync)
+// as well as a file; the trailer lets a reader with a file find the index, and through it one table's blocks, without
+// reading the rest.
+const (
+	snapshotFormatV2 byte = 2
+	snapshotFormatV3 byte = 3
+)
+
+const (
+	snapshotBlockData      byte = 1
+	snapshotBlockIndex     byte = 2 // the last, often only, block of the index
+	snapshotBlockIndexPart byte = 3 // a block of the index that another index block follows
+
+	snapshotCodecNone  byte = 0
+	snapshotCodecFlate byte = 1
+
+	snapshotBlockHeaderSize = 14
+	// snapshotBlockSize is the raw payload size past which a data block is closed; a single larger entry makes a
+	// larger block
+	snapshotBlockSize = 64 << 10
+	// maxSnapshotBlock bounds a block's lengths, so a damaged length cannot drive a huge allocation: a block holds at
+	// most a full block of entries plus one entry, which is no larger than a record
+	maxSnapshotBlock    = snapshotBlockSize + maxRecordSize
+	snapshotTrailerSize = 16
+	snapshotTrailer     = "DBSNPEND"
+)
+
+// ErrNoSnapshotIndex is returned by ReadSnapshotIndex and ReadSnapshotTable for a snapshot that carries no index: one
+// written in format version 2, or a compressed archive copy, which cannot be read from its end.
+var ErrNoSnapshotIndex = errors.New("snapshot has no index")
+
+// SnapshotIndex is the index of a snapshot: where each of its blocks starts, the table its entries belong to, and how
+// many entries it holds.
+type SnapshotIndex struct {
+	Blocks  []SnapshotBlock
+	Entries uint64
+}
+
+// SnapshotBlock is one data block of a snapshot, as its index lists it.
+type SnapshotBlock struct {
+	Table   string
+	Offset  int64
+	Entries uint64
+}
+
+// Tables returns the number of distinct tables the index lists.
+func (i SnapshotIndex) Tables() int {
+	seen := make(map[string]struct{})
+	for _, block := range i.Blocks {
+		seen[block.Table] = struct{}{}
+	}
+	return len(seen)
+}
+
+// snapshotWriter writes the blocks, index and trailer of a snapshot after its header.
+type snapshotWriter struct {
+	w        *bufio.Writer
+	offset   int64
+	compress bool
+	table    string
+	block    []byte // raw payload of the open block
+	entries  uint64 // in the open block
+	index    SnapshotIndex
+}
+
+func newSnapshotWriter(w io.Writer, compress bool) *snapshotWriter {
+	return &snapshotWriter{w: bufio.NewWriter(w), offset: int64(len(snapshotHeader)), compress: compress}
+}
+
+func (w *snapshotWriter) add(table, key, value string) error {
+	if w.entries > 0 && (table != w.table || len(w.block) >= snapshotBlockSize) {
+		if err := w.closeBlock(); err != nil {
+			return err
+		}
+	}
+	if w.entries == 0 {
+		w.table = table
+		w.block = appendSnapshotString(w.block[:0], table)
+	}
+	w.block = appendSnapshotString(appendSnapshotString(w.block, key), value)
+	w.entries++
+	return nil
+}
+
+func (w *snapshotWriter) closeBlock() error {
+	if w.entries == 0 {
+		return nil
+	}
+	w.index.Blocks = append(w.index.Blocks, SnapshotBlock{Table: w.table, Offset: w.offset, Entries: w.entries})
+	w.index.Entries += w.entries
+	w.entries = 0
+	payload, codec := w.block, snapshotCodecNone
+	if w.compress {
+		if compressed, ok := deflate(w.block); ok {
+			payload, codec = compressed, snapshotCodecFlate
+		}
+	}
+	return w.writeBlock(snapshotBlockData, codec, len(w.block), payload)
+}
+
+// finish closes the open block and writes the index and the trailer.
+func (w *snapshotWriter) finish() error {
+	if err := w.closeBlock(); err != nil {
+		return err
+	}
+	indexOffset := w.offset
+	index := binary.AppendUvarint(nil, uint64(len(w.index.Blocks)))
+	for _, block := range w.index.Blocks {
+		index = appendSnapshotString(index, block.Table)
+		index = binary.AppendUvarint(index, uint64(block.Offset)) // #nosec G115 -- offsets are never negative
+		index = binary.AppendUvarint(index, block.Entries)
+	}
+	index = binary.AppendUvarint(index, w.index.Entries)
+	for len(index) > snapshotBlockSize {
+		part := index[:snapshotBlockSize]
+		if err := w.writeBlock(snapshotBlockIndexPart, snapshotCodecNone, len(part), part); err != nil {
+			return err
+		}
+		index = index[snapshotBlockSize:]
+	}
+	if err := w.writeBlock(snapshotBlockIndex, snapshotCodecNone, len(index), index); err != nil {
+		return err
+	}
+	trailer := binary.BigEndian.AppendUint64(nil, uint64(indexOffset)) // #nosec G115 -- offsets are never negative
+	if _, err := w.w.Write(append(trailer, snapshotTrailer...)); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+func (w *snapshotWriter) writeBlock(kind, codec byte, rawLen int, payload []byte) error {
+	if rawLen > maxSnapshotBlock {
+		return fmt.Errorf("snapshot block of %d bytes exceeds maximum %d", rawLen, maxSnapshotBlock)
+	}
+	header := make([]byte, snapshotBlockHeaderSize)
+	header[0], header[1] = kind, codec
+	binary.BigEndian.PutUint32(header[2:], uint32(rawLen))       // #nosec G115 -- bounded by maxSnapshotBlock
+	binary.BigEndian.PutUint32(header[6:], uint32(len(payload))) // #nosec G115 -- no larger than the raw payload
+	binary.BigEndian.PutUint32(header[10:], crc32.ChecksumIEEE(payload))
+	if _, err := w.w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(payload); err != nil {
+		return err
+	}
+	w.offset += int64(len(header) + len(payload))
+	return nil
+}
+
+// deflate compresses data, reporting false when that does not make it smaller.
+func deflate(data []byte) ([]byte, bool) {
+	var buf bytes.Buffer
+	writer, _ := flate.NewWriter(&buf, flate.BestSpeed) // only fails for an invalid level
+	// writes to a bytes.Buffer cannot fail
+	_, _ = writer.Write(data)
+	_ = writer.Close()
+	if buf.Len() >= len(data) {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+func appendSnapshotString(buf []byte, s string) []byte {
+	return append(binary.AppendUvarint(buf, uint64(len(s))), s...)
+}
+
+// snapshotReader reads the entries of a snapshot of either format in order. For version 3 it checks every block
+// against its checksum and, at the end, the index and trailer against the blocks it read.
+type snapshotReader struct {
+	counter *countingReader
+	reader  *bufio.Reader
+	format  byte // 0 for an empty file, which holds no entries
+	pos     int64
+
+	// version 3
+	rest       []byte // entries of the current block not read yet
+	table      string
+	blocks     []SnapshotBlock
+	entries    uint64
+	compressed bool
+	index      []byte // payloads of the index blocks read so far
+	indexPos   int64  // offset of the first index block, or -1 before it
+	done       bool
+}
+
+func newSnapshotReader(r io.Reader) (*snapshotReader, error) {
+	s := &snapshotReader{counter: &countingReader{r: r}, indexPos: -1}
+	s.reader = bufio.NewReader(s.counter)
+	buf, err := s.reader.Peek(len(snapshotHeader))
+	switch {
+	case len(buf) == 0 && errors.Is(err, io.EOF):
+		return s, nil
+	case string(buf) == snapshotHeader:
+		s.format = snapshotFormatV3
+	case string(buf) == snapshotHeaderV2:
+		s.format = snapshotFormatV2
+	case err != nil && !errors.Is(err, io.EOF):
+		return nil, err
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	_, err = s.reader.Discard(len(snapshotHeader))
+	return s, err
+}
+
+// position returns the offset of the entry (version 2) or block (version 3) last read, the one a damage report points
+// at.
+func (s *snapshotReader) position() int64 {
+	return s.pos
+}
+
+func (s *snapshotReader) offset() int64 {
+	return s.counter.n - int64(s.reader.Buffered())
+}
+
+// next returns the next entry, or io.EOF after the last one.
+func (s *snapshotReader) next() (string, string, string, error) {
+	switch s.format {
+	case 0:
+		return "", "", "", io.EOF
+	case snapshotFormatV2:
+		s.pos = s.offset()
+		return readSnapshotRecord(s.reader)
+	}
+	for len(s.rest) == 0 {
+		if s.done {
+			return "", "", "", io.EOF
+		}
+		if err := s.readBlock(); err != nil {
+			return "", "", "", err
+		}
+	}
+	key, rest, okKey := cutSnapshotString(s.rest)
+	value, rest, okValue := cutSnapshotString(rest)
+	if !okKey || !okValue {
+		return "", "", "", fmt.Errorf("damaged snapshot block at offset %d: entry overruns the block", s.pos)
+	}
+	s.rest = rest
+	s.blocks[len(s.blocks)-1].Entries++
+	s.entries++
+	return s.table, key, value, nil
+}
+
+// readBlock reads the next block: a data block becomes the entries next returns, an index part is kept, and the last
+// index block ends the snapshot once the index and the trailer match what was read.
+func (s *snapshotReader) readBlock() error {
+	s.pos = s.offset()
+	kind, codec, payload, err := readSnapshotBlock(s.reader)
+	if err != nil {
+		return fmt.Errorf("snapshot block at offset %d: %w", s.pos, err)
+	}
+	if kind == snapshotBlockIndex || kind == snapshotBlockIndexPart {
+		if s.indexPos < 0 {
+			s.indexPos = s.pos
+		}
+		s.index = append(s.index, payload...)
+		if kind == snapshotBlockIndex {
+			return s.finish()
+		}
+		return nil
+	}
+	if s.indexPos >= 0 {
+		return fmt.Errorf("snapshot block at offset %d: data block inside the index", s.pos)
+	}
+	table, rest, ok := cutSnapshotString(payload)
+	if !ok || len(rest) == 0 {
+		return fmt.Errorf("snapshot block at offset %d: no entries", s.pos)
+	}
+	s.table, s.rest = table, rest
+	s.blocks = append(s.blocks, SnapshotBlock{Table: table, Offset: s.pos})
+	s.compressed = s.compressed || codec == snapshotCodecFlate
+	return nil
+}
+
+func (s *snapshotReader) finish() error {
+	index, err := parseSnapshotIndex(s.index)
+	if err != nil {
+		return fmt.Errorf("snapshot index at offset %d: %w", s.indexPos, err)
+	}
+	if !sameSnapshotIndex(index, SnapshotIndex{Blocks: s.blocks, Entries: s.entries}) {
+		return fmt.Errorf("snapshot index at offset %d does not match its blocks", s.indexPos)
+	}
+	trailer := make([]byte, snapshotTrailerSize)
+	if _, err = io.ReadFull(s.reader, trailer); err != nil {
+		return fmt.Errorf("read snapshot trailer: %w", unexpectedEOF(err))
+	}
+	if string(trailer[8:]) != snapshotTrailer || binary.BigEndian.Uint64(trailer) != uint64(s.indexPos) { // #nosec G115
+		return errors.New("damaged snapshot trailer")
+	}
+	if _, err = s.reader.Peek(1); !errors.Is(err, io.EOF) {
+		return errors.New("data after the snapshot trailer")
+	}
+	s.done = true
+	return nil
+}
+
+// readSnapshotBlock reads one block and checks it against its checksum, returning its payload decompressed.
+func readSnapshotBlock(reader io.Reader) (kind, codec byte, payload []byte, err error) {
+	header := make([]byte, snapshotBlockHeaderSize)
+	if _, err = io.ReadFull(reader, header); err != nil {
+		return 0, 0, nil, fmt.Errorf("read block header: %w", unexpectedEOF(err))
+	}
+	kind, codec = header[0], header[1]
+	rawLen, storedLen := binary.BigEndian.Uint32(header[2:]), binary.BigEndian.Uint32(header[6:])
+	if kind != snapshotBlockData && kind != snapshotBlockIndex && kind != snapshotBlockIndexPart {
+		return 0, 0, nil, fmt.Errorf("unknown block kind %d", kind)
+	}
+	if rawLen > maxSnapshotBlock || storedLen > rawLen {
+		return 0, 0, nil, fmt.Errorf("invalid block lengths %d and %d", rawLen, storedLen)
+	}
+	payload = make([]byte, storedLen)
+	if _, err = io.ReadFull(reader, payload); err != nil {
+		return 0, 0, nil, fmt.Errorf("read block: %w", unexpectedEOF(err))
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[10:]) {
+		return 0, 0, nil, ErrChecksum
+	}
+	switch codec {
+	case snapshotCodecNone:
+		if storedLen != rawLen {
+			return 0, 0, nil, fmt.Errorf("invalid block lengths %d and %d", rawLen, storedLen)
+		}
+		return kind, codec, payload, nil
+	case snapshotCodecFlate:
+		raw := make([]byte, rawLen)
+		inflater := flate.NewReader(bytes.NewReader(payload))
+		if _, err = io.ReadFull(inflater, raw); err != nil {
+			return 0, 0, nil, fmt.Errorf("inflate block: %w", err)
+		}
+		return kind, codec, raw, nil
+	default:
+		return 0, 0, nil, fmt.Errorf("unknown block codec %d", codec)
+	}
+}
+
+func parseSnapshotIndex(payload []byte) (SnapshotIndex, error) {
+	errDamaged := errors.New("damaged index")
+	count, n := binary.Uvarint(payload)
+	if n <= 0 || count > uint64(len(payload)) {
+		return SnapshotIndex{}, errDamaged
+	}
+	rest := payload[n:]
+	index := SnapshotIndex{Blocks: make([]SnapshotBlock, 0, count)}
+	for range count {
+		table, after, ok := cutSnapshotString(rest)
+		if !ok {
+			return SnapshotIndex{}, errDamaged
+		}
+		offset, n1 := binary.Uvarint(after)
+		if n1 <= 0 {
+			return SnapshotIndex{}, errDamaged
+		}
+		entries, n2 := binary.Uvarint(after[n1:])
+		if n2 <= 0 {
+			return SnapshotIndex{}, errDamaged
+		}
+		// #nosec G115 -- compared against real offsets, never used to seek unchecked
+		index.Blocks = append(index.Blocks, SnapshotBlock{Table: table, Offset: int64(offset), Entries: entries})
+		rest = after[n1+n2:]
+	}
+	var n3 int
+	if index.Entries, n3 = binary.Uvarint(rest); n3 <= 0 || n3 != len(rest) {
+		return SnapshotIndex{}, errDamaged
+	}
+	return index, nil
+}
+
+func sameSnapshotIndex(a, b SnapshotIndex) bool {
+	if a.Entries != b.Entries || len(a.Blocks) != len(b.Blocks) {
+		return false
+	}
+	for i := range a.Blocks {
+		if a.Blocks[i] != b.Blocks[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func cutSnapshotString(buf []byte) (string, []byte, bool) {
+	length, n := binary.Uvarint(buf)
+	if n <= 0 || length > uint64(len(buf)-n) {
+		return "", nil, false
+	}
+	end := n + int(length) // #nosec G115 -- bounded by len(buf) above
+	return string(buf[n:end]), buf[end:], true
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// ReadSnapshotIndex reads the index of the snapshot file at path from its end, without reading its entries. It returns
+// ErrNoSnapshotIndex for a snapshot written in format version 2 or a compressed archive copy.
+func ReadSnapshotIndex(path string) (SnapshotIndex, error) {
+	file, err := os.Open(path) // #nosec G304 -- the caller names the snapshot to read
+	if err != nil {
+		return SnapshotIndex{}, err
+	}
+	defer func() { _ = file.Close() }()
+	return readSnapshotIndex(file)
+}
+
+func readSnapshotIndex(file *os.File) (SnapshotIndex, error) {
+	header := make([]byte, len(snapshotHeader))
+	if _, err := file.ReadAt(header, 0); err != nil || string(header) != snapshotHeader {
+		return SnapshotIndex{}, ErrNoSnapshotIndex
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return SnapshotIndex{}, err
+	}
+	trailer := make([]byte, snapshotTrailerSize)
+	if info.Size() < int64(len(snapshotHeader)+snapshotTrailerSize) {
+		return SnapshotIndex{}, errors.New("snapshot ends before its trailer")
+	}
+	if _, err = file.ReadAt(trailer, info.Size()-snapshotTrailerSize); err != nil {
+		return SnapshotIndex{}, err
+	}
+	indexOffset := binary.BigEndian.Uint64(trailer)
+	if string(trailer[8:]) != snapshotTrailer || indexOffset >= uint64(info.Size()) { // #nosec G115
+		return SnapshotIndex{}, errors.New("damaged snapshot trailer")
+	}
+	// #nosec G115 -- checked against the file size above
+	reader := io.NewSectionReader(file, int64(indexOffset), info.Size()-snapshotTrailerSize-int64(indexOffset))
+	var index []byte
+	for {
+		kind, _, payload, err := readSnapshotBlock(reader)
+		if err == nil && kind == snapshotBlockData {
+			err = errors.New("trailer does not point at the index")
+		}
+		if err != nil {
+			return SnapshotIndex{}, fmt.Errorf("snapshot index: %w", err)
+		}
+		index = append(index, payload...)
+		if kind == snapshotBlockIndex {
+			return parseSnapshotIndex(index)
+		}
+	}
+}
+
+// ReadSnapshotTable calls fn for every entry of table in the snapshot file at path, reading only the blocks the index
+// lists for it. It returns ErrNoSnapshotIndex for a snapshot that carries no index; read it in full instead.
+func ReadSnapshotTable(path, table string, fn func(key, value string) error) error {
+	file, err := os.Open(path) // #nosec G304 -- the caller names the snapshot to read
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	index, err := readSnapshotIndex(file)
+	if err != nil {
+		return err
+	}
+	for _, block := range index.Blocks {
+		if block.Table != table {
+			continue
+		}
+		if err = readSnapshotTableBlock(file, block, fn); err != nil {
+			return fmt.Errorf("snapshot block at offset %d: %w", block.Offset, err)
+		}
+	}
+	return nil
+}
+
+func readSnapshotTableBlock(file *os.File, block SnapshotBlock, fn func(key, value string) error) error {
+	reader := bufio.NewReader(io.NewSectionReader(file, block.Offset, snapshotBlockHeaderSize+maxSnapshotBlock))
+	kind, _, payload, err := readSnapshotBlock(reader)
+	if err != nil {
+		return err
+	}
+	table, rest, ok := cutSnapshotString(payload)
+	if kind != snapshotBlockData || !ok || table != block.Table {
+		return errors.New("index does not match the block")
+	}
+	var entries uint64
+	for len(rest) > 0 {
+		key, after, okKey := cutSnapshotString(rest)
+		value, after, okValue := cutSnapshotString(after)
+		if !okKey || !okValue {
+			return errors.New("entry overruns the block")
+		}
+		if err = fn(key, value); err != nil {
+			return err
+		}
+		rest = after
+		entries++
+	}
+	if entries != block.Entries {
+		return errors.New("index does not match the block")
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package wal_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/OutOfStack/db/internal/protocol"
+	"github.com/OutOfStack/db/internal/wal"
+)
+
+// TestSnapshotBlocksAndIndex writes a snapshot spanning several blocks and tables, with and without compression, and
+// checks it loads back whole, that its index counts every entry, and that one table reads back through the index alone.
+func TestSnapshotBlocksAndIndex(t *testing.T) {
+	t.Parallel()
+	state := newTestState()
+	for i := range 3000 {
+		state.set(fmt.Sprintf("t%d", i%3), fmt.Sprintf("key-%04d", i), strings.Repeat("v", 50))
+	}
+
+	sizes := make(map[bool]int64)
+	for _, compress := range []bool{false, true} {
+		dir := t.TempDir()
+		if err := wal.WriteSnapshot(t.Context(), dir, 7, state, wal.WithSnapshotCompression(compress)); err != nil {
+			t.Fatal(err)
+		}
+		loaded := newTestState()
+		lsn, err := wal.LoadLatestSnapshot(dir, func(table, key, value string) error {
+			loaded.set(table, key, value)
+			return nil
+		})
+		if err != nil || lsn != 7 || !reflect.DeepEqual(loaded.values, state.values) {
+			t.Fatalf("LoadLatestSnapshot(compress %v) = %d, %v; want LSN 7 and every entry", compress, lsn, err)
+		}
+
+		path := filepath.Join(dir, "snapshot-00000000000000000007.db")
+		index, err := wal.ReadSnapshotIndex(path)
+		if err != nil || index.Entries != 3000 || index.Tables() != 3 || len(index.Blocks) < 3 {
+			t.Fatalf("ReadSnapshotIndex() = %d entries, %d tables, %d blocks, %v", index.Entries, index.Tables(),
+				len(index.Blocks), err)
+		}
+		got := make(map[string]string)
+		err = wal.ReadSnapshotTable(path, "t1", func(key, value string) error {
+			got[key] = value
+			return nil
+		})
+		if err != nil || !reflect.DeepEqual(got, state.values["t1"]) {
+			t.Fatalf("ReadSnapshotTable(t1) = %d keys, %v; want %d", len(got), err, len(state.values["t1"]))
+		}
+		report, err := wal.InspectSnapshot(path, nil)
+		if err != nil || report.Damage != nil || report.Entries != 3000 || report.Tables != 3 ||
+			report.Compressed != compress {
+			t.Fatalf("InspectSnapshot(compress %v) = %+v, %v", compress, report, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[compress] = info.Size()
+	}
+	if sizes[true] >= sizes[false] {
+		t.Fatalf("compressed snapshot is %d bytes, uncompressed %d", sizes[true], sizes[false])
+	}
+}
+
+// TestSnapshotIndexSpansBlocks writes a snapshot of so many tables that its index outgrows one block, and checks it
+// loads back whole and that its index and one table read back from the file.
+func TestSnapshotIndexSpansBlocks(t *testing.T) {
+	t.Parallel()
+	const tables = 10000
+	state := newTestState()
+	for i := range tables {
+		state.set(fmt.Sprintf("table-%05d", i), "key", "value")
+	}
+	dir := t.TempDir()
+	if err := wal.WriteSnapshot(t.Context(), dir, 3, state); err != nil {
+		t.Fatal(err)
+	}
+	loaded := newTestState()
+	lsn, err := wal.LoadLatestSnapshot(dir, func(table, key, value string) error {
+		loaded.set(table, key, value)
+		return nil
+	})
+	if err != nil || lsn != 3 || !reflect.DeepEqual(loaded.values, state.values) {
+		t.Fatalf("LoadLatestSnapshot() = %d, %v; want LSN 3 and every entry", lsn, err)
+	}
+
+	path := filepath.Join(dir, "snapshot-00000000000000000003.db")
+	index, err := wal.ReadSnapshotIndex(path)
+	if err != nil || index.Entries != tables || index.Tables() != tables || len(index.Blocks) != tables {
+		t.Fatalf("ReadSnapshotIndex() = %d entries, %d tables, %d blocks, %v; want %d of each", index.Entries,
+			index.Tables(), len(index.Blocks), err, tables)
+	}
+	got := make(map[string]string)
+	err = wal.ReadSnapshotTable(path, "table-09999", func(key, value string) error {
+		got[key] = value
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(got, map[string]string{"key": "value"}) {
+		t.Fatalf("ReadSnapshotTable(table-09999) = %v, %v", got, err)
+	}
+	report, err := wal.InspectSnapshot(path, nil)
+	if err != nil || report.Damage != nil || report.Entries != tables || report.Tables != tables {
+		t.Fatalf("InspectSnapshot() = %+v, %v", report, err)
+	}
+}
+
+// TestSnapshotDamageIsDetected flips one byte inside a value, which a version 2 snapshot would have loaded silently, and
+// checks loading, verifying and inspecting all report it.
+func TestSnapshotDamageIsDetected(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	state := newTestState()
+	state.set("t", "a", "first value")
+	state.set("t", "b", "second value")
+	if err := wal.WriteSnapshot(t.Context(), dir, 3, state); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "snapshot-00000000000000000003.db")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := strings.Index(string(data), "second value")
+	data[at] ^= 0x01
+	if err = os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = wal.LoadLatestSnapshot(dir, func(_, _, _ string) error { return nil }); !errors.Is(err, wal.ErrChecksum) {
+		t.Fatalf("LoadLatestSnapshot() of a flipped byte error = %v, want ErrChecksum", err)
+	}
+	if _, corruptions, vErr := wal.VerifySnapshots(t.Context(), dir, nil); vErr != nil || len(corruptions) != 1 {
+		t.Fatalf("VerifySnapshots() = %+v, %v; want the snapshot reported", corruptions, vErr)
+	}
+	report, err := wal.InspectSnapshot(path, nil)
+	if err != nil || !errors.Is(report.Damage, wal.ErrChecksum) || report.Entries != 0 || report.DamageOffset != 7 {
+		t.Fatalf("InspectSnapshot() = %+v, %v; want a checksum mismatch in the block at offset 7", report, err)
+	}
+}
+
+// TestVersion2SnapshotsAreRead checks a snapshot written before blocks and checksums still loads, and has no index.
+func TestVersion2SnapshotsAreRead(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snapshot-00000000000000000004.db")
+	var data strings.Builder
+	data.WriteString("DBSNP\x00\x02")
+	for _, entry := range [][]string{{"t", "a", "1"}, {"u", "b", "2"}} {
+		if err := protocol.WriteCommand(&data, wal.CommandSet, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(path, []byte(data.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := newTestState()
+	lsn, err := wal.LoadLatestSnapshot(dir, func(table, key, value string) error {
+		loaded.set(table, key, value)
+		return nil
+	})
+	if err != nil || lsn != 4 || loaded.values["u"]["b"] != "2" || len(loaded.values) != 2 {
+		t.Fatalf("LoadLatestSnapshot() of version 2 = %d, %v, %v", lsn, loaded.values, err)
+	}
+	if _, err = wal.ReadSnapshotIndex(path); !errors.Is(err, wal.ErrNoSnapshotIndex) {
+		t.Fatalf("ReadSnapshotIndex() of version 2 error = %v, want ErrNoSnapshotIndex", err)
+	}
+	if report, iErr := wal.InspectSnapshot(path, nil); iErr != nil || report.Format != 2 || report.Entries != 2 {
+		t.Fatalf("InspectSnapshot() of version 2 = %+v, %v", report, iErr)
+	}
+}
@@ -51,14 +51,14 @@ func ReadRecordsFrom(dir string, fromLSN uint64, fn func(Record) error) error {
 }
 
 func readSegmentRecords(segment numberedFile, isLast bool, fromLSN uint64, fn func(Record) error) error {
-	file, reader, err := openWALSegment(segment.path)
+	file, reader, format, err := openWALSegment(segment.path)
 	if err != nil {
 		return fmt.Errorf("open WAL segment %s: %w", segment.path, err)
 	}
 	defer func() { _ = file.Close() }()
 
 	for {
-		record, readErr := readRecord(reader)
+		record, readErr := readRecord(reader, format)
 		if errors.Is(readErr, io.EOF) {
 			return nil
 		}
@@ -0,0 +1,215 @@
+package wal
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/OutOfStack/db/internal/scrub"
+)
+
+// VerifySegments re-reads every WAL segment in dir through throttle and checks each record's checksum and that LSNs run
+// on without a gap, returning the number of segments checked and the damaged ones. The newest segment may be appended
+// to while it is read, so a record cut short at its end is an append in flight, not damage.
+func VerifySegments(ctx context.Context, dir string, throttle *scrub.Throttle) (int, []scrub.Corruption, error) {
+	segments, err := listNumberedFiles(dir, WALPrefix, WALSuffix)
+	if err != nil {
+		return 0, nil, fmt.Errorf("list WAL segments: %w", err)
+	}
+	var (
+		checked     int
+		corruptions []scrub.Corruption
+	)
+	for index, segment := range segments {
+		offset, verifyErr := verifySegment(ctx, segment, index == len(segments)-1, throttle)
+		if errors.Is(verifyErr, os.ErrNotExist) {
+			continue // pruned since the listing
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return checked, corruptions, ctxErr
+		}
+		checked++
+		if verifyErr != nil {
+			corruptions = append(corruptions, scrub.Corruption{File: segment.path, Offset: offset, Err: verifyErr})
+		}
+	}
+	return checked, corruptions, nil
+}
+
+// verifySegment reads one segment and returns the offset of its first damaged record along with the damage.
+func verifySegment(ctx context.Context, segment numberedFile, isLast bool, throttle *scrub.Throttle) (int64, error) {
+	file, err := os.Open(segment.path) // #nosec G304 -- path comes from the WAL directory listing
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+	format, offset, err := segmentFormat(file)
+	if err != nil {
+		return 0, fmt.Errorf("read WAL segment header: %w", err)
+	}
+
+	counter := &countingReader{r: scrub.Reader(ctx, io.NewSectionReader(file, offset, 1<<62), throttle)}
+	reader := bufio.NewReader(counter)
+	next := segment.number
+	for {
+		position := offset + counter.n - int64(reader.Buffered())
+		record, readErr := readRecord(reader, format)
+		if errors.Is(readErr, io.EOF) {
+			return position, nil
+		}
+		if readErr != nil {
+			if isLast && errors.Is(readErr, ErrPartialRecord) {
+				return position, nil
+			}
+			return position, readErr
+		}
+		if record.LSN != next {
+			return position, fmt.Errorf("non-contiguous WAL LSN: got %d, want %d", record.LSN, next)
+		}
+		next++
+	}
+}
+
+// VerifySnapshots re-reads every snapshot in dir through throttle and checks it reads to the end. A snapshot of the
+// current format is checked block by block against its checksums and index. One of version 2 carries no checksum, so
+// damage inside a value goes unnoticed there; what is caught is damage to the framing, which is also what would make a
+// restart fail to load the snapshot.
+func VerifySnapshots(ctx context.Context, dir string, throttle *scrub.Throttle) (int, []scrub.Corruption, error) {
+	snapshots, err := listNumberedFiles(dir, SnapshotPrefix, SnapshotSuffix)
+	if err != nil {
+		return 0, nil, fmt.Errorf("list snapshots: %w", err)
+	}
+	var (
+		checked     int
+		corruptions []scrub.Corruption
+	)
+	for _, snapshot := range snapshots {
+		offset, verifyErr := verifySnapshot(ctx, snapshot.path, throttle)
+		if errors.Is(verifyErr, os.ErrNotExist) {
+			continue // replaced by a newer snapshot since the listing
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return checked, corruptions, ctxErr
+		}
+		checked++
+		if verifyErr != nil {
+			corruptions = append(corruptions, scrub.Corruption{File: snapshot.path, Offset: offset, Err: verifyErr})
+		}
+	}
+	return checked, corruptions, nil
+}
+
+func verifySnapshot(ctx context.Context, path string, throttle *scrub.Throttle) (int64, error) {
+	file, err := os.Open(path) // #nosec G304 -- path comes from the snapshot directory listing
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = file.Close() }()
+
+	snapshot, err := newSnapshotReader(scrub.Reader(ctx, file, throttle))
+	if err != nil {
+		return 0, fmt.Errorf("read snapshot header: %w", err)
+	}
+	for {
+		if _, _, _, readErr := snapshot.next(); errors.Is(readErr, io.EOF) {
+			return snapshot.position(), nil
+		} else if readErr != nil {
+			return snapshot.position(), readErr
+		}
+	}
+}
+
+// QuarantineSegment moves a damaged WAL segment out of dir into its quarantine subdirectory. Replay needs contiguous
+// LSNs, so every older segment goes with it, and only records the durable state already holds may go: the segment's
+// last LSN must be at most coveredLSN — the LSN of the latest snapshot, or the one the tiered engine has synced. The
+// newest segment is never moved, since the writer is still appending to it.
+func QuarantineSegment(dir, path string, coveredLSN uint64) (string, error) {
+	segments, err := listNumberedFiles(dir, WALPrefix, WALSuffix)
+	if err != nil {
+		return "", fmt.Errorf("list WAL segments: %w", err)
+	}
+	index := -1
+	for i, segment := range segments {
+		if segment.path == path {
+			index = i
+		}
+	}
+	switch {
+	case index < 0:
+		return "", fmt.Errorf("%s is not a WAL segment in %s", path, dir)
+	case index == len(segments)-1:
+		return "", errors.New("the newest WAL segment is still being written; quarantine it once the log moves past it")
+	case segments[index+1].number-1 > coveredLSN:
+		return "", fmt.Errorf("the segment holds records up to LSN %d, past the durable state at LSN %d",
+			segments[index+1].number-1, coveredLSN)
+	}
+	moved := make([]string, 0, index+1)
+	for _, segment := range segments[:index+1] {
+		moved = append(moved, segment.path)
+	}
+	if err = quarantine(dir, moved, os.Rename); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("moved %d segments up to LSN %d to %s", len(moved), segments[index+1].number-1,
+		filepath.Join(dir, scrub.QuarantineDir)), nil
+}
+
+// QuarantineSnapshot sets a damaged snapshot aside in dir's quarantine subdirectory and replaces it with a fresh one
+// that write takes. The damaged file is linked into quarantine before write runs and unlinked only after, so a crash
+// in between never leaves the directory without the snapshot recovery would look for.
+func QuarantineSnapshot(dir, path string, write func() error) (string, error) {
+	before, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("stat snapshot: %w", err)
+	}
+	if err = quarantine(dir, []string{path}, os.Link); err != nil {
+		return "", err
+	}
+	if err = write(); err != nil {
+		return "", fmt.Errorf("write a replacement snapshot: %w", err)
+	}
+	// the replacement either took the damaged file's name (same LSN) or removed it as older
+	if after, statErr := os.Stat(path); statErr == nil && os.SameFile(before, after) {
+		return "", errors.New("no replacement snapshot was written; the damaged one is still in place")
+	}
+	if err = SyncDirectory(dir); err != nil {
+		return "", fmt.Errorf("sync snapshot directory: %w", err)
+	}
+	return "replaced by a fresh snapshot; the damaged one is in " + filepath.Join(dir, scrub.QuarantineDir), nil
+}
+
+// quarantine places files into dir's quarantine subdirectory with place (a rename or a hard link).
+func quarantine(dir string, paths []string, place func(oldPath, newPath string) error) error {
+	target := filepath.Join(dir, scrub.QuarantineDir)
+	if err := os.MkdirAll(target, 0o750); err != nil {
+		return fmt.Errorf("create quarantine directory: %w", err)
+	}
+	for _, path := range paths {
+		if err := place(path, filepath.Join(target, filepath.Base(path))); err != nil {
+			return fmt.Errorf("quarantine %s: %w", filepath.Base(path), err)
+		}
+	}
+	if err := SyncDirectory(target); err != nil {
+		return fmt.Errorf("sync quarantine directory: %w", err)
+	}
+	if err := SyncDirectory(dir); err != nil {
+		return fmt.Errorf("sync directory: %w", err)
+	}
+	return nil
+}
+
+// countingReader counts the bytes read through it, which is how a buffered scan finds the offset of a record.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
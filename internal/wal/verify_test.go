@@ -0,0 +1,124 @@
+package wal_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/OutOfStack/db/internal/wal"
+)
+
+func TestVerifySegmentsAndQuarantine(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	writer, err := wal.OpenWriter(wal.WriterConfig{Dir: dir, Sync: wal.SyncAlways, SegmentSize: 1}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err = writer.Append(t.Context(), wal.CommandSet, []string{"t", key, "v"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	segments := walSegmentFiles(t, dir)
+	data, err := os.ReadFile(segments[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err = os.WriteFile(segments[1], data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// a record cut short at the end of the newest segment is an append in flight, not damage
+	appendBytes(t, segments[2], []byte{0, 0, 0, 0})
+
+	checked, corruptions, err := wal.VerifySegments(t.Context(), dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked != 3 || len(corruptions) != 1 || corruptions[0].File != segments[1] || corruptions[0].Offset != 7 {
+		t.Fatalf("VerifySegments() = %d, %+v; want the first record of the second segment", checked, corruptions)
+	}
+
+	if _, err = wal.QuarantineSegment(dir, segments[1], 1); err == nil {
+		t.Fatal("QuarantineSegment() moved records the durable state does not hold")
+	}
+	if _, err = wal.QuarantineSegment(dir, segments[2], 3); err == nil {
+		t.Fatal("QuarantineSegment() moved the segment being written")
+	}
+	if _, err = wal.QuarantineSegment(dir, segments[1], 2); err != nil {
+		t.Fatalf("QuarantineSegment() error = %v", err)
+	}
+	for _, segment := range segments[:2] {
+		if _, err = os.Stat(filepath.Join(dir, "quarantine", filepath.Base(segment))); err != nil {
+			t.Fatalf("quarantined segment: %v", err)
+		}
+	}
+	if checked, corruptions, err = wal.VerifySegments(t.Context(), dir, nil); err != nil || checked != 1 || len(corruptions) != 0 {
+		t.Fatalf("VerifySegments() after quarantine = %d, %+v, %v; want one clean segment", checked, corruptions, err)
+	}
+	lastLSN, err := wal.NewReader(dir, nil).Replay(2, func(wal.Record) error { return nil })
+	if err != nil || lastLSN != 3 {
+		t.Fatalf("Replay() after quarantine = %d, %v; want 3, nil", lastLSN, err)
+	}
+}
+
+func TestVerifySnapshotsAndQuarantine(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	state := newTestState()
+	state.set("t", "a", "1")
+	state.set("t", "b", "2")
+	if err := wal.WriteSnapshot(t.Context(), dir, 5, state); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "snapshot-00000000000000000005.db")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(path, data[:len(data)-3], 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	checked, corruptions, err := wal.VerifySnapshots(t.Context(), dir, nil)
+	if err != nil || checked != 1 || len(corruptions) != 1 {
+		t.Fatalf("VerifySnapshots() = %d, %+v, %v; want one damaged snapshot", checked, corruptions, err)
+	}
+	if _, err = wal.QuarantineSnapshot(dir, path, func() error { return nil }); err == nil {
+		t.Fatal("QuarantineSnapshot() succeeded without a replacement snapshot")
+	}
+	if err = os.Remove(filepath.Join(dir, "quarantine", filepath.Base(path))); err != nil {
+		t.Fatal(err)
+	}
+	_, err = wal.QuarantineSnapshot(dir, path, func() error {
+		return wal.WriteSnapshot(context.Background(), dir, 6, state)
+	})
+	if err != nil {
+		t.Fatalf("QuarantineSnapshot() error = %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "quarantine", filepath.Base(path))); err != nil {
+		t.Fatalf("quarantined snapshot: %v", err)
+	}
+	if checked, corruptions, err = wal.VerifySnapshots(t.Context(), dir, nil); err != nil || checked != 1 || len(corruptions) != 0 {
+		t.Fatalf("VerifySnapshots() after quarantine = %d, %+v, %v; want one clean snapshot", checked, corruptions, err)
+	}
+}
+
+func appendBytes(t *testing.T, path string, data []byte) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = file.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err = file.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
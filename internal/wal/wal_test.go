@@ -1,15 +1,20 @@
 package wal_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
+	"hash/crc32"
 	"os"
 	"path/filepath"
 	"reflect"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/OutOfStack/db/internal/metrics"
 	"github.com/OutOfStack/db/internal/protocol"
 	"github.com/OutOfStack/db/internal/wal"
 )
@@ -21,10 +26,17 @@ func TestRecordRoundTripAndChecksum(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	want := wal.Record{LSN: 1, Command: wal.CommandSet, Args: []string{"users", "name", "value\nwith\x00bytes"}}
-	if _, err = writer.Append(t.Context(), want.Command, want.Args); err != nil {
+	want := wal.Record{
+		LSN:     1,
+		Origin:  "loader@127.0.0.1:5000",
+		Command: wal.CommandSet,
+		Args:    []string{"users", "name", "value\nwith\x00bytes"},
+	}
+	before := time.Now()
+	if _, err = writer.Append(wal.WithOrigin(t.Context(), want.Origin), want.Command, want.Args); err != nil {
 		t.Fatal(err)
 	}
+	after := time.Now()
 	if _, err = writer.Append(t.Context(), wal.CommandSet, []string{"users", "second", "value"}); err != nil {
 		t.Fatal(err)
 	}
@@ -39,6 +51,10 @@ func TestRecordRoundTripAndChecksum(t *testing.T) {
 		}
 		return nil
 	})
+	if got.Time.Before(before) || got.Time.After(after) {
+		t.Fatalf("Replay() record time = %v, want between %v and %v", got.Time, before, after)
+	}
+	got.Time = time.Time{}
 	if err != nil || !reflect.DeepEqual(got, want) {
 		t.Fatalf("Replay() record = %#v, %v; want %#v, nil", got, err, want)
 	}
@@ -116,6 +132,65 @@ func TestHeaderlessFilesAreRejected(t *testing.T) {
 	})
 }
 
+// TestVersion2SegmentsAreRead covers segments written before records carried a commit time and origin: they replay
+// with both left zero, and the writer leaves them as they are, starting the next record in a segment of the current
+// format. A version 2 tail holding only its header is started again in the current format instead.
+func TestVersion2SegmentsAreRead(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	segment := []byte("DBWAL\x00\x02")
+	for lsn := uint64(1); lsn <= 2; lsn++ {
+		segment = append(segment, encodeRecordV2(t, wal.Record{LSN: lsn, Command: wal.CommandDel, Args: []string{"t", "k"}})...)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "wal-00000000000000000001.log"), segment, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "wal-00000000000000000003.log"), []byte("DBWAL\x00\x02"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	writer, err := wal.OpenWriter(wal.WriterConfig{Dir: dir, Sync: wal.SyncAlways, SegmentSize: 1 << 20}, 2)
+	if err != nil {
+		t.Fatalf("OpenWriter() error = %v", err)
+	}
+	if _, err = writer.Append(t.Context(), wal.CommandSet, []string{"t", "k", "v"}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	var replayed []wal.Record
+	if _, err = wal.NewReader(dir, nil).Replay(0, func(record wal.Record) error {
+		replayed = append(replayed, record)
+		return nil
+	}); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if len(replayed) != 3 || !replayed[0].Time.IsZero() || !replayed[1].Time.IsZero() || replayed[2].Time.IsZero() {
+		t.Fatalf("replayed = %#v, want two untimed records and a timed one", replayed)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "wal-00000000000000000001.log"))
+	if err != nil || !bytes.Equal(data, segment) {
+		t.Fatalf("version 2 segment changed: %q, %v", data, err)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "wal-00000000000000000003.log"))
+	if err != nil || !strings.HasPrefix(string(data), "DBWAL\x00\x03") {
+		t.Fatalf("new segment = %q, %v; want the current header", data, err)
+	}
+}
+
+// encodeRecordV2 encodes a record as version 2 segments hold it: LSN, protocol command, CRC32 of both.
+func encodeRecordV2(t *testing.T, record wal.Record) []byte {
+	t.Helper()
+	var body bytes.Buffer
+	body.Write(binary.BigEndian.AppendUint64(nil, record.LSN))
+	if err := protocol.WriteCommand(&body, record.Command, record.Args); err != nil {
+		t.Fatal(err)
+	}
+	return binary.BigEndian.AppendUint32(body.Bytes(), crc32.ChecksumIEEE(body.Bytes()))
+}
+
 // TestAppendingToRecoveredEmptySegment covers the other side of the empty-segment case above: reopening one must give it
 // a header before appending, or the records land where the header belongs and the next open rejects the whole segment.
 func TestAppendingToRecoveredEmptySegment(t *testing.T) {
@@ -456,3 +531,36 @@ func TestAppendRecordEnforcesContiguityAndReset(t *testing.T) {
 		t.Fatalf("AppendRecord(11) after reset error = %v", err)
 	}
 }
+
+// TestWriterMetrics verifies the writer counts its appends, group commits and fsyncs.
+func TestWriterMetrics(t *testing.T) {
+	t.Parallel()
+	writer, err := wal.OpenWriter(wal.WriterConfig{Dir: t.TempDir(), Sync: wal.SyncAlways, SegmentSize: 1 << 20}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = writer.Close() }()
+	for i := range 3 {
+		if _, err = writer.Append(t.Context(), wal.CommandSet, []string{"t", "k", strings.Repeat("v", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	registry := metrics.NewRegistry()
+	registry.Register(writer)
+	var out strings.Builder
+	if _, err = registry.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"db_wal_last_lsn 3\n",
+		"db_wal_appends_total 3\n",
+		"db_wal_append_duration_seconds_count 3\n",
+		"db_wal_fsync_duration_seconds_count 3\n",
+		"db_wal_batch_size_count 3\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Fatalf("metrics lack %q:\n%s", line, out.String())
+		}
+	}
+}
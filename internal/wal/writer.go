@@ -11,6 +11,8 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/OutOfStack/db/internal/info"
+	"github.com/OutOfStack/db/internal/metrics"
 	"github.com/OutOfStack/db/internal/protocol"
 )
 
@@ -26,11 +28,13 @@ const (
 // ErrClosed is returned when an operation is attempted after shutdown starts.
 var ErrClosed = errors.New("wal writer is closed")
 
-// WriterConfig configures the segmented WAL writer.
+// WriterConfig configures the segmented WAL writer. With an Archive directory, Prune copies segments there before
+// removing them.
 type WriterConfig struct {
 	Dir         string
 	Sync        SyncPolicy
 	SegmentSize int64
+	Archive     ArchiveConfig
 }
 
 type requestKind uint8
@@ -47,9 +51,12 @@ type writerRequest struct {
 	kind    requestKind
 	command string
 	args    []string
+	origin  string
 	record  Record // used by requestAppendReplicated, which carries an explicit LSN
 	uptoLSN uint64
-	result  chan writerResult
+	// archived holds the segments a prune request found already archived
+	archived map[uint64]struct{}
+	result   chan writerResult
 }
 
 // subscriberBuffer bounds how many committed records the writer can queue for a single replication subscriber before
@@ -66,6 +73,12 @@ type writerResult struct {
 	err error
 }
 
+// appended is the outcome of one append of a group commit.
+type appended struct {
+	record Record
+	err    error
+}
+
 // Writer serializes WAL appends through one goroutine.
 type Writer struct {
 	config WriterConfig
@@ -81,6 +94,11 @@ type Writer struct {
 
 	subsMu sync.RWMutex
 	subs   map[*subscriber]struct{}
+
+	appends       metrics.Counter
+	appendLatency *metrics.Histogram // enqueue to ack, as the caller waits
+	fsyncLatency  *metrics.Histogram // the fsyncs appends wait for or the once-a-second sync
+	batchSize     *metrics.Histogram // appends committed by one group commit
 }
 
 // OpenWriter opens a writer after recovery. lastLSN must be the last LSN returned by snapshot loading plus WAL replay.
@@ -118,18 +136,24 @@ func OpenWriter(config WriterConfig, lastLSN uint64) (*Writer, error) {
 		requests: make(chan writerRequest, 256),
 		done:     make(chan struct{}),
 		subs:     make(map[*subscriber]struct{}),
+
+		appendLatency: metrics.NewHistogram(metrics.LatencyBuckets()),
+		fsyncLatency:  metrics.NewHistogram(metrics.LatencyBuckets()),
+		batchSize:     metrics.NewHistogram(metrics.SizeBuckets()),
 	}
 	writer.lastLSN.Store(lastLSN)
 	go writer.run()
 	return writer, nil
 }
 
-// Append writes one mutation and waits until it satisfies the configured sync policy.
+// Append writes one mutation and waits until it satisfies the configured sync policy. The record is stamped with the
+// time it is committed and the origin set on ctx by WithOrigin.
 func (w *Writer) Append(ctx context.Context, command string, args []string) (uint64, error) {
 	if w.closing.Load() {
 		return 0, ErrClosed
 	}
-	if err := validateRecord(Record{Command: command, Args: args}); err != nil {
+	origin := OriginFrom(ctx)
+	if err := validateRecord(Record{Origin: origin, Command: command, Args: args}); err != nil {
 		return 0, err
 	}
 	// Reject records the recovery reader could not decode (its RESP limit is maxRecordSize). The network layer's max
@@ -137,8 +161,16 @@ func (w *Writer) Append(ctx context.Context, command string, args []string) (uin
 	if size := protocol.CommandSize(command, args); size > maxRecordSize {
 		return 0, fmt.Errorf("WAL record size %d exceeds maximum %d bytes", size, maxRecordSize)
 	}
+	start := time.Now()
+	defer w.appendLatency.ObserveSince(start)
 	result := make(chan writerResult, 1)
-	request := writerRequest{kind: requestAppend, command: command, args: append([]string(nil), args...), result: result}
+	request := writerRequest{
+		kind:    requestAppend,
+		command: command,
+		args:    append([]string(nil), args...),
+		origin:  origin,
+		result:  result,
+	}
 	select {
 	case w.requests <- request:
 	case <-ctx.Done():
@@ -162,8 +194,8 @@ func (w *Writer) Append(ctx context.Context, command string, args []string) (uin
 }
 
 // AppendRecord writes a record with a caller-assigned LSN. Standbys use it to persist records received from the
-// master's replication stream, preserving the master's LSNs so a promoted standby continues the same log. The record's
-// LSN must be exactly the current LastLSN+1.
+// master's replication stream, preserving the master's LSNs, commit times and origins, so a promoted standby continues
+// the same log. The record's LSN must be exactly the current LastLSN+1.
 func (w *Writer) AppendRecord(ctx context.Context, record Record) error {
 	if w.closing.Load() {
 		return ErrClosed
@@ -213,9 +245,60 @@ func (w *Writer) publish(record Record) {
 // LastLSN returns the most recently written LSN.
 func (w *Writer) LastLSN() uint64 { return w.lastLSN.Load() }
 
-// Prune removes segments whose records are all represented by a snapshot.
+// Info reports the persistence section of INFO: the log's position, sync policy and segment size, and the newest
+// snapshot in its directory, with the time it was written (0 when there is none). A directory that cannot be listed
+// leaves out the fields that need it.
+func (w *Writer) Info(_ context.Context) info.Section {
+	section := info.Section{Name: "persistence"}
+	last := w.LastLSN()
+	section.Add("wal_enabled", true)
+	section.Add("wal_last_lsn", last)
+	if oldest, err := OldestRecordLSN(w.config.Dir, last+1); err == nil {
+		section.Add("wal_oldest_lsn", oldest)
+	}
+	section.Add("wal_fsync", string(w.config.Sync))
+	section.Add("wal_segment_size", w.config.SegmentSize)
+	lsn, path, ok, err := LatestSnapshotInfo(w.config.Dir)
+	if err != nil {
+		return section
+	}
+	var written time.Time
+	if ok {
+		if stat, statErr := os.Stat(path); statErr == nil {
+			written = stat.ModTime()
+		}
+	}
+	section.Add("last_snapshot_lsn", lsn)
+	section.Add("last_snapshot_time", written)
+	return section
+}
+
+// Collect reports the log's position, appends, their latency and group-commit batch sizes, and fsync latency.
+func (w *Writer) Collect(enc *metrics.Encoder) {
+	enc.Gauge("db_wal_last_lsn", "LSN of the last record written to the WAL.", float64(w.LastLSN()))
+	enc.Counter("db_wal_appends_total", "Records appended to the WAL, including those replicated from a master.", float64(w.appends.Value()))
+	enc.Histogram("db_wal_append_duration_seconds",
+		"Time from submitting a WAL append to its acknowledgement under the sync policy.", w.appendLatency)
+	enc.Histogram("db_wal_fsync_duration_seconds", "Time to fsync the WAL segment being appended to.", w.fsyncLatency)
+	enc.Histogram("db_wal_batch_size", "Appends committed together by one group commit.", w.batchSize)
+}
+
+// sync fsyncs the segment being appended to, timing it.
+func (w *Writer) sync(file *os.File) error {
+	start := time.Now()
+	err := file.Sync()
+	w.fsyncLatency.ObserveSince(start)
+	return err
+}
+
+// Prune removes segments whose records are all represented by a snapshot, archiving them first when the writer has an
+// archive. When archiving fails nothing more is removed, so the next prune tries again.
 func (w *Writer) Prune(ctx context.Context, uptoLSN uint64) error {
-	return w.control(ctx, writerRequest{kind: requestPrune, uptoLSN: uptoLSN})
+	archived, err := w.archiveSegments(uptoLSN)
+	if err != nil {
+		return err
+	}
+	return w.control(ctx, writerRequest{kind: requestPrune, uptoLSN: uptoLSN, archived: archived})
 }
 
 // Close flushes, fsyncs, and closes the WAL. It is safe to call more than once.
@@ -305,7 +388,7 @@ func (w *Writer) syncEverySecond(state *writerState) {
 	if state.terminalErr != nil || state.file == nil {
 		return
 	}
-	if err := state.file.Sync(); err != nil {
+	if err := w.sync(state.file); err != nil {
 		state.terminalErr = fmt.Errorf("sync WAL: %w", err)
 	}
 }
@@ -326,28 +409,30 @@ func (w *Writer) collectAppendBatch(first writerRequest) ([]writerRequest, *writ
 }
 
 func (w *Writer) handleBatch(batch []writerRequest, state *writerState) {
-	results := make([]writerResult, len(batch))
+	w.batchSize.Observe(float64(len(batch)))
+	results := make([]appended, len(batch))
 	wrote := false
 	for index, request := range batch {
 		if state.terminalErr != nil {
 			results[index].err = state.terminalErr
 			continue
 		}
-		lsn, err := w.appendOne(request, state)
+		record, err := w.appendOne(request, state)
 		if err != nil {
 			state.terminalErr = fmt.Errorf("append WAL record: %w", err)
 			results[index].err = state.terminalErr
 			continue
 		}
-		results[index].lsn = lsn
+		results[index].record = record
 		wrote = true
+		w.appends.Inc()
 	}
 
 	// Sync whatever was written even when a later append in the batch failed: the earlier records are already on disk and
 	// will replay on restart, so their callers must be acked, not failed. Only a sync failure leaves those records
 	// non-durable, and only then do we fail the callers we would ack.
 	if wrote && w.config.Sync == SyncAlways && state.file != nil {
-		if err := state.file.Sync(); err != nil {
+		if err := w.sync(state.file); err != nil {
 			state.terminalErr = fmt.Errorf("sync WAL: %w", err)
 			for index := range results {
 				if results[index].err == nil {
@@ -357,37 +442,44 @@ func (w *Writer) handleBatch(batch []writerRequest, state *writerState) {
 		}
 	}
 	for index, request := range batch {
-		request.result <- results[index]
+		request.result <- writerResult{lsn: results[index].record.LSN, err: results[index].err}
 	}
 
 	// Publish only records the callers were acked for; a failed append or sync leaves the record non-durable, so it must
 	// not be streamed to standbys.
-	for index, request := range batch {
-		if results[index].err == nil {
-			w.publish(Record{LSN: results[index].lsn, Command: request.command, Args: request.args})
+	for _, result := range results {
+		if result.err == nil {
+			w.publish(result.record)
 		}
 	}
 }
 
-func (w *Writer) appendOne(request writerRequest, state *writerState) (uint64, error) {
-	lsn := w.lastLSN.Load() + 1
-	record, err := encodeRecord(Record{LSN: lsn, Command: request.command, Args: request.args})
+func (w *Writer) appendOne(request writerRequest, state *writerState) (Record, error) {
+	record := Record{
+		LSN: w.lastLSN.Load() + 1,
+		// without its monotonic clock reading, the time is the one a reader of the segment gets back
+		Time:    time.Now().UTC().Round(0),
+		Origin:  request.origin,
+		Command: request.command,
+		Args:    request.args,
+	}
+	encoded, err := encodeRecord(record, formatV3)
 	if err != nil {
-		return 0, err
+		return Record{}, err
 	}
-	if err = w.ensureSegment(state, lsn, int64(len(record))); err != nil {
-		return 0, err
+	if err = w.ensureSegment(state, record.LSN, int64(len(encoded))); err != nil {
+		return Record{}, err
 	}
-	written, err := state.file.Write(record)
+	written, err := state.file.Write(encoded)
 	state.size += int64(written)
 	if err != nil {
-		return 0, err
+		return Record{}, err
 	}
-	if written != len(record) {
-		return 0, io.ErrShortWrite
+	if written != len(encoded) {
+		return Record{}, io.ErrShortWrite
 	}
-	w.lastLSN.Store(lsn)
-	return lsn, nil
+	w.lastLSN.Store(record.LSN)
+	return record, nil
 }
 
 // appendReplicated writes a record with its own LSN, enforcing contiguity with the current tail. Under a durable sync
@@ -397,7 +489,7 @@ func (w *Writer) appendReplicated(record Record, state *writerState) error {
 	if record.LSN != expected {
 		return fmt.Errorf("non-contiguous replicated LSN: got %d, want %d", record.LSN, expected)
 	}
-	encoded, err := encodeRecord(record)
+	encoded, err := encodeRecord(record, formatV3)
 	if err != nil {
 		return err
 	}
@@ -415,12 +507,13 @@ func (w *Writer) appendReplicated(record Record, state *writerState) error {
 		return state.terminalErr
 	}
 	if w.config.Sync != SyncNo && state.file != nil {
-		if err = state.file.Sync(); err != nil {
+		if err = w.sync(state.file); err != nil {
 			state.terminalErr = fmt.Errorf("sync WAL: %w", err)
 			return state.terminalErr
 		}
 	}
 	w.lastLSN.Store(record.LSN)
+	w.appends.Inc()
 	return nil
 }
 
@@ -522,7 +615,7 @@ func (w *Writer) handleControl(request writerRequest, state *writerState) bool {
 	case requestPrune:
 		err := state.terminalErr
 		if err == nil {
-			err = w.prune(state, request.uptoLSN)
+			err = w.prune(state, request.uptoLSN, request.archived)
 		}
 		request.result <- writerResult{err: err}
 		return false
@@ -572,7 +665,7 @@ func (w *Writer) syncAllSegments() error {
 	return nil
 }
 
-func (w *Writer) prune(state *writerState, uptoLSN uint64) error {
+func (w *Writer) prune(state *writerState, uptoLSN uint64, archived map[uint64]struct{}) error {
 	if state.file != nil {
 		if err := state.file.Sync(); err != nil {
 			return fmt.Errorf("sync WAL before prune: %w", err)
@@ -591,6 +684,9 @@ func (w *Writer) prune(state *writerState, uptoLSN uint64) error {
 			state.size = 0
 		}
 		for _, segment := range segments {
+			if err = w.archiveRemoved(segment, archived); err != nil {
+				return err
+			}
 			if err = os.Remove(segment.path); err != nil && !os.IsNotExist(err) {
 				return fmt.Errorf("remove WAL segment: %w", err)
 			}
@@ -602,6 +698,9 @@ func (w *Writer) prune(state *writerState, uptoLSN uint64) error {
 		if segments[index+1].number > uptoLSN+1 {
 			break
 		}
+		if err = w.archiveRemoved(segments[index], archived); err != nil {
+			return err
+		}
 		if err = os.Remove(segments[index].path); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("remove WAL segment: %w", err)
 		}